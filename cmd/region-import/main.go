@@ -0,0 +1,74 @@
+// Command region-import mengisi tabel regions dari dataset wilayah BPS/Kemendagri dalam format CSV
+// "code,name[,latitude,longitude]". Jalankan ulang dengan file terbaru untuk memperbarui dataset.
+//
+//	go run ./cmd/region-import -file wilayah.csv -deactivate-missing -link-names
+//	go run ./cmd/region-import -url https://example.com/wilayah.csv
+package main
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/initializers"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	file := flag.String("file", "", "path CSV dataset wilayah")
+	url := flag.String("url", "", "URL CSV dataset wilayah, dipakai jika -file kosong")
+	deactivateMissing := flag.Bool("deactivate-missing", false, "nonaktifkan wilayah yang tidak ada di dataset (hanya untuk dataset lengkap)")
+	linkNames := flag.Bool("link-names", false, "tautkan bank dan user lama ke kode wilayah berdasarkan nama")
+	flag.Parse()
+
+	if *file == "" && *url == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	initializers.LoadEnvVarables()
+	configs.ConnectDB()
+	configs.DatabaseSync()
+
+	dataset, err := openDataset(*file, *url)
+	if err != nil {
+		log.Fatal("Failed to open region dataset: ", err)
+	}
+	defer dataset.Close()
+
+	result, err := helpers.ImportRegions(configs.DB, dataset, helpers.RegionImportOptions{DeactivateMissing: *deactivateMissing})
+	if err != nil {
+		log.Fatal("Failed to import regions: ", err)
+	}
+	fmt.Printf("Imported %d regions: %d provinces, %d districts, %d subdistricts, %d villages, %d deactivated\n",
+		result.Rows, result.Levels["province"], result.Levels["district"], result.Levels["subdistrict"], result.Levels["village"], result.Deactivated)
+
+	if *linkNames {
+		linked, err := helpers.LinkRegionNames(configs.DB)
+		if err != nil {
+			log.Fatal("Failed to link region names: ", err)
+		}
+		fmt.Printf("Linked %d parent banks, %d child banks, %d users\n", linked.ParentBanks, linked.ChildBanks, linked.Users)
+	}
+}
+
+func openDataset(file, url string) (io.ReadCloser, error) {
+	if file != "" {
+		return os.Open(file)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -18,5 +18,31 @@ func DatabaseSync() {
 		&models.WasteDepositItem{},
 		&models.WasteDeposit{},
 		&models.PickupRequest{},
+		&models.LedgerJournal{},
+		&models.LedgerEntry{},
+		&models.AuthSession{},
+		&models.RefreshToken{},
+		&models.IdempotencyKey{},
+		&models.PpobCallbackLog{},
+		&models.PpobMarginRule{},
+		&models.PpobProduct{},
+		&models.PpobCatalogSync{},
+		&models.PpobCatalogChange{},
+		&models.PpobInquiry{},
+		&models.ProductWastePrice{},
+		&models.WasteStock{},
+		&models.WasteStockMovement{},
+		&models.WasteTransfer{},
+		&models.WasteTransferItem{},
+		&models.Offtaker{},
+		&models.WasteSale{},
+		&models.WasteSaleItem{},
+		&models.WasteSalePayment{},
+		&models.WasteDepositRevision{},
+		&models.PickupSlot{},
+		&models.PickupRequestItem{},
+		&models.Region{},
+		&models.Payment{},
+		&models.PaymentWebhookLog{},
 	)
 }
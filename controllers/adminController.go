@@ -145,7 +145,7 @@ func DeleteUserAdmin(c *fiber.Ctx) error {
 		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
 	}
 
-	if err := configs.DB.Delete(&userAdmin).Error; err != nil {
+	if err := helpers.DeleteUserWithSessions(configs.DB, &userAdmin); err != nil {
 		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
 	}
 
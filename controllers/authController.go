@@ -5,11 +5,10 @@ import (
 	"backend-mulungs/helpers"
 
 	"backend-mulungs/models"
-	"os"
-	"time"
+	"errors"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -43,15 +42,75 @@ func LoginC(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Password wrong!", nil, nil)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.Id,
-		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
+	if user.Status == "inactive" {
+		return helpers.Response(c, 403, "Failed", "Account is inactive", nil, nil)
+	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	pair, err := helpers.IssueSession(configs.DB, user.Id, c.Get("User-Agent"), c.IP())
 	if err != nil {
 		return helpers.Response(c, 400, "Failed", "Invalid to create token", nil, nil)
 	}
 
-	return helpers.Response(c, 200, "Success", "Data User found", user, &tokenString)
+	return helpers.SessionResponse(c, 200, "Data User found", user, pair)
+}
+
+// RefreshTokenC - tukar refresh token dengan access token baru (refresh token lama tidak berlaku lagi)
+func RefreshTokenC(c *fiber.Ctx) error {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to read body", nil, nil)
+	}
+
+	pair, err := helpers.RotateRefreshToken(configs.DB, body.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, helpers.ErrRefreshTokenReused):
+			return helpers.Response(c, 401, "Failed", "Refresh token already used, session has been revoked", nil, nil)
+		case errors.Is(err, helpers.ErrInvalidRefreshToken), errors.Is(err, helpers.ErrSessionRevoked):
+			return helpers.Response(c, 401, "Failed", "Invalid or expired refresh token", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to refresh token", nil, nil)
+	}
+
+	return helpers.SessionResponse(c, 200, "Token refreshed", nil, pair)
+}
+
+// LogoutC - cabut sesi yang sedang dipakai
+func LogoutC(c *fiber.Ctx) error {
+	sessionID, err := helpers.ExtractSessionID(c)
+	if err != nil || sessionID == 0 {
+		return helpers.Response(c, 400, "Failed", "Invalid session", nil, nil)
+	}
+
+	if err := helpers.RevokeSession(configs.DB, sessionID, helpers.RevokeLogout); err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to logout", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Logout successfully", nil, nil)
+}
+
+// RevokeUserSessionsC - admin mencabut semua sesi user (misal HP hilang atau operator keluar)
+func RevokeUserSessionsC(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid user ID", nil, nil)
+	}
+
+	var user models.User
+	if err := configs.DB.First(&user, id).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "User not found", nil, nil)
+	}
+
+	revoked, err := helpers.RevokeUserSessions(configs.DB, user.Id, helpers.RevokeByAdmin)
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to revoke sessions", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Sessions revoked successfully", map[string]any{
+		"user_id":          user.Id,
+		"revoked_sessions": revoked,
+	}, nil)
 }
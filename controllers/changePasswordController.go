@@ -19,6 +19,10 @@ func ChangePassword(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid user ID", nil, nil)
 	}
 
+	if err := helpers.ScopeSelf(c, uint(userID)); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
 	var body struct {
 		CurrentPassword string `json:"current_password"`
 		NewPassword     string `json:"new_password"`
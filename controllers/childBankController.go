@@ -22,6 +22,7 @@ func CreateChildBank(c *fiber.Ctx) error {
 		Longitude    float64 `json:"longitude"`
 		ParentBankID uint    `json:"parentBank_id"`
 		Norek        uint    `json:"norek"`
+		models.RegionCodes
 	}
 
 	// Parse body JSON
@@ -37,8 +38,20 @@ func CreateChildBank(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Invalid longitude value (must be between -180 and 180)", nil, nil)
 	}
 
+	// Operator bank induk hanya boleh membuat unit di bawah bank induknya sendiri
+	if err := helpers.ScopeBank(c, &body.ParentBankID, nil); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	// Kode wilayah opsional, nama kecamatan diambil dari dataset
+	regionCodes, _, err := resolveRegionBody(body.RegionCodes, nil, nil, &body.Subdistrict)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
+
 	// mapping ke model ChildBank
 	childBank := models.ChildBank{
+		RegionCodes:  regionCodes,
 		Subdistrict:  body.Subdistrict,
 		RT:           body.RT,
 		RW:           body.RW,
@@ -64,6 +77,7 @@ func CreateChildBank(c *fiber.Ctx) error {
 		Longitude:    childBank.Longitude,
 		ParentBankID: childBank.ParentBankID,
 		Norek:        childBank.Norek,
+		RegionCodes:  childBank.RegionCodes,
 	}
 
 	return helpers.Response(c, 201, "Success", "Child Bank created successfully", res, nil)
@@ -76,6 +90,7 @@ func GetAllChildBanks(c *fiber.Ctx) error {
 		Page         int    `query:"page"`
 		Limit        int    `query:"limit"`
 		Subdistrict  string `query:"subdistrict"`
+		RegionCode   string `query:"region_code"` // kode provinsi, kabupaten/kota atau kecamatan
 		ParentBankID string `query:"parent_bank_id"`
 	}
 
@@ -107,6 +122,11 @@ func GetAllChildBanks(c *fiber.Ctx) error {
 		dbQuery = dbQuery.Where("subdistrict = ?", query.Subdistrict)
 	}
 
+	// Filter by kode wilayah di tingkat mana pun
+	if code := helpers.NormalizeRegionCode(query.RegionCode); code != "" {
+		dbQuery = dbQuery.Where("province_code = ? OR district_code = ? OR subdistrict_code = ?", code, code, code)
+	}
+
 	// Filter by parent_bank_id
 	if query.ParentBankID != "" {
 		dbQuery = dbQuery.Where("parent_bank_id = ?", query.ParentBankID)
@@ -194,6 +214,7 @@ func UpdateChildBank(c *fiber.Ctx) error {
 		Longitude    float64 `json:"longitude"`
 		ParentBankID uint    `json:"parentBank_id"`
 		Norek        uint    `json:"norek"`
+		models.RegionCodes
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -213,6 +234,25 @@ func UpdateChildBank(c *fiber.Ctx) error {
 		return helpers.Response(c, 404, "Failed", "Child Bank not found", nil, nil)
 	}
 
+	// Unit dan bank induk tujuannya harus dalam scope operator, unit tidak bisa dipindah ke bank induk lain
+	if err := helpers.ScopeBank(c, &childBank.ParentBankID, &childBank.Id); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	if err := helpers.ScopeBank(c, &body.ParentBankID, nil); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	regionCodes, regionGiven, err := resolveRegionBody(body.RegionCodes, nil, nil, &body.Subdistrict)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
+	if regionGiven {
+		childBank.RegionCodes = regionCodes
+	} else if body.Subdistrict != childBank.Subdistrict {
+		// Nama diubah manual tanpa kode, kode lama tidak lagi sesuai
+		childBank.RegionCodes = models.RegionCodes{}
+	}
+
 	childBank.Subdistrict = body.Subdistrict
 	childBank.RT = body.RT
 	childBank.RW = body.RW
@@ -237,6 +277,7 @@ func UpdateChildBank(c *fiber.Ctx) error {
 		Longitude:    childBank.Longitude,
 		ParentBankID: childBank.ParentBankID,
 		Norek:        childBank.Norek,
+		RegionCodes:  childBank.RegionCodes,
 	}
 
 	return helpers.Response(c, 200, "Success", "Child Bank updated successfully", res, nil)
@@ -254,6 +295,10 @@ func DeleteChildBank(c *fiber.Ctx) error {
 		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
 	}
 
+	if err := helpers.ScopeBank(c, &childBank.ParentBankID, &childBank.Id); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
 	if err := configs.DB.Delete(&childBank).Error; err != nil {
 		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
 	}
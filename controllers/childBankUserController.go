@@ -22,6 +22,7 @@ func CreateUserChildBank(c *fiber.Ctx) error {
 		Province    string `json:"province"`
 		District    string `json:"district"`
 		ChildBankID uint   `json:"child_bank_id"` // Wajib untuk user child bank
+		models.RegionCodes
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -43,6 +44,15 @@ func CreateUserChildBank(c *fiber.Ctx) error {
 	if err := configs.DB.First(&childBank, body.ChildBankID).Error; err != nil {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Child bank not found", nil, nil)
 	}
+	if err := helpers.ScopeBank(c, &childBank.ParentBankID, &childBank.Id); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	// Kode wilayah opsional, nama provinsi dan kabupaten/kota diambil dari dataset
+	regionCodes, _, err := resolveRegionBody(body.RegionCodes, &body.Province, &body.District, nil)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
 
 	// Hash password
 	hashedPassword, err := helpers.HashPassword(body.Password)
@@ -64,6 +74,7 @@ func CreateUserChildBank(c *fiber.Ctx) error {
 		RoleID:      roleID,
 		ChildBankID: &body.ChildBankID, // Gunakan pointer karena field nullable
 		Status:      "active",
+		RegionCodes: regionCodes,
 	}
 
 	if err := configs.DB.Create(&user).Error; err != nil {
@@ -95,6 +106,7 @@ func UpdateUserChildBank(c *fiber.Ctx) error {
 		Province    string `json:"province,omitempty"`
 		District    string `json:"district,omitempty"`
 		ChildBankID *uint  `json:"child_bank_id,omitempty"` // Pointer karena bisa null
+		models.RegionCodes
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -106,13 +118,19 @@ func UpdateUserChildBank(c *fiber.Ctx) error {
 	if err := configs.DB.Where("id = ? AND role_id = ?", id, 4).First(&user).Error; err != nil {
 		return helpers.Response(c, fiber.StatusNotFound, "Failed", "User child bank not found", nil, nil)
 	}
+	if err := helpers.ScopeBank(c, nil, user.ChildBankID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
 
-	// Validasi ChildBankID jika diupdate
+	// Validasi ChildBankID jika diupdate, unit tujuan juga harus dalam scope operator
 	if body.ChildBankID != nil && *body.ChildBankID != 0 {
 		var childBank models.ChildBank
 		if err := configs.DB.First(&childBank, *body.ChildBankID).Error; err != nil {
 			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Child bank not found", nil, nil)
 		}
+		if err := helpers.ScopeBank(c, &childBank.ParentBankID, &childBank.Id); err != nil {
+			return helpers.ScopeResponse(c, err)
+		}
 	}
 
 	// Update fields
@@ -147,6 +165,23 @@ func UpdateUserChildBank(c *fiber.Ctx) error {
 		updates["address"] = body.Address
 	}
 
+	regionCodes, regionGiven, err := resolveRegionBody(body.RegionCodes, &body.Province, &body.District, nil)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
+	if regionGiven {
+		updates["province_code"] = regionCodes.ProvinceCode
+		updates["district_code"] = regionCodes.DistrictCode
+		updates["subdistrict_code"] = regionCodes.SubdistrictCode
+		updates["village_code"] = regionCodes.VillageCode
+	} else if (body.Province != "" && body.Province != user.Province) || (body.District != "" && body.District != user.District) {
+		// Nama diubah manual tanpa kode, kode lama tidak lagi sesuai
+		updates["province_code"] = nil
+		updates["district_code"] = nil
+		updates["subdistrict_code"] = nil
+		updates["village_code"] = nil
+	}
+
 	if body.Province != "" {
 		updates["province"] = body.Province
 	}
@@ -172,7 +207,12 @@ func UpdateUserChildBank(c *fiber.Ctx) error {
 }
 func GetAllUsersChildBank(c *fiber.Ctx) error {
 	parentBankID := c.Query("parent_bank_id")
-	
+
+	// Operator bank induk hanya melihat user unit di bawah bank induknya, kosong berarti bank induknya sendiri
+	if authUser := helpers.AuthUser(c); parentBankID == "" && helpers.AuthRole(c) == models.RoleParentBank && authUser.ParentBankID != nil {
+		parentBankID = strconv.FormatUint(uint64(*authUser.ParentBankID), 10)
+	}
+
 	if parentBankID == "" {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "parent_bank_id is required", nil, nil)
 	}
@@ -181,6 +221,10 @@ func GetAllUsersChildBank(c *fiber.Ctx) error {
 	if err != nil {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid parent_bank_id format", nil, nil)
 	}
+	scopedParentID := uint(parentID)
+	if err := helpers.ScopeBank(c, &scopedParentID, nil); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
 
 	var users []models.User
 	
@@ -213,9 +257,12 @@ func DeleteUserChildBank(c *fiber.Ctx) error {
 	if err := configs.DB.Where("id = ? AND role_id = ?", id, 4).First(&user).Error; err != nil {
 		return helpers.Response(c, fiber.StatusNotFound, "Failed", "User child bank not found", nil, nil)
 	}
+	if err := helpers.ScopeBank(c, nil, user.ChildBankID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
 
 	// Soft delete
-	if err := configs.DB.Delete(&user).Error; err != nil {
+	if err := helpers.DeleteUserWithSessions(configs.DB, &user); err != nil {
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to delete user child bank", nil, nil)
 	}
 
@@ -4,6 +4,8 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -35,6 +37,11 @@ func CreateDonation(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Invalid user ID format", nil, nil)
 	}
 
+	// Donasi memotong saldo, operator bank tidak boleh berdonasi atas nama nasabah
+	if err := helpers.ScopeSelf(c, uint(userIDUint)); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
 	// Start database transaction
 	tx := configs.DB.Begin()
 
@@ -76,21 +83,7 @@ func CreateDonation(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Insufficient balance", nil, nil)
 	}
 
-	// 5. Potong saldo user
-	user.Balance -= req.Amount
-	if err := tx.Save(&user).Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 500, "Failed", "Failed to deduct user balance", nil, nil)
-	}
-
-	// 6. Auto increment currentAmount di donation
-	donation.CurrentAmount += req.Amount
-	if err := tx.Save(&donation).Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 500, "Failed", "Failed to update donation amount", nil, nil)
-	}
-
-	// 7. Create donation history
+	// 5. Create donation history
 	history := models.DonationHistory{
 		UserID:     uint(userIDUint),
 		DonationID: req.DonationID,
@@ -102,6 +95,21 @@ func CreateDonation(c *fiber.Ctx) error {
 		return helpers.Response(c, 500, "Failed", "Failed to create donation history", nil, nil)
 	}
 
+	// 6. Potong saldo user dan tambah currentAmount donation lewat ledger
+	_, err = helpers.NewLedgerService(tx).Post(
+		fmt.Sprintf("DON-%d", history.Id),
+		"Donasi ke kampanye #"+strconv.Itoa(int(donation.Id)),
+		helpers.Debit(models.AccountUserWallet, user.Id, req.Amount),
+		helpers.Credit(models.AccountDonationEscrow, donation.Id, req.Amount),
+	)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrInsufficientBalance) {
+			return helpers.Response(c, 400, "Failed", "Insufficient balance", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to deduct user balance", nil, nil)
+	}
+
 	// 8. Commit transaction
 	tx.Commit()
 
@@ -127,6 +135,10 @@ func GetUserDonations(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Invalid user ID format", nil, nil)
 	}
 
+	if err := helpers.ScopeUser(c, uint(userIDUint)); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
 	var req struct {
 		Page  int `query:"page"`
 		Limit int `query:"limit"`
@@ -229,11 +241,22 @@ func CompleteDonation(c *fiber.Ctx) error {
 	// 3. Simpan amount sebelumnya untuk history
 	previousAmount := donation.CurrentAmount
 
-	// 4. Update donation - set amount 0 dan status completed
+	// 4. Cairkan dana terkumpul (currentAmount jadi 0) lalu ubah status completed
+	_, err = helpers.NewLedgerService(tx).Post(
+		fmt.Sprintf("DON-COMPLETE-%d", donation.Id),
+		"Penyaluran dana donasi",
+		helpers.Debit(models.AccountDonationEscrow, donation.Id, previousAmount),
+		helpers.Credit(models.AccountCash, 0, previousAmount),
+	)
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to complete donation", nil, nil)
+	}
+
 	donation.CurrentAmount = 0
 	donation.Status = "completed"
 
-	if err := tx.Save(&donation).Error; err != nil {
+	if err := tx.Model(&donation).Update("status", donation.Status).Error; err != nil {
 		tx.Rollback()
 		return helpers.Response(c, 500, "Failed", "Failed to complete donation", nil, nil)
 	}
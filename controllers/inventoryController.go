@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetWasteStock - stok sampah per bank per produk.
+// ?child_bank_id= satu bank unit, ?parent_bank_id= bank induk beserta unitnya (own_only=true hanya bank induk),
+// tanpa filter: admin semua bank, operator bank miliknya.
+func GetWasteStock(c *fiber.Ctx) error {
+	query, err := inventoryBankQuery(c, configs.DB.Model(&models.WasteStock{}))
+	if err != nil {
+		return inventoryScopeResponse(c, err)
+	}
+	if productID := c.Query("product_waste_id"); productID != "" {
+		query = query.Where("product_waste_id = ?", productID)
+	}
+	if c.Query("include_empty") != "true" {
+		query = query.Where("quantity <> 0")
+	}
+
+	var stocks []models.WasteStock
+	if err := query.Preload("ProductWaste", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Order("bank_key, product_waste_id").Find(&stocks).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch waste stock", nil, nil)
+	}
+
+	// Total per produk untuk semua bank yang tercakup filter
+	type stockTotal struct {
+		ProductWasteID uint    `json:"product_waste_id"`
+		WasteType      string  `json:"waste_type"`
+		Unit           string  `json:"unit"`
+		Quantity       float64 `json:"quantity"`
+	}
+	totals := []stockTotal{}
+	index := map[string]int{}
+	for _, stock := range stocks {
+		key := strconv.Itoa(int(stock.ProductWasteID)) + "|" + stock.Unit
+		i, ok := index[key]
+		if !ok {
+			total := stockTotal{ProductWasteID: stock.ProductWasteID, Unit: stock.Unit}
+			if stock.ProductWaste != nil {
+				total.WasteType = stock.ProductWaste.WasteType
+			}
+			totals = append(totals, total)
+			i = len(totals) - 1
+			index[key] = i
+		}
+		totals[i].Quantity = math.Round((totals[i].Quantity+stock.Quantity)*1000) / 1000
+	}
+
+	data := map[string]any{
+		"stocks": stocks,
+		"totals": totals,
+	}
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// GetWasteStockMovements - riwayat pergerakan stok dengan filter bank seperti GetWasteStock,
+// ?product_waste_id=&type=&reference=&start_date=&end_date= (YYYY-MM-DD)
+func GetWasteStockMovements(c *fiber.Ctx) error {
+	var req struct {
+		ProductWasteID uint   `query:"product_waste_id"`
+		Type           string `query:"type"`
+		Reference      string `query:"reference"`
+		StartDate      string `query:"start_date"`
+		EndDate        string `query:"end_date"`
+		Page           int    `query:"page"`
+		Limit          int    `query:"limit"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	offset := (req.Page - 1) * req.Limit
+
+	query, err := inventoryBankQuery(c, configs.DB.Model(&models.WasteStockMovement{}))
+	if err != nil {
+		return inventoryScopeResponse(c, err)
+	}
+	if req.ProductWasteID != 0 {
+		query = query.Where("product_waste_id = ?", req.ProductWasteID)
+	}
+	if req.Type != "" {
+		query = query.Where("type = ?", req.Type)
+	}
+	if req.Reference != "" {
+		query = query.Where("reference = ?", req.Reference)
+	}
+	if req.StartDate != "" {
+		startDate, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid start_date format, use YYYY-MM-DD", nil, nil)
+		}
+		query = query.Where("DATE(created_at) >= ?", startDate.Format("2006-01-02"))
+	}
+	if req.EndDate != "" {
+		endDate, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid end_date format, use YYYY-MM-DD", nil, nil)
+		}
+		query = query.Where("DATE(created_at) <= ?", endDate.Format("2006-01-02"))
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var movements []models.WasteStockMovement
+	if err := query.Preload("ProductWaste", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Order("id DESC").Offset(offset).Limit(req.Limit).Find(&movements).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch stock movements", nil, nil)
+	}
+
+	data := map[string]any{
+		"movements": movements,
+		"meta": map[string]any{
+			"page":  req.Page,
+			"limit": req.Limit,
+			"total": total,
+			"pages": (int(total) + req.Limit - 1) / req.Limit,
+		},
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// CreateStockAdjustment - koreksi stok (stok opname, susut, hilang). quantity negatif mengurangi stok.
+func CreateStockAdjustment(c *fiber.Ctx) error {
+	var body struct {
+		ParentBankID   *uint   `json:"parent_bank_id"`
+		ChildBankID    *uint   `json:"child_bank_id"`
+		ProductWasteID uint    `json:"product_waste_id"`
+		Quantity       float64 `json:"quantity"`
+		Unit           string  `json:"unit"`
+		Note           string  `json:"note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+
+	if body.ProductWasteID == 0 || body.Quantity == 0 {
+		return helpers.Response(c, 400, "Failed", "product_waste_id and a non-zero quantity are required", nil, nil)
+	}
+	if strings.TrimSpace(body.Note) == "" {
+		return helpers.Response(c, 400, "Failed", "Note is required for stock adjustments", nil, nil)
+	}
+	if body.ParentBankID != nil && body.ChildBankID != nil {
+		return helpers.Response(c, 400, "Failed", "Cannot specify both parent_bank_id and child_bank_id", nil, nil)
+	}
+
+	// Tanpa bank berarti bank milik operator yang login
+	bank := helpers.InventoryBank{ParentBankID: body.ParentBankID, ChildBankID: body.ChildBankID}
+	if bank.Key() == "" {
+		bank = authInventoryBank(c)
+		if bank.Key() == "" {
+			return helpers.Response(c, 400, "Failed", "parent_bank_id or child_bank_id is required", nil, nil)
+		}
+	}
+	if err := helpers.ScopeBank(c, bank.ParentBankID, bank.ChildBankID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	var product models.ProductWaste
+	if err := configs.DB.First(&product, body.ProductWasteID).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Product waste not found", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+	movement, err := helpers.NewInventoryService(tx).Move(helpers.StockMove{
+		Bank:           bank,
+		ProductWasteID: product.Id,
+		Type:           models.StockMovementAdjustment,
+		Quantity:       body.Quantity,
+		Unit:           body.Unit,
+		Reference:      helpers.UniqueReference("ADJ", time.Now(), product.Id),
+		Note:           strings.TrimSpace(body.Note),
+		CreatedBy:      helpers.AuthUserID(c),
+	})
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrInsufficientStock) || errors.Is(err, helpers.ErrIncompatibleUnit) {
+			return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to adjust stock", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return helpers.Response(c, 201, "Success", "Stock adjusted successfully", movement, nil)
+}
+
+// authInventoryBank - bank milik operator yang login
+func authInventoryBank(c *fiber.Ctx) helpers.InventoryBank {
+	user := helpers.AuthUser(c)
+	if user == nil {
+		return helpers.InventoryBank{}
+	}
+	switch helpers.AuthRole(c) {
+	case models.RoleChildBank:
+		return helpers.InventoryBank{ChildBankID: user.ChildBankID}
+	case models.RoleParentBank:
+		return helpers.InventoryBank{ParentBankID: user.ParentBankID}
+	}
+	return helpers.InventoryBank{}
+}
+
+// inventoryBankQuery menerapkan filter bank dan scope user ke query stok/pergerakan stok
+func inventoryBankQuery(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	parentBankID, err := optionalUintQuery(c, "parent_bank_id")
+	if err != nil {
+		return nil, err
+	}
+	childBankID, err := optionalUintQuery(c, "child_bank_id")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case childBankID != nil:
+		if err := helpers.ScopeBank(c, nil, childBankID); err != nil {
+			return nil, err
+		}
+		return query.Where("child_bank_id = ?", *childBankID), nil
+	case parentBankID != nil:
+		if err := helpers.ScopeBank(c, parentBankID, nil); err != nil {
+			return nil, err
+		}
+		if c.Query("own_only") == "true" {
+			return query.Where("bank_key = ?", helpers.InventoryBank{ParentBankID: parentBankID}.Key()), nil
+		}
+		return query.Where("parent_bank_id = ?", *parentBankID), nil
+	case helpers.HasRole(c, models.RoleAdmin):
+		return query, nil
+	}
+
+	bank := authInventoryBank(c)
+	switch {
+	case bank.ChildBankID != nil:
+		return query.Where("child_bank_id = ?", *bank.ChildBankID), nil
+	case bank.ParentBankID != nil:
+		return query.Where("parent_bank_id = ?", *bank.ParentBankID), nil
+	}
+	return nil, helpers.ErrForbidden
+}
+
+func inventoryScopeResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, helpers.ErrForbidden) {
+		return helpers.ScopeResponse(c, err)
+	}
+	return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+}
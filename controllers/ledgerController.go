@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetLedgerJournals - List jurnal ledger dengan filter reference dan akun
+func GetLedgerJournals(c *fiber.Ctx) error {
+	var req struct {
+		Reference   string `query:"reference"`
+		AccountType string `query:"account_type"`
+		AccountID   uint   `query:"account_id"`
+		Page        int    `query:"page"`
+		Limit       int    `query:"limit"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	offset := (req.Page - 1) * req.Limit
+
+	query := configs.DB.Model(&models.LedgerJournal{}).Preload("Entries")
+
+	if req.Reference != "" {
+		query = query.Where("reference = ?", req.Reference)
+	}
+
+	if req.AccountType != "" {
+		sub := configs.DB.Model(&models.LedgerEntry{}).Select("journal_id").Where("account_type = ?", req.AccountType)
+		if req.AccountID != 0 {
+			sub = sub.Where("account_id = ?", req.AccountID)
+		}
+		query = query.Where("id IN (?)", sub)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var journals []models.LedgerJournal
+	if err := query.Order("id DESC").Offset(offset).Limit(req.Limit).Find(&journals).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch ledger journals", nil, nil)
+	}
+
+	data := map[string]any{
+		"journals": journals,
+		"meta": map[string]any{
+			"page":  req.Page,
+			"limit": req.Limit,
+			"total": total,
+			"pages": (int(total) + req.Limit - 1) / req.Limit,
+		},
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// GetLedgerAccount - Saldo akun hasil hitung ulang dari jurnal dibandingkan saldo tersimpan
+func GetLedgerAccount(c *fiber.Ctx) error {
+	accountType := c.Params("type")
+	accountID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid account ID", nil, nil)
+	}
+
+	ledger := helpers.NewLedgerService(configs.DB)
+
+	journalBalance, err := ledger.Balance(accountType, uint(accountID))
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to calculate ledger balance", nil, nil)
+	}
+
+	data := map[string]any{
+		"account_type":    accountType,
+		"account_id":      accountID,
+		"journal_balance": journalBalance,
+	}
+
+	storedBalance, materialized, err := ledger.StoredBalance(accountType, uint(accountID))
+	if err != nil {
+		if errors.Is(err, helpers.ErrLedgerAccount) {
+			return helpers.Response(c, 404, "Failed", "Account not found", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to fetch stored balance", nil, nil)
+	}
+	if materialized {
+		data["stored_balance"] = storedBalance
+		data["in_sync"] = storedBalance == journalBalance
+	}
+
+	var entries []models.LedgerEntry
+	configs.DB.Where("account_type = ? AND account_id = ?", accountType, accountID).
+		Order("id DESC").
+		Limit(50).
+		Find(&entries)
+	data["recent_entries"] = entries
+
+	return helpers.Response(c, 200, "Success", "Ledger account retrieved successfully", data, nil)
+}
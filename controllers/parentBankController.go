@@ -4,6 +4,7 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -26,9 +27,12 @@ func GetPrentBank(c *fiber.Ctx) error {
 // Function for admin in web
 func CreateParentBank(c *fiber.Ctx) error {
 	var body struct {
-		District string `json:"district"`
-		Province string `json:"province"`
-		Address  string `json:"address"`
+		District  string   `json:"district"`
+		Province  string   `json:"province"`
+		Address   string   `json:"address"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		models.RegionCodes
 	}
 
 	// Parse body JSON
@@ -36,11 +40,25 @@ func CreateParentBank(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Failed to read body", nil, nil)
 	}
 
+	// Koordinat opsional, tapi harus diisi berpasangan
+	if err := validateBankCoordinates(body.Latitude, body.Longitude); err != nil {
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	}
+
+	// Kode wilayah opsional, nama provinsi dan kabupaten/kota diambil dari dataset
+	regionCodes, _, err := resolveRegionBody(body.RegionCodes, &body.Province, &body.District, nil)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
+
 	// Mapping ke model
 	parentBank := models.ParentBank{
-		District: body.District,
-		Province: body.Province,
-		Address:  body.Address,
+		District:    body.District,
+		Province:    body.Province,
+		Address:     body.Address,
+		Latitude:    body.Latitude,
+		Longitude:   body.Longitude,
+		RegionCodes: regionCodes,
 	}
 
 	// Simpan ke database
@@ -62,6 +80,9 @@ func GetParentBankID(c *fiber.Ctx) error {
 	if err := configs.DB.Preload("ParentBank").Preload("Role").Where("id = ?", id).First(&user).Error; err != nil {
 		return helpers.Response(c, 404, "Failed", "Parent Bank not found", nil, nil)
 	}
+	if err := helpers.ScopeBank(c, user.ParentBankID, nil); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
 
 	return helpers.Response(c, 200, "Success", "Data Found", user.ParentBank, nil)
 }
@@ -71,23 +92,46 @@ func UpdateParentBank(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	var body struct {
-		District string `json:"district"`
-		Province string `json:"province"`
-		Address  string `json:"address"`
+		District  string   `json:"district"`
+		Province  string   `json:"province"`
+		Address   string   `json:"address"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		models.RegionCodes
 	}
 
 	if err := c.BodyParser(&body); err != nil {
 		return helpers.Response(c, 400, "Failed", "Failed to read body", nil, nil)
 	}
 
+	// Koordinat opsional, tapi harus diisi berpasangan
+	if err := validateBankCoordinates(body.Latitude, body.Longitude); err != nil {
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	}
+
 	var parentBank models.ParentBank
 	if err := configs.DB.First(&parentBank, id).Error; err != nil {
 		return helpers.Response(c, 404, "Failed", "Parent Bank not found", nil, nil)
 	}
 
+	regionCodes, regionGiven, err := resolveRegionBody(body.RegionCodes, &body.Province, &body.District, nil)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
+	if regionGiven {
+		parentBank.RegionCodes = regionCodes
+	} else if body.Province != parentBank.Province || body.District != parentBank.District {
+		// Nama diubah manual tanpa kode, kode lama tidak lagi sesuai
+		parentBank.RegionCodes = models.RegionCodes{}
+	}
+
 	parentBank.District = body.District
 	parentBank.Province = body.Province
 	parentBank.Address = body.Address
+	if body.Latitude != nil {
+		parentBank.Latitude = body.Latitude
+		parentBank.Longitude = body.Longitude
+	}
 
 	if err := configs.DB.Save(&parentBank).Error; err != nil {
 		return helpers.Response(c, 500, "Failed", "Failed to update parent bank", nil, nil)
@@ -111,3 +155,19 @@ func DeleteParentBank(c *fiber.Ctx) error {
 
 	return helpers.Response(c, 200, "Success", "Parent Bank deleted successfully", nil, nil)
 }
+
+func validateBankCoordinates(latitude, longitude *float64) error {
+	if (latitude == nil) != (longitude == nil) {
+		return errors.New("Latitude and longitude must be provided together")
+	}
+	if latitude == nil {
+		return nil
+	}
+	if *latitude < -90 || *latitude > 90 {
+		return errors.New("Invalid latitude value (must be between -90 and 90)")
+	}
+	if *longitude < -180 || *longitude > 180 {
+		return errors.New("Invalid longitude value (must be between -180 and 180)")
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"backend-mulungs/payment"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetPaymentMethods - metode top up (VA/QRIS) yang tersedia di gateway aktif
+func GetPaymentMethods(c *fiber.Ctx) error {
+	gateway := payment.Default()
+	return helpers.Response(c, 200, "Success", "List of payment methods", fiber.Map{
+		"gateway": gateway.Name(),
+		"methods": gateway.Methods(),
+	}, nil)
+}
+
+// CreateTopUpPayment - top up saldo lewat payment gateway. Transaction "topup" pending dibuat bersama
+// Payment, lalu gateway memberi nomor VA/QRIS yang berlaku sampai expires_at. Saldo bertambah otomatis
+// saat webhook lunas masuk (PaymentWebhook), tanpa konfirmasi admin.
+func CreateTopUpPayment(c *fiber.Ctx) error {
+	var body struct {
+		UserID uint   `json:"user_id"`
+		Amount int    `json:"amount"`
+		Method string `json:"method"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+
+	// user_id di body dibatasi sesuai scope user yang login, kosong berarti diri sendiri
+	userID, err := helpers.ResolveUserID(c, body.UserID)
+	if err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	gateway := payment.Default()
+	method, err := payment.FindMethod(gateway, body.Method)
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", fmt.Sprintf("Payment method %q is not available", body.Method), nil, nil)
+	}
+	if body.Amount < method.MinAmount || body.Amount > method.MaxAmount {
+		return helpers.Response(c, 400, "Failed", fmt.Sprintf("Amount for %s must be between %d and %d", method.Name, method.MinAmount, method.MaxAmount), nil, nil)
+	}
+
+	var user models.User
+	if err := configs.DB.First(&user, userID).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "User not found", nil, nil)
+	}
+
+	// Transaction dan Payment disimpan dulu supaya order id yang dikirim ke gateway selalu tercatat
+	tx := configs.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	transaction := models.Transaction{
+		UserID:  userID,
+		Balance: body.Amount,
+		Status:  "pending",
+		Desc:    "Topup via " + method.Name,
+		Type:    "topup",
+	}
+	if err := tx.Create(&transaction).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to create transaction", nil, nil)
+	}
+
+	topup := models.Payment{
+		TransactionID: transaction.Id,
+		UserID:        userID,
+		Gateway:       gateway.Name(),
+		Method:        method.Code,
+		OrderID:       fmt.Sprintf("TOPUP-%d", transaction.Id),
+		Amount:        body.Amount,
+		Status:        models.PaymentStatusPending,
+		ExpiresAt:     time.Now().Add(method.Expiry),
+	}
+	if err := tx.Create(&topup).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to create payment", nil, nil)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to create payment", nil, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 30*time.Second)
+	defer cancel()
+	charge, err := gateway.CreateCharge(ctx, payment.ChargeRequest{
+		OrderID:       topup.OrderID,
+		Amount:        topup.Amount,
+		Method:        topup.Method,
+		CustomerName:  user.Name,
+		CustomerEmail: user.Email,
+		ExpiresAt:     topup.ExpiresAt,
+	})
+	if err != nil {
+		// Gateway menolak atau tidak bisa dihubungi, transaksi ditutup supaya tidak menggantung
+		if _, settleErr := settlePaymentOutcome(topup.OrderID, helpers.PaymentOutcome{Status: models.PaymentStatusFailed, Reason: err.Error()}); settleErr != nil {
+			log.Printf("Payment %s: failed to close after gateway error: %v\n", topup.OrderID, settleErr)
+		}
+		if errors.Is(err, payment.ErrUnsupportedMethod) || errors.Is(err, payment.ErrInvalidAmount) {
+			return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+		}
+		return helpers.Response(c, 502, "Failed", "Payment gateway is unavailable, please try again", nil, nil)
+	}
+
+	topup.ExternalID = &charge.ExternalID
+	topup.VANumber = charge.VANumber
+	topup.QRString = charge.QRString
+	if !charge.ExpiresAt.IsZero() {
+		topup.ExpiresAt = charge.ExpiresAt
+	}
+	err = configs.DB.Model(&topup).
+		Select("external_id", "va_number", "qr_string", "expires_at").
+		Updates(&topup).Error
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to save payment instruction", nil, nil)
+	}
+
+	topup.Transaction = &transaction
+	return helpers.Response(c, 200, "Success", "Payment created, complete it before expires_at", topup, nil)
+}
+
+// GetTopUpPayment - status dan instruksi pembayaran top up
+func GetTopUpPayment(c *fiber.Ctx) error {
+	var topup models.Payment
+	if err := configs.DB.Preload("Transaction").First(&topup, c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.Response(c, 404, "Failed", "Payment not found", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to fetch payment", nil, nil)
+	}
+	if err := helpers.ScopeUser(c, topup.UserID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", topup, nil)
+}
+
+// PaymentWebhook - notifikasi status dari payment gateway. Signature HMAC-SHA256 body di header
+// X-Callback-Signature wajib valid; webhook ulang untuk order yang sama tidak memproses saldo lagi.
+func PaymentWebhook(c *fiber.Ctx) error {
+	status, message, event := processPaymentWebhook(c.Body(), c.Get(payment.SignatureHeader), c.IP())
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"status":  "error",
+			"message": message,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": message,
+		"data": fiber.Map{
+			"order_id": event.OrderID,
+			"status":   event.Status,
+		},
+	})
+}
+
+// SimulatePayment - hanya untuk PAYMENT_GATEWAY=simulator dengan PAYMENT_SIMULATOR_ENABLED=true (admin):
+// membuat webhook bertanda tangan seperti gateway sungguhan lalu memprosesnya lewat jalur yang sama
+// dengan PaymentWebhook.
+// Body: status=paid|expired|failed (default paid), amount opsional untuk menguji nominal yang tidak cocok.
+func SimulatePayment(c *fiber.Ctx) error {
+	simulator, ok := payment.Default().(*payment.Simulator)
+	if !ok || !payment.SimulatorEnabled() {
+		return helpers.Response(c, 404, "Failed", "Payment simulator is not enabled", nil, nil)
+	}
+
+	var body struct {
+		Status string `json:"status"`
+		Amount int    `json:"amount"`
+	}
+	if err := c.BodyParser(&body); err != nil && len(c.Body()) > 0 {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+	if body.Status == "" {
+		body.Status = payment.StatusPaid
+	}
+
+	var topup models.Payment
+	if err := configs.DB.First(&topup, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Payment not found", nil, nil)
+	}
+	if err := helpers.ScopeUser(c, topup.UserID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	event := payment.WebhookEvent{
+		OrderID: topup.OrderID,
+		Status:  body.Status,
+		Amount:  topup.Amount,
+	}
+	if topup.ExternalID != nil {
+		event.ExternalID = *topup.ExternalID
+	}
+	if body.Amount != 0 {
+		event.Amount = body.Amount
+	}
+	webhookBody, signature, err := simulator.Webhook(event)
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to build webhook: "+err.Error(), nil, nil)
+	}
+
+	status, message, _ := processPaymentWebhook(webhookBody, signature, c.IP())
+	configs.DB.Preload("Transaction").First(&topup, topup.Id)
+	if status != fiber.StatusOK {
+		return helpers.Response(c, status, "Failed", message, topup, nil)
+	}
+	return helpers.Response(c, 200, "Success", message, topup, nil)
+}
+
+// processPaymentWebhook memverifikasi dan menyelesaikan satu webhook, mengembalikan HTTP status dan
+// pesan untuk gateway. Semua webhook dicatat di PaymentWebhookLog.
+func processPaymentWebhook(body []byte, signature, remoteIP string) (int, string, *payment.WebhookEvent) {
+	gateway := payment.Default()
+	webhookLog := models.PaymentWebhookLog{
+		Gateway:  gateway.Name(),
+		RemoteIP: remoteIP,
+		RawBody:  string(body),
+		Result:   models.CallbackResultError,
+	}
+	defer func() {
+		configs.DB.Create(&webhookLog)
+	}()
+
+	event, err := gateway.ParseWebhook(body, signature)
+	if err != nil {
+		webhookLog.Error = err.Error()
+		switch {
+		case errors.Is(err, payment.ErrInvalidSignature):
+			webhookLog.Result = models.CallbackResultInvalidSignature
+			return fiber.StatusUnauthorized, "invalid signature", nil
+		case errors.Is(err, payment.ErrInvalidPayload):
+			return fiber.StatusBadRequest, err.Error(), nil
+		}
+		return fiber.StatusServiceUnavailable, "payment gateway is not configured", nil
+	}
+	webhookLog.SignValid = true
+	webhookLog.OrderID = event.OrderID
+	webhookLog.Status = event.Status
+
+	outcome := helpers.PaymentOutcome{Amount: event.Amount, PaidAt: event.PaidAt}
+	switch event.Status {
+	case payment.StatusPaid:
+		outcome.Status = models.PaymentStatusPaid
+	case payment.StatusExpired:
+		outcome.Status = models.PaymentStatusExpired
+		outcome.Reason = "expired at gateway"
+	case payment.StatusFailed:
+		outcome.Status = models.PaymentStatusFailed
+		outcome.Reason = "failed at gateway"
+	default:
+		// Masih menunggu pembayaran, tunggu webhook berikutnya
+		webhookLog.Result = models.CallbackResultIgnored
+		return fiber.StatusOK, "payment still pending", event
+	}
+
+	if _, err := settlePaymentOutcome(event.OrderID, outcome); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			webhookLog.Result = models.CallbackResultNotFound
+			return fiber.StatusNotFound, "payment not found", event
+		case errors.Is(err, helpers.ErrPaymentAlreadySettled):
+			webhookLog.Result = models.CallbackResultDuplicate
+			return fiber.StatusOK, "webhook already processed", event
+		case errors.Is(err, helpers.ErrPaymentAmountMismatch):
+			// Tidak dikreditkan, perlu dicek manual ke gateway
+			webhookLog.Error = err.Error()
+			return fiber.StatusUnprocessableEntity, "paid amount does not match payment", event
+		}
+		webhookLog.Error = err.Error()
+		return fiber.StatusInternalServerError, "failed to settle payment", event
+	}
+
+	webhookLog.Result = models.CallbackResultProcessed
+	return fiber.StatusOK, "webhook processed successfully", event
+}
+
+// settlePaymentOutcome menjalankan helpers.SettlePayment dalam transaksi database sendiri
+func settlePaymentOutcome(orderID string, outcome helpers.PaymentOutcome) (*models.Payment, error) {
+	var settled *models.Payment
+	err := configs.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		settled, err = helpers.SettlePayment(tx, orderID, outcome)
+		return err
+	})
+	return settled, err
+}
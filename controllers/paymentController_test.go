@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/models"
+	"backend-mulungs/payment"
+	"backend-mulungs/testdb"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPaymentWebhookProcessedOnce(t *testing.T) {
+	db := testdb.Open(t,
+		&models.User{},
+		&models.Transaction{},
+		&models.Payment{},
+		&models.PaymentWebhookLog{},
+		&models.LedgerJournal{},
+		&models.LedgerEntry{},
+	)
+	simulator := payment.NewSimulator("rahasia")
+
+	previousDB, previousGateway := configs.DB, payment.Default()
+	configs.DB = db
+	payment.SetDefault(simulator)
+	t.Cleanup(func() {
+		configs.DB = previousDB
+		payment.SetDefault(previousGateway)
+	})
+
+	user := models.User{Name: "Nasabah Uji", Email: "nasabah@example.com", Balance: 1000, Status: "active"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	transaction := models.Transaction{UserID: user.Id, Balance: 50000, Status: "pending", Type: "topup"}
+	if err := db.Create(&transaction).Error; err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	topup := models.Payment{
+		TransactionID: transaction.Id,
+		UserID:        user.Id,
+		Gateway:       simulator.Name(),
+		Method:        payment.MethodVABCA,
+		OrderID:       "TOPUP-1",
+		Amount:        50000,
+		Status:        models.PaymentStatusPending,
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}
+	if err := db.Create(&topup).Error; err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+
+	app := fiber.New()
+	app.Post("/payments/webhook", PaymentWebhook)
+
+	// Gateway mengirim ulang webhook yang sama persis, misalnya karena response pertama timeout
+	webhookBody, signature, err := simulator.Webhook(payment.WebhookEvent{OrderID: topup.OrderID, Status: payment.StatusPaid, Amount: topup.Amount})
+	if err != nil {
+		t.Fatalf("build webhook: %v", err)
+	}
+	messages := []string{"webhook processed successfully", "webhook already processed"}
+	for i, want := range messages {
+		req := httptest.NewRequest("POST", "/payments/webhook", strings.NewReader(string(webhookBody)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(payment.SignatureHeader, signature)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("webhook #%d: %v", i+1, err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		var decoded map[string]any
+		json.Unmarshal(raw, &decoded)
+		if resp.StatusCode != fiber.StatusOK || decoded["message"] != want {
+			t.Fatalf("webhook #%d = %d %s, want 200 %q", i+1, resp.StatusCode, raw, want)
+		}
+	}
+
+	// Saldo hanya bertambah sekali
+	db.First(&user, user.Id)
+	if user.Balance != 51000 {
+		t.Fatalf("balance = %d, want 51000", user.Balance)
+	}
+	db.First(&transaction, transaction.Id)
+	if transaction.Status != "confirm" {
+		t.Fatalf("transaction status = %s, want confirm", transaction.Status)
+	}
+	var journals int64
+	db.Model(&models.LedgerJournal{}).Count(&journals)
+	if journals != 1 {
+		t.Fatalf("ledger journals = %d, want 1", journals)
+	}
+
+	var results []string
+	db.Model(&models.PaymentWebhookLog{}).Order("id ASC").Pluck("result", &results)
+	if len(results) != 2 || results[0] != models.CallbackResultProcessed || results[1] != models.CallbackResultDuplicate {
+		t.Fatalf("webhook log results = %v, want processed then duplicate", results)
+	}
+}
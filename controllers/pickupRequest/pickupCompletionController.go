@@ -0,0 +1,196 @@
+package pickuprequest
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PickupCompletionRequest - hasil timbang di lokasi, atau setoran yang sudah dicatat di bank
+type PickupCompletionRequest struct {
+	BankNote  string                     `json:"bank_note"`
+	DepositID *uint                      `json:"deposit_id"`
+	Items     []PickupWeighedItemRequest `json:"items"`
+}
+
+// PickupWeighedItemRequest - item hasil timbang, satuan kosong memakai satuan produk
+type PickupWeighedItemRequest struct {
+	ProductWasteID uint    `json:"product_waste_id"`
+	Weight         float64 `json:"weight"`
+	Unit           string  `json:"unit"`
+}
+
+var (
+	errDepositNotFound = errors.New("waste deposit not found")
+	errDepositMismatch = errors.New("waste deposit does not belong to the pickup user and bank")
+	errDepositLinked   = errors.New("waste deposit is already linked to a pickup request")
+	errDepositVoided   = errors.New("waste deposit has been voided")
+)
+
+// CompletePickupRequest - menyelesaikan penjemputan. Wajib membawa item hasil timbang (setoran dibuat
+// otomatis dan saldo user bertambah) atau deposit_id setoran yang sudah dicatat untuk user dan bank
+// yang sama. Boleh dilakukan operator bank atau petugas yang ditunjuk.
+func CompletePickupRequest(c *fiber.Ctx) error {
+	return completePickupRequest(c, c.Params("id"))
+}
+
+func completePickupRequest(c *fiber.Ctx, id string) error {
+	var body PickupCompletionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+	if (body.DepositID == nil) == (len(body.Items) == 0) {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Completing a pickup requires either weighed items or deposit_id", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	var pickup models.PickupRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pickup, id).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.Response(c, fiber.StatusNotFound, "Failed", "Pickup request not found", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch pickup request", nil, nil)
+	}
+
+	// Petugas yang ditunjuk boleh menyelesaikan penjemputannya sendiri
+	authUser := helpers.AuthUser(c)
+	isCollector := authUser != nil && pickup.CollectorID != nil && *pickup.CollectorID == authUser.Id
+	if !isCollector {
+		if err := scopePickupBank(c, &pickup); err != nil {
+			tx.Rollback()
+			return helpers.ScopeResponse(c, err)
+		}
+	}
+
+	if !pickup.CanTransitionTo(models.PickupStatusCompleted) {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusConflict, "Failed", fmt.Sprintf("Cannot change pickup request status from %s to %s", pickup.Status, models.PickupStatusCompleted), nil, nil)
+	}
+
+	var err error
+	if body.DepositID != nil {
+		err = linkPickupDeposit(tx, &pickup, *body.DepositID)
+	} else {
+		items := make([]helpers.DepositItemInput, 0, len(body.Items))
+		for _, item := range body.Items {
+			items = append(items, helpers.DepositItemInput{
+				ProductWasteID: item.ProductWasteID,
+				Weight:         item.Weight,
+				Unit:           item.Unit,
+			})
+		}
+		_, err = helpers.NewWasteDepositService(tx).Create(helpers.DepositInput{
+			UserID:          pickup.UserID,
+			ParentBankID:    pickup.ParentBankID,
+			ChildBankID:     pickup.ChildBankID,
+			PickupRequestID: &pickup.Id,
+			Items:           items,
+			CreatedBy:       helpers.AuthUserID(c),
+		})
+	}
+	if err != nil {
+		tx.Rollback()
+		return completionErrorResponse(c, err)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       models.PickupStatusCompleted,
+		"completed_at": &now,
+		"updated_at":   now,
+	}
+	if note := strings.TrimSpace(body.BankNote); note != "" {
+		updates["bank_note"] = note
+	}
+
+	// Update kondisional supaya perubahan status paralel tidak saling menimpa
+	result := tx.Model(&models.PickupRequest{}).
+		Where("id = ? AND status = ?", pickup.Id, pickup.Status).
+		Updates(updates)
+	if result.Error != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update pickup request status", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusConflict, "Failed", "Pickup request status has changed, please reload", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondPickup(c, pickup.Id, "Pickup request completed and waste deposit recorded")
+}
+
+// linkPickupDeposit menautkan setoran yang sudah ada. Setoran harus aktif, belum tertaut, dan milik
+// user serta bank yang sama dengan penjemputan.
+func linkPickupDeposit(tx *gorm.DB, pickup *models.PickupRequest, depositID uint) error {
+	var deposit models.WasteDeposit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&deposit, depositID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errDepositNotFound
+		}
+		return err
+	}
+
+	if deposit.Status == models.DepositStatusVoided {
+		return errDepositVoided
+	}
+	if deposit.PickupRequestID != nil {
+		return errDepositLinked
+	}
+	if deposit.UserID != pickup.UserID || !sameBankID(deposit.ParentBankID, pickup.ParentBankID) || !sameBankID(deposit.ChildBankID, pickup.ChildBankID) {
+		return errDepositMismatch
+	}
+
+	result := tx.Model(&models.WasteDeposit{}).
+		Where("id = ? AND pickup_request_id IS NULL", deposit.Id).
+		Update("pickup_request_id", pickup.Id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errDepositLinked
+	}
+	return nil
+}
+
+func sameBankID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func completionErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errDepositNotFound):
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Waste deposit not found", nil, nil)
+	case errors.Is(err, errDepositMismatch):
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, errDepositLinked), errors.Is(err, errDepositVoided):
+		return helpers.Response(c, fiber.StatusConflict, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, helpers.ErrDepositInvalid), errors.Is(err, helpers.ErrDepositDuplicateRef):
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, helpers.ErrDepositProductNotFound), errors.Is(err, helpers.ErrDepositUserNotFound), errors.Is(err, helpers.ErrDepositBankNotFound):
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", err.Error(), nil, nil)
+	}
+	return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to record waste deposit", nil, nil)
+}
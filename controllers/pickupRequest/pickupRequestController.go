@@ -4,12 +4,16 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
+	"errors"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CheckNearbyBanks - Cek semua bank pembantu dalam radius 1KM (bukan hanya yang terdekat)
@@ -34,29 +38,48 @@ func CheckNearbyBanks(c *fiber.Ctx) error {
 		body.Radius = 1.0
 	}
 
-	// Cari SEMUA bank pembantu dalam radius 1KM (bukan hanya 1)
-	var nearbyChildBanks []models.ChildBank
-	query := `
+	// Bank unit yang wilayah layanannya mencakup lokasi user
+	match, err := helpers.FindServiceAreaBanks(configs.DB, body.Latitude, body.Longitude)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to find service area banks: "+err.Error(), nil, nil)
+	}
+	nearbyChildBanks := match.ChildBanks
+	matchType := "service_area"
+
+	// Bank unit yang belum menggambar wilayah masih dicari dengan radius
+	if len(nearbyChildBanks) == 0 {
+		matchType = "radius"
+		query := `
 		SELECT *,
 		(6371 * acos(cos(radians(?)) * cos(radians(latitude)) * 
 		cos(radians(longitude) - radians(?)) + 
 		sin(radians(?)) * sin(radians(latitude)))) AS distance
 		FROM child_banks 
-		WHERE deleted_at IS NULL
+		WHERE deleted_at IS NULL AND service_area IS NULL
 		HAVING distance < ?
 		ORDER BY distance ASC
-	` // HAPUS LIMIT 1
+	`
 
-	if err := configs.DB.
-		Raw(query, body.Latitude, body.Longitude, body.Latitude, body.Radius).
-		Preload("ParentBank").
-		Find(&nearbyChildBanks).Error; err != nil {
-		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to find nearby banks: "+err.Error(), nil, nil)
+		if err := configs.DB.
+			Raw(query, body.Latitude, body.Longitude, body.Latitude, body.Radius).
+			Preload("ParentBank").
+			Find(&nearbyChildBanks).Error; err != nil {
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to find nearby banks: "+err.Error(), nil, nil)
+		}
 	}
 
-	// Cari parent bank default (fallback)
-	var parentBank models.ParentBank
-	configs.DB.First(&parentBank)
+	// Bank induk fallback: yang wilayahnya mencakup lokasi, induk dari bank unit terdekat,
+	// lalu bank induk terdekat yang punya koordinat
+	parentBank := match.ParentBank
+	if parentBank == nil && len(nearbyChildBanks) > 0 {
+		parentBank = &nearbyChildBanks[0].ParentBank
+	}
+	if parentBank == nil {
+		parentBank, err = nearestParentBank(body.Latitude, body.Longitude)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to find parent bank: "+err.Error(), nil, nil)
+		}
+	}
 
 	// Format response dengan semua bank terdekat
 	type ChildBankWithDistance struct {
@@ -84,20 +107,45 @@ func CheckNearbyBanks(c *fiber.Ctx) error {
 		"nearby_banks_count":   len(childBanksResponse),
 		"fallback_parent_bank": parentBank,
 		"has_nearby_banks":     len(childBanksResponse) > 0,
+		"match_type":           matchType, // service_area atau radius
 	}
 
 	// Tentukan message berdasarkan jumlah bank yang ditemukan
-	if len(childBanksResponse) > 0 {
+	if len(childBanksResponse) > 0 && matchType == "service_area" {
+		response["message"] = fmt.Sprintf("Ditemukan %d bank pembantu yang melayani lokasi ini", len(childBanksResponse))
+		response["bank_type"] = "child_bank"
+	} else if len(childBanksResponse) > 0 {
 		response["message"] = fmt.Sprintf("Ditemukan %d bank pembantu dalam radius %.1fKM", len(childBanksResponse), body.Radius)
 		response["bank_type"] = "child_bank"
-	} else {
+	} else if parentBank != nil {
 		response["message"] = fmt.Sprintf("Tidak ada bank pembantu dalam radius %.1fKM. Request akan dikirim ke bank induk.", body.Radius)
 		response["bank_type"] = "parent_bank"
+	} else {
+		response["message"] = "Belum ada bank yang melayani lokasi ini"
+		response["bank_type"] = ""
 	}
 
 	return helpers.Response(c, fiber.StatusOK, "Success", "Nearby banks check completed", response, nil)
 }
 
+// nearestParentBank - bank induk terdekat yang sudah mengisi koordinat, nil jika tidak ada
+func nearestParentBank(latitude, longitude float64) (*models.ParentBank, error) {
+	var parentBanks []models.ParentBank
+	if err := configs.DB.Where("latitude IS NOT NULL AND longitude IS NOT NULL").Find(&parentBanks).Error; err != nil {
+		return nil, err
+	}
+
+	var nearest *models.ParentBank
+	nearestDistance := math.Inf(1)
+	for i := range parentBanks {
+		distance := helpers.CalculateDistance(latitude, longitude, *parentBanks[i].Latitude, *parentBanks[i].Longitude)
+		if distance < nearestDistance {
+			nearest, nearestDistance = &parentBanks[i], distance
+		}
+	}
+	return nearest, nil
+}
+
 // CreatePickupRequest - Create pickup request dimana user memilih bank (child bank atau parent bank)
 func CreatePickupRequest(c *fiber.Ctx) error {
 	var body struct {
@@ -106,21 +154,28 @@ func CreatePickupRequest(c *fiber.Ctx) error {
 		Longitude    float64 `json:"longitude"`
 		ChildBankID  *uint   `json:"child_bank_id"`  // Optional - user pilih salah satu
 		ParentBankID *uint   `json:"parent_bank_id"` // Optional - user pilih salah satu
+		pickupScheduleRequest
+		Notes string              `json:"notes"`
+		Items []PickupItemRequest `json:"items"` // perkiraan sampah, optional
 	}
 
 	if err := c.BodyParser(&body); err != nil {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Failed to read body: "+err.Error(), nil, nil)
 	}
 
+	// user_id dibatasi sesuai scope user yang login, kosong berarti diri sendiri
+	scopedUserID, err := helpers.ResolveUserID(c, body.UserID)
+	if err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	body.UserID = scopedUserID
+
 	// Validasi required fields
 	if body.UserID == 0 || body.Latitude == 0 || body.Longitude == 0 {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "User ID and coordinates are required", nil, nil)
 	}
 
-	// Validasi: user harus pilih salah satu, child bank ATAU parent bank
-	if body.ChildBankID == nil && body.ParentBankID == nil {
-		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Either child_bank_id or parent_bank_id is required", nil, nil)
-	}
+	// Validasi: user pilih salah satu, child bank ATAU parent bank
 	if body.ChildBankID != nil && body.ParentBankID != nil {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Cannot specify both child_bank_id and parent_bank_id", nil, nil)
 	}
@@ -133,6 +188,24 @@ func CreatePickupRequest(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid longitude value", nil, nil)
 	}
 
+	if body.ChildBankID == nil && body.ParentBankID == nil {
+		// Tanpa pilihan bank, pakai bank yang wilayah layanannya mencakup lokasi
+		bank, err := helpers.ResolveServiceBank(configs.DB, body.Latitude, body.Longitude)
+		if err != nil {
+			if errors.Is(err, helpers.ErrNoServiceArea) {
+				return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Either child_bank_id or parent_bank_id is required, no bank service area covers this location", nil, nil)
+			}
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to find service area bank", nil, nil)
+		}
+		body.ChildBankID, body.ParentBankID = bank.ChildBankID, bank.ParentBankID
+	} else {
+		// Bank yang sudah menggambar wilayah hanya menerima penjemputan di dalam wilayahnya
+		covered, err := helpers.BankCoversPoint(configs.DB, helpers.InventoryBank{ParentBankID: body.ParentBankID, ChildBankID: body.ChildBankID}, body.Latitude, body.Longitude)
+		if err == nil && !covered {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Pickup location is outside the selected bank service area", nil, nil)
+		}
+	}
+
 	// Start transaction
 	tx := configs.DB.Begin()
 	defer func() {
@@ -179,8 +252,24 @@ func CreatePickupRequest(c *fiber.Ctx) error {
 		ParentBankID: body.ParentBankID,
 		Latitude:     body.Latitude,
 		Longitude:    body.Longitude,
-		Status:       "pending",
+		Status:       models.PickupStatusPending,
+		Notes:        strings.TrimSpace(body.Notes),
+	}
+
+	// Jadwal optional untuk client lama, jika diisi slot dicek kapasitasnya
+	if !body.pickupScheduleRequest.empty() {
+		if err := applyPickupSchedule(tx, &pickupRequest, body.pickupScheduleRequest); err != nil {
+			tx.Rollback()
+			return pickupErrorResponse(c, err)
+		}
+	}
+
+	items, err := buildPickupItems(tx, body.Items)
+	if err != nil {
+		tx.Rollback()
+		return pickupErrorResponse(c, err)
 	}
+	pickupRequest.EstimatedItems = items
 
 	if err := tx.Create(&pickupRequest).Error; err != nil {
 		tx.Rollback()
@@ -194,11 +283,8 @@ func CreatePickupRequest(c *fiber.Ctx) error {
 	}
 
 	// Preload relations untuk response
-	if err := configs.DB.
-		Preload("User").
-		Preload("ChildBank").
+	if err := pickupPreloads(configs.DB).
 		Preload("ChildBank.ParentBank").
-		Preload("ParentBank").
 		First(&pickupRequest, pickupRequest.Id).Error; err != nil {
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to load pickup request data", nil, nil)
 	}
@@ -228,27 +314,52 @@ func getPickupSuccessMessage(bankType string, bank interface{}) string {
 	return "Request penjemputan berhasil dikirim"
 }
 
-// GetPickupRequests - Get pickup requests with optional filters (user_id untuk child bank, parent_bank_id untuk parent bank)
+// GetPickupRequests - Get pickup requests with optional filters (user_id untuk child bank, parent_bank_id untuk parent bank).
+// ?collector=me untuk petugas penjemput, ?status=&pickup_date=YYYY-MM-DD&slot_id=
 func GetPickupRequests(c *fiber.Ctx) error {
 	userID := c.Query("user_id")
 	parentBankID := c.Query("parent_bank_id")
+	collector := c.Query("collector")
 
-	query := configs.DB.
-		Preload("User").
-		Preload("User.Role").
-		Preload("ChildBank").
-		Preload("ParentBank").
+	query := pickupPreloads(configs.DB).
 		Where("deleted_at IS NULL")
 
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if pickupDate := c.Query("pickup_date"); pickupDate != "" {
+		date, err := parseDate(pickupDate)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid pickup_date format, use YYYY-MM-DD", nil, nil)
+		}
+		query = query.Where("pickup_date = ?", date.Format("2006-01-02"))
+	}
+	if slotID := c.Query("slot_id"); slotID != "" {
+		query = query.Where("slot_id = ?", slotID)
+	}
+
+	// Petugas melihat request yang ditugaskan kepadanya
+	if collector == "me" {
+		query = query.Where("collector_id = ?", helpers.AuthUser(c).Id)
+	}
+
 	// Filter by user_id (untuk child bank)
 	if userID != "" {
+		userIDUint, err := strconv.ParseUint(userID, 10, 32)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid user ID format", nil, nil)
+		}
+		if err := helpers.ScopeUser(c, uint(userIDUint)); err != nil {
+			return helpers.ScopeResponse(c, err)
+		}
+
 		// Cari user untuk mendapatkan child_bank_id
 		var user models.User
 		result := configs.DB.
 			Select("id", "child_bank_id").
 			Where("id = ? AND deleted_at IS NULL", userID).
 			First(&user)
-		
+
 		if result.Error != nil {
 			if result.Error == gorm.ErrRecordNotFound {
 				return helpers.Response(c, 404, "Failed", "User not found", nil, nil)
@@ -266,12 +377,24 @@ func GetPickupRequests(c *fiber.Ctx) error {
 
 	// Filter by parent_bank_id (untuk parent bank)
 	if parentBankID != "" {
+		parentBankIDUint, err := strconv.ParseUint(parentBankID, 10, 32)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid parent bank ID format", nil, nil)
+		}
+		scopedParentBankID := uint(parentBankIDUint)
+		if err := helpers.ScopeBank(c, &scopedParentBankID, nil); err != nil {
+			return helpers.ScopeResponse(c, err)
+		}
+
 		query = query.Where("parent_bank_id = ?", parentBankID)
 	}
 
-	// Jika tidak ada filter, return semua data
+	// Jika tidak ada filter, admin melihat semua data dan user lain hanya request miliknya
+	if userID == "" && parentBankID == "" && collector != "me" && !helpers.HasRole(c, models.RoleAdmin) {
+		query = query.Where("user_id = ?", helpers.AuthUser(c).Id)
+	}
 	var pickupRequests []models.PickupRequest
-	result := query.Find(&pickupRequests)
+	result := query.Order("pickup_date IS NULL, pickup_date ASC, window_start ASC, id DESC").Find(&pickupRequests)
 	if result.Error != nil {
 		return helpers.Response(c, 500, "Failed", "Failed to fetch pickup requests", nil, nil)
 	}
@@ -282,94 +405,85 @@ func GetPickupRequests(c *fiber.Ctx) error {
 
 	return helpers.Response(c, 200, "Success", "Pickup requests retrieved successfully", pickupRequests, nil)
 }
+
+// UpdatePickupRequestStatus - perpindahan status oleh operator bank (confirm, reject, complete) atau
+// petugas yang ditunjuk (on_the_way, complete), mengikuti alur di models.PickupRequest.CanTransitionTo.
+// Body optional {"bank_note": "..."}.
 func UpdatePickupRequestStatus(c *fiber.Ctx) error {
-    id := c.Params("id_request")
-    status := c.Params("status") // "confirm", "reject", or "complete"
-
-    // Validate status
-    if status != "confirm" && status != "reject" && status != "complete" {
-        return helpers.Response(c, 400, "Failed", "Invalid status. Use 'confirm', 'reject' or 'complete'", nil, nil)
-    }
-
-    var pickupRequest models.PickupRequest
-    result := configs.DB.
-        Preload("User").
-        Preload("User.Role").
-        Preload("ChildBank").
-        Preload("ParentBank").
-        Where("id = ? AND deleted_at IS NULL", id).
-        First(&pickupRequest)
-    
-    if result.Error != nil {
-        if result.Error == gorm.ErrRecordNotFound {
-            return helpers.Response(c, 404, "Failed", "Pickup request not found", nil, nil)
-        }
-        return helpers.Response(c, 500, "Failed", "Failed to fetch pickup request", nil, nil)
-    }
-
-    targetStatus := status
-    message := status
-
-    // Mapping untuk response message yang lebih user-friendly
-    if status == "confirm" {
-        message = "confirm" // Tetap "confirm" untuk response
-    }
-
-    // Cek jika status sudah sama
-    if pickupRequest.Status == targetStatus {
-        return helpers.Response(c, 400, "Failed", fmt.Sprintf("Pickup request already %sed", message), nil, nil)
-    }
-
-    // Validasi status transition
-    switch status {
-    case "confirm":
-        if pickupRequest.Status != "pending" {
-            return helpers.Response(c, 400, "Failed", "Can only confirm pending pickup requests", nil, nil)
-        }
-    case "reject":
-        if pickupRequest.Status != "pending" {
-            return helpers.Response(c, 400, "Failed", "Can only reject pending pickup requests", nil, nil)
-        }
-    case "complete":
-        if pickupRequest.Status != "confirm" {
-            return helpers.Response(c, 400, "Failed", "Can only complete confirmed pickup requests", nil, nil)
-        }
-    }
-
-    // Update status
-    result = configs.DB.Model(&pickupRequest).Updates(map[string]interface{}{
-        "status":     targetStatus,
-        "updated_at": time.Now(),
-    })
-    
-    if result.Error != nil {
-        fmt.Printf("Database error: %v\n", result.Error)
-        return helpers.Response(c, 500, "Failed", fmt.Sprintf("Failed to %s pickup request", message), nil, nil)
-    }
-
-    if result.RowsAffected == 0 {
-        return helpers.Response(c, 500, "Failed", "No rows affected", nil, nil)
-    }
-
-    // Reload data untuk response
-    var updatedPickupRequest models.PickupRequest
-    result = configs.DB.
-        Preload("User").
-        Preload("User.Role").
-        Preload("ChildBank").
-        Preload("ParentBank").
-        Where("id = ?", id).
-        First(&updatedPickupRequest)
-
-    if result.Error != nil {
-        return helpers.Response(c, 500, "Failed", "Failed to fetch updated pickup request data", nil, nil)
-    }
-
-    // Response message yang konsisten dengan "confirm"
-    responseMessage := fmt.Sprintf("Pickup request %sed successfully", message)
-    if message == "confirm" {
-        responseMessage = "Pickup request confirmed successfully"
-    }
-
-    return helpers.Response(c, 200, "Success", responseMessage, updatedPickupRequest, nil)
-}
\ No newline at end of file
+	id := c.Params("id_request")
+	status := c.Params("status")
+
+	// Selesai selalu lewat pencatatan setoran hasil timbang
+	if status == models.PickupStatusCompleted {
+		return completePickupRequest(c, id)
+	}
+
+	var body struct {
+		BankNote string `json:"bank_note"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+		}
+	}
+
+	switch status {
+	case models.PickupStatusConfirmed, models.PickupStatusRejected, models.PickupStatusOnTheWay, models.PickupStatusCompleted:
+	default:
+		return helpers.Response(c, 400, "Failed", "Invalid status. Use 'confirm', 'reject', 'on_the_way' or 'complete'", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+
+	var pickupRequest models.PickupRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&pickupRequest).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			return helpers.Response(c, 404, "Failed", "Pickup request not found", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to fetch pickup request", nil, nil)
+	}
+
+	// Petugas yang ditunjuk boleh memulai dan menyelesaikan penjemputannya sendiri
+	authUser := helpers.AuthUser(c)
+	isCollector := authUser != nil && pickupRequest.CollectorID != nil && *pickupRequest.CollectorID == authUser.Id &&
+		status == models.PickupStatusOnTheWay
+	if !isCollector {
+		if err := scopePickupBank(c, &pickupRequest); err != nil {
+			tx.Rollback()
+			return helpers.ScopeResponse(c, err)
+		}
+	}
+
+	if !pickupRequest.CanTransitionTo(status) {
+		tx.Rollback()
+		return helpers.Response(c, 409, "Failed", fmt.Sprintf("Cannot change pickup request status from %s to %s", pickupRequest.Status, status), nil, nil)
+	}
+
+	updates := map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}
+	if note := strings.TrimSpace(body.BankNote); note != "" {
+		updates["bank_note"] = note
+	}
+
+	// Update kondisional supaya perubahan status paralel tidak saling menimpa
+	result := tx.Model(&models.PickupRequest{}).
+		Where("id = ? AND status = ?", pickupRequest.Id, pickupRequest.Status).
+		Updates(updates)
+	if result.Error != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to update pickup request status", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return helpers.Response(c, 409, "Failed", "Pickup request status has changed, please reload", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondPickup(c, pickupRequest.Id, fmt.Sprintf("Pickup request status updated to %s", status))
+}
@@ -0,0 +1,256 @@
+package pickuprequest
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// pickupRouteStatuses - penjemputan yang sudah disetujui bank dan belum selesai
+var pickupRouteStatuses = []string{models.PickupStatusConfirmed, models.PickupStatusAssigned, models.PickupStatusOnTheWay}
+
+type pickupRouteRequest struct {
+	ParentBankID *uint  `query:"parent_bank_id"`
+	ChildBankID  *uint  `query:"child_bank_id"`
+	Date         string `query:"date"`         // YYYY-MM-DD, default hari ini
+	CollectorID  uint   `query:"collector_id"` // kosong: semua penjemputan bank (operator) atau milik sendiri (petugas)
+	StartTime    string `query:"start_time"`   // HH:MM jam berangkat dari bank
+}
+
+// PickupRouteStop - satu titik kunjungan pada rute
+type PickupRouteStop struct {
+	Sequence             int       `json:"sequence"`
+	PickupRequestID      uint      `json:"pickup_request_id"`
+	Status               string    `json:"status"`
+	UserID               uint      `json:"user_id"`
+	UserName             string    `json:"user_name"`
+	UserPhone            string    `json:"user_phone"`
+	Address              string    `json:"address"`
+	Notes                string    `json:"notes"`
+	Latitude             float64   `json:"latitude"`
+	Longitude            float64   `json:"longitude"`
+	CollectorID          *uint     `json:"collector_id"`
+	WindowStart          string    `json:"window_start"`
+	WindowEnd            string    `json:"window_end"`
+	LegDistanceKm        float64   `json:"leg_distance_km"`
+	CumulativeDistanceKm float64   `json:"cumulative_distance_km"`
+	TravelMinutes        float64   `json:"travel_minutes"`
+	EstimatedArrival     time.Time `json:"estimated_arrival"`
+	EstimatedDeparture   time.Time `json:"estimated_departure"`
+	OutsideWindow        bool      `json:"outside_window"` // perkiraan tiba di luar jam yang diminta user
+}
+
+// GetPickupRoute - urutan kunjungan penjemputan untuk satu bank, tanggal dan petugas. Rute berangkat
+// dan kembali ke koordinat bank, diurutkan dengan nearest neighbour lalu 2-opt.
+// ?parent_bank_id=|child_bank_id=&date=YYYY-MM-DD&collector_id=&start_time=HH:MM
+func GetPickupRoute(c *fiber.Ctx) error {
+	var req pickupRouteRequest
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid query parameters", nil, nil)
+	}
+	if req.ParentBankID != nil && req.ChildBankID != nil {
+		return slotErrorResponse(c, errBothBanks)
+	}
+
+	authUser := helpers.AuthUser(c)
+	if authUser == nil {
+		return helpers.Response(c, fiber.StatusUnauthorized, "Failed", "Unauthorized", nil, nil)
+	}
+
+	// Bank default: bank operator yang login, atau bank tempat petugas terdaftar
+	bank := helpers.InventoryBank{ParentBankID: req.ParentBankID, ChildBankID: req.ChildBankID}
+	if bank.Key() == "" {
+		bank = operatorBank(c)
+	}
+	if bank.Key() == "" && !helpers.HasRole(c, models.RoleAdmin) {
+		if authUser.ChildBankID != nil {
+			bank = helpers.InventoryBank{ChildBankID: authUser.ChildBankID}
+		} else if authUser.ParentBankID != nil {
+			bank = helpers.InventoryBank{ParentBankID: authUser.ParentBankID}
+		}
+	}
+	if bank.Key() == "" {
+		return slotErrorResponse(c, errBankRequired)
+	}
+
+	// Operator bank melihat rute petugas mana pun, petugas hanya rutenya sendiri
+	if !isBankOperator(c, bank) {
+		if req.CollectorID != 0 && req.CollectorID != authUser.Id {
+			return helpers.ScopeResponse(c, helpers.ErrForbidden)
+		}
+		req.CollectorID = authUser.Id
+	}
+
+	date := today()
+	if req.Date != "" {
+		parsed, err := parseDate(req.Date)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "date must use YYYY-MM-DD format", nil, nil)
+		}
+		date = parsed
+	}
+
+	settings := helpers.RouteSettingsFromEnv()
+	startAt := date.Add(settings.StartAt)
+	if req.StartTime != "" {
+		start, err := time.Parse("15:04", req.StartTime)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "start_time must use HH:MM format", nil, nil)
+		}
+		startAt = date.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+	} else if now := time.Now(); date.Equal(today()) && now.After(startAt) {
+		// Rute hari ini yang diminta setelah jam berangkat dihitung dari sekarang
+		startAt = now.Truncate(time.Minute)
+	}
+
+	depot, err := bankRoutePoint(bank)
+	if err != nil {
+		if errors.Is(err, errBankCoordinates) {
+			return helpers.Response(c, fiber.StatusUnprocessableEntity, "Failed", err.Error(), nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Bank not found", nil, nil)
+	}
+
+	query := configs.DB.Preload("User").
+		Where("status IN ?", pickupRouteStatuses).
+		Where("pickup_date = ?", date.Format("2006-01-02"))
+	if bank.ChildBankID != nil {
+		query = query.Where("child_bank_id = ?", *bank.ChildBankID)
+	} else {
+		query = query.Where("parent_bank_id = ? AND child_bank_id IS NULL", *bank.ParentBankID)
+	}
+	if req.CollectorID != 0 {
+		query = query.Where("collector_id = ?", req.CollectorID)
+	}
+
+	var pickups []models.PickupRequest
+	if err := query.Order("id ASC").Find(&pickups).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch pickup requests", nil, nil)
+	}
+	if len(pickups) > settings.MaxStops {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Too many pickups for one route, filter by collector_id", nil, nil)
+	}
+
+	points := make([]helpers.RoutePoint, len(pickups))
+	for i, pickup := range pickups {
+		points[i] = helpers.RoutePoint{Latitude: pickup.Latitude, Longitude: pickup.Longitude}
+	}
+	order := helpers.OptimizeRoute(depot, points)
+
+	stops := make([]PickupRouteStop, 0, len(order))
+	previous := depot
+	clock := startAt
+	var totalDistance float64
+	for sequence, index := range order {
+		pickup := pickups[index]
+		point := points[index]
+
+		leg := settings.DistanceKm(previous, point)
+		travel := settings.TravelTime(leg)
+		totalDistance += leg
+		arrival := clock.Add(travel)
+		departure := arrival.Add(settings.StopTime())
+
+		stops = append(stops, PickupRouteStop{
+			Sequence:             sequence + 1,
+			PickupRequestID:      pickup.Id,
+			Status:               pickup.Status,
+			UserID:               pickup.UserID,
+			UserName:             pickup.User.Name,
+			UserPhone:            pickup.User.Phone,
+			Address:              pickup.User.Address,
+			Notes:                pickup.Notes,
+			Latitude:             pickup.Latitude,
+			Longitude:            pickup.Longitude,
+			CollectorID:          pickup.CollectorID,
+			WindowStart:          pickup.WindowStart,
+			WindowEnd:            pickup.WindowEnd,
+			LegDistanceKm:        roundKm(leg),
+			CumulativeDistanceKm: roundKm(totalDistance),
+			TravelMinutes:        math.Round(travel.Minutes()*10) / 10,
+			EstimatedArrival:     arrival,
+			EstimatedDeparture:   departure,
+			OutsideWindow:        outsideWindow(date, arrival, pickup.WindowStart, pickup.WindowEnd),
+		})
+
+		previous = point
+		clock = departure
+	}
+
+	// Kembali ke bank setelah titik terakhir
+	returnDistance := 0.0
+	if len(stops) > 0 {
+		returnDistance = settings.DistanceKm(previous, depot)
+		totalDistance += returnDistance
+		clock = clock.Add(settings.TravelTime(returnDistance))
+	}
+
+	return helpers.Response(c, fiber.StatusOK, "Success", "Pickup route generated successfully", fiber.Map{
+		"bank": fiber.Map{
+			"parent_bank_id": bank.ParentBankID,
+			"child_bank_id":  bank.ChildBankID,
+			"latitude":       depot.Latitude,
+			"longitude":      depot.Longitude,
+		},
+		"date":                   date.Format("2006-01-02"),
+		"collector_id":           req.CollectorID,
+		"stops":                  stops,
+		"stop_count":             len(stops),
+		"return_distance_km":     roundKm(returnDistance),
+		"total_distance_km":      roundKm(totalDistance),
+		"start_at":               startAt,
+		"finish_at":              clock,
+		"total_duration_minutes": math.Round(clock.Sub(startAt).Minutes()),
+		"assumptions": fiber.Map{
+			"speed_kmh":    settings.SpeedKmh,
+			"stop_minutes": settings.StopMinutes,
+			"road_factor":  settings.RoadFactor,
+		},
+	}, nil)
+}
+
+var errBankCoordinates = errors.New("bank coordinates are not set, update the bank latitude and longitude first")
+
+// bankRoutePoint - koordinat bank sebagai titik awal dan akhir rute
+func bankRoutePoint(bank helpers.InventoryBank) (helpers.RoutePoint, error) {
+	if bank.ChildBankID != nil {
+		var childBank models.ChildBank
+		if err := configs.DB.First(&childBank, *bank.ChildBankID).Error; err != nil {
+			return helpers.RoutePoint{}, err
+		}
+		return helpers.RoutePoint{Latitude: childBank.Latitude, Longitude: childBank.Longitude}, nil
+	}
+
+	var parentBank models.ParentBank
+	if err := configs.DB.First(&parentBank, *bank.ParentBankID).Error; err != nil {
+		return helpers.RoutePoint{}, err
+	}
+	if parentBank.Latitude == nil || parentBank.Longitude == nil {
+		return helpers.RoutePoint{}, errBankCoordinates
+	}
+	return helpers.RoutePoint{Latitude: *parentBank.Latitude, Longitude: *parentBank.Longitude}, nil
+}
+
+// outsideWindow - true jika perkiraan tiba sebelum atau sesudah jam yang diminta user
+func outsideWindow(date, arrival time.Time, windowStart, windowEnd string) bool {
+	if windowStart == "" || windowEnd == "" {
+		return false
+	}
+	start, errStart := time.Parse("15:04", windowStart)
+	end, errEnd := time.Parse("15:04", windowEnd)
+	if errStart != nil || errEnd != nil {
+		return false
+	}
+	from := date.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+	until := date.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute)
+	return arrival.Before(from) || arrival.After(until)
+}
+
+func roundKm(distance float64) float64 {
+	return math.Round(distance*100) / 100
+}
@@ -0,0 +1,367 @@
+package pickuprequest
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pickupScheduleRequest - jadwal penjemputan: slot bank, atau tanggal dan jam yang diminta user
+type pickupScheduleRequest struct {
+	SlotID      *uint  `json:"slot_id"`
+	PickupDate  string `json:"pickup_date"`  // YYYY-MM-DD, dipakai jika tanpa slot
+	WindowStart string `json:"window_start"` // HH:MM
+	WindowEnd   string `json:"window_end"`
+}
+
+func (req pickupScheduleRequest) empty() bool {
+	return req.SlotID == nil && req.PickupDate == "" && req.WindowStart == "" && req.WindowEnd == ""
+}
+
+// PickupItemRequest - perkiraan sampah yang akan dijemput
+type PickupItemRequest struct {
+	ProductWasteID  uint    `json:"product_waste_id"`
+	EstimatedWeight float64 `json:"estimated_weight"`
+	Unit            string  `json:"unit"`
+}
+
+var errPickupSchedule = errors.New("invalid pickup schedule")
+
+// applyPickupSchedule memesan slot (dengan cek kapasitas) atau menyimpan tanggal/jam permintaan user
+func applyPickupSchedule(tx *gorm.DB, pickup *models.PickupRequest, req pickupScheduleRequest) error {
+	bank := helpers.InventoryBank{ParentBankID: pickup.ParentBankID, ChildBankID: pickup.ChildBankID}
+
+	if req.SlotID != nil {
+		slot, err := bookPickupSlot(tx, *req.SlotID, bank, pickup.Id)
+		if err != nil {
+			return err
+		}
+		date := slot.Date
+		pickup.SlotID = &slot.Id
+		pickup.PickupDate = &date
+		pickup.WindowStart = slot.StartTime
+		pickup.WindowEnd = slot.EndTime
+		return nil
+	}
+
+	if req.PickupDate == "" {
+		return fmt.Errorf("%w: slot_id or pickup_date is required", errPickupSchedule)
+	}
+	date, err := parseDate(req.PickupDate)
+	if err != nil {
+		return fmt.Errorf("%w: pickup_date must use YYYY-MM-DD format", errPickupSchedule)
+	}
+	if date.Before(today()) {
+		return fmt.Errorf("%w: pickup_date cannot be in the past", errPickupSchedule)
+	}
+	if req.WindowStart != "" || req.WindowEnd != "" {
+		if err := validateWindow(req.WindowStart, req.WindowEnd); err != nil {
+			return fmt.Errorf("%w: %s", errPickupSchedule, err.Error())
+		}
+	}
+
+	pickup.SlotID = nil
+	pickup.PickupDate = &date
+	pickup.WindowStart = req.WindowStart
+	pickup.WindowEnd = req.WindowEnd
+	return nil
+}
+
+// buildPickupItems memvalidasi perkiraan item, satuan kosong memakai satuan produk
+func buildPickupItems(tx *gorm.DB, items []PickupItemRequest) ([]models.PickupRequestItem, error) {
+	var result []models.PickupRequestItem
+	for i, item := range items {
+		if item.EstimatedWeight <= 0 {
+			return nil, fmt.Errorf("%w: estimated_weight at index %d must be greater than 0", errPickupSchedule, i)
+		}
+		var product models.ProductWaste
+		if err := tx.First(&product, item.ProductWasteID).Error; err != nil {
+			return nil, fmt.Errorf("%w: product waste not found at index %d", errPickupSchedule, i)
+		}
+
+		unit := product.Unit
+		if strings.TrimSpace(item.Unit) != "" {
+			normalized, err := helpers.NormalizeWasteUnit(item.Unit)
+			if err != nil {
+				return nil, fmt.Errorf("%w: item %d: %s", errPickupSchedule, i, err.Error())
+			}
+			unit = normalized
+		}
+
+		result = append(result, models.PickupRequestItem{
+			ProductWasteID:  product.Id,
+			EstimatedWeight: item.EstimatedWeight,
+			Unit:            unit,
+		})
+	}
+	return result, nil
+}
+
+// ReschedulePickupRequest - user pemilik request memindah jadwal. Request kembali menunggu konfirmasi
+// bank dan petugas yang sudah ditunjuk dilepas.
+func ReschedulePickupRequest(c *fiber.Ctx) error {
+	var body pickupScheduleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+	if body.empty() {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "slot_id or pickup_date is required", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+
+	pickup, err := lockPickupRequest(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return pickupErrorResponse(c, err)
+	}
+	if err := helpers.ScopeSelf(c, pickup.UserID); err != nil {
+		tx.Rollback()
+		return helpers.ScopeResponse(c, err)
+	}
+	switch pickup.Status {
+	case models.PickupStatusPending, models.PickupStatusConfirmed, models.PickupStatusAssigned:
+	default:
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusConflict, "Failed", fmt.Sprintf("Cannot reschedule a pickup request with status %s", pickup.Status), nil, nil)
+	}
+
+	if err := applyPickupSchedule(tx, pickup, body); err != nil {
+		tx.Rollback()
+		return pickupErrorResponse(c, err)
+	}
+
+	err = tx.Model(&models.PickupRequest{}).Where("id = ?", pickup.Id).Updates(map[string]any{
+		"slot_id":          pickup.SlotID,
+		"pickup_date":      pickup.PickupDate,
+		"window_start":     pickup.WindowStart,
+		"window_end":       pickup.WindowEnd,
+		"status":           models.PickupStatusPending,
+		"collector_id":     nil,
+		"assigned_at":      nil,
+		"reschedule_count": gorm.Expr("reschedule_count + 1"),
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to reschedule pickup request", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondPickup(c, pickup.Id, "Pickup request rescheduled successfully")
+}
+
+// CancelPickupRequest - dibatalkan oleh user pemilik request atau operator bank tujuan sebelum
+// petugas berangkat. Kapasitas slot otomatis kembali.
+func CancelPickupRequest(c *fiber.Ctx) error {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+		}
+	}
+
+	tx := configs.DB.Begin()
+
+	pickup, err := lockPickupRequest(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return pickupErrorResponse(c, err)
+	}
+	if helpers.ScopeSelf(c, pickup.UserID) != nil {
+		if err := scopePickupBank(c, pickup); err != nil {
+			tx.Rollback()
+			return helpers.ScopeResponse(c, err)
+		}
+	}
+	if !pickup.CanTransitionTo(models.PickupStatusCancelled) {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusConflict, "Failed", fmt.Sprintf("Cannot cancel a pickup request with status %s", pickup.Status), nil, nil)
+	}
+
+	now := time.Now()
+	err = tx.Model(&models.PickupRequest{}).Where("id = ?", pickup.Id).Updates(map[string]any{
+		"status":        models.PickupStatusCancelled,
+		"cancel_reason": strings.TrimSpace(body.Reason),
+		"cancelled_at":  &now,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to cancel pickup request", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondPickup(c, pickup.Id, "Pickup request cancelled successfully")
+}
+
+// AssignPickupCollector - operator bank menunjuk petugas penjemput (user yang terdaftar di bank
+// tujuan atau bank induknya). Bisa dipanggil ulang untuk mengganti petugas.
+func AssignPickupCollector(c *fiber.Ctx) error {
+	var body struct {
+		CollectorID uint   `json:"collector_id"`
+		BankNote    string `json:"bank_note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+	if body.CollectorID == 0 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "collector_id is required", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+
+	pickup, err := lockPickupRequest(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return pickupErrorResponse(c, err)
+	}
+	if err := scopePickupBank(c, pickup); err != nil {
+		tx.Rollback()
+		return helpers.ScopeResponse(c, err)
+	}
+	if !pickup.CanTransitionTo(models.PickupStatusAssigned) {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusConflict, "Failed", fmt.Sprintf("Cannot assign a collector to a pickup request with status %s", pickup.Status), nil, nil)
+	}
+
+	if err := validateCollector(tx, pickup, body.CollectorID); err != nil {
+		tx.Rollback()
+		return pickupErrorResponse(c, err)
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"status":       models.PickupStatusAssigned,
+		"collector_id": body.CollectorID,
+		"assigned_at":  &now,
+	}
+	if note := strings.TrimSpace(body.BankNote); note != "" {
+		updates["bank_note"] = note
+	}
+	if err := tx.Model(&models.PickupRequest{}).Where("id = ?", pickup.Id).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to assign collector", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondPickup(c, pickup.Id, "Collector assigned successfully")
+}
+
+var (
+	errCollectorNotFound = errors.New("collector not found")
+	errCollectorBank     = errors.New("collector is not registered under the pickup bank")
+	errPickupNotFound    = errors.New("pickup request not found")
+)
+
+// validateCollector - petugas harus user aktif di bank unit/induk tujuan, atau di bank induk dari
+// bank unit tujuan, atau di bank unit di bawah bank induk tujuan
+func validateCollector(tx *gorm.DB, pickup *models.PickupRequest, collectorID uint) error {
+	var collector models.User
+	if err := tx.Preload("ChildBank").First(&collector, collectorID).Error; err != nil {
+		return errCollectorNotFound
+	}
+	if collector.Status == "inactive" {
+		return errCollectorNotFound
+	}
+
+	parentBankID := pickup.ParentBankID
+	if pickup.ChildBankID != nil {
+		if collector.ChildBankID != nil && *collector.ChildBankID == *pickup.ChildBankID {
+			return nil
+		}
+		var childBank models.ChildBank
+		if err := tx.Select("id", "parent_bank_id").First(&childBank, *pickup.ChildBankID).Error; err != nil {
+			return err
+		}
+		parentBankID = &childBank.ParentBankID
+	}
+	if parentBankID == nil {
+		return errCollectorBank
+	}
+
+	if collector.ParentBankID != nil && *collector.ParentBankID == *parentBankID {
+		return nil
+	}
+	if pickup.ChildBankID == nil && collector.ChildBank != nil && collector.ChildBank.ParentBankID == *parentBankID {
+		return nil
+	}
+	return errCollectorBank
+}
+
+// lockPickupRequest mengambil request dengan FOR UPDATE
+func lockPickupRequest(c *fiber.Ctx, tx *gorm.DB) (*models.PickupRequest, error) {
+	var pickup models.PickupRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pickup, c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errPickupNotFound
+		}
+		return nil, err
+	}
+	return &pickup, nil
+}
+
+func scopePickupBank(c *fiber.Ctx, pickup *models.PickupRequest) error {
+	if !helpers.HasRole(c, models.RoleAdmin, models.RoleParentBank, models.RoleChildBank) {
+		return helpers.ErrForbidden
+	}
+	return helpers.ScopeBank(c, pickup.ParentBankID, pickup.ChildBankID)
+}
+
+func pickupErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errPickupNotFound):
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Pickup request not found", nil, nil)
+	case errors.Is(err, errPickupSchedule):
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, errCollectorNotFound):
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Collector not found", nil, nil)
+	case errors.Is(err, errCollectorBank):
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Collector is not registered under the pickup bank", nil, nil)
+	case errors.Is(err, errSlotFull), errors.Is(err, errSlotUnavailable), errors.Is(err, errSlotBank):
+		return slotErrorResponse(c, err)
+	}
+	return helpers.ScopeResponse(c, err)
+}
+
+func respondPickup(c *fiber.Ctx, id uint, message string) error {
+	var pickup models.PickupRequest
+	if err := pickupPreloads(configs.DB).First(&pickup, id).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to load pickup request data", nil, nil)
+	}
+	// Semua perubahan penjemputan lewat sini, teruskan ke stream user
+	publishPickupStatus(&pickup)
+	return helpers.Response(c, fiber.StatusOK, "Success", message, pickup, nil)
+}
+
+func pickupPreloads(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("User").
+		Preload("User.Role").
+		Preload("ChildBank").
+		Preload("ParentBank").
+		Preload("Slot").
+		Preload("Collector").
+		Preload("EstimatedItems").
+		Preload("EstimatedItems.ProductWaste", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("WasteDeposit").
+		Preload("WasteDeposit.Items").
+		Preload("WasteDeposit.Items.ProductWaste", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+}
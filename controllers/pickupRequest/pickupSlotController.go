@@ -0,0 +1,436 @@
+package pickuprequest
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rentang tanggal maksimal sekali buat slot
+const maxSlotRangeDays = 62
+
+type pickupSlotWindow struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	Capacity  int    `json:"capacity"`
+}
+
+// CreatePickupSlots - bank membuka slot penjemputan untuk rentang tanggal. Setiap tanggal (yang harinya
+// ada di weekdays, 0 = Minggu; kosong = setiap hari) mendapat semua windows. Slot yang sudah ada dilewati.
+// Tanpa parent_bank_id/child_bank_id berarti bank milik operator yang login.
+func CreatePickupSlots(c *fiber.Ctx) error {
+	var body struct {
+		ParentBankID *uint              `json:"parent_bank_id"`
+		ChildBankID  *uint              `json:"child_bank_id"`
+		StartDate    string             `json:"start_date"`
+		EndDate      string             `json:"end_date"` // kosong = start_date saja
+		Weekdays     []int              `json:"weekdays"`
+		Windows      []pickupSlotWindow `json:"windows"`
+		Note         string             `json:"note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+
+	bank, err := requestBank(c, body.ParentBankID, body.ChildBankID)
+	if err != nil {
+		return slotErrorResponse(c, err)
+	}
+
+	startDate, err := parseDate(body.StartDate)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid start_date format, use YYYY-MM-DD", nil, nil)
+	}
+	endDate := startDate
+	if body.EndDate != "" {
+		if endDate, err = parseDate(body.EndDate); err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid end_date format, use YYYY-MM-DD", nil, nil)
+		}
+	}
+	if endDate.Before(startDate) {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "end_date must not be before start_date", nil, nil)
+	}
+	if endDate.Sub(startDate) > maxSlotRangeDays*24*time.Hour {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", fmt.Sprintf("Date range cannot exceed %d days", maxSlotRangeDays), nil, nil)
+	}
+	if startDate.Before(today()) {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Cannot create slots in the past", nil, nil)
+	}
+
+	if len(body.Windows) == 0 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "At least one time window is required", nil, nil)
+	}
+	for i, window := range body.Windows {
+		if err := validateWindow(window.StartTime, window.EndTime); err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", fmt.Sprintf("Window %d: %s", i, err.Error()), nil, nil)
+		}
+		if window.Capacity <= 0 {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", fmt.Sprintf("Window %d: capacity must be greater than 0", i), nil, nil)
+		}
+	}
+
+	weekdays := map[time.Weekday]bool{}
+	for _, day := range body.Weekdays {
+		if day < 0 || day > 6 {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "weekdays must be between 0 (Sunday) and 6 (Saturday)", nil, nil)
+		}
+		weekdays[time.Weekday(day)] = true
+	}
+
+	var slots []models.PickupSlot
+	for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+		if len(weekdays) > 0 && !weekdays[date.Weekday()] {
+			continue
+		}
+		for _, window := range body.Windows {
+			slots = append(slots, models.PickupSlot{
+				BankKey:      bank.Key(),
+				ParentBankID: bank.ParentBankID,
+				ChildBankID:  bank.ChildBankID,
+				Date:         date,
+				StartTime:    window.StartTime,
+				EndTime:      window.EndTime,
+				Capacity:     window.Capacity,
+				IsActive:     true,
+				Note:         strings.TrimSpace(body.Note),
+				CreatedBy:    helpers.AuthUserID(c),
+			})
+		}
+	}
+	if len(slots) == 0 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "No dates in range match the given weekdays", nil, nil)
+	}
+
+	result := configs.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&slots)
+	if result.Error != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to create pickup slots", nil, nil)
+	}
+
+	data := map[string]any{
+		"created": result.RowsAffected,
+		"skipped": int64(len(slots)) - result.RowsAffected,
+	}
+	return helpers.Response(c, fiber.StatusCreated, "Success", "Pickup slots created successfully", data, nil)
+}
+
+// GetPickupSlots - slot satu bank beserta jumlah request aktif.
+// ?child_bank_id= atau ?parent_bank_id= (operator boleh kosong = banknya sendiri)
+// &start_date=&end_date= (default hari ini sampai 14 hari ke depan)&available_only=true
+func GetPickupSlots(c *fiber.Ctx) error {
+	var req struct {
+		ParentBankID  uint   `query:"parent_bank_id"`
+		ChildBankID   uint   `query:"child_bank_id"`
+		StartDate     string `query:"start_date"`
+		EndDate       string `query:"end_date"`
+		AvailableOnly bool   `query:"available_only"`
+	}
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	// Slot bisa dilihat semua user untuk memilih jadwal, tanpa bank berarti bank operator yang login
+	var bank helpers.InventoryBank
+	switch {
+	case req.ChildBankID != 0:
+		bank.ChildBankID = &req.ChildBankID
+	case req.ParentBankID != 0:
+		bank.ParentBankID = &req.ParentBankID
+	default:
+		bank = operatorBank(c)
+	}
+	if bank.Key() == "" {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "child_bank_id or parent_bank_id is required", nil, nil)
+	}
+
+	startDate, endDate := today(), today().AddDate(0, 0, 14)
+	var err error
+	if req.StartDate != "" {
+		if startDate, err = parseDate(req.StartDate); err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid start_date format, use YYYY-MM-DD", nil, nil)
+		}
+	}
+	if req.EndDate != "" {
+		if endDate, err = parseDate(req.EndDate); err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid end_date format, use YYYY-MM-DD", nil, nil)
+		}
+	}
+
+	query := configs.DB.Where("bank_key = ? AND date BETWEEN ? AND ?", bank.Key(), startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	if !isBankOperator(c, bank) {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var slots []models.PickupSlot
+	if err := query.Order("date ASC, start_time ASC").Find(&slots).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch pickup slots", nil, nil)
+	}
+
+	if err := fillSlotBookings(configs.DB, slots); err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to count slot bookings", nil, nil)
+	}
+
+	if req.AvailableOnly {
+		available := slots[:0]
+		for _, slot := range slots {
+			if slot.IsActive && slot.Booked < slot.Capacity {
+				available = append(available, slot)
+			}
+		}
+		slots = available
+	}
+
+	return helpers.Response(c, fiber.StatusOK, "Success", "Data found", slots, nil)
+}
+
+// UpdatePickupSlot - ubah kapasitas, status aktif atau catatan slot. Kapasitas tidak boleh di bawah
+// jumlah request aktif.
+func UpdatePickupSlot(c *fiber.Ctx) error {
+	var body struct {
+		Capacity *int    `json:"capacity"`
+		IsActive *bool   `json:"is_active"`
+		Note     *string `json:"note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+
+	slot, err := lockSlot(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return slotErrorResponse(c, err)
+	}
+
+	if body.Capacity != nil {
+		if *body.Capacity <= 0 {
+			tx.Rollback()
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Capacity must be greater than 0", nil, nil)
+		}
+		if *body.Capacity < slot.Booked {
+			tx.Rollback()
+			return helpers.Response(c, fiber.StatusConflict, "Failed", fmt.Sprintf("Capacity cannot be lower than %d active bookings", slot.Booked), nil, nil)
+		}
+		slot.Capacity = *body.Capacity
+	}
+	if body.IsActive != nil {
+		slot.IsActive = *body.IsActive
+	}
+	if body.Note != nil {
+		slot.Note = strings.TrimSpace(*body.Note)
+	}
+
+	if err := tx.Save(slot).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update pickup slot", nil, nil)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return helpers.Response(c, fiber.StatusOK, "Success", "Pickup slot updated successfully", slot, nil)
+}
+
+// DeletePickupSlot - slot yang sudah pernah dipesan tidak bisa dihapus, nonaktifkan saja
+func DeletePickupSlot(c *fiber.Ctx) error {
+	tx := configs.DB.Begin()
+
+	slot, err := lockSlot(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return slotErrorResponse(c, err)
+	}
+	// Request yang sudah selesai/batal tetap menunjuk ke slot untuk riwayat
+	var used int64
+	if err := tx.Model(&models.PickupRequest{}).Unscoped().Where("slot_id = ?", slot.Id).Count(&used).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to check slot bookings", nil, nil)
+	}
+	if used > 0 {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusConflict, "Failed", "Slot has pickup requests, deactivate it instead", nil, nil)
+	}
+
+	if err := tx.Delete(slot).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to delete pickup slot", nil, nil)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return helpers.Response(c, fiber.StatusOK, "Success", "Pickup slot deleted successfully", nil, nil)
+}
+
+var (
+	errSlotUnavailable = errors.New("pickup slot is not available")
+	errSlotFull        = errors.New("pickup slot is full")
+	errSlotBank        = errors.New("pickup slot belongs to another bank")
+	errBankRequired    = errors.New("parent_bank_id or child_bank_id is required")
+	errBothBanks       = errors.New("cannot specify both parent_bank_id and child_bank_id")
+)
+
+// bookPickupSlot mengunci slot dan memastikan masih ada kapasitas untuk satu request lagi.
+// excludeRequestID dipakai saat reschedule supaya request itu sendiri tidak ikut dihitung.
+func bookPickupSlot(tx *gorm.DB, slotID uint, bank helpers.InventoryBank, excludeRequestID uint) (*models.PickupSlot, error) {
+	var slot models.PickupSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&slot, slotID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errSlotUnavailable
+		}
+		return nil, err
+	}
+	if slot.BankKey != bank.Key() {
+		return nil, errSlotBank
+	}
+	if !slot.IsActive || slot.Date.Before(today()) {
+		return nil, errSlotUnavailable
+	}
+
+	var booked int64
+	err := tx.Model(&models.PickupRequest{}).
+		Where("slot_id = ? AND status IN ? AND id <> ?", slot.Id, models.PickupActiveStatuses, excludeRequestID).
+		Count(&booked).Error
+	if err != nil {
+		return nil, err
+	}
+	if int(booked) >= slot.Capacity {
+		return nil, errSlotFull
+	}
+	slot.Booked = int(booked) + 1
+	return &slot, nil
+}
+
+func lockSlot(c *fiber.Ctx, tx *gorm.DB) (*models.PickupSlot, error) {
+	var slot models.PickupSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&slot, c.Params("id")).Error; err != nil {
+		return nil, err
+	}
+	if err := helpers.ScopeBank(c, slot.ParentBankID, slot.ChildBankID); err != nil {
+		return nil, err
+	}
+	slots := []models.PickupSlot{slot}
+	if err := fillSlotBookings(tx, slots); err != nil {
+		return nil, err
+	}
+	return &slots[0], nil
+}
+
+// fillSlotBookings mengisi jumlah request aktif per slot
+func fillSlotBookings(db *gorm.DB, slots []models.PickupSlot) error {
+	if len(slots) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(slots))
+	for i, slot := range slots {
+		ids[i] = slot.Id
+	}
+
+	var counts []struct {
+		SlotID uint
+		Total  int
+	}
+	err := db.Model(&models.PickupRequest{}).
+		Select("slot_id, COUNT(*) AS total").
+		Where("slot_id IN ? AND status IN ?", ids, models.PickupActiveStatuses).
+		Group("slot_id").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	booked := make(map[uint]int, len(counts))
+	for _, count := range counts {
+		booked[count.SlotID] = count.Total
+	}
+	for i := range slots {
+		slots[i].Booked = booked[slots[i].Id]
+	}
+	return nil
+}
+
+func slotErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Pickup slot not found", nil, nil)
+	case errors.Is(err, errBankRequired), errors.Is(err, errBothBanks):
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, errSlotFull):
+		return helpers.Response(c, fiber.StatusConflict, "Failed", "Pickup slot is full", nil, nil)
+	case errors.Is(err, errSlotUnavailable), errors.Is(err, errSlotBank):
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+	return helpers.ScopeResponse(c, err)
+}
+
+// requestBank - bank dari body atau bank operator yang login, harus lolos scope
+func requestBank(c *fiber.Ctx, parentBankID, childBankID *uint) (helpers.InventoryBank, error) {
+	if parentBankID != nil && childBankID != nil {
+		return helpers.InventoryBank{}, errBothBanks
+	}
+	bank := helpers.InventoryBank{ParentBankID: parentBankID, ChildBankID: childBankID}
+	if bank.Key() == "" {
+		bank = operatorBank(c)
+	}
+	if bank.Key() == "" {
+		return bank, errBankRequired
+	}
+	if err := helpers.ScopeBank(c, bank.ParentBankID, bank.ChildBankID); err != nil {
+		return bank, err
+	}
+	return bank, nil
+}
+
+// operatorBank - bank milik operator yang login, kosong untuk admin dan user biasa
+func operatorBank(c *fiber.Ctx) helpers.InventoryBank {
+	user := helpers.AuthUser(c)
+	if user == nil {
+		return helpers.InventoryBank{}
+	}
+	switch helpers.AuthRole(c) {
+	case models.RoleChildBank:
+		return helpers.InventoryBank{ChildBankID: user.ChildBankID}
+	case models.RoleParentBank:
+		return helpers.InventoryBank{ParentBankID: user.ParentBankID}
+	}
+	return helpers.InventoryBank{}
+}
+
+func isBankOperator(c *fiber.Ctx, bank helpers.InventoryBank) bool {
+	if !helpers.HasRole(c, models.RoleAdmin, models.RoleParentBank, models.RoleChildBank) {
+		return false
+	}
+	return helpers.ScopeBank(c, bank.ParentBankID, bank.ChildBankID) == nil
+}
+
+func validateWindow(start, end string) error {
+	startTime, err := time.Parse("15:04", start)
+	if err != nil {
+		return errors.New("start_time must use HH:MM format")
+	}
+	endTime, err := time.Parse("15:04", end)
+	if err != nil {
+		return errors.New("end_time must use HH:MM format")
+	}
+	if !endTime.After(startTime) {
+		return errors.New("end_time must be after start_time")
+	}
+	return nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,233 @@
+package pickuprequest
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"backend-mulungs/realtime"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PickupLiveState - status dan posisi petugas yang dikirim ke user lewat stream
+type PickupLiveState struct {
+	PickupRequestID     uint       `json:"pickup_request_id"`
+	Status              string     `json:"status"`
+	CollectorID         *uint      `json:"collector_id"`
+	CollectorName       string     `json:"collector_name,omitempty"`
+	CollectorPhone      string     `json:"collector_phone,omitempty"`
+	CollectorLatitude   *float64   `json:"collector_latitude"`
+	CollectorLongitude  *float64   `json:"collector_longitude"`
+	CollectorLocationAt *time.Time `json:"collector_location_at"`
+	DistanceKm          *float64   `json:"distance_km"`
+	EtaMinutes          *float64   `json:"eta_minutes"`
+	Eta                 *time.Time `json:"eta"`
+	PickupDate          *time.Time `json:"pickup_date"`
+	WindowStart         string     `json:"window_start"`
+	WindowEnd           string     `json:"window_end"`
+}
+
+// UpdateCollectorLocation - aplikasi petugas mengirim posisi GPS selama penjemputan. Posisi terakhir
+// disimpan dan diteruskan ke user bersama perkiraan waktu tiba.
+func UpdateCollectorLocation(c *fiber.Ctx) error {
+	var body struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+	if body.Latitude == nil || body.Longitude == nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Latitude and longitude are required", nil, nil)
+	}
+	if *body.Latitude < -90 || *body.Latitude > 90 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid latitude value (must be between -90 and 90)", nil, nil)
+	}
+	if *body.Longitude < -180 || *body.Longitude > 180 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid longitude value (must be between -180 and 180)", nil, nil)
+	}
+
+	var pickup models.PickupRequest
+	if err := configs.DB.Preload("Collector").First(&pickup, c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.Response(c, fiber.StatusNotFound, "Failed", "Pickup request not found", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch pickup request", nil, nil)
+	}
+
+	// Hanya petugas yang ditunjuk yang mengirim posisi
+	authUser := helpers.AuthUser(c)
+	if authUser == nil || pickup.CollectorID == nil || *pickup.CollectorID != authUser.Id {
+		return helpers.ScopeResponse(c, helpers.ErrForbidden)
+	}
+	if pickup.Status != models.PickupStatusAssigned && pickup.Status != models.PickupStatusOnTheWay {
+		return helpers.Response(c, fiber.StatusConflict, "Failed", fmt.Sprintf("Cannot share location while pickup request is %s", pickup.Status), nil, nil)
+	}
+
+	now := time.Now()
+	result := configs.DB.Model(&models.PickupRequest{}).
+		Where("id = ? AND collector_id = ?", pickup.Id, authUser.Id).
+		Updates(map[string]interface{}{
+			"collector_latitude":    *body.Latitude,
+			"collector_longitude":   *body.Longitude,
+			"collector_location_at": &now,
+		})
+	if result.Error != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update collector location", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return helpers.Response(c, fiber.StatusConflict, "Failed", "Pickup request has been reassigned, please reload", nil, nil)
+	}
+
+	pickup.CollectorLatitude = body.Latitude
+	pickup.CollectorLongitude = body.Longitude
+	pickup.CollectorLocationAt = &now
+
+	state := pickupLiveState(&pickup)
+	realtime.Default().Publish(realtime.PickupTopic(pickup.Id), realtime.EventLocation, state)
+
+	return helpers.Response(c, fiber.StatusOK, "Success", "Collector location updated", state, nil)
+}
+
+// StreamPickupRequest - Server-Sent Events untuk satu penjemputan. Event pertama "snapshot" berisi
+// kondisi terakhir, lalu "location" dan "status" dikirim saat berubah. Stream ditutup setelah status
+// akhir. Bisa dibuka oleh user pemilik request, petugas yang ditunjuk atau operator bank.
+func StreamPickupRequest(c *fiber.Ctx) error {
+	var pickup models.PickupRequest
+	if err := configs.DB.Preload("Collector").First(&pickup, c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.Response(c, fiber.StatusNotFound, "Failed", "Pickup request not found", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch pickup request", nil, nil)
+	}
+
+	authUser := helpers.AuthUser(c)
+	isOwner := authUser != nil && pickup.UserID == authUser.Id
+	isCollector := authUser != nil && pickup.CollectorID != nil && *pickup.CollectorID == authUser.Id
+	if !isOwner && !isCollector && !isBankOperator(c, helpers.InventoryBank{ParentBankID: pickup.ParentBankID, ChildBankID: pickup.ChildBankID}) {
+		return helpers.ScopeResponse(c, helpers.ErrForbidden)
+	}
+
+	// Subscribe sebelum mengirim snapshot supaya perubahan di antaranya tidak hilang
+	sub := realtime.Default().Subscribe(realtime.PickupTopic(pickup.Id))
+	snapshot := realtime.Event{
+		Type:  realtime.EventSnapshot,
+		Topic: realtime.PickupTopic(pickup.Id),
+		Data:  pickupLiveState(&pickup),
+		At:    time.Now(),
+	}
+	heartbeat := durationEnv("PICKUP_STREAM_HEARTBEAT", 15*time.Second)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // nginx jangan menahan response
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		if err := writePickupEvent(w, snapshot); err != nil || models.PickupStatusFinal(pickup.Status) {
+			return
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.Events:
+				if !ok {
+					// Client terlalu lambat, putus supaya connect ulang dan mendapat snapshot baru
+					return
+				}
+				if err := writePickupEvent(w, event); err != nil {
+					return
+				}
+				if state, ok := event.Data.(PickupLiveState); ok && models.PickupStatusFinal(state.Status) {
+					return
+				}
+			case <-ticker.C:
+				// Komentar SSE menjaga koneksi tetap hidup dan mendeteksi client yang sudah pergi
+				if _, err := w.WriteString(": ping\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func writePickupEvent(w *bufio.Writer, event realtime.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// publishPickupStatus meneruskan perubahan status ke stream user, dipanggil setelah commit
+func publishPickupStatus(pickup *models.PickupRequest) {
+	realtime.Default().Publish(realtime.PickupTopic(pickup.Id), realtime.EventStatus, pickupLiveState(pickup))
+}
+
+// pickupLiveState - posisi petugas dan perkiraan tiba. ETA memakai jarak haversine dengan asumsi
+// kecepatan dari helpers.RouteSettingsFromEnv, hanya selama petugas masih menuju lokasi.
+func pickupLiveState(pickup *models.PickupRequest) PickupLiveState {
+	state := PickupLiveState{
+		PickupRequestID:     pickup.Id,
+		Status:              pickup.Status,
+		CollectorID:         pickup.CollectorID,
+		CollectorLatitude:   pickup.CollectorLatitude,
+		CollectorLongitude:  pickup.CollectorLongitude,
+		CollectorLocationAt: pickup.CollectorLocationAt,
+		PickupDate:          pickup.PickupDate,
+		WindowStart:         pickup.WindowStart,
+		WindowEnd:           pickup.WindowEnd,
+	}
+	if pickup.Collector != nil {
+		state.CollectorName = pickup.Collector.Name
+		state.CollectorPhone = pickup.Collector.Phone
+	}
+
+	tracking := pickup.Status == models.PickupStatusAssigned || pickup.Status == models.PickupStatusOnTheWay
+	if !tracking || pickup.CollectorLatitude == nil || pickup.CollectorLongitude == nil || pickup.CollectorLocationAt == nil {
+		return state
+	}
+
+	settings := helpers.RouteSettingsFromEnv()
+	distance := settings.DistanceKm(
+		helpers.RoutePoint{Latitude: *pickup.CollectorLatitude, Longitude: *pickup.CollectorLongitude},
+		helpers.RoutePoint{Latitude: pickup.Latitude, Longitude: pickup.Longitude},
+	)
+	travel := settings.TravelTime(distance)
+	eta := pickup.CollectorLocationAt.Add(travel)
+	distanceKm := roundKm(distance)
+	etaMinutes := math.Round(travel.Minutes()*10) / 10
+
+	state.DistanceKm = &distanceKm
+	state.EtaMinutes = &etaMinutes
+	state.Eta = &eta
+	return state
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
@@ -4,94 +4,44 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
-	"bytes"
+	"backend-mulungs/ppob"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 	"strconv"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func GetListPostpaid(c *fiber.Ctx) error {
 	typ := c.Params("type")
 	province := c.Query("province")
 	bpjsType := c.Query("bpjs_type") // Query parameter baru: "kesehatan" atau "ketenagakerjaan"
-	username := os.Getenv("IDENTITY")
-	sign := helpers.MakeSignPricelist("pl")
 
-	if username == "" || sign == "" {
-		return helpers.Response(c, 400, "Failed", "Username or sign is Empty", nil, nil)
-	}
-
-	var settings models.Ppob
-	if err := configs.DB.First(&settings).Error; err != nil {
-		return helpers.Response(c, 400, "Failed", "Gagal mengambil margin dari database", nil, nil)
-	}
-
-	reqBody := models.ExternalRequestPostpaid{
-		Commands: "pricelist-pasca",
-		Status:   "all",
-		Username: username,
-		Sign:     sign,
-	}
-
-	if typ == "pdam" && province != "" {
-		reqBody.Province = &province
-	}
-
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Gagal encode request body", nil, nil)
-	}
-
-	url := fmt.Sprintf("https://testpostpaid.mobilepulsa.net/api/v1/bill/check/%s", typ)
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed request API external", nil, nil)
+	// Katalog lokal dipakai setelah sinkronisasi pertama, sebelumnya langsung ke provider
+	var pasca []map[string]any
+	var err error
+	if helpers.PpobCatalogSynced(configs.DB, models.PpobKindPostpaid) {
+		pasca, err = helpers.PostpaidCatalog(configs.DB, typ, province)
+	} else {
+		pasca, err = ppob.Default().PostpaidPricelist(c.UserContext(), typ, province)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Gagal membaca response body", nil, nil)
-	}
-
-	// Decode response ke map[string]interface{} untuk handle struktur dinamis
-	var apiResponse map[string]any
-	if err := json.Unmarshal(body, &apiResponse); err != nil {
-		return helpers.Response(c, 400, "Failed", "Gagal decode response API", nil, nil)
-	}
-
-	// Cek jika response ada data
-	if apiResponse["data"] == nil {
-		return helpers.Response(c, 404, "Not Found", "Tidak ada data ditemukan", nil, nil)
-	}
-
-	// Extract data pasca dari response
-	data, ok := apiResponse["data"].(map[string]any)
-	if !ok {
-		return helpers.Response(c, 400, "Failed", "Format data tidak valid", nil, nil)
+		return ppobErrorResponse(c, err, "Failed request API external")
 	}
-
-	pasca, ok := data["pasca"].([]any)
-	if !ok {
+	if len(pasca) == 0 {
 		return helpers.Response(c, 404, "Not Found", "Tidak ada data pasca ditemukan", nil, nil)
 	}
 
 	// --- Filter data ---
 	var filtered []map[string]any
 
-	for _, item := range pasca {
-		itemMap, ok := item.(map[string]any)
-		if !ok {
-			continue
-		}
-
+	for _, itemMap := range pasca {
 		itemType, typeOk := itemMap["type"].(string)
 		itemCode, codeOk := itemMap["code"].(string)
 		itemName, nameOk := itemMap["name"].(string)
@@ -177,85 +127,53 @@ func PostpaidInquiry(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
 	}
 
-	username := os.Getenv("IDENTITY")
-	sign := helpers.MakeSignPricelist(reqBody.RefID)
-
-	if username == "" || sign == "" {
-		return helpers.Response(c, 400, "Failed", "Username or sign is Empty", nil, nil)
-	}
-
-	// Siapkan body request ke IAK
-	payload := map[string]any{
-		"commands": "inq-pasca",
-		"username": username,
-		"code":     reqBody.Code,
-		"hp":       reqBody.Hp,
-		"ref_id":   reqBody.RefID,
-		"month":    reqBody.Month,
-		"sign":     sign,
-	}
-
-	jsonBody, _ := json.Marshal(payload)
-
-	// Kirim request ke API eksternal
-	url := "https://testpostpaid.mobilepulsa.net/api/v1/bill/check"
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
+	// Kirim inquiry ke provider PPOB
+	data, err := ppob.Default().PostpaidInquiry(c.UserContext(), ppob.PostpaidInquiryRequest{
+		Code:  reqBody.Code,
+		Hp:    reqBody.Hp,
+		RefID: reqBody.RefID,
+		Month: reqBody.Month,
+	})
 	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed request API external", nil, nil)
-	}
-	defer resp.Body.Close()
-
-	// Baca respons dari eksternal API
-	body, _ := io.ReadAll(resp.Body)
-
-	// Unmarshal hasil API
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed decode response", nil, nil)
-	}
-
-	// Cek jika response ada error
-	if responseCode, ok := result["response_code"].(string); ok && responseCode != "00" {
-		message := "Inquiry failed"
-		if msg, ok := result["message"].(string); ok {
-			message = msg
+		var providerErr *ppob.ProviderError
+		if errors.As(err, &providerErr) {
+			message := providerErr.Message
+			if message == "" {
+				message = "Inquiry failed"
+			}
+			return helpers.Response(c, 400, "Failed", message, providerErr.Raw, nil)
 		}
-		return helpers.Response(c, 400, "Failed", message, result, nil)
-	}
-
-	// Extract data dari response
-	data, ok := result["data"].(map[string]interface{})
-	if !ok {
-		return helpers.Response(c, 400, "Failed", "Invalid response data", nil, nil)
+		return ppobErrorResponse(c, err, "Failed request API external")
 	}
 
-	// Ambil margin dari tabel PPOB
-	var ppobSettings models.Ppob
-	if err := configs.DB.First(&ppobSettings).Error; err != nil {
-		// Jika tidak ada setting, gunakan default 0%
-		ppobSettings.Margin = 0
+	// Ambil aturan margin PPOB yang berlaku
+	marginRules, err := helpers.LoadPpobMarginRules(configs.DB, time.Now())
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to load PPOB margin", nil, nil)
 	}
 
-	// Jika ada margin, apply ke price saja
-	if ppobSettings.Margin > 0 {
-		// Cari field price untuk ditambahkan margin
-		if price, ok := data["price"].(float64); ok && price > 0 {
-			// Hitung price dengan margin
-			marginAmount := price * (float64(ppobSettings.Margin) / 100)
-			priceWithMargin := price + marginAmount
-
-			// Update hanya field price
-			data["price"] = priceWithMargin
+	// Margin hanya diterapkan ke field price, nominalnya sama persis dengan yang dipotong PaymentPostpaid
+	if sellingPrice, basePrice, ok := postpaidSellingPrice(marginRules, data); ok && basePrice > 0 {
+		if sellingPrice != basePrice {
+			data["price"] = float64(sellingPrice)
 
 			// Log untuk debugging
-			fmt.Printf("💰 Margin applied - Original price: Rp. %.0f, Margin: %.1f%%, Final price: Rp. %.0f\n",
-				price, float64(ppobSettings.Margin), priceWithMargin)
+			fmt.Printf("💰 Margin applied - Original price: Rp. %d, Margin: Rp. %d, Final price: Rp. %d\n",
+				basePrice, sellingPrice-basePrice, sellingPrice)
+		}
+
+		// Simpan harga tagihan, PaymentPostpaid menahan saldo sebesar ini sebelum membayar ke provider
+		if err := savePostpaidInquiry(c, data, basePrice, sellingPrice); err != nil {
+			return helpers.Response(c, 500, "Failed", "Failed to save inquiry", nil, nil)
 		}
 	}
 
 	// Return hasil inquiry (dengan price yang sudah include margin jika ada)
 	return helpers.Response(c, 200, "Success", "Success Inquiry", data, nil)
 }
+// PaymentPostpaid - bayar tagihan hasil inquiry. Seperti TopupPrepaid, saldo ditahan di clearing PPOB
+// dan riwayat PROSES di-commit SEBELUM request ke provider, lalu diselesaikan lewat helpers.SettlePrepaid.
+// Jika response provider hilang, reconciler mengirim ulang pembayaran tr_id yang sama.
 func PaymentPostpaid(c *fiber.Ctx) error {
 	var reqBody struct {
 		TrID   string `json:"tr_id"`
@@ -265,168 +183,98 @@ func PaymentPostpaid(c *fiber.Ctx) error {
 	if err := c.BodyParser(&reqBody); err != nil {
 		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
 	}
-
-	// Convert user_id dari string ke uint
-	userID, err := strconv.ParseUint(reqBody.UserID, 10, 32)
-	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Invalid user ID", nil, nil)
+	if reqBody.TrID == "" {
+		return helpers.Response(c, 400, "Failed", "tr_id is required", nil, nil)
 	}
 
-	username := os.Getenv("IDENTITY")
-	sign := helpers.MakeSignPricelist(reqBody.TrID)
-	if username == "" || sign == "" {
-		return helpers.Response(c, 400, "Failed", "Username or sign is Empty", nil, nil)
-	}
-
-	// Start database transaction
-	tx := configs.DB.Begin()
-
-	// 1. Cek dan potong saldo user di awal
-	var user models.User
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, uint(userID)).Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 404, "Failed", "User not found", nil, nil)
+	// Convert user_id dari string ke uint, kosong berarti user yang login
+	var requestedUserID uint64
+	if reqBody.UserID != "" {
+		parsed, err := strconv.ParseUint(reqBody.UserID, 10, 32)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid user ID", nil, nil)
+		}
+		requestedUserID = parsed
 	}
 
-	// 2. Ambil margin dari tabel PPOB
-	var ppobSettings models.Ppob
-	if err := tx.First(&ppobSettings).Error; err != nil {
-		// Jika tidak ada setting, gunakan default 0%
-		ppobSettings.Margin = 0
+	// Pembayaran memotong saldo, operator bank tidak boleh membayar dari saldo nasabah
+	userID, err := helpers.ResolveSelfUserID(c, uint(requestedUserID))
+	if err != nil {
+		return helpers.ScopeResponse(c, err)
 	}
 
-	// Siapkan body request ke IAK
-	payload := map[string]any{
-		"commands": "pay-pasca",
-		"username": username,
-		"tr_id":    reqBody.TrID,
-		"sign":     sign,
+	// Nominal diambil dari hasil inquiry yang tersimpan, sama dengan yang ditampilkan ke user
+	var inquiry models.PpobInquiry
+	if err := configs.DB.Where("tr_id = ?", reqBody.TrID).First(&inquiry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.Response(c, 404, "Failed", "Inquiry not found, please inquire the bill again", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to fetch inquiry", nil, nil)
 	}
-	jsonBody, _ := json.Marshal(payload)
-	url := "https://testpostpaid.mobilepulsa.net/api/v1/bill/check"
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
-
-	if err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", "Failed to call external API", nil, nil)
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(inquiry.Data), &data); err != nil {
+		return helpers.Response(c, 500, "Failed", "Invalid inquiry data", nil, nil)
 	}
+	totalAmount := inquiry.SellingPrice
 
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", "Failed decode response", nil, nil)
-	}
+	// 1. Tahan saldo dan simpan riwayat PROSES lalu commit sebelum membayar ke provider
+	tx := configs.DB.Begin()
 
-	// Cek jika response ada error
-	if responseCode, ok := result["response_code"].(string); ok && responseCode != "00" {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
 		tx.Rollback()
-		message := "Payment failed"
-		if msg, ok := result["message"].(string); ok {
-			message = msg
-		}
-		return helpers.Response(c, 400, "Failed", message, result, nil)
+		return helpers.Response(c, 404, "Failed", "User not found", nil, nil)
 	}
 
-	// Extract data dari response
-	data, ok := result["data"].(map[string]interface{})
-	if !ok {
+	// tr_id yang sedang diproses atau sudah lunas tidak boleh dibayar lagi
+	var history models.HistoryModel
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ref_id = ?", reqBody.TrID).First(&history).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", "Invalid response data", nil, nil)
+		return helpers.Response(c, 500, "Failed", "Failed to check transaction history", nil, nil)
 	}
-
-	// 3. Hitung total amount = price (sudah include admin IAK) + margin PPOB
-	var totalAmount int
-	var marginAmount int
-	var productPrice int
-
-	// Gunakan price yang sudah include admin IAK
-	if price, ok := data["price"].(float64); ok {
-		basePrice := int(price)
-		
-		// Hitung margin dari PPOB
-		if ppobSettings.Margin > 0 {
-			marginAmount = int(float64(basePrice) * (float64(ppobSettings.Margin) / 100))
-		}
-		
-		// Total yang harus dibayar user = price IAK + margin PPOB
-		totalAmount = basePrice + marginAmount
-		
-		// Product price juga sama dengan total amount (harga IAK + margin PPOB)
-		productPrice = totalAmount
-		
-		fmt.Printf("💰 Price calculation:\n")
-		fmt.Printf("   IAK price (include admin): Rp. %d\n", basePrice)
-		fmt.Printf("   Margin PPOB: %.1f%%\n", float64(ppobSettings.Margin))
-		fmt.Printf("   Margin amount: Rp. %d\n", marginAmount)
-		fmt.Printf("   Product price: Rp. %d\n", productPrice)
-		fmt.Printf("   Total user pay: Rp. %d\n", totalAmount)
-		
-	} else {
+	if history.Id != 0 && history.Status != models.HistoryStatusFailed {
 		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", "Cannot determine payment amount from price field", nil, nil)
+		return helpers.Response(c, 409, "Failed", "This bill is already being processed or has been paid", nil, nil)
 	}
 
-	// 4. Validasi saldo user cukup
 	if user.Balance < totalAmount {
 		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", 
-			fmt.Sprintf("Saldo tidak cukup. Saldo anda: Rp. %d, Dibutuhkan: Rp. %d", 
+		return helpers.Response(c, 400, "Failed",
+			fmt.Sprintf("Saldo tidak cukup. Saldo anda: Rp. %d, Dibutuhkan: Rp. %d",
 				user.Balance, totalAmount), nil, nil)
 	}
 
-	// 5. Potong saldo user (price IAK + margin PPOB)
-	user.Balance -= totalAmount
-	if err := tx.Save(&user).Error; err != nil {
+	// Dana ditahan di clearing PPOB sampai provider menjawab
+	_, err = helpers.NewLedgerService(tx).Post(
+		reqBody.TrID,
+		"Pembayaran PPOB pascabayar "+inquiry.Code,
+		helpers.Debit(models.AccountUserWallet, user.Id, totalAmount),
+		helpers.Credit(models.AccountPpobClearing, 0, totalAmount),
+	)
+	if err != nil {
 		tx.Rollback()
-		return helpers.Response(c, 500, "Failed", "Failed to deduct user balance", nil, nil)
-	}
-
-	// 6. Tambahkan margin PPOB ke company balance
-	if marginAmount > 0 {
-		var company models.Company
-		if err := tx.First(&company).Error; err != nil {
-			// Jika company tidak ada, buat baru
-			company = models.Company{Balance: marginAmount}
-			if err := tx.Create(&company).Error; err != nil {
-				tx.Rollback()
-				return helpers.Response(c, 500, "Failed", "Failed to create company record", nil, nil)
-			}
-		} else {
-			// Jika company sudah ada, tambah balance
-			company.Balance += marginAmount
-			if err := tx.Save(&company).Error; err != nil {
-				tx.Rollback()
-				return helpers.Response(c, 500, "Failed", "Failed to update company balance", nil, nil)
-			}
+		if errors.Is(err, helpers.ErrInsufficientBalance) {
+			return helpers.Response(c, 400, "Failed", "Saldo tidak cukup", nil, nil)
 		}
-		fmt.Printf("💼 Margin added to company balance: Rp. %d\n", marginAmount)
-	}
-
-	// 7. Simpan history transaksi
-	history := models.HistoryModel{
-		UserID:      uint(userID),
-		RefID:       reqBody.TrID,
-		ProductType: determineProductType(data), // ✅ PERBAIKAN: Gunakan fungsi determineProductType
-		Status:      "SUCCESS",
+		return helpers.Response(c, 500, "Failed", "Failed to deduct user balance", nil, nil)
 	}
+	user.Balance -= totalAmount
 
-	// Set product name
+	// Riwayat yang pernah gagal dipakai lagi untuk percobaan berikutnya
+	history.UserID = user.Id
+	history.Kind = models.PpobKindPostpaid
+	history.RefID = reqBody.TrID
+	history.ProductType = determineProductType(data)
 	history.ProductName = getProductName(data)
-
+	history.ProductPrice = strconv.Itoa(totalAmount)
+	history.TotalPrice = strconv.Itoa(totalAmount)
+	history.UserNumber = inquiry.Hp
+	history.Status = models.HistoryStatusPending
+	history.Message = ""
 	if period, ok := data["period"].(string); ok {
 		history.BillingPeriod = period
 	}
-
-	// Simpan harga dengan format yang benar
-	// Product price = harga IAK + margin PPOB (sama dengan total amount)
-	history.ProductPrice = fmt.Sprintf("%d", productPrice)
-	history.TotalPrice = fmt.Sprintf("%d", totalAmount)
-
-	// Simpan desc hanya jika ada dan berisi data
 	if desc, ok := data["desc"].(map[string]interface{}); ok && len(desc) > 0 {
 		if nama, ok := desc["nama"].(string); ok && nama != "" {
 			history.Province = nama
@@ -435,37 +283,109 @@ func PaymentPostpaid(c *fiber.Ctx) error {
 			history.BillingPeriod = periode
 		}
 	}
+	if err := tx.Save(&history).Error; err != nil {
+		tx.Rollback()
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate entry") {
+			// Pembayaran paralel untuk tr_id yang sama menyimpan riwayatnya lebih dulu
+			return helpers.Response(c, 409, "Failed", "This bill is already being processed or has been paid", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to save transaction history", nil, nil)
+	}
 
-	// Set UserNumber jika ada
-	if hp, ok := data["hp"].(string); ok {
-		history.UserNumber = hp
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to save transaction history", nil, nil)
 	}
 
-	if err := tx.Create(&history).Error; err != nil {
-		// ❌ Jika gagal simpan history, kembalikan saldo user dan company balance
-		user.Balance += totalAmount
-		tx.Save(&user)
-		
-		if marginAmount > 0 {
-			var company models.Company
-			if err := tx.First(&company).Error; err == nil {
-				company.Balance -= marginAmount
-				tx.Save(&company)
-			}
+	// 2. Bayar tagihan ke provider PPOB
+	paid, err := ppob.Default().PostpaidPayment(c.UserContext(), reqBody.TrID)
+	status, statusErr := ppob.PostpaidPaymentStatus(reqBody.TrID, paid, err)
+	if statusErr != nil {
+		// Timeout/network/response tidak terbaca: tagihan mungkin sudah dibayar, riwayat dibiarkan
+		// PROSES dan diselesaikan oleh reconciler
+		log.Printf("PaymentPostpaid %s: provider result unknown, left pending: %v\n", reqBody.TrID, statusErr)
+		return helpers.Response(c, 202, "Success", "Pembayaran diproses, status akan diperbarui otomatis", history, nil)
+	}
+
+	settled, err := settlePrepaidOutcome(reqBody.TrID, helpers.PrepaidOutcome{
+		Success:     status.Status == ppob.StatusSuccess,
+		Price:       inquiry.BasePrice,
+		ProductCode: inquiry.Code,
+		Message:     status.Message,
+	})
+	if err != nil {
+		if errors.Is(err, helpers.ErrPpobAlreadySettled) {
+			// Reconciler menyelesaikan transaksi ini lebih dulu
+			return helpers.Response(c, 200, "Success", "Transaction already settled", settled, nil)
 		}
-		
-		tx.Rollback()
-		return helpers.Response(c, 500, "Failed", "Failed to save transaction history", nil, nil)
+		log.Printf("PaymentPostpaid %s: failed to settle: %v\n", reqBody.TrID, err)
+		return helpers.Response(c, 202, "Success", "Pembayaran diproses, status akan diperbarui otomatis", history, nil)
 	}
 
-	// Commit transaction
-	tx.Commit()
+	if status.Status != ppob.StatusSuccess {
+		// ❌ Ditolak provider: saldo sudah dikembalikan
+		return helpers.Response(c, 400, "Failed", status.Message, settled, nil)
+	}
 
 	// Log untuk debugging
-	fmt.Printf("✅ PaymentPostpaid berhasil - UserID: %d, Amount: Rp. %d, Saldo tersisa: Rp. %d\n", 
+	fmt.Printf("✅ PaymentPostpaid berhasil - UserID: %d, Amount: Rp. %d, Saldo tersisa: Rp. %d\n",
 		userID, totalAmount, user.Balance)
 
-	return helpers.Response(c, 200, "Success", "Payment processed successfully", result["data"], nil)
+	if paid == nil {
+		// Tagihan sudah dibayar oleh percobaan sebelumnya
+		return helpers.Response(c, 200, "Success", "Payment processed successfully", settled, nil)
+	}
+	return helpers.Response(c, 200, "Success", "Payment processed successfully", paid, nil)
+}
+
+// savePostpaidInquiry menyimpan (atau memperbarui) harga tagihan untuk tr_id dari provider
+func savePostpaidInquiry(c *fiber.Ctx, data map[string]interface{}, basePrice, sellingPrice int) error {
+	trID := postpaidTrID(data)
+	if trID == "" {
+		return errors.New("inquiry response has no tr_id")
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	inquiry := models.PpobInquiry{
+		TrID:         trID,
+		BasePrice:    basePrice,
+		SellingPrice: sellingPrice,
+		Data:         string(raw),
+	}
+	inquiry.Code, _ = data["code"].(string)
+	inquiry.Hp, _ = data["hp"].(string)
+	if userID := helpers.AuthUserID(c); userID != nil {
+		inquiry.UserID = *userID
+	}
+
+	return configs.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tr_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "user_id", "code", "hp", "base_price", "selling_price", "data"}),
+	}).Create(&inquiry).Error
+}
+
+// postpaidTrID - tr_id dari response provider, angka (IAK) atau string
+func postpaidTrID(data map[string]interface{}) string {
+	switch trID := data["tr_id"].(type) {
+	case float64:
+		return strconv.FormatFloat(trID, 'f', -1, 64)
+	case string:
+		return trID
+	}
+	return ""
+}
+
+// postpaidSellingPrice - harga jual pascabayar dari field price (sudah termasuk admin IAK) ditambah
+// margin, dibulatkan lewat SellingPrice. Dipakai inquiry dan pembayaran supaya nominalnya selalu sama.
+func postpaidSellingPrice(rules *helpers.PpobMarginRules, data map[string]interface{}) (sellingPrice, basePrice int, ok bool) {
+	price, ok := data["price"].(float64)
+	if !ok {
+		return 0, 0, false
+	}
+	sellingPrice = int(rules.SellingPrice(postpaidProductRef(data), price))
+	return sellingPrice, int(helpers.RoundToNearest(price)), true
 }
 
 // Fungsi untuk menentukan product type berdasarkan response data
@@ -502,6 +422,16 @@ func determineProductType(data map[string]interface{}) string {
 	return "unknown"
 }
 
+// postpaidProductRef - identitas produk pascabayar untuk aturan margin
+func postpaidProductRef(data map[string]interface{}) helpers.PpobProductRef {
+	code, _ := data["code"].(string)
+	return helpers.PpobProductRef{
+		Category:    determineProductType(data),
+		Operator:    code,
+		ProductCode: code,
+	}
+}
+
 // Helper function untuk generate product name
 func getProductName(data map[string]interface{}) string {
 	productType := determineProductType(data)
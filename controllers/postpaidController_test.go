@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"backend-mulungs/models"
+	"backend-mulungs/ppob"
+	"backend-mulungs/workers"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// inquiry mengambil tagihan PLN pascabayar dari Fake (Rp102.500 termasuk admin, tanpa margin)
+func (env *ppobTestEnv) inquiry(hp string) string {
+	env.t.Helper()
+
+	status, body := env.post("/postpaid/inquiry", map[string]any{
+		"code":   "PLNPOSTPAID",
+		"hp":     hp,
+		"ref_id": "INQ-" + hp,
+		"month":  "1",
+	})
+	if status != fiber.StatusOK {
+		env.t.Fatalf("inquiry status = %d, body %v", status, body)
+	}
+	data, _ := body["data"].(map[string]any)
+	return postpaidTrID(data)
+}
+
+func (env *ppobTestEnv) payBill(trID string) (int, map[string]any) {
+	env.t.Helper()
+	return env.post("/postpaid/payment", map[string]any{"tr_id": trID})
+}
+
+func TestPaymentPostpaidSuccess(t *testing.T) {
+	env := newPpobTestEnv(t, 150000)
+	trID := env.inquiry("081234567891")
+
+	status, body := env.payBill(trID)
+	if status != fiber.StatusOK {
+		t.Fatalf("payment status = %d, body %v", status, body)
+	}
+	history := env.history(trID)
+	if history.Status != models.HistoryStatusSuccess || history.Kind != models.PpobKindPostpaid {
+		t.Fatalf("history = %s %s, want SUCCESS postpaid", history.Status, history.Kind)
+	}
+	if got := env.balance(); got != 47500 {
+		t.Fatalf("balance after payment = %d, want 47500", got)
+	}
+	if got := env.ledgerBalance(models.AccountPpobClearing, 0); got != 0 {
+		t.Fatalf("ppob clearing = %d, want 0", got)
+	}
+
+	// tr_id yang sudah lunas tidak boleh memotong saldo lagi
+	status, body = env.payBill(trID)
+	if status != fiber.StatusConflict {
+		t.Fatalf("second payment status = %d, want 409, body %v", status, body)
+	}
+	if got := env.balance(); got != 47500 {
+		t.Fatalf("balance after second payment = %d, want 47500", got)
+	}
+}
+
+func TestPaymentPostpaidInsufficientBalanceDoesNotPay(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+	trID := env.inquiry("081234567891")
+
+	status, body := env.payBill(trID)
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("payment status = %d, want 400, body %v", status, body)
+	}
+	if got := env.balance(); got != 50000 {
+		t.Fatalf("balance = %d, want 50000", got)
+	}
+
+	// Tagihan belum dibayar ke provider, sehingga bisa dibayar setelah saldo cukup
+	env.db.Model(&models.User{}).Where("id = ?", env.user.Id).Update("balance", 150000)
+	if status, body := env.payBill(trID); status != fiber.StatusOK {
+		t.Fatalf("payment after top up status = %d, body %v", status, body)
+	}
+	if got := env.balance(); got != 47500 {
+		t.Fatalf("balance after payment = %d, want 47500", got)
+	}
+}
+
+func TestPaymentPostpaidRejectedRefunds(t *testing.T) {
+	env := newPpobTestEnv(t, 150000)
+	trID := env.inquiry("081234567891")
+
+	// Provider menolak pembayaran, misalnya inquiry sudah kedaluwarsa
+	ppob.SetDefault(rejectingProvider{env.fake})
+	status, body := env.payBill(trID)
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("payment status = %d, want 400, body %v", status, body)
+	}
+	if got := env.history(trID).Status; got != models.HistoryStatusFailed {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusFailed)
+	}
+	if got := env.balance(); got != 150000 {
+		t.Fatalf("balance after rejection = %d, want 150000", got)
+	}
+
+	// Riwayat yang gagal boleh dicoba lagi
+	ppob.SetDefault(env.fake)
+	if status, body := env.payBill(trID); status != fiber.StatusOK {
+		t.Fatalf("retry status = %d, body %v", status, body)
+	}
+	if got := env.balance(); got != 47500 {
+		t.Fatalf("balance after retry = %d, want 47500", got)
+	}
+}
+
+func TestPaymentPostpaidTimeoutSettledByReconciler(t *testing.T) {
+	env := newPpobTestEnv(t, 150000)
+	trID := env.inquiry("081234567891")
+
+	ppob.SetDefault(timeoutProvider{env.fake})
+	status, body := env.payBill(trID)
+	if status != fiber.StatusAccepted {
+		t.Fatalf("payment status = %d, want 202, body %v", status, body)
+	}
+	if got := env.history(trID).Status; got != models.HistoryStatusPending {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusPending)
+	}
+	if got := env.balance(); got != 47500 {
+		t.Fatalf("balance after timeout = %d, want 47500 (held)", got)
+	}
+
+	// Reconciler mengirim ulang pembayaran, provider menjawab tagihan sudah lunas
+	env.db.Model(&models.HistoryModel{}).Where("ref_id = ?", trID).Update("created_at", time.Now().Add(-time.Hour))
+	reconciler := &workers.PpobReconciler{Provider: env.fake, StaleAfter: 10 * time.Minute, BatchSize: 10}
+	result, err := reconciler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if result.Success != 1 || result.Errors != 0 {
+		t.Fatalf("reconcile result = %+v, want 1 success", result)
+	}
+	if got := env.history(trID).Status; got != models.HistoryStatusSuccess {
+		t.Fatalf("history status after reconcile = %s, want %s", got, models.HistoryStatusSuccess)
+	}
+	if got := env.balance(); got != 47500 {
+		t.Fatalf("balance after reconcile = %d, want 47500", got)
+	}
+	if got := env.ledgerBalance(models.AccountPpobClearing, 0); got != 0 {
+		t.Fatalf("ppob clearing = %d, want 0", got)
+	}
+}
+
+// rejectingProvider - provider menolak pembayaran tagihan
+type rejectingProvider struct {
+	*ppob.Fake
+}
+
+func (p rejectingProvider) PostpaidPayment(ctx context.Context, trID string) (map[string]any, error) {
+	return nil, &ppob.ProviderError{Op: "pay-pasca", RC: "16", Message: "INQUIRY NOT FOUND"}
+}
+
+func (p timeoutProvider) PostpaidPayment(ctx context.Context, trID string) (map[string]any, error) {
+	if _, err := p.Fake.PostpaidPayment(ctx, trID); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: context deadline exceeded", ppob.ErrUnavailable)
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"backend-mulungs/workers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SyncPpobCatalog - sinkronisasi katalog PPOB sekarang, ?kind=prepaid|postpaid (kosong untuk keduanya)
+func SyncPpobCatalog(c *fiber.Ctx) error {
+	kind := c.Query("kind")
+	if kind != "" && kind != models.PpobKindPrepaid && kind != models.PpobKindPostpaid {
+		return helpers.Response(c, 400, "Failed", "Kind must be prepaid or postpaid", nil, nil)
+	}
+
+	triggeredBy := helpers.AuthUserID(c)
+
+	syncer := workers.NewPpobCatalogSyncerFromEnv()
+
+	var syncs []models.PpobCatalogSync
+	var err error
+	if kind == "" {
+		syncs, err = syncer.SyncAll(c.UserContext(), models.CatalogSyncTriggerManual, triggeredBy)
+	} else {
+		var run *models.PpobCatalogSync
+		run, err = syncer.Sync(c.UserContext(), kind, models.CatalogSyncTriggerManual, triggeredBy)
+		if run != nil {
+			syncs = append(syncs, *run)
+		}
+	}
+
+	if err != nil {
+		if len(syncs) == 0 {
+			return helpers.Response(c, 500, "Failed", "Failed to sync PPOB catalog", nil, nil)
+		}
+		return helpers.Response(c, 502, "Failed", "PPOB catalog sync failed: "+err.Error(), syncs, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "PPOB catalog synced", syncs, nil)
+}
+
+// GetPpobCatalogSyncs - riwayat sinkronisasi katalog
+func GetPpobCatalogSyncs(c *fiber.Ctx) error {
+	var req struct {
+		Kind  string `query:"kind"`
+		Page  int    `query:"page"`
+		Limit int    `query:"limit"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	offset := (req.Page - 1) * req.Limit
+
+	query := configs.DB.Model(&models.PpobCatalogSync{})
+	if req.Kind != "" {
+		query = query.Where("kind = ?", req.Kind)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var syncs []models.PpobCatalogSync
+	if err := query.Order("id DESC").Offset(offset).Limit(req.Limit).Find(&syncs).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch catalog syncs", nil, nil)
+	}
+
+	data := map[string]any{
+		"syncs": syncs,
+		"meta": map[string]any{
+			"page":  req.Page,
+			"limit": req.Limit,
+			"total": total,
+			"pages": (int(total) + req.Limit - 1) / req.Limit,
+		},
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// GetPpobCatalogSync - detail sinkronisasi beserta daftar perubahan produk.
+// :id bisa "latest" untuk sinkronisasi sukses terakhir (filter ?kind=), ?change= untuk jenis perubahan.
+func GetPpobCatalogSync(c *fiber.Ctx) error {
+	query := configs.DB.Model(&models.PpobCatalogSync{})
+	if c.Params("id") == "latest" {
+		query = query.Where("status = ?", models.CatalogSyncSuccess).Order("id DESC")
+		if kind := c.Query("kind"); kind != "" {
+			query = query.Where("kind = ?", kind)
+		}
+	} else {
+		query = query.Where("id = ?", c.Params("id"))
+	}
+
+	var run models.PpobCatalogSync
+	if err := query.First(&run).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Catalog sync not found", nil, nil)
+	}
+
+	changes := configs.DB.Where("sync_id = ?", run.Id)
+	if change := c.Query("change"); change != "" {
+		changes = changes.Where("`change` = ?", change)
+	}
+	if err := changes.Order("id ASC").Find(&run.Changes).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch catalog changes", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", run, nil)
+}
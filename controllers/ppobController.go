@@ -4,26 +4,124 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
+	"backend-mulungs/workers"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 )
 
+// marginRuleRequest - body create/update aturan margin, field nil tidak diubah saat update
+type marginRuleRequest struct {
+	Margin         *int       `json:"margin"` // format lama: margin persen global
+	Name           *string    `json:"name"`
+	Category       *string    `json:"category"`
+	Operator       *string    `json:"operator"`
+	ProductCode    *string    `json:"product_code"`
+	Type           *string    `json:"type"`
+	Value          *float64   `json:"value"`
+	MinMargin      *int       `json:"min_margin"`
+	MaxMargin      *int       `json:"max_margin"`
+	EffectiveFrom  *time.Time `json:"effective_from"`
+	EffectiveUntil *time.Time `json:"effective_until"`
+	IsActive       *bool      `json:"is_active"`
+}
 
+func (body marginRuleRequest) apply(rule *models.PpobMarginRule) {
+	if body.Name != nil {
+		rule.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Category != nil {
+		rule.Category = strings.ToLower(strings.TrimSpace(*body.Category))
+	}
+	if body.Operator != nil {
+		rule.Operator = helpers.PpobOperatorKey(strings.TrimSpace(*body.Operator))
+	}
+	if body.ProductCode != nil {
+		rule.ProductCode = strings.TrimSpace(*body.ProductCode)
+	}
+	if body.Type != nil {
+		rule.Type = strings.ToLower(*body.Type)
+	}
+	if body.Value != nil {
+		rule.Value = *body.Value
+	}
+	if body.MinMargin != nil {
+		rule.MinMargin = body.MinMargin
+	}
+	if body.MaxMargin != nil {
+		rule.MaxMargin = body.MaxMargin
+	}
+	if body.EffectiveFrom != nil {
+		rule.EffectiveFrom = body.EffectiveFrom
+	}
+	if body.EffectiveUntil != nil {
+		rule.EffectiveUntil = body.EffectiveUntil
+	}
+	if body.IsActive != nil {
+		rule.IsActive = *body.IsActive
+	}
+}
 
-func CreateMargin(c *fiber.Ctx) error {
-	var body struct {
-		Margin int `json:"margin"`
+func validateMarginRule(rule *models.PpobMarginRule) string {
+	if rule.Type != models.MarginTypePercent && rule.Type != models.MarginTypeFlat {
+		return "Type must be percent or flat"
+	}
+	if rule.Value < 0 {
+		return "Value cannot be negative"
+	}
+	if rule.Type == models.MarginTypePercent && rule.Value > 100 {
+		return "Percent value cannot exceed 100"
 	}
+	if rule.MinMargin != nil && *rule.MinMargin < 0 {
+		return "Min margin cannot be negative"
+	}
+	if rule.MinMargin != nil && rule.MaxMargin != nil && *rule.MinMargin > *rule.MaxMargin {
+		return "Min margin cannot be greater than max margin"
+	}
+	if rule.EffectiveFrom != nil && rule.EffectiveUntil != nil && !rule.EffectiveUntil.After(*rule.EffectiveFrom) {
+		return "Effective until must be after effective from"
+	}
+	return ""
+}
+
+// CreateMargin - buat aturan margin PPOB. Body lama {"margin": N} tetap didukung
+// dan mengubah margin persen default yang dipakai jika tidak ada aturan yang cocok.
+func CreateMargin(c *fiber.Ctx) error {
+	var body marginRuleRequest
 
 	// parsing body JSON
 	if err := c.BodyParser(&body); err != nil {
-		return helpers.Response(c, 500, "Failed", "Failed to read body", nil, nil)
+		return helpers.Response(c, 400, "Failed", "Failed to read body", nil, nil)
+	}
+
+	if body.Margin != nil && body.Type == nil && body.Value == nil {
+		return updateDefaultMargin(c, *body.Margin)
+	}
+
+	rule := models.PpobMarginRule{Type: models.MarginTypePercent, IsActive: true}
+	body.apply(&rule)
+	if msg := validateMarginRule(&rule); msg != "" {
+		return helpers.Response(c, 400, "Failed", msg, nil, nil)
+	}
+
+	if err := configs.DB.Create(&rule).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to create margin rule", nil, nil)
+	}
+
+	return helpers.Response(c, 201, "Success", "Margin rule created successfully", rule, nil)
+}
+
+func updateDefaultMargin(c *fiber.Ctx, margin int) error {
+	if margin < 0 || margin > 100 {
+		return helpers.Response(c, 400, "Failed", "Margin must be between 0 and 100", nil, nil)
 	}
 
 	// cek apakah sudah ada data margin di tabel
 	var existing models.Ppob
 	if err := configs.DB.First(&existing).Error; err == nil {
 		// jika sudah ada → update
-		existing.Margin = body.Margin
+		existing.Margin = margin
 		if err := configs.DB.Save(&existing).Error; err != nil {
 			return helpers.Response(c, 400, "Failed", "Failed to update margin", nil, nil)
 		}
@@ -32,7 +130,7 @@ func CreateMargin(c *fiber.Ctx) error {
 
 	// kalau belum ada → buat baru
 	ppob := models.Ppob{
-		Margin: body.Margin,
+		Margin: margin,
 	}
 	if err := configs.DB.Create(&ppob).Error; err != nil {
 		return helpers.Response(c, 400, "Failed", "Failed to create margin", nil, nil)
@@ -40,3 +138,154 @@ func CreateMargin(c *fiber.Ctx) error {
 
 	return helpers.Response(c, 200, "Success", "Margin created successfully", ppob, nil)
 }
+
+// GetMarginRules - daftar aturan margin beserta margin default
+func GetMarginRules(c *fiber.Ctx) error {
+	query := configs.DB.Model(&models.PpobMarginRule{})
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", strings.ToLower(category))
+	}
+	if active := c.Query("active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	var rules []models.PpobMarginRule
+	if err := query.Order("category, operator, product_code, id DESC").Find(&rules).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch margin rules", nil, nil)
+	}
+
+	var settings models.Ppob
+	configs.DB.First(&settings)
+
+	data := map[string]any{
+		"default_margin": settings.Margin,
+		"rules":          rules,
+	}
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+func GetMarginRule(c *fiber.Ctx) error {
+	var rule models.PpobMarginRule
+	if err := configs.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Margin rule not found", nil, nil)
+	}
+	return helpers.Response(c, 200, "Success", "Data found", rule, nil)
+}
+
+func UpdateMarginRule(c *fiber.Ctx) error {
+	var rule models.PpobMarginRule
+	if err := configs.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Margin rule not found", nil, nil)
+	}
+
+	var body marginRuleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to read body", nil, nil)
+	}
+
+	body.apply(&rule)
+	if msg := validateMarginRule(&rule); msg != "" {
+		return helpers.Response(c, 400, "Failed", msg, nil, nil)
+	}
+
+	if err := configs.DB.Save(&rule).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to update margin rule", nil, nil)
+	}
+	return helpers.Response(c, 200, "Success", "Margin rule updated successfully", rule, nil)
+}
+
+func DeleteMarginRule(c *fiber.Ctx) error {
+	var rule models.PpobMarginRule
+	if err := configs.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Margin rule not found", nil, nil)
+	}
+
+	if err := configs.DB.Delete(&rule).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to delete margin rule", nil, nil)
+	}
+	return helpers.Response(c, 200, "Success", "Margin rule deleted successfully", nil, nil)
+}
+
+// ResolveMargin - preview aturan dan harga jual untuk satu produk
+// ?category=pulsa&operator=telkomsel&product_code=htelkomsel10000&price=10500
+func ResolveMargin(c *fiber.Ctx) error {
+	ref := helpers.PpobProductRef{
+		Category:    c.Query("category"),
+		Operator:    c.Query("operator"),
+		ProductCode: c.Query("product_code"),
+	}
+	price := c.QueryFloat("price")
+
+	rules, err := helpers.LoadPpobMarginRules(configs.DB, time.Now())
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to load margin rules", nil, nil)
+	}
+
+	data := map[string]any{
+		"rule":          rules.Resolve(ref),
+		"base_price":    price,
+		"margin":        rules.Margin(ref, price),
+		"selling_price": rules.SellingPrice(ref, price),
+	}
+	return helpers.Response(c, 200, "Success", "Margin resolved", data, nil)
+}
+
+// GetCallbackLogs - Audit callback PPOB dengan filter ref_id dan hasil proses
+func GetCallbackLogs(c *fiber.Ctx) error {
+	var req struct {
+		RefID  string `query:"ref_id"`
+		Result string `query:"result"`
+		Page   int    `query:"page"`
+		Limit  int    `query:"limit"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	offset := (req.Page - 1) * req.Limit
+
+	query := configs.DB.Model(&models.PpobCallbackLog{})
+	if req.RefID != "" {
+		query = query.Where("ref_id = ?", req.RefID)
+	}
+	if req.Result != "" {
+		query = query.Where("result = ?", req.Result)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var logs []models.PpobCallbackLog
+	if err := query.Order("id DESC").Offset(offset).Limit(req.Limit).Find(&logs).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch callback logs", nil, nil)
+	}
+
+	data := map[string]any{
+		"logs": logs,
+		"meta": map[string]any{
+			"page":  req.Page,
+			"limit": req.Limit,
+			"total": total,
+			"pages": (int(total) + req.Limit - 1) / req.Limit,
+		},
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// ReconcilePpob - jalankan reconciler PPOB sekarang tanpa menunggu jadwal
+func ReconcilePpob(c *fiber.Ctx) error {
+	result, err := workers.NewPpobReconcilerFromEnv().RunOnce(c.UserContext())
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to reconcile PPOB transactions", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "PPOB transactions reconciled", result, nil)
+}
@@ -4,25 +4,23 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
-	"bytes"
-	"encoding/json"
+	"backend-mulungs/ppob"
+	"crypto/subtle"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"regexp"
+	"log"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // get list prepaid PPOB
 func GetListPrepaid(c *fiber.Ctx) error {
-	username := os.Getenv("IDENTITY")
+	provider := ppob.Default()
 	typ := c.Params("type")
 	operator := c.Query("operator")
 	NumberPLN := c.Query("numberPLN")
@@ -33,50 +31,20 @@ func GetListPrepaid(c *fiber.Ctx) error {
 	streamingStr := c.Query("streaming") // hasilnya string, misal "true" atau "false"
 	streaming, _ := strconv.ParseBool(streamingStr)
 
-	sign := helpers.MakeSignPricelist("pl")
-
-	if username == "" || sign == "" {
-		return helpers.Response(c, 400, "Failed", "Username or sign is Empty", nil, nil)
-	}
-	var settings models.Ppob
-	if err := configs.DB.First(&settings).Error; err != nil {
-		return helpers.Response(c, 400, "Failed", "Gagal mengambil margin dari database", nil, nil)
-	}
-	margin := float64(settings.Margin)
-
-	reqBody := models.ExternalRequestPrepaid{
-		Status:   "all",
-		Username: username,
-		Sign:     sign,
-	}
-	jsonBody, _ := json.Marshal(reqBody)
-
-	// url := "https://prepaid.iak.dev/api/pricelist/%s"
-	url := fmt.Sprintf("https://prepaid.iak.dev/api/pricelist/%s/%s", typ, operator)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
-
+	marginRules, err := helpers.LoadPpobMarginRules(configs.DB, time.Now())
 	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed request API external", nil, nil)
+		return helpers.Response(c, 400, "Failed", "Gagal mengambil margin dari database", nil, nil)
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 
 	var result models.PrepaidResponse
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		return helpers.Response(c, 400, "Failed", "Gagal decode response API", nil, nil)
-	}
-
-	if result.Data.RC != "00" {
-		return helpers.Response(c, 400, "Failed", result.Data.Message, nil, nil)
+	pricelist, err := prepaidPricelist(c, typ, operator)
+	if err != nil {
+		return ppobErrorResponse(c, err, "Failed request API external")
 	}
+	result.Data.Pricelist = pricelist
 
 	if typ == "etoll" && operator == "" {
-		for i := range result.Data.Pricelist {
-			price := result.Data.Pricelist[i].ProductPrice
-			result.Data.Pricelist[i].ProductPrice = helpers.RoundToNearest(price * (1 + margin/100))
-		}
+		applyPrepaidMargin(marginRules, typ, result.Data.Pricelist)
 
 		uniqueEtoll := UniqueEtollByDescription(result.Data.Pricelist)
 
@@ -181,34 +149,16 @@ func GetListPrepaid(c *fiber.Ctx) error {
 		return helpers.Response(c, 200, "Success", "Data game populer berhasil diambil", filtered, nil)
 	}
 
-	for i := range result.Data.Pricelist {
-		price := result.Data.Pricelist[i].ProductPrice
-		result.Data.Pricelist[i].ProductPrice = helpers.RoundToNearest(price * (1 + margin/100))
-	}
+	applyPrepaidMargin(marginRules, typ, result.Data.Pricelist)
 
 	if typ == "pln" && NumberPLN != "" {
-		inquiryReq := map[string]string{
-			"username":    username,
-			"customer_id": NumberPLN,
-			"sign":        helpers.MakeSignPricelist(NumberPLN),
-		}
-		inquiryBody, _ := json.Marshal(inquiryReq)
-		urlInqueryPLN := "https://prepaid.iak.dev/api/inquiry-pln"
-		inquiryResp, err := http.Post(urlInqueryPLN, "application/json", bytes.NewBuffer(inquiryBody))
-
+		customer, err := provider.InquiryPLN(c.UserContext(), NumberPLN)
 		if err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal request inquiry PLN", nil, nil)
-		}
-		defer inquiryResp.Body.Close()
-
-		inquiryData, _ := io.ReadAll(inquiryResp.Body)
-		var inquiryResult models.InquiryPLNResponse
-		if err := json.Unmarshal(inquiryData, &inquiryResult); err != nil {
-			return helpers.Response(c, 400, "Failed", "Destination number not found", nil, nil)
+			return ppobErrorResponse(c, err, "Gagal request inquiry PLN")
 		}
 
 		combined := models.CombinedPrepaidResponse{
-			Customer:  inquiryResult.Data,
+			Customer:  customer,
 			Pricelist: result.Data.Pricelist,
 		}
 		return helpers.Response(c, 200, "Success", "Data PLN berhasil digabungkan", combined, nil)
@@ -217,26 +167,13 @@ func GetListPrepaid(c *fiber.Ctx) error {
 
 	// --- Jika OVO, lakukan Inquiry OVO ---
 	if typ == "etoll" && operator == "ovo" && NumberOVO != "" {
-		inquiryReq := map[string]string{
-			"username":    username,
-			"customer_id": NumberOVO,
-			"sign":        helpers.MakeSignPricelist(NumberOVO),
-		}
-		inquiryBody, _ := json.Marshal(inquiryReq)
-		inquiryResp, err := http.Post("https://prepaid.iak.dev/api/inquiry-ovo", "application/json", bytes.NewBuffer(inquiryBody))
+		customer, err := provider.InquiryOVO(c.UserContext(), NumberOVO)
 		if err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal request inquiry OVO", nil, nil)
-		}
-		defer inquiryResp.Body.Close()
-
-		inquiryData, _ := io.ReadAll(inquiryResp.Body)
-		var inquiryResult models.InquiryOVOResponse
-		if err := json.Unmarshal(inquiryData, &inquiryResult); err != nil {
-			return helpers.Response(c, 400, "Failed", "Destination number not found", nil, nil)
+			return ppobErrorResponse(c, err, "Gagal request inquiry OVO")
 		}
 
 		combined := models.CombinedPrepaidResponse{
-			Customer:  inquiryResult.Data,
+			Customer:  customer,
 			Pricelist: result.Data.Pricelist,
 		}
 		return helpers.Response(c, 200, "Success", "Data OVO berhasil digabungkan", combined, nil)
@@ -244,31 +181,14 @@ func GetListPrepaid(c *fiber.Ctx) error {
 
 	// --- Inquiry Pulsa ---
 	if bicara && Number != "" {
-		inquiryReq := map[string]string{
-			"username":    username,
-			"customer_id": Number,
-			"sign":        helpers.MakeSignPricelist("op"),
-		}
-		inquiryBody, _ := json.Marshal(inquiryReq)
-		inquiryResp, err := http.Post("https://prepaid.iak.dev/api/check-operator", "application/json", bytes.NewBuffer(inquiryBody))
+		// 🧩 Jika inquiry gagal (rc bukan "00" atau operator kosong) provider mengembalikan error
+		inquiryResult, err := provider.CheckOperator(c.UserContext(), Number)
 		if err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal request inquiry Pulsa", nil, nil)
-		}
-		defer inquiryResp.Body.Close()
-
-		inquiryData, _ := io.ReadAll(inquiryResp.Body)
-		var inquiryResult models.InquiryPulsaResponse
-		if err := json.Unmarshal(inquiryData, &inquiryResult); err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal decode inquiry Pulsa", nil, nil)
-		}
-
-		// 🧩 Jika inquiry gagal (rc bukan "00" atau operator kosong)
-		if inquiryResult.Data.RC != "00" || inquiryResult.Data.Operator == "" {
-			return helpers.Response(c, 400, "Failed", inquiryResult.Data.Message, nil, nil)
+			return ppobErrorResponse(c, err, "Gagal request inquiry Pulsa")
 		}
 
 		// Operator dari hasil inquiry
-		operatorName := strings.ToLower(inquiryResult.Data.Operator)
+		operatorName := strings.ToLower(inquiryResult.Operator)
 
 		// 🟢 Filter hanya product_category == "bicara"
 		filtered := []models.ProductPrepaid{}
@@ -287,7 +207,7 @@ func GetListPrepaid(c *fiber.Ctx) error {
 
 		// Gabungkan data operator + produk
 		combined := models.CombinedPrepaidResponse{
-			Customer:  inquiryResult.Data,
+			Customer:  inquiryResult,
 			Pricelist: filtered,
 		}
 
@@ -296,29 +216,12 @@ func GetListPrepaid(c *fiber.Ctx) error {
 
 	// --- Inquiry Pulsa ---
 	if typ == "pulsa" && Number != "" {
-		inquiryReq := map[string]string{
-			"username":    username,
-			"customer_id": Number,
-			"sign":        helpers.MakeSignPricelist("op"),
-		}
-		inquiryBody, _ := json.Marshal(inquiryReq)
-		inquiryResp, err := http.Post("https://prepaid.iak.dev/api/check-operator", "application/json", bytes.NewBuffer(inquiryBody))
+		inquiryResult, err := provider.CheckOperator(c.UserContext(), Number)
 		if err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal request inquiry Pulsa", nil, nil)
-		}
-		defer inquiryResp.Body.Close()
-
-		inquiryData, _ := io.ReadAll(inquiryResp.Body)
-		var inquiryResult models.InquiryPulsaResponse
-		if err := json.Unmarshal(inquiryData, &inquiryResult); err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal decode inquiry Pulsa", nil, nil)
-		}
-
-		if inquiryResult.Data.RC != "00" || inquiryResult.Data.Operator == "" {
-			return helpers.Response(c, 400, "Failed", inquiryResult.Data.Message, nil, nil)
+			return ppobErrorResponse(c, err, "Gagal request inquiry Pulsa")
 		}
 
-		operatorName := strings.ToLower(inquiryResult.Data.Operator)
+		operatorName := strings.ToLower(inquiryResult.Operator)
 
 		// 🧩 Filter hanya produk yang cocok dengan operator, dan TIDAK "bicara"
 		filtered := []models.ProductPrepaid{}
@@ -335,7 +238,7 @@ func GetListPrepaid(c *fiber.Ctx) error {
 		}
 
 		combined := models.CombinedPrepaidResponse{
-			Customer:  inquiryResult.Data,
+			Customer:  inquiryResult,
 			Pricelist: filtered,
 		}
 
@@ -344,30 +247,13 @@ func GetListPrepaid(c *fiber.Ctx) error {
 
 	// --- Inquiry Data ---
 	if typ == "data" && Number != "" {
-		inquiryReq := map[string]string{
-			"username":    username,
-			"customer_id": Number,
-			"sign":        helpers.MakeSignPricelist("op"),
-		}
-		inquiryBody, _ := json.Marshal(inquiryReq)
-		inquiryResp, err := http.Post("https://prepaid.iak.dev/api/check-operator", "application/json", bytes.NewBuffer(inquiryBody))
+		// ❌ Jika nomor tidak valid provider mengembalikan error
+		inquiryResult, err := provider.CheckOperator(c.UserContext(), Number)
 		if err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal request inquiry Data", nil, nil)
-		}
-		defer inquiryResp.Body.Close()
-
-		inquiryData, _ := io.ReadAll(inquiryResp.Body)
-		var inquiryResult models.InquiryPulsaResponse
-		if err := json.Unmarshal(inquiryData, &inquiryResult); err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal decode inquiry Data", nil, nil)
-		}
-
-		// ❌ Jika nomor tidak valid
-		if inquiryResult.Data.RC != "00" || inquiryResult.Data.Operator == "" {
-			return helpers.Response(c, 400, "Failed", inquiryResult.Data.Message, nil, nil)
+			return ppobErrorResponse(c, err, "Gagal request inquiry Data")
 		}
 
-		operatorName := strings.ToLower(inquiryResult.Data.Operator)
+		operatorName := strings.ToLower(inquiryResult.Operator)
 
 		// ✅ Daftar resmi operator internet
 		operatorMapping := map[string]string{
@@ -386,29 +272,15 @@ func GetListPrepaid(c *fiber.Ctx) error {
 			return helpers.Response(c, 400, "Failed", fmt.Sprintf("Operator %s tidak dikenali", operatorName), nil, nil)
 		}
 
-		// 🔁 Update URL endpoint agar diarahkan ke kategori operator mapping
-		url = fmt.Sprintf("https://prepaid.iak.dev/api/pricelist/%s/%s", typ, targetCategory)
-
-		// 🔁 Request ulang daftar produk sesuai kategori mapping
-		resp2, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
+		// 🔁 Request ulang daftar produk sesuai kategori operator mapping
+		pricelist2, err := prepaidPricelist(c, typ, targetCategory)
 		if err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal request API external", nil, nil)
-		}
-		defer resp2.Body.Close()
-
-		body2, _ := io.ReadAll(resp2.Body)
-		var result2 models.PrepaidResponse
-		if err := json.Unmarshal(body2, &result2); err != nil {
-			return helpers.Response(c, 400, "Failed", "Gagal decode response API", nil, nil)
-		}
-
-		if result2.Data.RC != "00" {
-			return helpers.Response(c, 400, "Failed", result2.Data.Message, nil, nil)
+			return ppobErrorResponse(c, err, "Gagal request API external")
 		}
 
 		// ✅ Filter hanya produk aktif dari hasil mapping
 		filtered := []models.ProductPrepaid{}
-		for _, item := range result2.Data.Pricelist {
+		for _, item := range pricelist2 {
 			if strings.ToLower(item.Status) == "active" {
 				filtered = append(filtered, item)
 			}
@@ -417,10 +289,11 @@ func GetListPrepaid(c *fiber.Ctx) error {
 		if len(filtered) == 0 {
 			return helpers.Response(c, 400, "Failed", fmt.Sprintf("Tidak ada produk untuk operator %s", operatorName), nil, nil)
 		}
+		applyPrepaidMargin(marginRules, typ, filtered)
 
 		// ✅ Gabungkan hasil inquiry + produk
 		combined := models.CombinedPrepaidResponse{
-			Customer:  inquiryResult.Data,
+			Customer:  inquiryResult,
 			Pricelist: filtered,
 		}
 
@@ -430,26 +303,39 @@ func GetListPrepaid(c *fiber.Ctx) error {
 	return helpers.Response(c, 200, "Success", "Data retrieved successfully", result.Data.Pricelist, nil)
 }
 
+// prepaidPricelist - pricelist dari katalog lokal, langsung ke provider jika katalog belum pernah disinkronkan
+func prepaidPricelist(c *fiber.Ctx, productType, operator string) ([]models.ProductPrepaid, error) {
+	if helpers.PpobCatalogSynced(configs.DB, models.PpobKindPrepaid) {
+		return helpers.PrepaidCatalog(configs.DB, productType, operator)
+	}
+	return ppob.Default().Pricelist(c.UserContext(), productType, operator)
+}
+
+// applyPrepaidMargin mengganti harga provider dengan harga jual sesuai aturan margin yang paling spesifik
+func applyPrepaidMargin(rules *helpers.PpobMarginRules, productType string, products []models.ProductPrepaid) {
+	for i := range products {
+		ref := helpers.PpobProductRef{
+			Category:    productType,
+			Operator:    products[i].ProductDescription,
+			ProductCode: products[i].ProductCode,
+		}
+		if ref.Category == "" {
+			ref.Category = products[i].ProductType
+		}
+		products[i].ProductPrice = rules.SellingPrice(ref, products[i].ProductPrice)
+	}
+}
+
 func UniqueEtollByDescription(products []models.ProductPrepaid) []models.ProductListPrepaid {
 	seen := make(map[string]bool)
 	unique := make([]models.ProductListPrepaid, 0)
 
-	// Regex untuk hapus tanda kurung dan spasi, ganti dengan "_"
-	re := regexp.MustCompile(`[()\s]+`)
-
 	for _, p := range products {
 		if !seen[p.ProductDescription] {
 			seen[p.ProductDescription] = true
 
 			// Bersihkan product description → jadi operator
-			operator := re.ReplaceAllString(p.ProductDescription, "_")
-
-			// Hapus underscore berlebih di awal/akhir dan tengah
-			operator = strings.Trim(operator, "_")
-			operator = strings.ReplaceAll(operator, "__", "_")
-
-			// Ubah jadi huruf kecil semua
-			operator = strings.ToLower(operator)
+			operator := helpers.PpobOperatorKey(p.ProductDescription)
 
 			unique = append(unique, models.ProductListPrepaid{
 				ProductDescription: p.ProductDescription,
@@ -464,8 +350,6 @@ func UniqueEtollByDescription(products []models.ProductPrepaid) []models.Product
 
 // topup prepaid and save to history
 func TopupPrepaid(c *fiber.Ctx) error {
-	username := os.Getenv("IDENTITY")
-
 	var reqBody struct {
 		RefID         string `json:"ref_id"`
 		UserID        uint   `json:"user_id"`
@@ -486,23 +370,74 @@ func TopupPrepaid(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Gagal membaca body", nil, nil)
 	}
 
-	// ⚡ PERBAIKAN: Gunakan TotalPrice yang sudah dalam format angka saja
-	// TotalPrice: "11500" (tanpa "Rp.")
-	productPrice, err := strconv.Atoi(reqBody.TotalPrice)
+	// Pembelian memotong saldo, hanya untuk diri sendiri (atau admin), kosong berarti diri sendiri
+	scopedUserID, err := helpers.ResolveSelfUserID(c, reqBody.UserID)
 	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Format total price tidak valid: "+reqBody.TotalPrice, nil, nil)
+		return helpers.ScopeResponse(c, err)
 	}
+	reqBody.UserID = scopedUserID
 
-	// Start database transaction
+	// Harga jual dihitung ulang dari katalog + aturan margin, total_price dari client hanya dicocokkan
+	product, err := helpers.FindPpobProduct(configs.DB, models.PpobKindPrepaid, reqBody.ProductCode)
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Gagal mengambil data produk", nil, nil)
+	}
+
+	var productPrice int
+	if product != nil {
+		if product.Status != models.PpobProductActive {
+			return helpers.Response(c, 400, "Failed", "Produk sedang tidak tersedia", nil, nil)
+		}
+
+		marginRules, err := helpers.LoadPpobMarginRules(configs.DB, time.Now())
+		if err != nil {
+			return helpers.Response(c, 500, "Failed", "Gagal mengambil margin dari database", nil, nil)
+		}
+		productPrice = int(marginRules.SellingPrice(helpers.PpobProductRef{
+			Category:    product.ProductType,
+			Operator:    product.ProductDescription,
+			ProductCode: product.ProductCode,
+		}, product.Price))
+
+		if reqBody.TotalPrice != "" {
+			clientPrice, err := strconv.Atoi(reqBody.TotalPrice)
+			if err != nil || clientPrice != productPrice {
+				return helpers.Response(c, 409, "Failed", "Harga produk sudah berubah, silakan muat ulang daftar harga",
+					fiber.Map{"total_price": productPrice}, nil)
+			}
+		}
+		reqBody.TotalPrice = strconv.Itoa(productPrice)
+	} else if helpers.PpobCatalogSynced(configs.DB, models.PpobKindPrepaid) {
+		return helpers.Response(c, 404, "Failed", "Produk tidak ditemukan", nil, nil)
+	} else {
+		// Katalog belum tersinkron: TotalPrice "11500" (tanpa "Rp.") dari client
+		productPrice, err = strconv.Atoi(reqBody.TotalPrice)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Format total price tidak valid: "+reqBody.TotalPrice, nil, nil)
+		}
+	}
+
+	// 1. Potong saldo dan simpan riwayat PROSES lalu commit SEBELUM request ke provider, supaya
+	// transaksi yang sudah terkirim ke provider selalu tercatat dan bisa diselesaikan reconciler
 	tx := configs.DB.Begin()
 
-	// 1. Cek dan potong saldo user di awal (dengan lock untuk avoid race condition)
 	var user models.User
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, reqBody.UserID).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, reqBody.UserID).Error; err != nil {
 		tx.Rollback()
 		return helpers.Response(c, 404, "Failed", "User tidak ditemukan", nil, nil)
 	}
 
+	// ref_id dipakai untuk settle, ref_id yang sama tidak boleh menahan saldo dua kali
+	var existing int64
+	if err := tx.Model(&models.HistoryModel{}).Where("ref_id = ?", reqBody.RefID).Count(&existing).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Gagal mengecek riwayat transaksi", nil, nil)
+	}
+	if reqBody.RefID == "" || existing > 0 {
+		tx.Rollback()
+		return helpers.Response(c, 409, "Failed", "Ref ID kosong atau sudah pernah dipakai", nil, nil)
+	}
+
 	// Validasi saldo user cukup
 	if user.Balance < productPrice {
 		tx.Rollback()
@@ -511,55 +446,22 @@ func TopupPrepaid(c *fiber.Ctx) error {
 				user.Balance, productPrice), nil, nil)
 	}
 
-	// Potong saldo user di awal
-	user.Balance -= productPrice
-	if err := tx.Save(&user).Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 500, "Failed", "Gagal memotong saldo user", nil, nil)
-	}
-
-	// 2. Request ke API eksternal
-	requestBody := models.ExternalRequestTopup{
-		Username:    username,
-		Sign:        helpers.MakeSignPricelist(reqBody.RefID),
-		RefId:       reqBody.RefID,
-		CustomerId:  reqBody.UserNumber,
-		ProductCode: reqBody.ProductCode,
-	}
-	jsonBody, _ := json.Marshal(requestBody)
-
-	resp, err := http.Post("https://prepaid.iak.dev/api/top-up", "application/json", bytes.NewBuffer(jsonBody))
+	// Dana ditahan di clearing PPOB sampai callback provider
+	_, err = helpers.NewLedgerService(tx).Post(
+		reqBody.RefID,
+		"Pembelian PPOB prabayar "+reqBody.ProductCode,
+		helpers.Debit(models.AccountUserWallet, user.Id, productPrice),
+		helpers.Credit(models.AccountPpobClearing, 0, productPrice),
+	)
 	if err != nil {
-		// ❌ Jika API request gagal, kembalikan saldo user
-		user.Balance += productPrice
-		tx.Save(&user)
-		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", "Gagal request API eksternal", nil, nil)
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var result models.PrepaidResponseTopup
-	if err := json.Unmarshal(body, &result); err != nil {
-		// ❌ Jika decode response gagal, kembalikan saldo user
-		user.Balance += productPrice
-		tx.Save(&user)
 		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", "Gagal decode response API", nil, nil)
-	}
-
-	// ⚠️ Jika response dari API gagal (misalnya status = 2 atau pesan MAXIMUM ...),
-	// maka kembalikan saldo user
-	if result.Data.Status == 2 || strings.Contains(strings.ToUpper(result.Data.Message), "MAXIMUM 1 NUMBER 1 TIME IN 1 DAY") {
-		user.Balance += productPrice
-		tx.Save(&user)
-		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", result.Data.Message, result.Data, nil)
+		return helpers.Response(c, 500, "Failed", "Gagal memotong saldo user", nil, nil)
 	}
+	user.Balance -= productPrice
 
-	// 3. Simpan riwayat ke database dengan status PROSES
 	history := models.HistoryModel{
 		UserID:        reqBody.UserID,
+		Kind:          models.PpobKindPrepaid,
 		RefID:         reqBody.RefID,
 		ProductName:   reqBody.ProductName,
 		ProductPrice:  reqBody.ProductPrice, // Tetap simpan yang asli dengan "Rp." untuk display
@@ -571,24 +473,69 @@ func TopupPrepaid(c *fiber.Ctx) error {
 		Year:          reqBody.Year,
 		Province:      reqBody.Province,
 		Region:        reqBody.Region,
-		Status:        "PROSES", // Menunggu callback
+		Status:        models.HistoryStatusPending, // Menunggu callback
 	}
 	if err := tx.Create(&history).Error; err != nil {
-		// ❌ Jika gagal simpan history, kembalikan saldo user
-		user.Balance += productPrice
-		tx.Save(&user)
 		tx.Rollback()
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate entry") {
+			// Request paralel dengan ref_id yang sama lolos pengecekan di atas lebih dulu
+			return helpers.Response(c, 409, "Failed", "Ref ID kosong atau sudah pernah dipakai", nil, nil)
+		}
 		return helpers.Response(c, 500, "Failed", "Gagal menyimpan riwayat transaksi", nil, nil)
 	}
 
-	// Commit transaction
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Gagal menyimpan riwayat transaksi", nil, nil)
+	}
+
+	// 2. Request ke provider PPOB
+	topup, err := ppob.Default().Topup(c.UserContext(), ppob.TopupRequest{
+		RefID:       reqBody.RefID,
+		CustomerID:  reqBody.UserNumber,
+		ProductCode: reqBody.ProductCode,
+	})
+	if err != nil {
+		var providerErr *ppob.ProviderError
+		if !errors.As(err, &providerErr) && !errors.Is(err, ppob.ErrNotConfigured) {
+			// Timeout/network/response tidak terbaca: provider mungkin sudah memproses, riwayat
+			// dibiarkan PROSES dan diselesaikan oleh callback atau reconciler
+			log.Printf("TopupPrepaid %s: provider result unknown, left pending: %v\n", reqBody.RefID, err)
+			return helpers.Response(c, 202, "Success", "Transaksi diproses, status akan diperbarui otomatis", history, nil)
+		}
+
+		// ❌ Ditolak provider (status = 2, limit harian, dll) atau tidak pernah terkirim: saldo dikembalikan
+		message := "Gagal request API eksternal"
+		if providerErr != nil {
+			message = providerErr.Message
+		}
+		if _, settleErr := settlePrepaidOutcome(reqBody.RefID, helpers.PrepaidOutcome{
+			ProductCode: reqBody.ProductCode,
+			Message:     message,
+		}); settleErr != nil {
+			log.Printf("TopupPrepaid %s: failed to refund rejected topup: %v\n", reqBody.RefID, settleErr)
+		}
+		if providerErr != nil {
+			return helpers.Response(c, 400, "Failed", providerErr.Message, topup, nil)
+		}
+		return ppobErrorResponse(c, err, "Gagal request API eksternal")
+	}
 
 	// Log untuk debugging
 	fmt.Printf("✅ TopupPrepaid berhasil - UserID: %d, Amount: Rp. %d, Saldo tersisa: Rp. %d, Status: PROSES\n",
 		reqBody.UserID, productPrice, user.Balance)
 
-	return helpers.Response(c, 200, "Success", "Transaksi diproses, menunggu konfirmasi", result.Data, nil)
+	return helpers.Response(c, 200, "Success", "Transaksi diproses, menunggu konfirmasi", topup, nil)
+}
+
+// settlePrepaidOutcome menjalankan helpers.SettlePrepaid dalam transaksi database sendiri
+func settlePrepaidOutcome(refID string, outcome helpers.PrepaidOutcome) (*models.HistoryModel, error) {
+	var settled *models.HistoryModel
+	err := configs.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		settled, err = helpers.SettlePrepaid(tx, refID, outcome)
+		return err
+	})
+	return settled, err
 }
 
 func CallbackPrepaid(c *fiber.Ctx) error {
@@ -610,8 +557,20 @@ func CallbackPrepaid(c *fiber.Ctx) error {
 		} `json:"data"`
 	}
 
+	// Semua callback dicatat untuk audit, hasil akhirnya diisi sebelum return
+	callbackLog := models.PpobCallbackLog{
+		Source:   models.CallbackSourceCallback,
+		RemoteIP: c.IP(),
+		RawBody:  string(c.Body()),
+		Result:   models.CallbackResultError,
+	}
+	defer func() {
+		configs.DB.Create(&callbackLog)
+	}()
+
 	// Parse JSON body
 	if err := c.BodyParser(&body); err != nil {
+		callbackLog.Error = err.Error()
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
 			"message": "invalid request body",
@@ -620,176 +579,105 @@ func CallbackPrepaid(c *fiber.Ctx) error {
 	}
 
 	data := body.Data
+	callbackLog.RefID = data.RefID
+	callbackLog.Status = data.Status
+	callbackLog.RC = data.RC
+	callbackLog.Message = data.Message
 
 	// Validasi ref_id
 	if strings.TrimSpace(data.RefID) == "" {
+		callbackLog.Error = "missing ref_id"
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
 			"message": "missing ref_id in callback data",
 		})
 	}
 
-	// Start database transaction
-	tx := configs.DB.Begin()
-
-	// 1. Cari history transaksi berdasarkan ref_id
-	var history models.HistoryModel
-	if err := tx.Where("ref_id = ?", data.RefID).First(&history).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+	// Sign callback IAK = md5(username + api key + ref_id)
+	expectedSign := helpers.MakeSignPricelist(data.RefID)
+	callbackLog.SignValid = subtle.ConstantTimeCompare([]byte(expectedSign), []byte(strings.ToLower(data.Sign))) == 1
+	if !callbackLog.SignValid {
+		callbackLog.Result = models.CallbackResultInvalidSignature
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
-			"message": "transaction not found",
+			"message": "invalid signature",
 		})
 	}
 
-	// 2. Siapkan data yang akan diupdate
-	updateData := map[string]any{
-		"status": data.Message, // "SUCCESS" atau "FAILED"
+	// Status "0" berarti masih diproses provider, tunggu callback berikutnya
+	success := data.Status == "1" && data.RC == "00"
+	if !success && data.Status != "2" {
+		callbackLog.Result = models.CallbackResultIgnored
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "transaction still in process",
+		})
 	}
 
-	// ⚡ PLN memiliki stroom_token, non-PLN kosong
-	if strings.Contains(strings.ToLower(data.ProductCode), "pln") {
-		parts := strings.Split(data.SN, "/")
-		if len(parts) > 0 {
-			updateData["stroom_token"] = strings.TrimSpace(parts[0])
-		}
-	} else {
-		updateData["stroom_token"] = ""
+	outcome := helpers.PrepaidOutcome{
+		Success:     success,
+		SN:          data.SN,
+		ProductCode: data.ProductCode,
+		Message:     data.Message,
 	}
-
-	// 3. Jika status SUCCESS (status = "1" dan rc = "00")
-	if data.Status == "1" && data.RC == "00" {
-		// ⚡ PERBAIKAN: Gunakan TotalPrice yang sudah dalam format angka
-		userPaidPrice, err := strconv.Atoi(history.TotalPrice)
-		if err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"status":  "error",
-				"message": "invalid total price format in history: " + history.TotalPrice,
-			})
-		}
-
+	if success {
 		// Convert real price dari callback ke int
 		realPrice, err := strconv.Atoi(data.Price)
 		if err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			callbackLog.Error = "invalid price format: " + data.Price
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"status":  "error",
 				"message": "invalid price format in callback: " + data.Price,
 			})
 		}
+		outcome.Price = realPrice
+	}
 
-		// 3a. Hitung margin (selisih antara yang dibayar user vs real price dari callback)
-		marginAmount := userPaidPrice - realPrice
-
-		if marginAmount > 0 {
-			// 3b. Tambah margin ke company balance
-			var company models.Company
-			if err := tx.First(&company).Error; err != nil {
-				// Jika company tidak ada, buat baru
-				company = models.Company{Balance: marginAmount}
-				if err := tx.Create(&company).Error; err != nil {
-					tx.Rollback()
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-						"status":  "error",
-						"message": "failed to create company record",
-					})
-				}
-			} else {
-				// Jika company sudah ada, tambah balance
-				company.Balance += marginAmount
-				if err := tx.Save(&company).Error; err != nil {
-					tx.Rollback()
-					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-						"status":  "error",
-						"message": "failed to update company balance",
-					})
-				}
-			}
-
-			// Hitung persentase margin
-			marginPercentage := (float64(marginAmount) / float64(realPrice)) * 100
-
-			fmt.Printf("💰 SUCCESS - Margin calculation:\n")
-			fmt.Printf("   User paid: Rp. %d\n", userPaidPrice)
-			fmt.Printf("   IAK price: Rp. %d\n", realPrice)
-			fmt.Printf("   Margin: Rp. %d (%.1f%%)\n", marginAmount, marginPercentage)
-			fmt.Printf("   Added to company balance\n")
-		} else if marginAmount == 0 {
-			fmt.Printf("ℹ️ SUCCESS - No margin. User paid: Rp. %d, IAK price: Rp. %d\n",
-				userPaidPrice, realPrice)
-		} else {
-			fmt.Printf("⚠️ SUCCESS - Negative margin detected! User paid less than IAK price\n")
-			fmt.Printf("   User paid: Rp. %d, IAK price: Rp. %d\n", userPaidPrice, realPrice)
-		}
-
-		// Update history status
-		if err := tx.Model(&history).Updates(updateData).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"status":  "error",
-				"message": "failed to update history",
-				"error":   err.Error(),
-			})
-		}
-
-		fmt.Printf("✅ Transaction SUCCESS - RefID: %s\n", data.RefID)
-
-	} else {
-		// 4. Jika status FAILED, kembalikan saldo ke user
-		fmt.Printf("❌ Transaction FAILED - Status: %s, RC: %s, Message: %s\n",
-			data.Status, data.RC, data.Message)
-
-		// ⚡ PERBAIKAN: Gunakan TotalPrice untuk refund
-		productPrice, err := strconv.Atoi(history.TotalPrice)
-		if err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"status":  "error",
-				"message": "invalid total price format for refund: " + history.TotalPrice,
-			})
-		}
+	// Start database transaction
+	tx := configs.DB.Begin()
 
-		// Kembalikan saldo ke user
-		var user models.User
-		if err := tx.First(&user, history.UserID).Error; err != nil {
-			tx.Rollback()
+	history, err := helpers.SettlePrepaid(tx, data.RefID, outcome)
+	if err != nil {
+		tx.Rollback()
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			callbackLog.Result = models.CallbackResultNotFound
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"status":  "error",
-				"message": "user not found for refund",
-			})
-		}
-
-		user.Balance += productPrice
-		if err := tx.Save(&user).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"status":  "error",
-				"message": "failed to refund user balance",
+				"message": "transaction not found",
 			})
-		}
-
-		// Update history status ke FAILED
-		if err := tx.Model(&history).Updates(updateData).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"status":  "error",
-				"message": "failed to update history status",
-				"error":   err.Error(),
+		case errors.Is(err, helpers.ErrPpobAlreadySettled):
+			// Callback ulang untuk ref_id yang sama tidak memproses saldo lagi
+			callbackLog.Result = models.CallbackResultDuplicate
+			return c.JSON(fiber.Map{
+				"status":  "success",
+				"message": "callback already processed",
+				"data": fiber.Map{
+					"ref_id": data.RefID,
+					"status": history.Status,
+				},
 			})
 		}
-
-		fmt.Printf("💰 Refund processed - UserID: %d, Amount: Rp. %d, New Balance: Rp. %d\n",
-			user.Id, productPrice, user.Balance)
+		callbackLog.Error = err.Error()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "failed to settle transaction",
+		})
 	}
 
-	// 5. Commit transaction
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		callbackLog.Error = err.Error()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "failed to commit transaction",
+		})
+	}
+	callbackLog.Result = models.CallbackResultProcessed
 
 	// Log untuk debugging
 	fmt.Println("✅ CallbackPrepaid processed at:", time.Now().Format("02-01-2006 15:04:05"))
-	fmt.Printf("📦 Callback data: RefID: %s, Status: %s, RC: %s, Message: %s\n",
-		data.RefID, data.Status, data.RC, data.Message)
+	fmt.Printf("📦 Callback data: RefID: %s, Status: %s, RC: %s, Message: %s, History: %s\n",
+		data.RefID, data.Status, data.RC, data.Message, history.Status)
 
 	// Kirim respon sukses
 	return c.JSON(fiber.Map{
@@ -828,6 +716,10 @@ func GetHistoryByRefID(c *fiber.Ctx) error {
 		return helpers.Response(c, 500, "Failed", "Failed to fetch history", nil, nil)
 	}
 
+	if err := helpers.ScopeUser(c, history.UserID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
 	// Format tanggal menjadi dd-mm-YYYY HH:MM
 	formattedHistory := fiber.Map{
 		"id":             history.Id,
@@ -852,3 +744,19 @@ func GetHistoryByRefID(c *fiber.Ctx) error {
 	// ✅ Respons sukses pakai helper
 	return helpers.Response(c, 200, "Success", "History retrieved successfully", formattedHistory, nil)
 }
+
+// ppobErrorResponse - terjemahkan error dari package ppob ke response API
+func ppobErrorResponse(c *fiber.Ctx, err error, failedMessage string) error {
+	var providerErr *ppob.ProviderError
+	switch {
+	case errors.As(err, &providerErr):
+		return helpers.Response(c, 400, "Failed", providerErr.Message, nil, nil)
+	case errors.Is(err, ppob.ErrNotConfigured):
+		return helpers.Response(c, 400, "Failed", "Username or sign is Empty", nil, nil)
+	case errors.Is(err, ppob.ErrUnavailable):
+		return helpers.Response(c, 502, "Failed", failedMessage, nil, nil)
+	case errors.Is(err, ppob.ErrInvalidResponse):
+		return helpers.Response(c, 502, "Failed", "Gagal decode response API", nil, nil)
+	}
+	return helpers.Response(c, 400, "Failed", failedMessage, nil, nil)
+}
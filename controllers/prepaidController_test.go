@@ -0,0 +1,410 @@
+package controllers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"backend-mulungs/ppob"
+	"backend-mulungs/testdb"
+	"backend-mulungs/workers"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ppobTestEnv - database SQLite in-memory dan ppob.Fake sebagai provider default selama satu test
+type ppobTestEnv struct {
+	t    *testing.T
+	db   *gorm.DB
+	fake *ppob.Fake
+	app  *fiber.App
+	user models.User
+}
+
+func newPpobTestEnv(t *testing.T, balance int) *ppobTestEnv {
+	t.Helper()
+
+	db := testdb.Open(t,
+		&models.User{},
+		&models.HistoryModel{},
+		&models.LedgerJournal{},
+		&models.LedgerEntry{},
+		&models.Company{},
+		&models.PpobCallbackLog{},
+		&models.PpobProduct{},
+		&models.PpobCatalogSync{},
+		&models.PpobMarginRule{},
+		&models.Ppob{},
+		&models.PpobInquiry{},
+	)
+
+	// Katalog lokal berisi harga provider Fake, margin flat Rp500 untuk pulsa
+	err := db.Create(&models.PpobCatalogSync{Kind: models.PpobKindPrepaid, Status: models.CatalogSyncSuccess}).Error
+	if err != nil {
+		t.Fatalf("create catalog sync: %v", err)
+	}
+	// hsmartfren5000 ada di katalog tapi tidak dikenal Fake, sehingga ditolak provider
+	err = db.Create(&[]models.PpobProduct{
+		{Kind: models.PpobKindPrepaid, ProductCode: "htelkomsel10000", ProductDescription: "Telkomsel", ProductType: "pulsa", Price: 10500, Status: models.PpobProductActive},
+		{Kind: models.PpobKindPrepaid, ProductCode: "hsmartfren5000", ProductDescription: "Smartfren", ProductType: "pulsa", Price: 5500, Status: models.PpobProductActive},
+	}).Error
+	if err != nil {
+		t.Fatalf("create products: %v", err)
+	}
+	err = db.Create(&models.PpobMarginRule{Name: "Pulsa", Category: "pulsa", Type: models.MarginTypeFlat, Value: 500, IsActive: true}).Error
+	if err != nil {
+		t.Fatalf("create margin rule: %v", err)
+	}
+
+	env := &ppobTestEnv{t: t, db: db, fake: ppob.NewFake()}
+	env.user = models.User{Name: "Nasabah Uji", Email: "nasabah@example.com", Balance: balance, Status: "active"}
+	if err := db.Create(&env.user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	previousDB, previousProvider := configs.DB, ppob.Default()
+	configs.DB = db
+	ppob.SetDefault(env.fake)
+	t.Cleanup(func() {
+		configs.DB = previousDB
+		ppob.SetDefault(previousProvider)
+	})
+
+	env.app = fiber.New()
+	env.app.Use(func(c *fiber.Ctx) error {
+		user := env.user
+		c.Locals(helpers.LocalAuthUser, &user)
+		c.Locals(helpers.LocalAuthRole, models.RoleUser)
+		return c.Next()
+	})
+	env.app.Post("/prepaid/topup", TopupPrepaid)
+	env.app.Post("/prepaid/callback", CallbackPrepaid)
+	env.app.Post("/postpaid/inquiry", PostpaidInquiry)
+	env.app.Post("/postpaid/payment", PaymentPostpaid)
+
+	return env
+}
+
+func (env *ppobTestEnv) post(path string, body any) (int, map[string]any) {
+	env.t.Helper()
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		env.t.Fatalf("marshal body: %v", err)
+	}
+	req := httptest.NewRequest("POST", path, strings.NewReader(string(raw)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := env.app.Test(req, -1)
+	if err != nil {
+		env.t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var decoded map[string]any
+	json.Unmarshal(respBody, &decoded)
+	return resp.StatusCode, decoded
+}
+
+func (env *ppobTestEnv) topup(refID, customerID string) (int, map[string]any) {
+	env.t.Helper()
+	return env.post("/prepaid/topup", map[string]any{
+		"ref_id":       refID,
+		"product_code": "htelkomsel10000",
+		"product_name": "Telkomsel 10.000",
+		"product_type": "pulsa",
+		"user_number":  customerID,
+	})
+}
+
+// callback mengirim hasil CheckStatus dari Fake sebagai callback IAK bertanda tangan
+func (env *ppobTestEnv) callback(refID string) (int, map[string]any) {
+	env.t.Helper()
+
+	status, err := env.fake.CheckStatus(context.Background(), refID)
+	if err != nil {
+		env.t.Fatalf("fake check status: %v", err)
+	}
+	code := "2"
+	if status.Status == ppob.StatusSuccess {
+		code = "1"
+	}
+	return env.post("/prepaid/callback", map[string]any{
+		"data": map[string]any{
+			"ref_id":       refID,
+			"status":       code,
+			"product_code": status.ProductCode,
+			"price":        fmt.Sprint(status.Price),
+			"message":      status.Message,
+			"sn":           status.SN,
+			"rc":           status.RC,
+			"sign":         helpers.MakeSignPricelist(refID),
+		},
+	})
+}
+
+func (env *ppobTestEnv) balance() int {
+	env.t.Helper()
+	var balance int
+	if err := env.db.Table("users").Select("balance").Where("id = ?", env.user.Id).Scan(&balance).Error; err != nil {
+		env.t.Fatalf("load balance: %v", err)
+	}
+	return balance
+}
+
+func (env *ppobTestEnv) history(refID string) models.HistoryModel {
+	env.t.Helper()
+	var history models.HistoryModel
+	if err := env.db.Where("ref_id = ?", refID).First(&history).Error; err != nil {
+		env.t.Fatalf("load history %s: %v", refID, err)
+	}
+	return history
+}
+
+func (env *ppobTestEnv) ledgerBalance(accountType string, accountID uint) int {
+	env.t.Helper()
+	balance, err := helpers.NewLedgerService(env.db).Balance(accountType, accountID)
+	if err != nil {
+		env.t.Fatalf("ledger balance %s: %v", accountType, err)
+	}
+	return balance
+}
+
+func TestTopupPrepaidSuccess(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+
+	status, body := env.topup("REF-OK-1", "081234567891")
+	if status != fiber.StatusOK {
+		t.Fatalf("topup status = %d, body %v", status, body)
+	}
+	if got := env.balance(); got != 39000 {
+		t.Fatalf("balance after topup = %d, want 39000", got)
+	}
+	if got := env.history("REF-OK-1").Status; got != models.HistoryStatusPending {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusPending)
+	}
+
+	status, body = env.callback("REF-OK-1")
+	if status != fiber.StatusOK {
+		t.Fatalf("callback status = %d, body %v", status, body)
+	}
+	if got := env.history("REF-OK-1").Status; got != models.HistoryStatusSuccess {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusSuccess)
+	}
+	if got := env.balance(); got != 39000 {
+		t.Fatalf("balance after success = %d, want 39000", got)
+	}
+	if got := env.ledgerBalance(models.AccountPpobClearing, 0); got != 0 {
+		t.Fatalf("ppob clearing = %d, want 0", got)
+	}
+	var company models.Company
+	env.db.First(&company)
+	if company.Balance != 500 {
+		t.Fatalf("company revenue = %d, want 500", company.Balance)
+	}
+}
+
+func TestTopupPrepaidFailureRefund(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+
+	// Nomor berakhiran 0 selalu gagal di Fake
+	status, body := env.topup("REF-FAIL-1", "081234567890")
+	if status != fiber.StatusOK {
+		t.Fatalf("topup status = %d, body %v", status, body)
+	}
+	status, body = env.callback("REF-FAIL-1")
+	if status != fiber.StatusOK {
+		t.Fatalf("callback status = %d, body %v", status, body)
+	}
+
+	if got := env.history("REF-FAIL-1").Status; got != models.HistoryStatusFailed {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusFailed)
+	}
+	if got := env.balance(); got != 50000 {
+		t.Fatalf("balance after refund = %d, want 50000", got)
+	}
+	if got := env.ledgerBalance(models.AccountUserWallet, env.user.Id); got != 0 {
+		t.Fatalf("wallet ledger delta = %d, want 0", got)
+	}
+}
+
+func TestTopupPrepaidRejectedByProviderRefunds(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+
+	// Produk yang tidak dikenal Fake ditolak langsung saat Topup
+	status, body := env.post("/prepaid/topup", map[string]any{
+		"ref_id":       "REF-REJECT-1",
+		"product_code": "hsmartfren5000",
+		"user_number":  "081234567891",
+	})
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("topup status = %d, want 400, body %v", status, body)
+	}
+	if got := env.history("REF-REJECT-1").Status; got != models.HistoryStatusFailed {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusFailed)
+	}
+	if got := env.balance(); got != 50000 {
+		t.Fatalf("balance after rejection = %d, want 50000", got)
+	}
+}
+
+func TestCallbackPrepaidSettlesOnce(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+
+	if status, body := env.topup("REF-DUP-1", "081234567890"); status != fiber.StatusOK {
+		t.Fatalf("topup status = %d, body %v", status, body)
+	}
+	for i := 0; i < 3; i++ {
+		if status, body := env.callback("REF-DUP-1"); status != fiber.StatusOK {
+			t.Fatalf("callback #%d status = %d, body %v", i+1, status, body)
+		}
+	}
+
+	// Refund hanya sekali walaupun callback datang tiga kali
+	if got := env.balance(); got != 50000 {
+		t.Fatalf("balance after repeated callbacks = %d, want 50000", got)
+	}
+	var journals int64
+	env.db.Model(&models.LedgerJournal{}).Where("reference = ?", "REF-DUP-1").Count(&journals)
+	if journals != 2 {
+		t.Fatalf("journals for REF-DUP-1 = %d, want 2 (hold and refund)", journals)
+	}
+	var duplicates int64
+	env.db.Model(&models.PpobCallbackLog{}).Where("ref_id = ? AND result = ?", "REF-DUP-1", models.CallbackResultDuplicate).Count(&duplicates)
+	if duplicates != 2 {
+		t.Fatalf("duplicate callback logs = %d, want 2", duplicates)
+	}
+}
+
+func TestPpobReconcilerResolvesPending(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+
+	if status, body := env.topup("REF-REC-OK", "081234567891"); status != fiber.StatusOK {
+		t.Fatalf("topup status = %d, body %v", status, body)
+	}
+	if status, body := env.topup("REF-REC-FAIL", "081234567890"); status != fiber.StatusOK {
+		t.Fatalf("topup status = %d, body %v", status, body)
+	}
+	env.db.Model(&models.HistoryModel{}).Where("1 = 1").Update("created_at", time.Now().Add(-time.Hour))
+
+	reconciler := &workers.PpobReconciler{Provider: env.fake, StaleAfter: 10 * time.Minute, BatchSize: 10}
+	result, err := reconciler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if result.Checked != 2 || result.Success != 1 || result.Failed != 1 || result.Errors != 0 {
+		t.Fatalf("reconcile result = %+v, want 1 success and 1 failed", result)
+	}
+
+	if got := env.history("REF-REC-OK").Status; got != models.HistoryStatusSuccess {
+		t.Fatalf("REF-REC-OK status = %s, want %s", got, models.HistoryStatusSuccess)
+	}
+	if got := env.history("REF-REC-FAIL").Status; got != models.HistoryStatusFailed {
+		t.Fatalf("REF-REC-FAIL status = %s, want %s", got, models.HistoryStatusFailed)
+	}
+	if got := env.balance(); got != 39000 {
+		t.Fatalf("balance after reconcile = %d, want 39000", got)
+	}
+
+	// Callback yang datang terlambat tidak mengubah apa pun
+	if status, body := env.callback("REF-REC-FAIL"); status != fiber.StatusOK {
+		t.Fatalf("late callback status = %d, body %v", status, body)
+	}
+	if got := env.balance(); got != 39000 {
+		t.Fatalf("balance after late callback = %d, want 39000", got)
+	}
+}
+
+// timeoutProvider - Fake yang memproses topup tetapi response-nya hilang di jalan (timeout)
+type timeoutProvider struct {
+	*ppob.Fake
+}
+
+func (p timeoutProvider) Topup(ctx context.Context, req ppob.TopupRequest) (*models.DataTopup, error) {
+	if _, err := p.Fake.Topup(ctx, req); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: context deadline exceeded", ppob.ErrUnavailable)
+}
+
+func TestTopupPrepaidTimeoutLeftPendingForReconciler(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+	ppob.SetDefault(timeoutProvider{env.fake})
+
+	status, body := env.topup("REF-TIMEOUT-1", "081234567891")
+	if status != fiber.StatusAccepted {
+		t.Fatalf("topup status = %d, want 202, body %v", status, body)
+	}
+	// Saldo tetap ditahan, tidak di-refund karena provider mungkin sudah memproses
+	if got := env.history("REF-TIMEOUT-1").Status; got != models.HistoryStatusPending {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusPending)
+	}
+	if got := env.balance(); got != 39000 {
+		t.Fatalf("balance after timeout = %d, want 39000", got)
+	}
+
+	env.db.Model(&models.HistoryModel{}).Where("ref_id = ?", "REF-TIMEOUT-1").Update("created_at", time.Now().Add(-time.Hour))
+	reconciler := &workers.PpobReconciler{Provider: env.fake, StaleAfter: 10 * time.Minute, BatchSize: 10}
+	if _, err := reconciler.RunOnce(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if got := env.history("REF-TIMEOUT-1").Status; got != models.HistoryStatusSuccess {
+		t.Fatalf("history status after reconcile = %s, want %s", got, models.HistoryStatusSuccess)
+	}
+	if got := env.balance(); got != 39000 {
+		t.Fatalf("balance after reconcile = %d, want 39000", got)
+	}
+}
+
+// lostProvider - request topup tidak pernah sampai ke provider
+type lostProvider struct {
+	*ppob.Fake
+}
+
+func (p lostProvider) Topup(ctx context.Context, req ppob.TopupRequest) (*models.DataTopup, error) {
+	return nil, fmt.Errorf("%w: connection reset", ppob.ErrUnavailable)
+}
+
+func TestPpobReconcilerFailsTransactionNotFound(t *testing.T) {
+	env := newPpobTestEnv(t, 50000)
+	ppob.SetDefault(lostProvider{env.fake})
+
+	if status, body := env.topup("REF-LOST-1", "081234567891"); status != fiber.StatusAccepted {
+		t.Fatalf("topup status = %d, want 202, body %v", status, body)
+	}
+
+	reconciler := &workers.PpobReconciler{Provider: env.fake, StaleAfter: 10 * time.Minute, NotFoundAfter: time.Hour, BatchSize: 10}
+
+	// Belum melewati NotFoundAfter: dicoba lagi nanti, saldo tetap ditahan
+	env.db.Model(&models.HistoryModel{}).Where("ref_id = ?", "REF-LOST-1").Update("created_at", time.Now().Add(-30*time.Minute))
+	result, err := reconciler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if result.Errors != 1 || env.history("REF-LOST-1").Status != models.HistoryStatusPending {
+		t.Fatalf("reconcile result = %+v, want row left pending", result)
+	}
+
+	env.db.Model(&models.HistoryModel{}).Where("ref_id = ?", "REF-LOST-1").Update("created_at", time.Now().Add(-2*time.Hour))
+	result, err = reconciler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if result.Failed != 1 || result.Errors != 0 {
+		t.Fatalf("reconcile result = %+v, want 1 failed", result)
+	}
+	if got := env.history("REF-LOST-1").Status; got != models.HistoryStatusFailed {
+		t.Fatalf("history status = %s, want %s", got, models.HistoryStatusFailed)
+	}
+	if got := env.balance(); got != 50000 {
+		t.Fatalf("balance after not found = %d, want 50000", got)
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // GetTotalWaste - Get total waste weight
@@ -84,6 +86,17 @@ func GetProductWasteList(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch product waste", nil, nil)
 	}
 
+	// Harga yang berlaku sekarang untuk bank pada ?parent_bank_id=/?child_bank_id= (default: bank user
+	// yang login), termasuk harga terjadwal yang sudah jatuh tempo
+	scope, err := wastePriceScopeFromQuery(c, true)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+	prices, err := helpers.CurrentWastePrices(configs.DB, products, scope, time.Now())
+	if err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch product waste prices", nil, nil)
+	}
+
 	// Format response
 	var formattedProducts []map[string]any
 	for i, product := range products {
@@ -93,8 +106,9 @@ func GetProductWasteList(c *fiber.Ctx) error {
 			"waste_type":   product.WasteType,
 			"image":        product.Image,
 			"unit":         product.Unit,
-			"price":        product.Price,
-			"price_format": FormatCurrency(product.Price),
+			"price":        prices[product.Id].Price,
+			"price_format": FormatCurrency(prices[product.Id].Price),
+			"price_level":  prices[product.Id].Level,
 			"category":     product.Category,
 			"created_at":   product.CreatedAt,
 			"updated_at":   product.UpdatedAt,
@@ -142,6 +156,12 @@ func CreateProductWaste(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Category must be 'organik' or 'anorganik'", nil, nil)
 	}
 
+	// Validate unit, disimpan dalam bentuk baku (kg, ons, gram, liter, pcs)
+	unit, err = helpers.NormalizeWasteUnit(unit)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+
 	// Convert price to int
 	price, err := strconv.Atoi(priceStr)
 	if err != nil {
@@ -204,8 +224,15 @@ func CreateProductWaste(c *fiber.Ctx) error {
 		// Tidak ada file yang diupload, lanjut tanpa image
 	}
 
-	// Create product waste data di database
-	if err := configs.DB.Create(&product).Error; err != nil {
+	// Create product waste data di database beserta harga awal di riwayat harga
+	err = configs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		_, err := helpers.RecordWastePrice(tx, product.Id, helpers.WastePriceScope{}, product.Price, time.Now(), "Harga awal", helpers.AuthUserID(c))
+		return err
+	})
+	if err != nil {
 		// Jika upload foto berhasil tapi database gagal, hapus file dari S3
 		if product.Image != "" {
 			s3Service := helpers.NewS3Service()
@@ -255,7 +282,11 @@ func UpdateProductWaste(c *fiber.Ctx) error {
 		product.WasteType = wasteType
 	}
 	if unit != "" {
-		product.Unit = unit
+		normalizedUnit, err := helpers.NormalizeWasteUnit(unit)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+		}
+		product.Unit = normalizedUnit
 	}
 	if category != "" {
 		if category != "organik" && category != "anorganik" {
@@ -263,11 +294,13 @@ func UpdateProductWaste(c *fiber.Ctx) error {
 		}
 		product.Category = category
 	}
+	priceChanged := false
 	if priceStr != "" {
 		price, err := strconv.Atoi(priceStr)
-		if err != nil {
+		if err != nil || price < 0 {
 			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid price format", nil, nil)
 		}
+		priceChanged = price != product.Price
 		product.Price = price
 	}
 
@@ -326,8 +359,18 @@ func UpdateProductWaste(c *fiber.Ctx) error {
 		fmt.Printf("No new image file uploaded, keeping existing image\n")
 	}
 
-	// Update product waste data di database
-	if err := configs.DB.Save(&product).Error; err != nil {
+	// Update product waste data di database, perubahan harga langsung berlaku dan dicatat di riwayat
+	err = configs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		if !priceChanged {
+			return nil
+		}
+		_, err := helpers.RecordWastePrice(tx, product.Id, helpers.WastePriceScope{}, product.Price, time.Now(), "", helpers.AuthUserID(c))
+		return err
+	})
+	if err != nil {
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update product waste: "+err.Error(), nil, nil)
 	}
 
@@ -353,6 +396,292 @@ func DeleteProductWaste(c *fiber.Ctx) error {
 	return helpers.Response(c, 200, "Success", "Product waste deleted successfully", nil, nil)
 }
 
+// GetProductWastePrices - riwayat dan jadwal harga satu produk sampah.
+// ?parent_bank_id= atau ?child_bank_id= untuk melihat override bank tersebut.
+func GetProductWastePrices(c *fiber.Ctx) error {
+	var product models.ProductWaste
+	if err := configs.DB.First(&product, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Product waste not found", nil, nil)
+	}
+
+	scope, err := wastePriceScopeFromQuery(c, false)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+
+	response, err := productWastePriceTimeline(product, scope, time.Now())
+	if err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch price history", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Price history retrieved successfully", response, nil)
+}
+
+// GetWastePriceHistory - perkembangan harga per jenis sampah, ?waste_type= (sebagian nama)
+// dan ?from=&to= (YYYY-MM-DD) untuk membatasi periode
+func GetWastePriceHistory(c *fiber.Ctx) error {
+	wasteType := strings.TrimSpace(c.Query("waste_type"))
+	if wasteType == "" {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "waste_type is required", nil, nil)
+	}
+
+	scope, err := wastePriceScopeFromQuery(c, false)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+
+	var products []models.ProductWaste
+	if err := configs.DB.Where("waste_type LIKE ?", "%"+wasteType+"%").Order("waste_type").Find(&products).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch product waste", nil, nil)
+	}
+
+	var from, to time.Time
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromStr, time.Local)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid from date format, use YYYY-MM-DD", nil, nil)
+		}
+		from = parsed
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toStr, time.Local)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid to date format, use YYYY-MM-DD", nil, nil)
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	now := time.Now()
+	result := make([]map[string]any, 0, len(products))
+	for _, product := range products {
+		timeline, err := productWastePriceTimeline(product, scope, now)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch price history", nil, nil)
+		}
+
+		history := timeline["history"].([]models.ProductWastePrice)
+		filtered := make([]models.ProductWastePrice, 0, len(history))
+		for _, price := range history {
+			if !from.IsZero() && price.EffectiveFrom.Before(from) {
+				continue
+			}
+			if !to.IsZero() && !price.EffectiveFrom.Before(to) {
+				continue
+			}
+			filtered = append(filtered, price)
+		}
+		timeline["history"] = filtered
+		result = append(result, timeline)
+	}
+
+	return helpers.Response(c, 200, "Success", "Price history retrieved successfully", result, nil)
+}
+
+// ScheduleProductWastePrice - catat harga baru, effective_from kosong berarti berlaku sekarang.
+// parent_bank_id/child_bank_id di body membuat override untuk bank tersebut, tanpa keduanya
+// mengubah harga default company (khusus admin).
+func ScheduleProductWastePrice(c *fiber.Ctx) error {
+	var product models.ProductWaste
+	if err := configs.DB.First(&product, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Product waste not found", nil, nil)
+	}
+
+	var body struct {
+		Price         *int       `json:"price"`
+		EffectiveFrom *time.Time `json:"effective_from"`
+		Note          string     `json:"note"`
+		ParentBankID  *uint      `json:"parent_bank_id"`
+		ChildBankID   *uint      `json:"child_bank_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+	if body.Price == nil || *body.Price < 0 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Price is required and cannot be negative", nil, nil)
+	}
+	if body.ParentBankID != nil && body.ChildBankID != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Cannot specify both parent_bank_id and child_bank_id", nil, nil)
+	}
+
+	scope := helpers.WastePriceScope{ParentBankID: body.ParentBankID, ChildBankID: body.ChildBankID}
+	if err := scopeWastePriceLevel(c, scope); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	now := time.Now()
+	effectiveFrom := now
+	if body.EffectiveFrom != nil {
+		// Riwayat tidak boleh diubah mundur karena setoran lama sudah memakai harga saat itu
+		if body.EffectiveFrom.Before(now.Add(-time.Minute)) {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Effective from cannot be in the past", nil, nil)
+		}
+		if body.EffectiveFrom.After(now) {
+			effectiveFrom = *body.EffectiveFrom
+		}
+	}
+
+	price, err := helpers.RecordWastePrice(configs.DB, product.Id, scope, *body.Price, effectiveFrom, body.Note, helpers.AuthUserID(c))
+	if err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to save price", nil, nil)
+	}
+
+	message := "Price updated successfully"
+	if effectiveFrom.After(now) {
+		message = "Price scheduled successfully"
+	}
+	return helpers.Response(c, 201, "Success", message, price, nil)
+}
+
+// CancelProductWastePrice - batalkan harga terjadwal yang belum berlaku
+func CancelProductWastePrice(c *fiber.Ctx) error {
+	var price models.ProductWastePrice
+	if err := configs.DB.Where("id = ? AND product_waste_id = ?", c.Params("price_id"), c.Params("id")).First(&price).Error; err != nil {
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Scheduled price not found", nil, nil)
+	}
+
+	scope := helpers.WastePriceScope{ParentBankID: price.ParentBankID, ChildBankID: price.ChildBankID}
+	if err := scopeWastePriceLevel(c, scope); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	if !price.EffectiveFrom.After(time.Now()) {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Price is already effective and cannot be cancelled", nil, nil)
+	}
+
+	if err := configs.DB.Delete(&price).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to cancel scheduled price", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Scheduled price cancelled successfully", nil, nil)
+}
+
+// RemoveProductWastePriceOverride - hapus override bank (?parent_bank_id= atau ?child_bank_id=)
+// sehingga harga kembali mengikuti level di atasnya. Setoran lama tidak berubah karena menyimpan snapshot harga.
+func RemoveProductWastePriceOverride(c *fiber.Ctx) error {
+	var product models.ProductWaste
+	if err := configs.DB.First(&product, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Product waste not found", nil, nil)
+	}
+
+	scope, err := wastePriceScopeFromQuery(c, false)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+	if scope.Level() == models.WastePriceLevelDefault {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "parent_bank_id or child_bank_id is required", nil, nil)
+	}
+	if err := scopeWastePriceLevel(c, scope); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	prices, err := helpers.WastePriceHistory(configs.DB, product.Id, scope)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch price override", nil, nil)
+	}
+	if len(prices) == 0 {
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Price override not found", nil, nil)
+	}
+
+	if err := configs.DB.Delete(&prices).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to remove price override", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Price override removed successfully", nil, nil)
+}
+
+// productWastePriceTimeline - harga efektif sekarang (dengan pewarisan), serta riwayat dan jadwal
+// pada level scope
+func productWastePriceTimeline(product models.ProductWaste, scope helpers.WastePriceScope, now time.Time) (map[string]any, error) {
+	current, err := helpers.ResolveWastePrice(configs.DB, product, scope, now)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := helpers.WastePriceHistory(configs.DB, product.Id, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []models.ProductWastePrice{}
+	scheduled := []models.ProductWastePrice{}
+	for _, price := range prices {
+		if price.EffectiveFrom.After(now) {
+			scheduled = append(scheduled, price)
+			continue
+		}
+		history = append(history, price)
+	}
+
+	return map[string]any{
+		"product_waste_id": product.Id,
+		"waste_type":       product.WasteType,
+		"unit":             product.Unit,
+		"level":            scope.Level(),
+		"current_price":    current.Price,
+		"current_level":    current.Level,
+		"history":          history,
+		"scheduled":        scheduled,
+	}, nil
+}
+
+// wastePriceScopeFromQuery membaca ?parent_bank_id= / ?child_bank_id=. Jika keduanya kosong dan
+// useAuthBank aktif, bank milik user yang login yang dipakai.
+func wastePriceScopeFromQuery(c *fiber.Ctx, useAuthBank bool) (helpers.WastePriceScope, error) {
+	parentBankID, err := optionalUintQuery(c, "parent_bank_id")
+	if err != nil {
+		return helpers.WastePriceScope{}, err
+	}
+	childBankID, err := optionalUintQuery(c, "child_bank_id")
+	if err != nil {
+		return helpers.WastePriceScope{}, err
+	}
+	if parentBankID != nil && childBankID != nil {
+		return helpers.WastePriceScope{}, fmt.Errorf("cannot specify both parent_bank_id and child_bank_id")
+	}
+
+	if parentBankID == nil && childBankID == nil && useAuthBank {
+		if user := helpers.AuthUser(c); user != nil {
+			parentBankID, childBankID = user.ParentBankID, user.ChildBankID
+			if childBankID != nil {
+				parentBankID = nil
+			}
+		}
+	}
+
+	scope, err := helpers.NewWastePriceScope(configs.DB, parentBankID, childBankID)
+	if err != nil {
+		return helpers.WastePriceScope{}, fmt.Errorf("child bank not found")
+	}
+	return scope, nil
+}
+
+// scopeWastePriceLevel - harga default hanya admin, override bank oleh operator bank tersebut
+func scopeWastePriceLevel(c *fiber.Ctx, scope helpers.WastePriceScope) error {
+	switch scope.Level() {
+	case models.WastePriceLevelChildBank:
+		return helpers.ScopeBank(c, nil, scope.ChildBankID)
+	case models.WastePriceLevelParentBank:
+		return helpers.ScopeBank(c, scope.ParentBankID, nil)
+	}
+	if helpers.HasRole(c, models.RoleAdmin) {
+		return nil
+	}
+	return helpers.ErrForbidden
+}
+
+func optionalUintQuery(c *fiber.Ctx, key string) (*uint, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s format", key)
+	}
+	id := uint(parsed)
+	return &id, nil
+}
+
 // Helper function untuk format currency (simple version)
 func FormatCurrency(amount int) string {
 	return "Rp" + strconv.Itoa(amount)
@@ -1,95 +1,264 @@
 package controllers
 
 import (
+	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+const maxRegionSearchLimit = 100
+
 func RegionProvince(c *fiber.Ctx) error {
-	url := "https://ibnux.github.io/data-indonesia/provinsi.json"
-	resp, err := http.Get(url)
+	return listRegions(c, models.RegionLevelProvince, "", "provinsi.json", "List of provinces")
+}
 
-	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Cannot get data province", nil, nil)
-	}
-	defer resp.Body.Close()
+func RegionDistrict(c *fiber.Ctx) error {
+	idPovince := c.Query("idProvince")
+	return listRegions(c, models.RegionLevelDistrict, idPovince, fmt.Sprintf("kabupaten/%s.json", idPovince), "List of districts")
+}
 
-	body, _ := io.ReadAll(resp.Body)
+func RegionSubDistrict(c *fiber.Ctx) error {
+	idDistrict := c.Query("idDistrict")
+	return listRegions(c, models.RegionLevelSubdistrict, idDistrict, fmt.Sprintf("kecamatan/%s.json", idDistrict), "List of subdistricts")
+}
 
-	var result []models.RegionResponse
+func RegionVillage(c *fiber.Ctx) error {
+	idSubdistrict := c.Query("idSubdistrict")
+	return listRegions(c, models.RegionLevelVillage, idSubdistrict, fmt.Sprintf("kelurahan/%s.json", idSubdistrict), "List of villages")
+}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed to decode API response", nil, nil)
+// listRegions - wilayah satu tingkat dari tabel regions, ?search= untuk filter nama. Selama dataset
+// belum diimport (tabel kosong) masih membaca data-indonesia milik ibnux seperti sebelumnya.
+func listRegions(c *fiber.Ctx, level, parentCode, remotePath, message string) error {
+	var imported int64
+	if err := configs.DB.Model(&models.Region{}).Limit(1).Count(&imported).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch regions", nil, nil)
+	}
+	if imported == 0 {
+		return remoteRegions(c, remotePath, message)
 	}
 
-	return helpers.Response(c, 200, "Success", "List of provinces", result, nil)
-}
+	query := configs.DB.Where("level = ? AND is_active = ?", level, true)
+	if level != models.RegionLevelProvince {
+		if parentCode == "" {
+			return helpers.Response(c, 400, "Failed", "Parent region id is required", nil, nil)
+		}
+		query = query.Where("parent_code = ?", helpers.NormalizeRegionCode(parentCode))
+	}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		query = query.Where("name LIKE ?", "%"+search+"%")
+	}
 
-func RegionDistrict(c *fiber.Ctx) error {
-	idPovince := c.Query("idProvince")
-	url := fmt.Sprintf("https://ibnux.github.io/data-indonesia/kabupaten/%s.json", idPovince)
-	resp, err := http.Get(url)
+	var regions []models.Region
+	if err := query.Order("code ASC").Find(&regions).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch regions", nil, nil)
+	}
 
+	result := make([]models.RegionResponse, 0, len(regions))
+	for _, region := range regions {
+		response := models.RegionResponse{Id: region.Code, Name: region.Name}
+		if region.Latitude != nil && region.Longitude != nil {
+			response.Latitude, response.Longitude = *region.Latitude, *region.Longitude
+		}
+		result = append(result, response)
+	}
+	return helpers.Response(c, 200, "Success", message, result, nil)
+}
+
+func remoteRegions(c *fiber.Ctx, path, message string) error {
+	resp, err := http.Get("https://ibnux.github.io/data-indonesia/" + path)
 	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Cannot get data province", nil, nil)
+		return helpers.Response(c, 400, "Failed", "Cannot get data region", nil, nil)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 
 	var result []models.RegionResponse
-
 	if err := json.Unmarshal(body, &result); err != nil {
 		return helpers.Response(c, 400, "Failed", "Failed to decode API response", nil, nil)
 	}
 
-	return helpers.Response(c, 200, "Success", "List of provinces", result, nil)
+	return helpers.Response(c, 200, "Success", message, result, nil)
 }
 
-func RegionSubDistrict(c *fiber.Ctx) error {
-	idDistrict := c.Query("idDistrict")
-	url := fmt.Sprintf("https://ibnux.github.io/data-indonesia/kecamatan/%s.json", idDistrict)
-	resp, err := http.Get(url)
+type regionSearchResult struct {
+	models.Region
+	FullName string `json:"full_name"`
+}
 
-	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Cannot get data province", nil, nil)
+// SearchRegions - cari wilayah berdasarkan nama di semua tingkat, ?q=&level=&limit=
+func SearchRegions(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if len([]rune(q)) < 3 {
+		return helpers.Response(c, 400, "Failed", "Search query must be at least 3 characters", nil, nil)
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > maxRegionSearchLimit {
+		limit = maxRegionSearchLimit
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	query := configs.DB.Where("is_active = ? AND name LIKE ?", true, "%"+q+"%")
+	if level := c.Query("level"); level != "" {
+		query = query.Where("level = ?", level)
+	}
 
-	var result []models.RegionResponse
+	// Nama yang diawali kata kunci lebih dulu, lalu tingkat yang lebih tinggi
+	var regions []models.Region
+	err := query.
+		Order(gorm.Expr("CASE WHEN name LIKE ? THEN 0 ELSE 1 END", q+"%")).
+		Order("LENGTH(code) ASC").
+		Order("name ASC").
+		Limit(limit).
+		Find(&regions).Error
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to search regions", nil, nil)
+	}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed to decode API response", nil, nil)
+	ancestors, err := regionAncestors(regions)
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to search regions", nil, nil)
 	}
 
-	return helpers.Response(c, 200, "Success", "List of provinces", result, nil)
+	result := make([]regionSearchResult, 0, len(regions))
+	for _, region := range regions {
+		names := []string{region.Name}
+		for parent := region.ParentCode; parent != nil; {
+			ancestor, ok := ancestors[*parent]
+			if !ok {
+				break
+			}
+			names = append(names, ancestor.Name)
+			parent = ancestor.ParentCode
+		}
+		result = append(result, regionSearchResult{Region: region, FullName: strings.Join(names, ", ")})
+	}
+	return helpers.Response(c, 200, "Success", "Data found", result, nil)
 }
 
-func RegionVillage(c *fiber.Ctx) error {
-	idSubdistrict := c.Query("idSubdistrict")
-	url := fmt.Sprintf("https://ibnux.github.io/data-indonesia/kelurahan/%s.json", idSubdistrict)
-	resp, err := http.Get(url)
+// regionAncestors - semua induk dari hasil pencarian, maksimal tiga query untuk tiga tingkat di atas desa
+func regionAncestors(regions []models.Region) (map[string]models.Region, error) {
+	ancestors := map[string]models.Region{}
+	pending := regions
+	for i := 0; i < 3 && len(pending) > 0; i++ {
+		var codes []string
+		for _, region := range pending {
+			if region.ParentCode != nil {
+				if _, ok := ancestors[*region.ParentCode]; !ok {
+					codes = append(codes, *region.ParentCode)
+				}
+			}
+		}
+		if len(codes) == 0 {
+			break
+		}
+
+		pending = nil
+		if err := configs.DB.Where("code IN ?", codes).Find(&pending).Error; err != nil {
+			return nil, err
+		}
+		for _, region := range pending {
+			ancestors[region.Code] = region
+		}
+	}
+	return ancestors, nil
+}
 
+// GetRegion - detail wilayah beserta induknya sampai provinsi
+func GetRegion(c *fiber.Ctx) error {
+	path, err := helpers.RegionPath(configs.DB, c.Params("code"))
 	if err != nil {
-		return helpers.Response(c, 400, "Failed", "Cannot get data province", nil, nil)
+		if errors.Is(err, helpers.ErrRegionNotFound) {
+			return helpers.Response(c, 404, "Failed", "Region not found", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to fetch region", nil, nil)
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	var children int64
+	region := path[len(path)-1]
+	if err := configs.DB.Model(&models.Region{}).Where("parent_code = ? AND is_active = ?", region.Code, true).Count(&children).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch region", nil, nil)
+	}
 
-	var result []models.RegionResponse
+	return helpers.Response(c, 200, "Success", "Data found", fiber.Map{
+		"region":    region,
+		"path":      path,
+		"full_name": helpers.RegionFullName(path),
+		"children":  children,
+	}, nil)
+}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed to decode API response", nil, nil)
+// ImportRegionDataset - upload CSV dataset wilayah (lihat helpers.ImportRegions) untuk memperbarui tabel
+// regions tanpa deploy. Form: file, deactivate_missing=true untuk file lengkap, link_names=true untuk
+// menautkan bank/user lama ke kode wilayah setelah import.
+func ImportRegionDataset(c *fiber.Ctx) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", "Dataset file is required", nil, nil)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to read dataset file", nil, nil)
+	}
+	defer file.Close()
+
+	result, err := helpers.ImportRegions(configs.DB, file, helpers.RegionImportOptions{
+		DeactivateMissing: c.FormValue("deactivate_missing") == "true",
+	})
+	if err != nil {
+		if errors.Is(err, helpers.ErrInvalidRegionDataset) {
+			return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to import regions", nil, nil)
 	}
 
-	return helpers.Response(c, 200, "Success", "List of provinces", result, nil)
+	data := fiber.Map{"import": result}
+	if c.FormValue("link_names") == "true" {
+		linked, err := helpers.LinkRegionNames(configs.DB)
+		if err != nil {
+			return helpers.Response(c, 500, "Failed", "Regions imported but failed to link existing addresses", data, nil)
+		}
+		data["linked"] = linked
+	}
+	return helpers.Response(c, 200, "Success", "Regions imported successfully", data, nil)
+}
+
+// regionCodesResponse - response standar untuk error dari helpers.ResolveRegionCodes
+func regionCodesResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, helpers.ErrRegionNotFound) || errors.Is(err, helpers.ErrRegionMismatch) {
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	}
+	return helpers.Response(c, 500, "Failed", "Failed to resolve region codes", nil, nil)
+}
+
+// resolveRegionBody - validasi kode wilayah dari body, nama resmi dari dataset menimpa kolom teks
+// province/district/subdistrict (nil diabaikan). given false jika body tidak mengirim kode.
+func resolveRegionBody(input models.RegionCodes, province, district, subdistrict *string) (models.RegionCodes, bool, error) {
+	codes, names, err := helpers.ResolveRegionCodes(configs.DB, input)
+	if err != nil || codes.ProvinceCode == nil {
+		return codes, false, err
+	}
+	for _, field := range []struct {
+		target *string
+		code   *string
+		name   string
+	}{
+		{province, codes.ProvinceCode, names.Province},
+		{district, codes.DistrictCode, names.District},
+		{subdistrict, codes.SubdistrictCode, names.Subdistrict},
+	} {
+		if field.target != nil && field.code != nil {
+			*field.target = field.name
+		}
+	}
+	return codes, true, nil
 }
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// serviceAreaRequest - wilayah layanan dalam GeoJSON, null untuk menghapus
+type serviceAreaRequest struct {
+	BankType     string          `json:"bank_type"` // hanya untuk CheckServiceArea
+	BankID       uint            `json:"bank_id"`   // bank yang sedang digambar, tidak dihitung sebagai overlap
+	ServiceArea  json.RawMessage `json:"service_area"`
+	AllowOverlap bool            `json:"allow_overlap"`
+}
+
+var serviceAreaColumns = []string{"service_area", "area_min_lat", "area_max_lat", "area_min_lng", "area_max_lng"}
+
+// UpdateChildBankServiceArea - simpan wilayah layanan bank unit. Wilayah yang beririsan dengan bank
+// unit lain ditolak 409 kecuali allow_overlap=true.
+func UpdateChildBankServiceArea(c *fiber.Ctx) error {
+	var childBank models.ChildBank
+	if err := configs.DB.First(&childBank, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Child Bank not found", nil, nil)
+	}
+	if err := helpers.ScopeBank(c, &childBank.ParentBankID, &childBank.Id); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	area, overlaps, err := parseServiceAreaRequest(c, helpers.ServiceAreaChildBank, childBank.Id)
+	if err != nil {
+		return serviceAreaErrorResponse(c, err, overlaps, "Service area overlaps other child banks, set allow_overlap to save anyway")
+	}
+
+	helpers.SetServiceArea(&childBank.BankServiceArea, area)
+	if err := configs.DB.Model(&childBank).Select(serviceAreaColumns).Updates(&childBank).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to update service area", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Service area updated successfully", fiber.Map{
+		"child_bank_id": childBank.Id,
+		"service_area":  childBank.ServiceArea,
+		"overlaps":      overlapList(overlaps),
+	}, nil)
+}
+
+// UpdateParentBankServiceArea - simpan wilayah layanan bank induk, dipakai sebagai fallback saat tidak
+// ada bank unit yang mencakup lokasi user
+func UpdateParentBankServiceArea(c *fiber.Ctx) error {
+	var parentBank models.ParentBank
+	if err := configs.DB.First(&parentBank, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Parent Bank not found", nil, nil)
+	}
+
+	area, overlaps, err := parseServiceAreaRequest(c, helpers.ServiceAreaParentBank, parentBank.Id)
+	if err != nil {
+		return serviceAreaErrorResponse(c, err, overlaps, "Service area overlaps other parent banks, set allow_overlap to save anyway")
+	}
+
+	helpers.SetServiceArea(&parentBank.BankServiceArea, area)
+	if err := configs.DB.Model(&parentBank).Select(serviceAreaColumns).Updates(&parentBank).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to update service area", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Service area updated successfully", fiber.Map{
+		"parent_bank_id": parentBank.Id,
+		"service_area":   parentBank.ServiceArea,
+		"overlaps":       overlapList(overlaps),
+	}, nil)
+}
+
+// CheckServiceArea - validasi dan cek overlap tanpa menyimpan, untuk peta saat admin menggambar
+func CheckServiceArea(c *fiber.Ctx) error {
+	var body serviceAreaRequest
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to read body", nil, nil)
+	}
+
+	area, err := helpers.ParseServiceArea(body.ServiceArea)
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	}
+	overlaps, err := helpers.FindServiceAreaOverlaps(configs.DB, body.BankType, body.BankID, area)
+	if err != nil {
+		if errors.Is(err, helpers.ErrInvalidServiceArea) {
+			return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to check service area overlaps", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Service area is valid", fiber.Map{
+		"service_area": area.GeoJSON(),
+		"overlaps":     overlaps,
+		"has_overlap":  len(overlaps) > 0,
+		"bounding_box": fiber.Map{
+			"min_latitude":  area.MinLat,
+			"max_latitude":  area.MaxLat,
+			"min_longitude": area.MinLng,
+			"max_longitude": area.MaxLng,
+		},
+	}, nil)
+}
+
+// LookupServiceArea - bank yang wilayahnya mencakup ?latitude=&longitude=
+func LookupServiceArea(c *fiber.Ctx) error {
+	latitude := c.QueryFloat("latitude")
+	longitude := c.QueryFloat("longitude")
+	if latitude == 0 || longitude == 0 {
+		return helpers.Response(c, 400, "Failed", "Latitude and longitude are required", nil, nil)
+	}
+
+	match, err := helpers.FindServiceAreaBanks(configs.DB, latitude, longitude)
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to look up service area", nil, nil)
+	}
+
+	childBanks := match.ChildBanks
+	if childBanks == nil {
+		childBanks = []models.ChildBank{}
+	}
+	return helpers.Response(c, 200, "Success", "Service area lookup completed", fiber.Map{
+		"child_banks": childBanks,
+		"parent_bank": match.ParentBank,
+		"is_covered":  len(match.ChildBanks) > 0 || match.ParentBank != nil,
+		"overlapping": len(match.ChildBanks) > 1,
+		"latitude":    latitude,
+		"longitude":   longitude,
+	}, nil)
+}
+
+var (
+	errServiceAreaBody    = errors.New("Failed to read body")
+	errServiceAreaOverlap = errors.New("service area overlaps other banks")
+)
+
+// parseServiceAreaRequest membaca body dan mencari overlap. Area nil tanpa error berarti wilayah
+// dihapus. errServiceAreaOverlap dikembalikan bersama daftar bank jika overlap tidak diizinkan.
+func parseServiceAreaRequest(c *fiber.Ctx, bankType string, bankID uint) (*helpers.ServiceArea, []helpers.ServiceAreaOverlap, error) {
+	var body serviceAreaRequest
+	if err := c.BodyParser(&body); err != nil {
+		return nil, nil, errServiceAreaBody
+	}
+
+	// null atau kosong menghapus wilayah, bank kembali memakai pencarian radius
+	if len(body.ServiceArea) == 0 || string(body.ServiceArea) == "null" {
+		return nil, nil, nil
+	}
+
+	area, err := helpers.ParseServiceArea(body.ServiceArea)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	overlaps, err := helpers.FindServiceAreaOverlaps(configs.DB, bankType, bankID, area)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(overlaps) > 0 && !body.AllowOverlap {
+		return nil, overlaps, errServiceAreaOverlap
+	}
+	return area, overlaps, nil
+}
+
+func serviceAreaErrorResponse(c *fiber.Ctx, err error, overlaps []helpers.ServiceAreaOverlap, message string) error {
+	switch {
+	case errors.Is(err, errServiceAreaBody), errors.Is(err, helpers.ErrInvalidServiceArea):
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, errServiceAreaOverlap):
+		return helpers.Response(c, 409, "Failed", message, fiber.Map{"overlaps": overlaps}, nil)
+	}
+	return helpers.Response(c, 500, "Failed", "Failed to check service area overlaps", nil, nil)
+}
+
+func overlapList(overlaps []helpers.ServiceAreaOverlap) []helpers.ServiceAreaOverlap {
+	if overlaps == nil {
+		return []helpers.ServiceAreaOverlap{}
+	}
+	return overlaps
+}
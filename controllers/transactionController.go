@@ -4,6 +4,7 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -28,6 +29,13 @@ func TransactionCreateTopUp(c *fiber.Ctx) error {
 		})
 	}
 
+	// user_id di body dibatasi sesuai scope user yang login, kosong berarti diri sendiri
+	scopedUserID, err := helpers.ResolveUserID(c, body.UserID)
+	if err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	body.UserID = scopedUserID
+
 	transaction := models.Transaction{
 		UserID:  body.UserID,
 		Balance: body.Balance,
@@ -53,6 +61,13 @@ func TransactionCreateWithdraw(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
 	}
 
+	// Penarikan memotong saldo, hanya untuk diri sendiri (atau admin), kosong berarti diri sendiri
+	scopedUserID, err := helpers.ResolveSelfUserID(c, body.UserID)
+	if err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	body.UserID = scopedUserID
+
 	// Mulai transaction database
 	tx := configs.DB.Begin()
 	if tx.Error != nil {
@@ -61,7 +76,7 @@ func TransactionCreateWithdraw(c *fiber.Ctx) error {
 
 	// Cek saldo user dengan lock untuk menghindari race condition
 	var user models.User
-	err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, body.UserID).Error
+	err = tx.Set("gorm:query_option", "FOR UPDATE").First(&user, body.UserID).Error
 	if err != nil {
 		tx.Rollback()
 		if err == gorm.ErrRecordNotFound {
@@ -76,14 +91,6 @@ func TransactionCreateWithdraw(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Saldo tidak mencukupi", nil, nil)
 	}
 
-	// Kurangi saldo user
-	err = tx.Model(&models.User{}).Where("id = ?", body.UserID).
-		Update("balance", gorm.Expr("balance - ?", body.Balance)).Error
-	if err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 500, "Failed", "Gagal mengurangi saldo user", nil, nil)
-	}
-
 	// Buat transaksi withdraw
 	transaction := models.Transaction{
 		UserID:  body.UserID,
@@ -98,6 +105,21 @@ func TransactionCreateWithdraw(c *fiber.Ctx) error {
 		return helpers.Response(c, 500, "Failed", "Failed to create transaction", nil, nil)
 	}
 
+	// Kurangi saldo user, dana ditahan sampai admin konfirmasi/tolak
+	_, err = helpers.NewLedgerService(tx).Post(
+		fmt.Sprintf("TRX-%d", transaction.Id),
+		"Permintaan withdraw saldo",
+		helpers.Debit(models.AccountUserWallet, body.UserID, body.Balance),
+		helpers.Credit(models.AccountWithdrawClearing, body.UserID, body.Balance),
+	)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrInsufficientBalance) {
+			return helpers.Response(c, 400, "Failed", "Saldo tidak mencukupi", nil, nil)
+		}
+		return helpers.Response(c, 500, "Failed", "Gagal mengurangi saldo user", nil, nil)
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
@@ -378,6 +400,10 @@ func GetTransactionDetailHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := helpers.ScopeUser(c, transaction.UserID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
 	// Format tanggal
 	tanggal := transaction.CreatedAt.Format("02 January 2006")
 
@@ -441,6 +467,17 @@ func ConfirmTransactionHandler(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Transaksi sudah tidak dalam status 'pending'", nil, nil)
 	}
 
+	// Topup lewat payment gateway diselesaikan oleh webhook, bukan admin
+	var gatewayPayments int64
+	if err := tx.Model(&models.Payment{}).Where("transaction_id = ?", transaction.Id).Count(&gatewayPayments).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Gagal mengambil data pembayaran", nil, nil)
+	}
+	if gatewayPayments > 0 {
+		tx.Rollback()
+		return helpers.Response(c, 400, "Failed", "Topup via payment gateway dikonfirmasi otomatis oleh webhook", nil, nil)
+	}
+
 	// Update status transaksi
 	transaction.Status = "confirm"
 	// Set admin ID jika diperlukan
@@ -456,16 +493,31 @@ func ConfirmTransactionHandler(c *fiber.Ctx) error {
 		return helpers.Response(c, 500, "Failed", "Gagal memperbarui status transaksi", nil, nil)
 	}
 
+	ledger := helpers.NewLedgerService(tx)
+	reference := fmt.Sprintf("TRX-%d", transaction.Id)
+
 	// Untuk topup: tambahkan balance user
 	if transaction.Type == "topup" {
-		err = tx.Model(&models.User{}).Where("id = ?", transaction.UserID).
-			Update("balance", gorm.Expr("balance + ?", transaction.Balance)).Error
+		_, err = ledger.Post(reference, "Konfirmasi topup saldo",
+			helpers.Debit(models.AccountCash, 0, transaction.Balance),
+			helpers.Credit(models.AccountUserWallet, transaction.UserID, transaction.Balance),
+		)
 		if err != nil {
 			tx.Rollback()
 			return helpers.Response(c, 500, "Failed", "Gagal menambah balance user", nil, nil)
 		}
 	}
-	// Untuk withdraw: tidak perlu melakukan apa-apa karena saldo sudah dipotong saat create
+	// Untuk withdraw: saldo sudah dipotong saat create, dana yang ditahan dicairkan ke rekening user
+	if transaction.Type == "withdraw" {
+		_, err = ledger.Post(reference, "Konfirmasi withdraw saldo",
+			helpers.Debit(models.AccountWithdrawClearing, transaction.UserID, transaction.Balance),
+			helpers.Credit(models.AccountCash, 0, transaction.Balance),
+		)
+		if err != nil {
+			tx.Rollback()
+			return helpers.Response(c, 500, "Failed", "Gagal mencatat pencairan withdraw", nil, nil)
+		}
+	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
@@ -522,6 +574,17 @@ func RejectTransactionHandler(c *fiber.Ctx) error {
 		return helpers.Response(c, 400, "Failed", "Transaksi sudah tidak dalam status 'pending'", nil, nil)
 	}
 
+	// Topup lewat payment gateway diselesaikan oleh webhook, bukan admin
+	var gatewayPayments int64
+	if err := tx.Model(&models.Payment{}).Where("transaction_id = ?", transaction.Id).Count(&gatewayPayments).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Gagal mengambil data pembayaran", nil, nil)
+	}
+	if gatewayPayments > 0 {
+		tx.Rollback()
+		return helpers.Response(c, 400, "Failed", "Topup via payment gateway dikonfirmasi otomatis oleh webhook", nil, nil)
+	}
+
 	// Update status transaksi
 	transaction.Status = "reject"
 	// Set admin ID jika diperlukan (ambil dari JWT atau context)
@@ -533,8 +596,12 @@ func RejectTransactionHandler(c *fiber.Ctx) error {
 	// Kembalikan balance untuk transaksi withdraw yang direject
 	if transaction.Type == "withdraw" {
 		// Untuk withdraw yang direject: kembalikan balance ke user
-		err = tx.Model(&models.User{}).Where("id = ?", transaction.UserID).
-			Update("balance", gorm.Expr("balance + ?", transaction.Balance)).Error
+		_, err = helpers.NewLedgerService(tx).Post(
+			fmt.Sprintf("TRX-%d", transaction.Id),
+			"Withdraw ditolak, saldo dikembalikan",
+			helpers.Debit(models.AccountWithdrawClearing, transaction.UserID, transaction.Balance),
+			helpers.Credit(models.AccountUserWallet, transaction.UserID, transaction.Balance),
+		)
 		if err != nil {
 			tx.Rollback()
 			return helpers.Response(c, 500, "Failed", "Gagal mengembalikan balance user", nil, nil)
@@ -15,6 +15,9 @@ func RegisterUser(c *fiber.Ctx) error {
 		Email           string `json:"email"`
 		Password        string `json:"password"`
 		ConfirmPassword string `json:"confirm_password"`
+		// Lokasi rumah opsional, dipakai untuk menautkan user ke bank yang melayani wilayahnya
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -36,6 +39,7 @@ func RegisterUser(c *fiber.Ctx) error {
 		PlanID:   &planID,
 		RoleID:   2,
 	}
+	endUser.ParentBankID, endUser.ChildBankID = serviceAreaHomeBank(body.Latitude, body.Longitude)
 
 	if err := configs.DB.Create(&endUser).Error; err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate entry") {
@@ -53,6 +57,9 @@ func RegisterUserChildBank(c *fiber.Ctx) error {
 		Password string `json:"password"`
 		Phone    string `json:"phone"`
 		Address  string `json:"address"`
+		// Lokasi rumah opsional, dipakai untuk menautkan user ke bank yang melayani wilayahnya
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -76,6 +83,7 @@ func RegisterUserChildBank(c *fiber.Ctx) error {
 		PlanID:   &planID,
 		RoleID:   2,
 	}
+	endUser.ParentBankID, endUser.ChildBankID = serviceAreaHomeBank(body.Latitude, body.Longitude)
 
 	if err := configs.DB.Create(&endUser).Error; err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate entry") {
@@ -86,6 +94,19 @@ func RegisterUserChildBank(c *fiber.Ctx) error {
 	return helpers.Response(c, 200, "Success", "User create successfully", endUser, nil)
 }
 
+// serviceAreaHomeBank - bank yang wilayah layanannya mencakup lokasi user saat registrasi.
+// Tanpa koordinat atau tanpa wilayah yang cocok user tetap terdaftar tanpa bank.
+func serviceAreaHomeBank(latitude, longitude float64) (*uint, *uint) {
+	if latitude == 0 || longitude == 0 || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, nil
+	}
+	bank, err := helpers.ResolveServiceBank(configs.DB, latitude, longitude)
+	if err != nil {
+		return nil, nil
+	}
+	return bank.ParentBankID, bank.ChildBankID
+}
+
 func DivisiUserController(c *fiber.Ctx) error {
 	var division []models.Division
 
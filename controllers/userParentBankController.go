@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // GetUsers - Get all users with filtering and pagination (flat structure)
@@ -82,6 +83,7 @@ func CreateUserBankInduk(c *fiber.Ctx) error {
 		Province     string `json:"province"` // Field baru
 		District     string `json:"district"` // Field baru
 		ParentBankID *uint  `json:"parent_bank_id"`
+		models.RegionCodes
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -99,6 +101,12 @@ func CreateUserBankInduk(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to hash password", nil, nil)
 	}
 
+	// Kode wilayah opsional, nama provinsi dan kabupaten/kota diambil dari dataset
+	regionCodes, _, err := resolveRegionBody(body.RegionCodes, &body.Province, &body.District, nil)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
+
 	// Set default role ID untuk user bank induk
 	roleID := uint(3) // Sesuaikan dengan role ID untuk user bank induk
 
@@ -113,6 +121,7 @@ func CreateUserBankInduk(c *fiber.Ctx) error {
 		RoleID:       roleID,
 		ParentBankID: body.ParentBankID,
 		Status:       "active",
+		RegionCodes:  regionCodes,
 	}
 
 	if err := configs.DB.Create(&user).Error; err != nil {
@@ -160,6 +169,7 @@ func UpdateUser(c *fiber.Ctx) error {
 		DivisionID   *uint  `json:"division_id"`
 		ParentBankID *uint  `json:"parent_bank_id"`
 		Status       string `json:"status"`
+		models.RegionCodes
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -171,6 +181,17 @@ func UpdateUser(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusNotFound, "Failed", "User not found", nil, nil)
 	}
 
+	regionCodes, regionGiven, err := resolveRegionBody(body.RegionCodes, &body.Province, &body.District, nil)
+	if err != nil {
+		return regionCodesResponse(c, err)
+	}
+	if regionGiven {
+		user.RegionCodes = regionCodes
+	} else if body.Province != user.Province || body.District != user.District {
+		// Nama diubah manual tanpa kode, kode lama tidak lagi sesuai
+		user.RegionCodes = models.RegionCodes{}
+	}
+
 	// Update fields
 	user.Name = body.Name
 	user.Email = body.Email
@@ -184,7 +205,23 @@ func UpdateUser(c *fiber.Ctx) error {
 		user.Status = body.Status
 	}
 
-	if err := configs.DB.Save(&user).Error; err != nil {
+	// User yang dinonaktifkan langsung dikeluarkan dari semua device, dalam transaksi yang sama
+	// supaya status tidak tersimpan tanpa sesi yang dicabut
+	var revokeErr error
+	err = configs.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if user.Status == "inactive" {
+			_, revokeErr = helpers.RevokeUserSessions(tx, user.Id, helpers.RevokeUserInactive)
+			return revokeErr
+		}
+		return nil
+	})
+	if err != nil {
+		if revokeErr != nil {
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to revoke user sessions", nil, nil)
+		}
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate entry") {
 			return helpers.Response(c, 400, "Failed", "Email already exists", nil, nil)
 		}
@@ -209,7 +246,7 @@ func DeleteUser(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusNotFound, "Failed", "User not found", nil, nil)
 	}
 
-	if err := configs.DB.Delete(&user).Error; err != nil {
+	if err := helpers.DeleteUserWithSessions(configs.DB, &user); err != nil {
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to delete user", nil, nil)
 	}
 
@@ -0,0 +1,141 @@
+package wastedeposit
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type depositRegionRow struct {
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	DepositCount int64   `json:"deposit_count"`
+	UserCount    int64   `json:"user_count"`
+	TotalWeight  float64 `json:"total_weight"`
+	TotalPrice   int     `json:"total_price"`
+}
+
+// GetWasteDepositRegionReport - setoran aktif dikelompokkan per wilayah administrasi. Wilayah diambil dari
+// kode wilayah bank unit (atau bank induk untuk setoran langsung di bank induk), by=user memakai alamat
+// nasabah. Setoran dari bank/user yang belum punya kode wilayah dikumpulkan di baris code kosong.
+//
+// ?level=province|district|subdistrict&by=bank|user&region_code= (hanya wilayah di bawah kode ini)
+// beserta filter bank, tanggal dan item yang sama dengan ListWasteDeposits
+func GetWasteDepositRegionReport(c *fiber.Ctx) error {
+	var req depositListRequest
+	var report struct {
+		Level      string `query:"level"`
+		By         string `query:"by"`
+		RegionCode string `query:"region_code"`
+	}
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+	if err := c.QueryParser(&report); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+	if report.Level == "" {
+		report.Level = models.RegionLevelDistrict
+	}
+	if report.Level != models.RegionLevelProvince && report.Level != models.RegionLevelDistrict && report.Level != models.RegionLevelSubdistrict {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "level must be province, district or subdistrict", nil, nil)
+	}
+	if report.By == "" {
+		report.By = "bank"
+	}
+
+	// Kolom kode wilayah untuk satu tingkat
+	regionColumn := func(level string) string {
+		if report.By == "user" {
+			return "users." + level + "_code"
+		}
+		return "COALESCE(child_banks." + level + "_code, parent_banks." + level + "_code)"
+	}
+
+	query := configs.DB.Model(&models.WasteDeposit{})
+	switch report.By {
+	case "bank":
+		query = query.
+			Joins("LEFT JOIN child_banks ON child_banks.id = waste_deposits.child_bank_id").
+			Joins("LEFT JOIN parent_banks ON parent_banks.id = waste_deposits.parent_bank_id")
+	case "user":
+		query = query.Joins("LEFT JOIN users ON users.id = waste_deposits.user_id")
+	default:
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "by must be bank or user", nil, nil)
+	}
+
+	query, err := depositScopeQuery(c, query, req)
+	if err != nil {
+		if errors.Is(err, helpers.ErrForbidden) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.ScopeResponse(c, err)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to check access", nil, nil)
+	}
+
+	// Laporan hanya menghitung setoran aktif
+	req.Status = models.DepositStatusActive
+	query, err = depositFilterQuery(query, req)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+
+	var parent *models.Region
+	if report.RegionCode != "" {
+		var region models.Region
+		if err := configs.DB.Where("code = ?", helpers.NormalizeRegionCode(report.RegionCode)).First(&region).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return helpers.Response(c, fiber.StatusNotFound, "Failed", "Region not found", nil, nil)
+			}
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch region", nil, nil)
+		}
+		if region.Level == models.RegionLevelVillage {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "region_code cannot be a village", nil, nil)
+		}
+		query = query.Where(regionColumn(region.Level)+" = ?", region.Code)
+		parent = &region
+	}
+
+	rows := []depositRegionRow{}
+	column := regionColumn(report.Level)
+	err = query.
+		Select("COALESCE(" + column + ", '') AS code, COALESCE(MAX(regions.name), '') AS name, " +
+			"COUNT(*) AS deposit_count, COUNT(DISTINCT waste_deposits.user_id) AS user_count, " +
+			"COALESCE(SUM(waste_deposits.total_weight), 0) AS total_weight, COALESCE(SUM(waste_deposits.total_price), 0) AS total_price").
+		Joins("LEFT JOIN regions ON regions.code = " + column).
+		Group("COALESCE(" + column + ", '')").
+		Order("total_weight DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to build region report", nil, nil)
+	}
+
+	var summary depositRegionRow
+	for i := range rows {
+		rows[i].TotalWeight = math.Round(rows[i].TotalWeight*100) / 100
+		summary.DepositCount += rows[i].DepositCount
+		summary.TotalWeight += rows[i].TotalWeight
+		summary.TotalPrice += rows[i].TotalPrice
+		if rows[i].Code == "" {
+			rows[i].Name = "Belum ada kode wilayah"
+		}
+	}
+	summary.TotalWeight = math.Round(summary.TotalWeight*100) / 100
+
+	data := map[string]any{
+		"level":  report.Level,
+		"by":     report.By,
+		"region": parent,
+		"summary": map[string]any{
+			"deposit_count": summary.DepositCount,
+			"total_weight":  summary.TotalWeight,
+			"total_price":   summary.TotalPrice,
+		},
+		"rows": rows,
+	}
+	return helpers.Response(c, fiber.StatusOK, "Success", "Data found", data, nil)
+}
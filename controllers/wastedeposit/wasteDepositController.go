@@ -4,36 +4,17 @@ import (
 	"backend-mulungs/configs"
 	"backend-mulungs/helpers"
 	"backend-mulungs/models"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
-// GetAllWasteDeposits mendapatkan semua transaksi setoran sampah
-func GetAllWasteDeposits(c *fiber.Ctx) error {
-	var wasteDeposits []models.WasteDeposit
-
-	if err := configs.DB.
-		Preload("User").
-		Preload("Items").
-		Preload("Items.ProductWaste").
-		Find(&wasteDeposits).Error; err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed to fetch waste deposits", nil, nil)
-	}
-
-	if len(wasteDeposits) == 0 {
-		return helpers.Response(c, 200, "Success", "Data found", []models.WasteDeposit{}, nil)
-	}
-
-	return helpers.Response(c, 200, "Success", "Data Found", wasteDeposits, nil)
-}
-
 // GetWasteDepositByID mendapatkan transaksi setoran sampah by ID
 func GetWasteDepositByID(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -51,29 +32,11 @@ func GetWasteDepositByID(c *fiber.Ctx) error {
 		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
 	}
 
-	return helpers.Response(c, 200, "Success", "Waste deposit retrieved successfully", wasteDeposit, nil)
-}
-
-// GetWasteDepositsByUser mendapatkan transaksi setoran sampah by user ID
-func GetWasteDepositsByUser(c *fiber.Ctx) error {
-	userID := c.Params("user_id")
-
-	var wasteDeposits []models.WasteDeposit
-
-	if err := configs.DB.
-		Preload("User").
-		Preload("Items").
-		Preload("Items.ProductWaste").
-		Where("user_id = ?", userID).
-		Find(&wasteDeposits).Error; err != nil {
-		return helpers.Response(c, 400, "Failed", "Failed to fetch waste deposits", nil, nil)
+	if err := helpers.ScopeWasteDeposit(c, &wasteDeposit); err != nil {
+		return helpers.ScopeResponse(c, err)
 	}
 
-	if len(wasteDeposits) == 0 {
-		return helpers.Response(c, 200, "Success", "Data found", []models.WasteDeposit{}, nil)
-	}
-
-	return helpers.Response(c, 200, "Success", "Data Found", wasteDeposits, nil)
+	return helpers.Response(c, 200, "Success", "Waste deposit retrieved successfully", wasteDeposit, nil)
 }
 
 // CreateWasteDeposit membuat transaksi setoran sampah baru dengan upload S3 dan update balance
@@ -128,6 +91,11 @@ func CreateWasteDeposit(c *fiber.Ctx) error {
 		*parentBankID = uint(parentBankIDUint)
 	}
 
+	// Operator hanya boleh mencatat setoran di bank induk/unit miliknya sendiri
+	if err := helpers.ScopeBank(c, parentBankID, childBankID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
 	// Parse items dari form data
 	items, err := parseWasteDepositItems(form)
 	if err != nil {
@@ -139,6 +107,12 @@ func CreateWasteDeposit(c *fiber.Ctx) error {
 		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Items cannot be empty", nil, nil)
 	}
 
+	// Upload foto dulu, item ke-n memakai file ke-n jika ada
+	depositItems, err := uploadWasteDepositPhotos(items, form.File["photo[]"])
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+
 	// Start transaction
 	tx := configs.DB.Begin()
 	defer func() {
@@ -147,180 +121,24 @@ func CreateWasteDeposit(c *fiber.Ctx) error {
 		}
 	}()
 
-	// Generate reference ID
-	referenceID := "WD" + time.Now().Format("20060102150405")
-
-	// Calculate totals
-	var totalWeight float64
-	var totalPrice int
-
-	// Create waste deposit items
-	var depositItems []models.WasteDepositItem
-
-	// Handle file uploads untuk setiap item
-	files := form.File["photo[]"]
-	fileIndex := 0
-
-	for _, itemReq := range items {
-		// Get product waste data
-		var productWaste models.ProductWaste
-		if err := tx.First(&productWaste, itemReq.ProductWasteID).Error; err != nil {
-			tx.Rollback()
-			return helpers.Response(c, fiber.StatusNotFound, "Failed", "Product waste not found: "+strconv.Itoa(int(itemReq.ProductWasteID)), nil, nil)
-		}
-
-		// Calculate subtotal menggunakan harga dari product waste
-		subTotal := int(itemReq.Weight) * productWaste.Price
-
-		// Handle file upload untuk item ini jika ada
-		photoURL := ""
-		if fileIndex < len(files) {
-			file := files[fileIndex]
-
-			// Validate file size (max 2MB)
-			if file.Size > 2<<20 {
-				tx.Rollback()
-				return helpers.Response(c, fiber.StatusBadRequest, "Failed", "File size too large (max 2MB): "+file.Filename, nil, nil)
-			}
-
-			// Validate file type
-			allowedTypes := map[string]bool{
-				".jpg":  true,
-				".jpeg": true,
-				".png":  true,
-				".gif":  true,
-				".webp": true,
-			}
-
-			ext := strings.ToLower(filepath.Ext(file.Filename))
-			if !allowedTypes[ext] {
-				tx.Rollback()
-				return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid file type. Allowed: JPG, JPEG, PNG, GIF, WEBP: "+file.Filename, nil, nil)
-			}
-
-			// Upload to S3
-			s3Service := helpers.NewS3Service()
-			photoURL, err = s3Service.UploadFile(file, 0, "waste-deposit")
-			if err != nil {
-				tx.Rollback()
-				return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to upload image to cloud storage: "+err.Error(), nil, nil)
-			}
-
-			fileIndex++
-		}
-
-		item := models.WasteDepositItem{
-			ProductWasteID: itemReq.ProductWasteID,
-			Category:       productWaste.Category,
-			Weight:         itemReq.Weight,
-			Unit:           itemReq.Unit,
-			SubTotal:       subTotal,
-			Photo:          photoURL,
-		}
-
-		depositItems = append(depositItems, item)
-		totalWeight += itemReq.Weight
-		totalPrice += subTotal
-	}
-
-	// Create waste deposit
-	wasteDeposit := models.WasteDeposit{
+	wasteDeposit, err := helpers.NewWasteDepositService(tx).Create(helpers.DepositInput{
 		UserID:       uint(userID),
-		ChildBankID:  childBankID,
 		ParentBankID: parentBankID,
-		TotalWeight:  totalWeight,
-		TotalPrice:   totalPrice,
-		ReferenceID:  referenceID,
+		ChildBankID:  childBankID,
 		Items:        depositItems,
-	}
-
-	if err := tx.Create(&wasteDeposit).Error; err != nil {
-		tx.Rollback()
-
-		// Rollback: Hapus file yang sudah diupload ke S3 jika database error
-		for _, item := range depositItems {
-			if item.Photo != "" {
-				s3Service := helpers.NewS3Service()
-				imageKey := s3Service.ExtractKeyFromURL(item.Photo)
-				if imageKey != "" {
-					s3Service.DeleteFile(imageKey)
-				}
-			}
-		}
-
-		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate entry") {
-			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Reference ID already exists", nil, nil)
-		}
-		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
-	}
-
-	// ✅ UPDATE USER BALANCE DALAM TRANSACTION YANG SAMA
-	var user models.User
-	if err := tx.First(&user, userID).Error; err != nil {
-		tx.Rollback()
-
-		// Rollback: Hapus file S3
-		for _, item := range depositItems {
-			if item.Photo != "" {
-				s3Service := helpers.NewS3Service()
-				imageKey := s3Service.ExtractKeyFromURL(item.Photo)
-				if imageKey != "" {
-					s3Service.DeleteFile(imageKey)
-				}
-			}
-		}
-
-		return helpers.Response(c, fiber.StatusNotFound, "Failed", "User not found", nil, nil)
-	}
-
-	// Update user balance
-	newBalance := user.Balance + totalPrice
-	if err := tx.Model(&user).Update("balance", newBalance).Error; err != nil {
+		CreatedBy:    helpers.AuthUserID(c),
+	})
+	if err != nil {
 		tx.Rollback()
-
-		// Rollback: Hapus file S3
-		for _, item := range depositItems {
-			if item.Photo != "" {
-				s3Service := helpers.NewS3Service()
-				imageKey := s3Service.ExtractKeyFromURL(item.Photo)
-				if imageKey != "" {
-					s3Service.DeleteFile(imageKey)
-				}
-			}
-		}
-
-		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update user balance", nil, nil)
-	}
-
-	// ✅ CREATE TRANSACTION RECORD UNTUK RIWAYAT
-	transaction := models.Transaction{
-		UserID:  uint(userID),
-		Balance: totalPrice,
-		Type:    "topup",
-		Status:  "confirm", // Otomatis confirmed karena dari waste deposit
-		Desc:    "Topup dari setoran sampah - Ref: " + referenceID,
-	}
-
-	if err := tx.Create(&transaction).Error; err != nil {
-		// Log error tapi jangan rollback, karena waste deposit dan balance update sudah berhasil
-		fmt.Printf("Warning: Failed to create transaction record: %v\n", err)
+		// Rollback: Hapus file yang sudah diupload ke S3
+		deleteWasteDepositPhotos(depositItems)
+		return depositServiceErrorResponse(c, err)
 	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
-
-		// Rollback: Hapus file yang sudah diupload ke S3 jika commit error
-		for _, item := range depositItems {
-			if item.Photo != "" {
-				s3Service := helpers.NewS3Service()
-				imageKey := s3Service.ExtractKeyFromURL(item.Photo)
-				if imageKey != "" {
-					s3Service.DeleteFile(imageKey)
-				}
-			}
-		}
-
+		deleteWasteDepositPhotos(depositItems)
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
 	}
 
@@ -331,87 +149,83 @@ func CreateWasteDeposit(c *fiber.Ctx) error {
 		Preload("ParentBank").
 		Preload("Items").
 		Preload("Items.ProductWaste").
-		First(&wasteDeposit, wasteDeposit.Id).Error; err != nil {
+		First(wasteDeposit, wasteDeposit.Id).Error; err != nil {
 		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to load waste deposit data", nil, nil)
 	}
 
 	return helpers.Response(c, fiber.StatusOK, "Success", "Waste deposit created successfully and balance updated", wasteDeposit, nil)
 }
 
-// DeleteWasteDeposit menghapus transaksi setoran sampah (soft delete) dan kurangi balance
-func DeleteWasteDeposit(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	var wasteDeposit models.WasteDeposit
-	if err := configs.DB.Preload("Items").Preload("User").First(&wasteDeposit, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return helpers.Response(c, 404, "Failed", "Waste deposit not found", nil, nil)
-		}
-		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
-	}
-
-	// Start transaction untuk konsistensi
-	tx := configs.DB.Begin()
-
-	// ✅ KURANGI BALANCE USER
-	var user models.User
-	if err := tx.First(&user, wasteDeposit.UserID).Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, fiber.StatusNotFound, "Failed", "User not found", nil, nil)
+// uploadWasteDepositPhotos - validasi dan upload foto item ke S3. Jika salah satu gagal,
+// foto yang sudah terupload dihapus lagi.
+func uploadWasteDepositPhotos(items []WasteDepositItemRequest, files []*multipart.FileHeader) ([]helpers.DepositItemInput, error) {
+	allowedTypes := map[string]bool{
+		".jpg":  true,
+		".jpeg": true,
+		".png":  true,
+		".gif":  true,
+		".webp": true,
 	}
 
-	// Kurangi balance user
-	newBalance := user.Balance - wasteDeposit.TotalPrice
-	if newBalance < 0 {
-		newBalance = 0 // Prevent negative balance
-	}
+	inputs := make([]helpers.DepositItemInput, 0, len(items))
+	for i, itemReq := range items {
+		input := helpers.DepositItemInput{
+			ProductWasteID: itemReq.ProductWasteID,
+			Weight:         itemReq.Weight,
+			Unit:           itemReq.Unit,
+		}
 
-	if err := tx.Model(&user).Update("balance", newBalance).Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update user balance", nil, nil)
-	}
+		if i < len(files) {
+			file := files[i]
 
-	// ✅ CREATE TRANSACTION RECORD UNTUK RIWAYAT (WITHDRAWAL)
-	transaction := models.Transaction{
-		UserID:  wasteDeposit.UserID,
-		Balance: -wasteDeposit.TotalPrice, // Negative untuk withdrawal
-		Type:    "withdraw",
-		Status:  "confirm",
-		Desc:    "Refund dari penghapusan setoran sampah - Ref: " + wasteDeposit.ReferenceID,
-	}
+			// Validate file size (max 2MB)
+			if file.Size > 2<<20 {
+				deleteWasteDepositPhotos(inputs)
+				return nil, fmt.Errorf("File size too large (max 2MB): %s", file.Filename)
+			}
 
-	if err := tx.Create(&transaction).Error; err != nil {
-		fmt.Printf("Warning: Failed to create transaction record: %v\n", err)
-	}
+			ext := strings.ToLower(filepath.Ext(file.Filename))
+			if !allowedTypes[ext] {
+				deleteWasteDepositPhotos(inputs)
+				return nil, fmt.Errorf("Invalid file type. Allowed: JPG, JPEG, PNG, GIF, WEBP: %s", file.Filename)
+			}
 
-	// Hapus file S3 yang terkait sebelum soft delete
-	for _, item := range wasteDeposit.Items {
-		if item.Photo != "" {
-			s3Service := helpers.NewS3Service()
-			imageKey := s3Service.ExtractKeyFromURL(item.Photo)
-			if imageKey != "" {
-				// Hapus file dari S3
-				if err := s3Service.DeleteFile(imageKey); err != nil {
-					// Log error tapi lanjutkan proses delete
-					fmt.Printf("Failed to delete S3 file: %s, error: %v\n", imageKey, err)
-				}
+			photoURL, err := helpers.NewS3Service().UploadFile(file, 0, "waste-deposit")
+			if err != nil {
+				deleteWasteDepositPhotos(inputs)
+				return nil, fmt.Errorf("Failed to upload image to cloud storage: %s", err.Error())
 			}
+			input.Photo = photoURL
 		}
-	}
 
-	// Soft delete waste deposit
-	if err := tx.Delete(&wasteDeposit).Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 400, "Failed", "Failed to delete waste deposit", nil, nil)
+		inputs = append(inputs, input)
 	}
+	return inputs, nil
+}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+func deleteWasteDepositPhotos(items []helpers.DepositItemInput) {
+	s3Service := helpers.NewS3Service()
+	for _, item := range items {
+		if item.Photo == "" {
+			continue
+		}
+		if imageKey := s3Service.ExtractKeyFromURL(item.Photo); imageKey != "" {
+			s3Service.DeleteFile(imageKey)
+		}
 	}
+}
 
-	return helpers.Response(c, 200, "Success", "Waste deposit deleted successfully and balance adjusted", nil, nil)
+// depositServiceErrorResponse - status HTTP untuk error dari helpers.WasteDepositService
+func depositServiceErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, helpers.ErrDepositInvalid), errors.Is(err, helpers.ErrDepositDuplicateRef):
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, helpers.ErrDepositProductNotFound), errors.Is(err, helpers.ErrDepositUserNotFound), errors.Is(err, helpers.ErrDepositBankNotFound):
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", err.Error(), nil, nil)
+	case errors.Is(err, helpers.ErrInsufficientStock):
+		return helpers.Response(c, fiber.StatusConflict, "Failed", err.Error(), nil, nil)
+	}
+	return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to create waste deposit", nil, nil)
 }
 
 // Helper function untuk parse items dari form data
@@ -465,46 +279,3 @@ type WasteDepositItemRequest struct {
 	Weight         float64 `json:"weight"`
 	Unit           string  `json:"unit"`
 }
-
-// GetWasteDepositsByChildBank - Get waste deposits by child bank ID
-func GetWasteDepositsByChildBank(c *fiber.Ctx) error {
-	childBankID := c.Params("child_bank_id")
-
-	var wasteDeposits []models.WasteDeposit
-
-	// Query langsung berdasarkan child_bank_id di waste_deposits
-	if err := configs.DB.
-		Preload("User").
-		Preload("ChildBank").            // Preload child bank dari waste deposit
-		Preload("ChildBank.ParentBank"). // Preload parent bank dari child bank
-		Preload("Items").
-		Preload("Items.ProductWaste").
-		Where("child_bank_id = ?", childBankID). // Filter langsung berdasarkan child_bank_id di waste_deposits
-		Order("created_at DESC").                // Urutkan dari yang terbaru
-		Find(&wasteDeposits).Error; err != nil {
-		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
-	}
-
-	return helpers.Response(c, 200, "Success", "Waste deposits retrieved successfully", wasteDeposits, nil)
-}
-
-// GetWasteDepositsByParentBank - Get waste deposits by parent bank ID
-func GetWasteDepositsByParentBank(c *fiber.Ctx) error {
-	parentBankID := c.Params("parent_bank_id")
-
-	var wasteDeposits []models.WasteDeposit
-
-	// Query langsung berdasarkan parent_bank_id di waste_deposits
-	if err := configs.DB.
-		Preload("User").
-		Preload("ParentBank"). // Preload parent bank dari waste deposit
-		Preload("Items").
-		Preload("Items.ProductWaste").
-		Where("parent_bank_id = ?", parentBankID). // Filter langsung berdasarkan parent_bank_id di waste_deposits
-		Order("created_at DESC").
-		Find(&wasteDeposits).Error; err != nil {
-		return helpers.Response(c, 500, "Failed", err.Error(), nil, nil)
-	}
-
-	return helpers.Response(c, 200, "Success", "Waste deposits retrieved successfully", wasteDeposits, nil)
-}
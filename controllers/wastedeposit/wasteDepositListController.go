@@ -0,0 +1,353 @@
+package wastedeposit
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Kolom yang boleh dipakai untuk sort
+var depositSortColumns = map[string]string{
+	"id":           "waste_deposits.id",
+	"created_at":   "waste_deposits.created_at",
+	"total_price":  "waste_deposits.total_price",
+	"total_weight": "waste_deposits.total_weight",
+}
+
+const maxDepositListLimit = 100
+
+// depositListRequest - filter listing setoran
+type depositListRequest struct {
+	UserID         uint    `query:"user_id"`
+	ParentBankID   uint    `query:"parent_bank_id"`
+	ChildBankID    uint    `query:"child_bank_id"`
+	OwnOnly        bool    `query:"own_only"` // parent_bank_id tanpa setoran di bank unitnya
+	Status         string  `query:"status"`
+	Category       string  `query:"category"`
+	ProductWasteID uint    `query:"product_waste_id"`
+	Source         string  `query:"source"` // pickup atau direct (setor langsung di bank)
+	PickupID       uint    `query:"pickup_request_id"`
+	MinWeight      float64 `query:"min_weight"`
+	MaxWeight      float64 `query:"max_weight"`
+	MinPrice       int     `query:"min_price"`
+	MaxPrice       int     `query:"max_price"`
+	StartDate      string  `query:"start_date"`
+	EndDate        string  `query:"end_date"`
+	Search         string  `query:"search"` // reference_id atau nama nasabah
+	Sort           string  `query:"sort"`
+	Order          string  `query:"order"`
+	IncludeItems   string  `query:"include_items"`
+	Page           int     `query:"page"`
+	Limit          int     `query:"limit"`
+	Cursor         string  `query:"cursor"` // id terakhir dari halaman sebelumnya, hanya untuk sort id/created_at
+}
+
+// ListWasteDeposits - listing setoran dengan filter, sort, pagination dan total untuk hasil filter.
+// Tanpa filter bank: admin melihat semua, operator bank induk setoran di bank induk dan unitnya,
+// operator bank unit setoran di unitnya, nasabah setorannya sendiri.
+//
+// ?user_id=&parent_bank_id=&own_only=&child_bank_id=&status=active|voided&category=organik|anorganik
+// &product_waste_id=&min_weight=&max_weight=&min_price=&max_price=&start_date=&end_date= (YYYY-MM-DD)
+// &search=&sort=created_at|total_price|total_weight|id&order=desc|asc&include_items=false
+// &page=&limit= atau &cursor=
+func ListWasteDeposits(c *fiber.Ctx) error {
+	return listWasteDeposits(c, nil)
+}
+
+// GetWasteDepositsByUser - listing setoran satu nasabah, filter lain sama dengan ListWasteDeposits
+func GetWasteDepositsByUser(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("user_id"), 10, 32)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid user ID format", nil, nil)
+	}
+	return listWasteDeposits(c, func(req *depositListRequest) {
+		req.UserID = uint(userID)
+	})
+}
+
+// GetWasteDepositsByChildBank - listing setoran di satu bank unit
+func GetWasteDepositsByChildBank(c *fiber.Ctx) error {
+	childBankID, err := strconv.ParseUint(c.Params("child_bank_id"), 10, 32)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid child bank ID format", nil, nil)
+	}
+	return listWasteDeposits(c, func(req *depositListRequest) {
+		req.ChildBankID = uint(childBankID)
+		req.ParentBankID = 0
+	})
+}
+
+// GetWasteDepositsByParentBank - listing setoran yang dicatat langsung di bank induk.
+// ?own_only=false ikut menampilkan setoran di bank unit di bawahnya.
+func GetWasteDepositsByParentBank(c *fiber.Ctx) error {
+	parentBankID, err := strconv.ParseUint(c.Params("parent_bank_id"), 10, 32)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid parent bank ID format", nil, nil)
+	}
+	ownOnly := c.Query("own_only") != "false"
+	return listWasteDeposits(c, func(req *depositListRequest) {
+		req.ParentBankID = uint(parentBankID)
+		req.ChildBankID = 0
+		req.OwnOnly = ownOnly
+	})
+}
+
+func listWasteDeposits(c *fiber.Ctx, override func(*depositListRequest)) error {
+	var req depositListRequest
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+	if override != nil {
+		override(&req)
+	}
+
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.Limit <= 0 {
+		req.Limit = 10
+	}
+	if req.Limit > maxDepositListLimit {
+		req.Limit = maxDepositListLimit
+	}
+	if req.Sort == "" {
+		req.Sort = "created_at"
+	}
+	sortColumn, ok := depositSortColumns[req.Sort]
+	if !ok {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "sort must be one of id, created_at, total_price, total_weight", nil, nil)
+	}
+	if req.Order == "" {
+		req.Order = "desc"
+	}
+	if req.Order != "asc" && req.Order != "desc" {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "order must be asc or desc", nil, nil)
+	}
+
+	query, err := depositScopeQuery(c, configs.DB.Model(&models.WasteDeposit{}), req)
+	if err != nil {
+		if errors.Is(err, helpers.ErrForbidden) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.ScopeResponse(c, err)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to check access", nil, nil)
+	}
+
+	query, err = depositFilterQuery(query, req)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", err.Error(), nil, nil)
+	}
+
+	// Total untuk seluruh hasil filter; nominal dan berat setoran yang dibatalkan tidak dijumlahkan
+	var totals struct {
+		Count       int64   `json:"count"`
+		VoidedCount int64   `json:"voided_count"`
+		TotalWeight float64 `json:"total_weight"`
+		TotalPrice  int     `json:"total_price"`
+	}
+	err = query.Session(&gorm.Session{}).Select(
+		"COUNT(*) AS count, "+
+			"COALESCE(SUM(CASE WHEN waste_deposits.status = ? THEN 1 ELSE 0 END), 0) AS voided_count, "+
+			"COALESCE(SUM(CASE WHEN waste_deposits.status = ? THEN 0 ELSE waste_deposits.total_weight END), 0) AS total_weight, "+
+			"COALESCE(SUM(CASE WHEN waste_deposits.status = ? THEN 0 ELSE waste_deposits.total_price END), 0) AS total_price",
+		models.DepositStatusVoided, models.DepositStatusVoided, models.DepositStatusVoided,
+	).Scan(&totals).Error
+	if err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to calculate deposit totals", nil, nil)
+	}
+
+	listQuery := query.Session(&gorm.Session{}).
+		Preload("User").
+		Preload("ChildBank").
+		Preload("ParentBank")
+	if req.IncludeItems != "false" {
+		listQuery = listQuery.
+			Preload("Items").
+			Preload("Items.ProductWaste", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+	}
+
+	meta := map[string]any{
+		"limit": req.Limit,
+		"total": totals.Count,
+		"sort":  req.Sort,
+		"order": req.Order,
+	}
+
+	if req.Cursor != "" {
+		// Cursor memakai id, created_at ikut urut id karena diisi saat insert
+		if req.Sort != "id" && req.Sort != "created_at" {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "cursor pagination only supports sort by id or created_at", nil, nil)
+		}
+		cursor, err := strconv.ParseUint(req.Cursor, 10, 32)
+		if err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid cursor", nil, nil)
+		}
+		if cursor > 0 {
+			operator := "<"
+			if req.Order == "asc" {
+				operator = ">"
+			}
+			listQuery = listQuery.Where("waste_deposits.id "+operator+" ?", cursor)
+		}
+		listQuery = listQuery.Order("waste_deposits.id " + req.Order).Limit(req.Limit)
+	} else {
+		listQuery = listQuery.
+			Order(sortColumn + " " + req.Order).
+			Order("waste_deposits.id " + req.Order).
+			Offset((req.Page - 1) * req.Limit).
+			Limit(req.Limit)
+		meta["page"] = req.Page
+		meta["pages"] = (int(totals.Count) + req.Limit - 1) / req.Limit
+	}
+
+	var deposits []models.WasteDeposit
+	if err := listQuery.Find(&deposits).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch waste deposits", nil, nil)
+	}
+
+	if req.Cursor != "" {
+		var nextCursor *uint
+		if len(deposits) == req.Limit {
+			nextCursor = &deposits[len(deposits)-1].Id
+		}
+		meta["next_cursor"] = nextCursor
+	}
+
+	data := map[string]any{
+		"deposits": deposits,
+		"totals":   totals,
+		"meta":     meta,
+	}
+
+	return helpers.Response(c, fiber.StatusOK, "Success", "Data found", data, nil)
+}
+
+// depositScopeQuery - filter user/bank harus lolos scope, tanpa filter dibatasi sesuai role
+func depositScopeQuery(c *fiber.Ctx, query *gorm.DB, req depositListRequest) (*gorm.DB, error) {
+	childBanksOf := func(parentBankID uint) *gorm.DB {
+		return configs.DB.Model(&models.ChildBank{}).Select("id").Where("parent_bank_id = ?", parentBankID)
+	}
+
+	if req.UserID != 0 {
+		if err := helpers.ScopeUser(c, req.UserID); err != nil {
+			return nil, err
+		}
+		query = query.Where("waste_deposits.user_id = ?", req.UserID)
+	}
+
+	switch {
+	case req.ChildBankID != 0:
+		if err := helpers.ScopeBank(c, nil, &req.ChildBankID); err != nil {
+			return nil, err
+		}
+		return query.Where("waste_deposits.child_bank_id = ?", req.ChildBankID), nil
+	case req.ParentBankID != 0:
+		if err := helpers.ScopeBank(c, &req.ParentBankID, nil); err != nil {
+			return nil, err
+		}
+		if req.OwnOnly {
+			return query.Where("waste_deposits.parent_bank_id = ?", req.ParentBankID), nil
+		}
+		return query.Where("(waste_deposits.parent_bank_id = ? OR waste_deposits.child_bank_id IN (?))", req.ParentBankID, childBanksOf(req.ParentBankID)), nil
+	case req.UserID != 0, helpers.HasRole(c, models.RoleAdmin):
+		return query, nil
+	}
+
+	user := helpers.AuthUser(c)
+	if user == nil {
+		return nil, helpers.ErrForbidden
+	}
+	switch helpers.AuthRole(c) {
+	case models.RoleChildBank:
+		if user.ChildBankID == nil {
+			return nil, helpers.ErrForbidden
+		}
+		return query.Where("waste_deposits.child_bank_id = ?", *user.ChildBankID), nil
+	case models.RoleParentBank:
+		if user.ParentBankID == nil {
+			return nil, helpers.ErrForbidden
+		}
+		return query.Where("(waste_deposits.parent_bank_id = ? OR waste_deposits.child_bank_id IN (?))", *user.ParentBankID, childBanksOf(*user.ParentBankID)), nil
+	}
+	return query.Where("waste_deposits.user_id = ?", user.Id), nil
+}
+
+func depositFilterQuery(query *gorm.DB, req depositListRequest) (*gorm.DB, error) {
+	if req.Status != "" {
+		if req.Status != models.DepositStatusActive && req.Status != models.DepositStatusVoided {
+			return nil, errors.New("status must be active or voided")
+		}
+		query = query.Where("waste_deposits.status = ?", req.Status)
+	}
+
+	switch req.Source {
+	case "":
+	case "pickup":
+		query = query.Where("waste_deposits.pickup_request_id IS NOT NULL")
+	case "direct":
+		query = query.Where("waste_deposits.pickup_request_id IS NULL")
+	default:
+		return nil, errors.New("source must be pickup or direct")
+	}
+	if req.PickupID != 0 {
+		query = query.Where("waste_deposits.pickup_request_id = ?", req.PickupID)
+	}
+
+	// Filter item memakai EXISTS supaya satu setoran tidak muncul berulang
+	if req.Category != "" || req.ProductWasteID != 0 {
+		items := configs.DB.Model(&models.WasteDepositItem{}).
+			Select("1").
+			Where("waste_deposit_items.waste_deposit_id = waste_deposits.id")
+		if req.Category != "" {
+			if req.Category != "organik" && req.Category != "anorganik" {
+				return nil, errors.New("category must be organik or anorganik")
+			}
+			items = items.Where("waste_deposit_items.category = ?", req.Category)
+		}
+		if req.ProductWasteID != 0 {
+			items = items.Where("waste_deposit_items.product_waste_id = ?", req.ProductWasteID)
+		}
+		query = query.Where("EXISTS (?)", items)
+	}
+
+	if req.MinWeight > 0 {
+		query = query.Where("waste_deposits.total_weight >= ?", req.MinWeight)
+	}
+	if req.MaxWeight > 0 {
+		query = query.Where("waste_deposits.total_weight <= ?", req.MaxWeight)
+	}
+	if req.MinPrice > 0 {
+		query = query.Where("waste_deposits.total_price >= ?", req.MinPrice)
+	}
+	if req.MaxPrice > 0 {
+		query = query.Where("waste_deposits.total_price <= ?", req.MaxPrice)
+	}
+
+	if req.StartDate != "" {
+		startDate, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			return nil, errors.New("Invalid start_date format, use YYYY-MM-DD")
+		}
+		query = query.Where("DATE(waste_deposits.created_at) >= ?", startDate.Format("2006-01-02"))
+	}
+	if req.EndDate != "" {
+		endDate, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			return nil, errors.New("Invalid end_date format, use YYYY-MM-DD")
+		}
+		query = query.Where("DATE(waste_deposits.created_at) <= ?", endDate.Format("2006-01-02"))
+	}
+
+	if req.Search != "" {
+		search := "%" + req.Search + "%"
+		users := configs.DB.Model(&models.User{}).Select("id").Where("name LIKE ?", search)
+		query = query.Where("(waste_deposits.reference_id LIKE ? OR waste_deposits.user_id IN (?))", search, users)
+	}
+
+	return query, nil
+}
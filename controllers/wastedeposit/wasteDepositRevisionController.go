@@ -0,0 +1,478 @@
+package wastedeposit
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WasteDepositAmendItemRequest - item hasil koreksi. id diisi untuk item lama (foto dan harga
+// snapshotnya dipertahankan), kosong untuk item baru.
+type WasteDepositAmendItemRequest struct {
+	Id             uint    `json:"id"`
+	ProductWasteID uint    `json:"product_waste_id"`
+	Weight         float64 `json:"weight"`
+	Unit           string  `json:"unit"`
+}
+
+var (
+	errDepositVoided  = errors.New("waste deposit has been voided")
+	errDepositChanged = errors.New("waste deposit was changed by another request")
+)
+
+// AmendWasteDeposit - koreksi item setoran (berat, satuan, jenis sampah). Daftar items menggantikan
+// item lama; item yang tidak disebut dihapus (soft delete, foto tetap disimpan). Selisih harga
+// langsung dikredit/didebit ke saldo user dan selisih berat masuk/keluar stok bank.
+func AmendWasteDeposit(c *fiber.Ctx) error {
+	var body struct {
+		Reason string                         `json:"reason"`
+		Items  []WasteDepositAmendItemRequest `json:"items"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Reason is required", nil, nil)
+	}
+	if len(body.Items) == 0 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Items cannot be empty, void the deposit instead", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+
+	deposit, err := lockActiveDeposit(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return depositErrorResponse(c, err)
+	}
+
+	// Klaim revisi berikutnya lebih dulu, koreksi/pembatalan paralel yang kalah berhenti sebelum
+	// stok dan saldo berubah
+	revision := deposit.Revision + 1
+	if err := claimDepositRevision(tx, deposit, revision); err != nil {
+		tx.Rollback()
+		return depositErrorResponse(c, err)
+	}
+
+	priceScope, err := helpers.NewWastePriceScope(tx, deposit.ParentBankID, deposit.ChildBankID)
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to resolve deposit bank", nil, nil)
+	}
+
+	oldItems := make(map[uint]models.WasteDepositItem, len(deposit.Items))
+	for _, item := range deposit.Items {
+		oldItems[item.Id] = item
+	}
+
+	rounding := helpers.WasteRoundingFromEnv()
+	kept := map[uint]bool{}
+	var newItems []models.WasteDepositItem
+	var totalWeight float64
+	var totalPrice int
+
+	for i, itemReq := range body.Items {
+		var old *models.WasteDepositItem
+		if itemReq.Id != 0 {
+			item, ok := oldItems[itemReq.Id]
+			if !ok || kept[itemReq.Id] {
+				tx.Rollback()
+				return helpers.Response(c, fiber.StatusBadRequest, "Failed", fmt.Sprintf("Item %d is not part of this deposit", itemReq.Id), nil, nil)
+			}
+			kept[itemReq.Id] = true
+			old = &item
+			if itemReq.ProductWasteID == 0 {
+				itemReq.ProductWasteID = item.ProductWasteID
+			}
+		}
+
+		// Produk item lama yang sudah dihapus dari katalog tetap boleh dipakai
+		productQuery := tx
+		if old != nil && old.ProductWasteID == itemReq.ProductWasteID {
+			productQuery = tx.Unscoped()
+		}
+		var product models.ProductWaste
+		if err := productQuery.First(&product, itemReq.ProductWasteID).Error; err != nil {
+			tx.Rollback()
+			return helpers.Response(c, fiber.StatusNotFound, "Failed", fmt.Sprintf("Product waste not found at index %d", i), nil, nil)
+		}
+
+		// Produk yang sama memakai harga snapshot setoran, produk lain memakai harga yang berlaku
+		// saat setoran dibuat
+		unitPrice := 0
+		if old != nil && old.ProductWasteID == product.Id && old.PriceUnit != "" {
+			unitPrice = old.UnitPrice
+		} else {
+			resolved, err := helpers.ResolveWastePrice(tx, product, priceScope, deposit.CreatedAt)
+			if err != nil {
+				tx.Rollback()
+				return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to resolve product waste price", nil, nil)
+			}
+			unitPrice = resolved.Price
+		}
+
+		itemPrice, err := helpers.PriceWasteItem(product, unitPrice, itemReq.Weight, itemReq.Unit, rounding)
+		if err != nil {
+			tx.Rollback()
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", fmt.Sprintf("Item %d: %s", i, err.Error()), nil, nil)
+		}
+
+		item := models.WasteDepositItem{WasteDepositID: deposit.Id}
+		if old != nil {
+			item = *old
+		}
+		item.ProductWasteID = product.Id
+		item.Category = product.Category
+		item.Weight = itemReq.Weight
+		item.Unit = itemPrice.Unit
+		item.UnitPrice = itemPrice.UnitPrice
+		item.PriceUnit = itemPrice.PriceUnit
+		item.NormalizedWeight = itemPrice.NormalizedWeight
+		item.SubTotal = itemPrice.SubTotal
+
+		if err := tx.Omit("WasteDeposit", "ProductWaste").Save(&item).Error; err != nil {
+			tx.Rollback()
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to save deposit items", nil, nil)
+		}
+
+		newItems = append(newItems, item)
+		totalWeight += helpers.WasteWeightKg(item.Weight, item.Unit)
+		totalPrice += item.SubTotal
+	}
+
+	// Item yang dikeluarkan dari setoran di-soft delete, fotonya tidak dihapus dari S3
+	for _, item := range deposit.Items {
+		if kept[item.Id] {
+			continue
+		}
+		if err := tx.Delete(&models.WasteDepositItem{}, item.Id).Error; err != nil {
+			tx.Rollback()
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to remove deposit items", nil, nil)
+		}
+	}
+
+	reference := fmt.Sprintf("%s-R%d", deposit.ReferenceID, revision)
+	delta := totalPrice - deposit.TotalPrice
+
+	if err := moveDepositStockDelta(c, tx, deposit, deposit.Items, newItems, reference, "Koreksi setoran: "+reason); err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrInsufficientStock) {
+			return helpers.Response(c, fiber.StatusConflict, "Failed", "Waste stock is insufficient for this correction, the deposited waste has already been transferred or sold; adjust the stock first", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update waste stock", nil, nil)
+	}
+
+	if err := postDepositBalance(tx, deposit, reference, "Koreksi setoran sampah", delta); err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrInsufficientBalance) {
+			return helpers.Response(c, fiber.StatusConflict, "Failed", "User balance is insufficient for this correction", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update user balance", nil, nil)
+	}
+
+	err = tx.Model(&models.WasteDeposit{}).Where("id = ?", deposit.Id).Updates(map[string]any{
+		"total_weight": totalWeight,
+		"total_price":  totalPrice,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update waste deposit", nil, nil)
+	}
+
+	err = tx.Create(&models.WasteDepositRevision{
+		WasteDepositID:    deposit.Id,
+		Revision:          revision,
+		Action:            models.DepositRevisionAmend,
+		Reason:            reason,
+		TotalWeightBefore: deposit.TotalWeight,
+		TotalWeightAfter:  totalWeight,
+		TotalPriceBefore:  deposit.TotalPrice,
+		TotalPriceAfter:   totalPrice,
+		BalanceDelta:      delta,
+		ItemsBefore:       helpers.SnapshotDepositItems(deposit.Items),
+		ItemsAfter:        helpers.SnapshotDepositItems(newItems),
+		CreatedBy:         helpers.AuthUserID(c),
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to record deposit revision", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondDeposit(c, deposit.Id, "Waste deposit amended successfully and balance adjusted")
+}
+
+// VoidWasteDeposit - membatalkan setoran dengan alasan wajib. Saldo user didebit penuh (ditolak jika
+// saldo tidak cukup, tidak ada pemotongan diam-diam), stok dikeluarkan, data dan foto tetap disimpan.
+// Alasan dikirim lewat body {"reason": "..."} atau ?reason=.
+func VoidWasteDeposit(c *fiber.Ctx) error {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+		}
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		reason = strings.TrimSpace(c.Query("reason"))
+	}
+	if reason == "" {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Reason is required to void a waste deposit", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+
+	deposit, err := lockActiveDeposit(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return depositErrorResponse(c, err)
+	}
+
+	// Sama seperti koreksi, klaim revisi sebelum stok dan saldo berubah
+	revision := deposit.Revision + 1
+	if err := claimDepositRevision(tx, deposit, revision); err != nil {
+		tx.Rollback()
+		return depositErrorResponse(c, err)
+	}
+
+	reference := fmt.Sprintf("%s-R%d", deposit.ReferenceID, revision)
+
+	if err := moveDepositStockDelta(c, tx, deposit, deposit.Items, nil, reference, "Setoran dibatalkan: "+reason); err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrInsufficientStock) {
+			return helpers.Response(c, fiber.StatusConflict, "Failed", "Waste stock is insufficient to void this deposit, the deposited waste has already been transferred or sold; adjust the stock first", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update waste stock", nil, nil)
+	}
+
+	if err := postDepositBalance(tx, deposit, reference, "Pembatalan setoran sampah", -deposit.TotalPrice); err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrInsufficientBalance) {
+			return helpers.Response(c, fiber.StatusConflict, "Failed", "User balance is insufficient to void this deposit", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to update user balance", nil, nil)
+	}
+
+	now := time.Now()
+	err = tx.Model(&models.WasteDeposit{}).Where("id = ?", deposit.Id).Updates(map[string]any{
+		"status":      models.DepositStatusVoided,
+		"void_reason": reason,
+		"voided_at":   &now,
+		"voided_by":   helpers.AuthUserID(c),
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to void waste deposit", nil, nil)
+	}
+
+	err = tx.Create(&models.WasteDepositRevision{
+		WasteDepositID:    deposit.Id,
+		Revision:          revision,
+		Action:            models.DepositRevisionVoid,
+		Reason:            reason,
+		TotalWeightBefore: deposit.TotalWeight,
+		TotalPriceBefore:  deposit.TotalPrice,
+		BalanceDelta:      -deposit.TotalPrice,
+		ItemsBefore:       helpers.SnapshotDepositItems(deposit.Items),
+		CreatedBy:         helpers.AuthUserID(c),
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to record deposit revision", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondDeposit(c, deposit.Id, "Waste deposit voided successfully and balance adjusted")
+}
+
+// GetWasteDepositRevisions - riwayat lengkap perubahan setoran (admin)
+func GetWasteDepositRevisions(c *fiber.Ctx) error {
+	var deposit models.WasteDeposit
+	if err := configs.DB.Unscoped().First(&deposit, c.Params("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return helpers.Response(c, fiber.StatusNotFound, "Failed", "Waste deposit not found", nil, nil)
+		}
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", err.Error(), nil, nil)
+	}
+
+	var revisions []models.WasteDepositRevision
+	if err := configs.DB.Where("waste_deposit_id = ?", deposit.Id).Order("revision ASC").Find(&revisions).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to fetch deposit revisions", nil, nil)
+	}
+
+	data := map[string]any{
+		"deposit":   deposit,
+		"revisions": revisions,
+	}
+	return helpers.Response(c, fiber.StatusOK, "Success", "Data found", data, nil)
+}
+
+// lockActiveDeposit mengambil setoran dengan FOR UPDATE beserta itemnya, cek scope dan status aktif
+func lockActiveDeposit(c *fiber.Ctx, tx *gorm.DB) (*models.WasteDeposit, error) {
+	var deposit models.WasteDeposit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		First(&deposit, c.Params("id")).Error; err != nil {
+		return nil, err
+	}
+	if err := helpers.ScopeBank(c, deposit.ParentBankID, deposit.ChildBankID); err != nil {
+		return nil, err
+	}
+	if deposit.Status == models.DepositStatusVoided {
+		return nil, errDepositVoided
+	}
+	return &deposit, nil
+}
+
+// claimDepositRevision menaikkan revisi hanya jika setoran belum dibatalkan dan revisinya masih sama
+// dengan yang dibaca, errDepositChanged jika transaksi lain sudah mengubahnya lebih dulu
+func claimDepositRevision(tx *gorm.DB, deposit *models.WasteDeposit, revision int) error {
+	result := tx.Model(&models.WasteDeposit{}).
+		Where("id = ? AND status <> ? AND revision = ?", deposit.Id, models.DepositStatusVoided, deposit.Revision).
+		Update("revision", revision)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errDepositChanged
+	}
+	return nil
+}
+
+func depositErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errDepositChanged):
+		return helpers.Response(c, fiber.StatusConflict, "Failed", "Waste deposit was changed by another request, please reload", nil, nil)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return helpers.Response(c, fiber.StatusNotFound, "Failed", "Waste deposit not found", nil, nil)
+	case errors.Is(err, errDepositVoided):
+		return helpers.Response(c, fiber.StatusConflict, "Failed", "Waste deposit has already been voided", nil, nil)
+	}
+	return helpers.ScopeResponse(c, err)
+}
+
+// postDepositBalance - delta positif menambah saldo user, negatif mengurangi. Riwayat transaksi
+// user ikut dicatat seperti saat setoran dibuat.
+func postDepositBalance(tx *gorm.DB, deposit *models.WasteDeposit, reference, description string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+
+	ledger := helpers.NewLedgerService(tx)
+	transaction := models.Transaction{
+		UserID:  deposit.UserID,
+		Balance: delta,
+		Status:  "confirm",
+	}
+	if delta > 0 {
+		if _, err := ledger.Post(reference, description,
+			helpers.Debit(models.AccountWastePurchase, 0, delta),
+			helpers.Credit(models.AccountUserWallet, deposit.UserID, delta),
+		); err != nil {
+			return err
+		}
+		transaction.Type = "topup"
+		transaction.Desc = description + " - Ref: " + reference
+	} else {
+		if _, err := ledger.Post(reference, description,
+			helpers.Debit(models.AccountUserWallet, deposit.UserID, -delta),
+			helpers.Credit(models.AccountWastePurchase, 0, -delta),
+		); err != nil {
+			return err
+		}
+		transaction.Type = "withdraw"
+		transaction.Desc = description + " - Ref: " + reference
+	}
+
+	return tx.Create(&transaction).Error
+}
+
+// moveDepositStockDelta - selisih berat per produk antara item lama dan baru dibukukan ke stok bank.
+// Item setoran lama tanpa snapshot satuan tidak pernah masuk stok sehingga tidak dikeluarkan.
+func moveDepositStockDelta(c *fiber.Ctx, tx *gorm.DB, deposit *models.WasteDeposit, before, after []models.WasteDepositItem, reference, note string) error {
+	type stockKey struct {
+		productID uint
+		unit      string
+	}
+	deltas := map[stockKey]float64{}
+	for _, item := range before {
+		if item.NormalizedWeight != 0 {
+			deltas[stockKey{item.ProductWasteID, item.PriceUnit}] -= item.NormalizedWeight
+		}
+	}
+	for _, item := range after {
+		deltas[stockKey{item.ProductWasteID, item.PriceUnit}] += item.NormalizedWeight
+	}
+
+	keys := make([]stockKey, 0, len(deltas))
+	for key := range deltas {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].productID != keys[j].productID {
+			return keys[i].productID < keys[j].productID
+		}
+		return keys[i].unit < keys[j].unit
+	})
+
+	inventory := helpers.NewInventoryService(tx)
+	for _, key := range keys {
+		quantity := math.Round(deltas[key]*1000) / 1000
+		if quantity == 0 {
+			continue
+		}
+		movementType := models.StockMovementDeposit
+		if quantity < 0 {
+			movementType = models.StockMovementDepositVoid
+		}
+		// Sampah yang sudah ditransfer/dijual tidak bisa dikurangi lagi (ErrInsufficientStock), stok harus
+		// disesuaikan dulu lewat penyesuaian stok
+		_, err := inventory.Move(helpers.StockMove{
+			Bank:           helpers.InventoryBank{ParentBankID: deposit.ParentBankID, ChildBankID: deposit.ChildBankID},
+			ProductWasteID: key.productID,
+			Type:           movementType,
+			Quantity:       quantity,
+			Unit:           key.unit,
+			Reference:      reference,
+			Note:           note,
+			CreatedBy:      helpers.AuthUserID(c),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func respondDeposit(c *fiber.Ctx, id uint, message string) error {
+	var deposit models.WasteDeposit
+	if err := configs.DB.
+		Preload("User").
+		Preload("ChildBank").
+		Preload("ParentBank").
+		Preload("Items").
+		Preload("Items.ProductWaste", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		First(&deposit, id).Error; err != nil {
+		return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to load waste deposit data", nil, nil)
+	}
+	return helpers.Response(c, fiber.StatusOK, "Success", message, deposit, nil)
+}
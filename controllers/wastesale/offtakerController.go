@@ -0,0 +1,212 @@
+package wastesale
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type offtakerRequest struct {
+	ParentBankID *uint   `json:"parent_bank_id"`
+	Name         *string `json:"name"`
+	ContactName  *string `json:"contact_name"`
+	Phone        *string `json:"phone"`
+	Email        *string `json:"email"`
+	Address      *string `json:"address"`
+	Materials    *string `json:"materials"`
+	IsActive     *bool   `json:"is_active"`
+}
+
+func (req offtakerRequest) apply(offtaker *models.Offtaker) {
+	if req.Name != nil {
+		offtaker.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.ContactName != nil {
+		offtaker.ContactName = strings.TrimSpace(*req.ContactName)
+	}
+	if req.Phone != nil {
+		offtaker.Phone = strings.TrimSpace(*req.Phone)
+	}
+	if req.Email != nil {
+		offtaker.Email = strings.TrimSpace(*req.Email)
+	}
+	if req.Address != nil {
+		offtaker.Address = strings.TrimSpace(*req.Address)
+	}
+	if req.Materials != nil {
+		offtaker.Materials = strings.TrimSpace(*req.Materials)
+	}
+	if req.IsActive != nil {
+		offtaker.IsActive = *req.IsActive
+	}
+}
+
+// GetOfftakers - daftar offtaker. Operator bank induk melihat offtaker umum dan milik banknya.
+// ?search=&active=true&page=&limit=
+func GetOfftakers(c *fiber.Ctx) error {
+	var req struct {
+		Search string `query:"search"`
+		Active string `query:"active"`
+		Page   int    `query:"page"`
+		Limit  int    `query:"limit"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	offset := (req.Page - 1) * req.Limit
+
+	query := configs.DB.Model(&models.Offtaker{})
+	if !helpers.HasRole(c, models.RoleAdmin) {
+		user := helpers.AuthUser(c)
+		if user == nil || user.ParentBankID == nil {
+			return helpers.ScopeResponse(c, helpers.ErrForbidden)
+		}
+		query = query.Where("parent_bank_id IS NULL OR parent_bank_id = ?", *user.ParentBankID)
+	}
+	if req.Search != "" {
+		search := "%" + req.Search + "%"
+		query = query.Where("name LIKE ? OR contact_name LIKE ? OR materials LIKE ?", search, search, search)
+	}
+	if req.Active != "" {
+		query = query.Where("is_active = ?", req.Active == "true")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var offtakers []models.Offtaker
+	if err := query.Order("name ASC").Offset(offset).Limit(req.Limit).Find(&offtakers).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch offtakers", nil, nil)
+	}
+
+	data := map[string]any{
+		"offtakers": offtakers,
+		"meta": map[string]any{
+			"page":  req.Page,
+			"limit": req.Limit,
+			"total": total,
+			"pages": (int(total) + req.Limit - 1) / req.Limit,
+		},
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// GetOfftakerByID - detail offtaker
+func GetOfftakerByID(c *fiber.Ctx) error {
+	offtaker, err := findOfftaker(c, c.Params("id"))
+	if err != nil {
+		return offtakerErrorResponse(c, err)
+	}
+	return helpers.Response(c, 200, "Success", "Data found", offtaker, nil)
+}
+
+// CreateOfftaker - operator bank induk membuat offtaker untuk banknya, admin boleh membuat offtaker umum
+func CreateOfftaker(c *fiber.Ctx) error {
+	var body offtakerRequest
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+
+	offtaker := models.Offtaker{IsActive: true}
+	body.apply(&offtaker)
+	if offtaker.Name == "" {
+		return helpers.Response(c, 400, "Failed", "Name is required", nil, nil)
+	}
+
+	offtaker.ParentBankID = body.ParentBankID
+	if !helpers.HasRole(c, models.RoleAdmin) {
+		offtaker.ParentBankID = helpers.AuthUser(c).ParentBankID
+		if offtaker.ParentBankID == nil {
+			return helpers.ScopeResponse(c, helpers.ErrForbidden)
+		}
+	}
+	if offtaker.ParentBankID != nil {
+		if err := helpers.ScopeBank(c, offtaker.ParentBankID, nil); err != nil {
+			return helpers.ScopeResponse(c, err)
+		}
+	}
+
+	if err := configs.DB.Create(&offtaker).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to create offtaker", nil, nil)
+	}
+
+	return helpers.Response(c, 201, "Success", "Offtaker created successfully", offtaker, nil)
+}
+
+// UpdateOfftaker - offtaker umum hanya bisa diubah admin
+func UpdateOfftaker(c *fiber.Ctx) error {
+	offtaker, err := findOfftaker(c, c.Params("id"))
+	if err != nil {
+		return offtakerErrorResponse(c, err)
+	}
+	if offtaker.ParentBankID == nil && !helpers.HasRole(c, models.RoleAdmin) {
+		return helpers.ScopeResponse(c, helpers.ErrForbidden)
+	}
+
+	var body offtakerRequest
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+	body.apply(offtaker)
+	if offtaker.Name == "" {
+		return helpers.Response(c, 400, "Failed", "Name is required", nil, nil)
+	}
+
+	if err := configs.DB.Save(offtaker).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to update offtaker", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Offtaker updated successfully", offtaker, nil)
+}
+
+// DeleteOfftaker - soft delete, riwayat penjualan tetap menunjuk ke offtaker ini
+func DeleteOfftaker(c *fiber.Ctx) error {
+	offtaker, err := findOfftaker(c, c.Params("id"))
+	if err != nil {
+		return offtakerErrorResponse(c, err)
+	}
+	if offtaker.ParentBankID == nil && !helpers.HasRole(c, models.RoleAdmin) {
+		return helpers.ScopeResponse(c, helpers.ErrForbidden)
+	}
+
+	if err := configs.DB.Delete(offtaker).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to delete offtaker", nil, nil)
+	}
+
+	return helpers.Response(c, 200, "Success", "Offtaker deleted successfully", nil, nil)
+}
+
+// findOfftaker - offtaker umum bisa dibaca semua operator bank induk, offtaker bank hanya oleh banknya
+func findOfftaker(c *fiber.Ctx, id any) (*models.Offtaker, error) {
+	var offtaker models.Offtaker
+	if err := configs.DB.First(&offtaker, id).Error; err != nil {
+		return nil, err
+	}
+	if offtaker.ParentBankID != nil {
+		if err := helpers.ScopeBank(c, offtaker.ParentBankID, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &offtaker, nil
+}
+
+func offtakerErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return helpers.Response(c, 404, "Failed", "Offtaker not found", nil, nil)
+	}
+	return helpers.ScopeResponse(c, err)
+}
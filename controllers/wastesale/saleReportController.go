@@ -0,0 +1,132 @@
+package wastesale
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type saleReportRow struct {
+	Key            string  `json:"key"`
+	Label          string  `json:"label"`
+	Unit           string  `json:"unit,omitempty"`
+	Quantity       float64 `json:"quantity"`
+	Revenue        int     `json:"revenue"`
+	Cost           int     `json:"cost"`
+	Profit         int     `json:"profit"`
+	MarginPercent  float64 `json:"margin_percent"`
+	AvgSalePrice   float64 `json:"avg_sale_price,omitempty"`
+	AvgBuybackCost float64 `json:"avg_buyback_cost,omitempty"`
+}
+
+func (row *saleReportRow) finish() {
+	row.Quantity = math.Round(row.Quantity*1000) / 1000
+	row.Profit = row.Revenue - row.Cost
+	if row.Revenue != 0 {
+		row.MarginPercent = math.Round(float64(row.Profit)/float64(row.Revenue)*10000) / 100
+	}
+	if row.Unit != "" && row.Quantity != 0 {
+		row.AvgSalePrice = math.Round(float64(row.Revenue)/row.Quantity*100) / 100
+		row.AvgBuybackCost = math.Round(float64(row.Cost)/row.Quantity*100) / 100
+	}
+}
+
+// GetWasteSaleReport - laba penjualan sampah: harga jual ke offtaker dibanding harga beli dari nasabah
+// (WasteDepositItem) untuk berat yang terkirim. Hanya order yang sudah dikirim.
+// ?parent_bank_id=&offtaker_id=&start_date=&end_date= (YYYY-MM-DD, tanggal kirim)&group_by=product|offtaker|month
+func GetWasteSaleReport(c *fiber.Ctx) error {
+	var req struct {
+		ParentBankID uint   `query:"parent_bank_id"`
+		OfftakerID   uint   `query:"offtaker_id"`
+		StartDate    string `query:"start_date"`
+		EndDate      string `query:"end_date"`
+		GroupBy      string `query:"group_by"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+	if req.GroupBy == "" {
+		req.GroupBy = "product"
+	}
+
+	sales, err := saleBankQuery(c, configs.DB.Model(&models.WasteSale{}), req.ParentBankID)
+	if err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	sales = sales.Where("status = ?", models.SaleStatusDelivered)
+	if req.OfftakerID != 0 {
+		sales = sales.Where("offtaker_id = ?", req.OfftakerID)
+	}
+	sales, err = dateRange(sales, "delivered_at", req.StartDate, req.EndDate)
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	}
+
+	var summary struct {
+		Sales       int64 `json:"sales"`
+		Revenue     int   `json:"revenue"`
+		Cost        int   `json:"cost"`
+		Profit      int   `json:"profit"`
+		Paid        int   `json:"paid"`
+		Outstanding int   `json:"outstanding"`
+	}
+	err = sales.Session(&gorm.Session{}).
+		Select("COUNT(*) AS sales, COALESCE(SUM(invoice_amount), 0) AS revenue, COALESCE(SUM(cost_amount), 0) AS cost, COALESCE(SUM(paid_amount), 0) AS paid").
+		Scan(&summary).Error
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to build sale report", nil, nil)
+	}
+	summary.Profit = summary.Revenue - summary.Cost
+	summary.Outstanding = summary.Revenue - summary.Paid
+
+	rows := []saleReportRow{}
+	switch req.GroupBy {
+	case "product":
+		err = configs.DB.Table("waste_sale_items").
+			Select("CAST(waste_sale_items.product_waste_id AS CHAR) AS `key`, product_wastes.waste_type AS label, waste_sale_items.unit AS unit, "+
+				"COALESCE(SUM(waste_sale_items.delivered_quantity), 0) AS quantity, COALESCE(SUM(waste_sale_items.sub_total), 0) AS revenue, "+
+				"COALESCE(SUM(waste_sale_items.cost_amount), 0) AS cost").
+			Joins("LEFT JOIN product_wastes ON product_wastes.id = waste_sale_items.product_waste_id").
+			Where("waste_sale_items.sale_id IN (?)", sales.Session(&gorm.Session{}).Select("id")).
+			Group("waste_sale_items.product_waste_id, product_wastes.waste_type, waste_sale_items.unit").
+			Order("revenue DESC").
+			Scan(&rows).Error
+	case "offtaker":
+		// Kolom parent_bank_id juga ada di offtakers, jadi filter order lewat subquery
+		err = configs.DB.Table("waste_sales").
+			Select("CAST(waste_sales.offtaker_id AS CHAR) AS `key`, offtakers.name AS label, "+
+				"COALESCE(SUM(waste_sales.invoice_amount), 0) AS revenue, COALESCE(SUM(waste_sales.cost_amount), 0) AS cost").
+			Joins("LEFT JOIN offtakers ON offtakers.id = waste_sales.offtaker_id").
+			Where("waste_sales.id IN (?)", sales.Session(&gorm.Session{}).Select("id")).
+			Group("waste_sales.offtaker_id, offtakers.name").
+			Order("revenue DESC").
+			Scan(&rows).Error
+	case "month":
+		err = sales.Session(&gorm.Session{}).
+			Select("DATE_FORMAT(delivered_at, '%Y-%m') AS `key`, DATE_FORMAT(delivered_at, '%Y-%m') AS label, " +
+				"COALESCE(SUM(invoice_amount), 0) AS revenue, COALESCE(SUM(cost_amount), 0) AS cost").
+			Group("DATE_FORMAT(delivered_at, '%Y-%m')").
+			Order("`key` ASC").
+			Scan(&rows).Error
+	default:
+		return helpers.Response(c, 400, "Failed", "group_by must be product, offtaker or month", nil, nil)
+	}
+	if err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to build sale report", nil, nil)
+	}
+	for i := range rows {
+		rows[i].finish()
+	}
+
+	data := map[string]any{
+		"summary":  summary,
+		"group_by": req.GroupBy,
+		"rows":     rows,
+	}
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
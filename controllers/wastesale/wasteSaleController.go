@@ -0,0 +1,529 @@
+package wastesale
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WasteSaleItemRequest - item order, unit kosong berarti satuan produk
+type WasteSaleItemRequest struct {
+	ProductWasteID uint    `json:"product_waste_id"`
+	Quantity       float64 `json:"quantity"`
+	Unit           string  `json:"unit"`
+	UnitPrice      int     `json:"unit_price"` // harga jual per satuan produk
+}
+
+// CreateWasteSale - bank induk membuat order penjualan ke offtaker. Stok belum berkurang sampai
+// pengiriman dikonfirmasi.
+func CreateWasteSale(c *fiber.Ctx) error {
+	var body struct {
+		ParentBankID *uint                  `json:"parent_bank_id"`
+		OfftakerID   uint                   `json:"offtaker_id"`
+		Note         string                 `json:"note"`
+		Items        []WasteSaleItemRequest `json:"items"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+
+	parentBankID := body.ParentBankID
+	if parentBankID == nil {
+		if user := helpers.AuthUser(c); user != nil {
+			parentBankID = user.ParentBankID
+		}
+	}
+	if parentBankID == nil {
+		return helpers.Response(c, 400, "Failed", "parent_bank_id is required", nil, nil)
+	}
+	if err := helpers.ScopeBank(c, parentBankID, nil); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	if len(body.Items) == 0 {
+		return helpers.Response(c, 400, "Failed", "Items cannot be empty", nil, nil)
+	}
+
+	offtaker, err := findOfftaker(c, body.OfftakerID)
+	if err != nil {
+		return offtakerErrorResponse(c, err)
+	}
+	if !offtaker.IsActive {
+		return helpers.Response(c, 400, "Failed", "Offtaker is not active", nil, nil)
+	}
+	if offtaker.ParentBankID != nil && *offtaker.ParentBankID != *parentBankID {
+		return helpers.Response(c, 400, "Failed", "Offtaker belongs to another parent bank", nil, nil)
+	}
+
+	rounding := helpers.WasteRoundingFromEnv()
+	now := time.Now()
+
+	sale := models.WasteSale{
+		ReferenceID:   helpers.UniqueReference("WS", now, *parentBankID),
+		ParentBankID:  *parentBankID,
+		OfftakerID:    offtaker.Id,
+		Status:        models.SaleStatusOrdered,
+		PaymentStatus: models.SalePaymentUnpaid,
+		Note:          strings.TrimSpace(body.Note),
+		CreatedBy:     helpers.AuthUserID(c),
+	}
+
+	for i, itemReq := range body.Items {
+		if itemReq.UnitPrice < 0 {
+			return helpers.Response(c, 400, "Failed", fmt.Sprintf("Invalid unit price at index %d", i), nil, nil)
+		}
+
+		var product models.ProductWaste
+		if err := configs.DB.First(&product, itemReq.ProductWasteID).Error; err != nil {
+			return helpers.Response(c, 404, "Failed", fmt.Sprintf("Product waste not found at index %d", i), nil, nil)
+		}
+
+		itemPrice, err := helpers.PriceWasteItem(product, itemReq.UnitPrice, itemReq.Quantity, itemReq.Unit, rounding)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", fmt.Sprintf("Item %d: %s", i, err.Error()), nil, nil)
+		}
+
+		sale.Items = append(sale.Items, models.WasteSaleItem{
+			ProductWasteID: product.Id,
+			Quantity:       itemPrice.NormalizedWeight,
+			Unit:           itemPrice.PriceUnit,
+			UnitPrice:      itemPrice.UnitPrice,
+			SubTotal:       itemPrice.SubTotal,
+		})
+		sale.OrderTotal += itemPrice.SubTotal
+	}
+
+	if err := configs.DB.Create(&sale).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to create waste sale", nil, nil)
+	}
+
+	return respondSale(c, 201, sale.Id, "Waste sale created successfully")
+}
+
+// GetWasteSales - daftar order penjualan. ?parent_bank_id=&offtaker_id=&status=&payment_status=
+// &start_date=&end_date= (YYYY-MM-DD, tanggal order)&page=&limit=
+func GetWasteSales(c *fiber.Ctx) error {
+	var req struct {
+		ParentBankID  uint   `query:"parent_bank_id"`
+		OfftakerID    uint   `query:"offtaker_id"`
+		Status        string `query:"status"`
+		PaymentStatus string `query:"payment_status"`
+		StartDate     string `query:"start_date"`
+		EndDate       string `query:"end_date"`
+		Page          int    `query:"page"`
+		Limit         int    `query:"limit"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	offset := (req.Page - 1) * req.Limit
+
+	query, err := saleBankQuery(c, configs.DB.Model(&models.WasteSale{}), req.ParentBankID)
+	if err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	if req.OfftakerID != 0 {
+		query = query.Where("offtaker_id = ?", req.OfftakerID)
+	}
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+	if req.PaymentStatus != "" {
+		query = query.Where("payment_status = ?", req.PaymentStatus)
+	}
+	query, err = dateRange(query, "created_at", req.StartDate, req.EndDate)
+	if err != nil {
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var sales []models.WasteSale
+	if err := query.
+		Preload("Offtaker", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Items").
+		Preload("Items.ProductWaste", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("id DESC").Offset(offset).Limit(req.Limit).Find(&sales).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch waste sales", nil, nil)
+	}
+
+	data := map[string]any{
+		"sales": sales,
+		"meta": map[string]any{
+			"page":  req.Page,
+			"limit": req.Limit,
+			"total": total,
+			"pages": (int(total) + req.Limit - 1) / req.Limit,
+		},
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// GetWasteSaleByID - detail order beserta pembayarannya
+func GetWasteSaleByID(c *fiber.Ctx) error {
+	var sale models.WasteSale
+	if err := configs.DB.Select("id", "parent_bank_id").First(&sale, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Waste sale not found", nil, nil)
+	}
+	if err := helpers.ScopeBank(c, &sale.ParentBankID, nil); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	return respondSale(c, 200, sale.Id, "Data found")
+}
+
+// DeliverWasteSale - konfirmasi pengiriman dengan berat hasil timbang di offtaker. Item yang tidak
+// disebut dianggap terkirim sesuai pesanan. Stok bank induk berkurang dan tagihan terbit.
+func DeliverWasteSale(c *fiber.Ctx) error {
+	var body struct {
+		Items []struct {
+			Id                uint    `json:"id"`
+			DeliveredQuantity float64 `json:"delivered_quantity"`
+		} `json:"items"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+
+	delivered := map[uint]float64{}
+	for _, item := range body.Items {
+		if item.DeliveredQuantity < 0 || math.IsNaN(item.DeliveredQuantity) || math.IsInf(item.DeliveredQuantity, 0) {
+			return helpers.Response(c, 400, "Failed", fmt.Sprintf("Invalid delivered quantity for item %d", item.Id), nil, nil)
+		}
+		delivered[item.Id] = item.DeliveredQuantity
+	}
+
+	tx := configs.DB.Begin()
+
+	sale, err := lockSale(c, tx, models.SaleStatusOrdered)
+	if err != nil {
+		tx.Rollback()
+		return saleErrorResponse(c, err)
+	}
+
+	// Klaim status lebih dulu, pengiriman/pembatalan paralel yang kalah berhenti sebelum stok berubah
+	now := time.Now()
+	err = claimSaleStatus(tx, sale.Id, models.SaleStatusOrdered, map[string]any{
+		"status":       models.SaleStatusDelivered,
+		"delivered_at": &now,
+	})
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, errSaleStatus) {
+			return saleErrorResponse(c, err)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to deliver waste sale", nil, nil)
+	}
+
+	rounding := helpers.WasteRoundingFromEnv()
+	inventory := helpers.NewInventoryService(tx)
+	bank := helpers.InventoryBank{ParentBankID: &sale.ParentBankID}
+	invoiceAmount, costAmount := 0, 0
+
+	for _, item := range sale.Items {
+		quantity := item.Quantity
+		if q, ok := delivered[item.Id]; ok {
+			quantity = math.Round(q*1000) / 1000
+			delete(delivered, item.Id)
+		}
+
+		subTotal := rounding.Round(quantity * float64(item.UnitPrice))
+		costUnitPrice, err := helpers.AverageBuybackPrice(tx, sale.ParentBankID, item.ProductWasteID, item.Unit, now)
+		if err != nil {
+			tx.Rollback()
+			return helpers.Response(c, 500, "Failed", "Failed to calculate buy-back cost", nil, nil)
+		}
+		itemCost := int(math.Round(quantity * costUnitPrice))
+
+		if quantity > 0 {
+			_, err := inventory.Move(helpers.StockMove{
+				Bank:           bank,
+				ProductWasteID: item.ProductWasteID,
+				Type:           models.StockMovementSale,
+				Quantity:       -quantity,
+				Unit:           item.Unit,
+				Reference:      sale.ReferenceID,
+				CreatedBy:      helpers.AuthUserID(c),
+			})
+			if err != nil {
+				tx.Rollback()
+				if errors.Is(err, helpers.ErrInsufficientStock) {
+					return helpers.Response(c, 400, "Failed", fmt.Sprintf("Stock is not sufficient for item %d: %s", item.Id, err.Error()), nil, nil)
+				}
+				return helpers.Response(c, 500, "Failed", "Failed to move waste stock", nil, nil)
+			}
+		}
+
+		err = tx.Model(&models.WasteSaleItem{}).Where("id = ?", item.Id).Updates(map[string]any{
+			"delivered_quantity": quantity,
+			"sub_total":          subTotal,
+			"cost_unit_price":    math.Round(costUnitPrice*100) / 100,
+			"cost_amount":        itemCost,
+		}).Error
+		if err != nil {
+			tx.Rollback()
+			return helpers.Response(c, 500, "Failed", "Failed to update sale items", nil, nil)
+		}
+
+		invoiceAmount += subTotal
+		costAmount += itemCost
+	}
+
+	if len(delivered) > 0 {
+		tx.Rollback()
+		return helpers.Response(c, 400, "Failed", "Delivery contains items that are not part of this sale", nil, nil)
+	}
+
+	paymentStatus := models.SalePaymentUnpaid
+	if invoiceAmount == 0 {
+		paymentStatus = models.SalePaymentPaid
+	}
+
+	err = tx.Model(&models.WasteSale{}).Where("id = ?", sale.Id).Updates(map[string]any{
+		"payment_status": paymentStatus,
+		"invoice_number": fmt.Sprintf("INV/WS/%s/%d", now.Format("200601"), sale.Id),
+		"invoice_amount": invoiceAmount,
+		"cost_amount":    costAmount,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to deliver waste sale", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondSale(c, 200, sale.Id, "Waste sale delivered successfully")
+}
+
+// CancelWasteSale - order yang belum dikirim boleh dibatalkan
+func CancelWasteSale(c *fiber.Ctx) error {
+	tx := configs.DB.Begin()
+
+	sale, err := lockSale(c, tx, models.SaleStatusOrdered)
+	if err != nil {
+		tx.Rollback()
+		return saleErrorResponse(c, err)
+	}
+
+	now := time.Now()
+	err = claimSaleStatus(tx, sale.Id, models.SaleStatusOrdered, map[string]any{
+		"status":       models.SaleStatusCancelled,
+		"cancelled_at": &now,
+	})
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, errSaleStatus) {
+			return saleErrorResponse(c, err)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to cancel waste sale", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondSale(c, 200, sale.Id, "Waste sale cancelled")
+}
+
+// CreateWasteSalePayment - catat pembayaran offtaker, boleh dicicil sampai lunas.
+// Uang masuk ke rekening perusahaan dan dicatat sebagai pendapatan (companies.balance).
+func CreateWasteSalePayment(c *fiber.Ctx) error {
+	var body struct {
+		Amount int    `json:"amount"`
+		Method string `json:"method"`
+		PaidAt string `json:"paid_at"` // YYYY-MM-DD, kosong berarti hari ini
+		Note   string `json:"note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+	if body.Amount <= 0 {
+		return helpers.Response(c, 400, "Failed", "Amount must be greater than 0", nil, nil)
+	}
+
+	paidAt := time.Now()
+	if body.PaidAt != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", body.PaidAt, time.Local)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", "Invalid paid_at format, use YYYY-MM-DD", nil, nil)
+		}
+		paidAt = parsed
+	}
+
+	tx := configs.DB.Begin()
+
+	sale, err := lockSale(c, tx, models.SaleStatusDelivered)
+	if err != nil {
+		tx.Rollback()
+		return saleErrorResponse(c, err)
+	}
+
+	outstanding := sale.InvoiceAmount - sale.PaidAmount
+	if body.Amount > outstanding {
+		tx.Rollback()
+		return helpers.Response(c, 400, "Failed", fmt.Sprintf("Amount exceeds outstanding invoice of %d", outstanding), nil, nil)
+	}
+
+	// paid_amount hanya berubah jika belum disentuh pembayaran lain sejak dibaca, supaya cicilan
+	// paralel tidak melebihi tagihan
+	paidAmount := sale.PaidAmount + body.Amount
+	paymentStatus := models.SalePaymentPartial
+	if paidAmount >= sale.InvoiceAmount {
+		paymentStatus = models.SalePaymentPaid
+	}
+	result := tx.Model(&models.WasteSale{}).
+		Where("id = ? AND status = ? AND paid_amount = ?", sale.Id, models.SaleStatusDelivered, sale.PaidAmount).
+		Updates(map[string]any{
+			"paid_amount":    paidAmount,
+			"payment_status": paymentStatus,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to update payment status", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return helpers.Response(c, 409, "Failed", "Waste sale payment was updated by another request, please retry", nil, nil)
+	}
+
+	payment := models.WasteSalePayment{
+		SaleID:    sale.Id,
+		Reference: helpers.UniqueReference("WSP", time.Now(), sale.Id),
+		Amount:    body.Amount,
+		Method:    strings.TrimSpace(body.Method),
+		PaidAt:    paidAt,
+		Note:      strings.TrimSpace(body.Note),
+		CreatedBy: helpers.AuthUserID(c),
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to save payment", nil, nil)
+	}
+
+	_, err = helpers.NewLedgerService(tx).Post(
+		payment.Reference,
+		"Pembayaran penjualan sampah "+sale.InvoiceNumber,
+		helpers.Debit(models.AccountCash, 0, body.Amount),
+		helpers.Credit(models.AccountCompanyRevenue, 0, body.Amount),
+	)
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to post payment to ledger", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondSale(c, 201, sale.Id, "Payment recorded successfully")
+}
+
+var errSaleStatus = errors.New("waste sale status does not allow this action")
+
+// lockSale mengambil order dengan FOR UPDATE, cek scope bank induk dan statusnya
+func lockSale(c *fiber.Ctx, tx *gorm.DB, status string) (*models.WasteSale, error) {
+	var sale models.WasteSale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&sale, c.Params("id")).Error; err != nil {
+		return nil, err
+	}
+	if err := helpers.ScopeBank(c, &sale.ParentBankID, nil); err != nil {
+		return nil, err
+	}
+	if sale.Status != status {
+		return nil, errSaleStatus
+	}
+	return &sale, nil
+}
+
+// claimSaleStatus mengubah order hanya jika statusnya masih from, errSaleStatus jika transaksi lain
+// sudah mengubahnya lebih dulu
+func claimSaleStatus(tx *gorm.DB, id uint, from string, updates map[string]any) error {
+	result := tx.Model(&models.WasteSale{}).Where("id = ? AND status = ?", id, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSaleStatus
+	}
+	return nil
+}
+
+func saleErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return helpers.Response(c, 404, "Failed", "Waste sale not found", nil, nil)
+	case errors.Is(err, errSaleStatus):
+		return helpers.Response(c, 409, "Failed", "Waste sale status does not allow this action", nil, nil)
+	}
+	return helpers.ScopeResponse(c, err)
+}
+
+func respondSale(c *fiber.Ctx, status int, id uint, message string) error {
+	var sale models.WasteSale
+	if err := configs.DB.
+		Preload("ParentBank").
+		Preload("Offtaker", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Items").
+		Preload("Items.ProductWaste", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Payments", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		First(&sale, id).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to load waste sale", nil, nil)
+	}
+	return helpers.Response(c, status, "Success", message, sale, nil)
+}
+
+// saleBankQuery - filter parent_bank_id harus lolos scope, tanpa filter admin melihat semua dan
+// operator bank induk hanya banknya
+func saleBankQuery(c *fiber.Ctx, query *gorm.DB, parentBankID uint) (*gorm.DB, error) {
+	if parentBankID != 0 {
+		if err := helpers.ScopeBank(c, &parentBankID, nil); err != nil {
+			return nil, err
+		}
+		return query.Where("parent_bank_id = ?", parentBankID), nil
+	}
+	if helpers.HasRole(c, models.RoleAdmin) {
+		return query, nil
+	}
+	user := helpers.AuthUser(c)
+	if user == nil || user.ParentBankID == nil {
+		return nil, helpers.ErrForbidden
+	}
+	return query.Where("parent_bank_id = ?", *user.ParentBankID), nil
+}
+
+func dateRange(query *gorm.DB, column, startDate, endDate string) (*gorm.DB, error) {
+	if startDate != "" {
+		start, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return nil, errors.New("Invalid start_date format, use YYYY-MM-DD")
+		}
+		query = query.Where("DATE("+column+") >= ?", start.Format("2006-01-02"))
+	}
+	if endDate != "" {
+		end, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return nil, errors.New("Invalid end_date format, use YYYY-MM-DD")
+		}
+		query = query.Where("DATE("+column+") <= ?", end.Format("2006-01-02"))
+	}
+	return query, nil
+}
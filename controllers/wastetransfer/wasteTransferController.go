@@ -0,0 +1,487 @@
+package wastetransfer
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WasteTransferItemRequest - item yang diajukan bank unit, unit_price kosong memakai harga bank induk
+type WasteTransferItemRequest struct {
+	ProductWasteID uint    `json:"product_waste_id"`
+	Quantity       float64 `json:"quantity"`
+	Unit           string  `json:"unit"`
+	UnitPrice      *int    `json:"unit_price"`
+}
+
+// CreateWasteTransfer - bank unit mengajukan penyerahan sampah ke bank induknya
+func CreateWasteTransfer(c *fiber.Ctx) error {
+	var body struct {
+		ChildBankID *uint                      `json:"child_bank_id"`
+		Note        string                     `json:"note"`
+		Items       []WasteTransferItemRequest `json:"items"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+
+	// Tanpa child_bank_id berarti bank unit milik operator yang login
+	childBankID := body.ChildBankID
+	if childBankID == nil {
+		if user := helpers.AuthUser(c); user != nil && helpers.HasRole(c, models.RoleChildBank) {
+			childBankID = user.ChildBankID
+		}
+	}
+	if childBankID == nil {
+		return helpers.Response(c, 400, "Failed", "child_bank_id is required", nil, nil)
+	}
+	if err := helpers.ScopeBank(c, nil, childBankID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+	if len(body.Items) == 0 {
+		return helpers.Response(c, 400, "Failed", "Items cannot be empty", nil, nil)
+	}
+
+	var childBank models.ChildBank
+	if err := configs.DB.First(&childBank, *childBankID).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Child bank not found", nil, nil)
+	}
+
+	// Harga default mengikuti harga yang berlaku di bank induk penerima
+	priceScope := helpers.WastePriceScope{ParentBankID: &childBank.ParentBankID}
+	rounding := helpers.WasteRoundingFromEnv()
+	now := time.Now()
+
+	transfer := models.WasteTransfer{
+		ReferenceID:  helpers.UniqueReference("WT", now, childBank.Id),
+		ChildBankID:  childBank.Id,
+		ParentBankID: childBank.ParentBankID,
+		Status:       models.TransferStatusPending,
+		Note:         strings.TrimSpace(body.Note),
+		CreatedBy:    helpers.AuthUserID(c),
+	}
+
+	for i, itemReq := range body.Items {
+		var product models.ProductWaste
+		if err := configs.DB.First(&product, itemReq.ProductWasteID).Error; err != nil {
+			return helpers.Response(c, 404, "Failed", fmt.Sprintf("Product waste not found at index %d", i), nil, nil)
+		}
+
+		unitPrice := 0
+		if itemReq.UnitPrice != nil {
+			if *itemReq.UnitPrice < 0 {
+				return helpers.Response(c, 400, "Failed", fmt.Sprintf("Invalid unit price at index %d", i), nil, nil)
+			}
+			unitPrice = *itemReq.UnitPrice
+		} else {
+			resolved, err := helpers.ResolveWastePrice(configs.DB, product, priceScope, now)
+			if err != nil {
+				return helpers.Response(c, 500, "Failed", "Failed to resolve product waste price", nil, nil)
+			}
+			unitPrice = resolved.Price
+		}
+
+		// Jumlah disimpan dalam satuan harga produk
+		itemPrice, err := helpers.PriceWasteItem(product, unitPrice, itemReq.Quantity, itemReq.Unit, rounding)
+		if err != nil {
+			return helpers.Response(c, 400, "Failed", fmt.Sprintf("Item %d: %s", i, err.Error()), nil, nil)
+		}
+
+		transfer.Items = append(transfer.Items, models.WasteTransferItem{
+			ProductWasteID: product.Id,
+			Quantity:       itemPrice.NormalizedWeight,
+			Unit:           itemPrice.PriceUnit,
+			UnitPrice:      itemPrice.UnitPrice,
+			SubTotal:       itemPrice.SubTotal,
+		})
+		transfer.TotalPrice += itemPrice.SubTotal
+	}
+
+	// Cek stok bank unit cukup, stok baru dipindahkan saat konfirmasi
+	if err := checkTransferStock(configs.DB, childBank.Id, transfer.Items); err != nil {
+		return helpers.Response(c, 400, "Failed", err.Error(), nil, nil)
+	}
+
+	if err := configs.DB.Create(&transfer).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to create waste transfer", nil, nil)
+	}
+
+	return helpers.Response(c, 201, "Success", "Waste transfer created successfully", transfer, nil)
+}
+
+// GetWasteTransfers - daftar transfer sesuai scope: bank unit miliknya, bank induk unit di bawahnya, admin semua.
+// ?status=&child_bank_id=&parent_bank_id=&page=&limit=
+func GetWasteTransfers(c *fiber.Ctx) error {
+	var req struct {
+		Status       string `query:"status"`
+		ChildBankID  uint   `query:"child_bank_id"`
+		ParentBankID uint   `query:"parent_bank_id"`
+		Page         int    `query:"page"`
+		Limit        int    `query:"limit"`
+	}
+
+	if err := c.QueryParser(&req); err != nil {
+		return helpers.Response(c, 400, "Failed", "Failed to parse query parameters", nil, nil)
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	offset := (req.Page - 1) * req.Limit
+
+	query := configs.DB.Model(&models.WasteTransfer{})
+	if req.ChildBankID != 0 {
+		if err := helpers.ScopeBank(c, nil, &req.ChildBankID); err != nil {
+			return helpers.ScopeResponse(c, err)
+		}
+		query = query.Where("child_bank_id = ?", req.ChildBankID)
+	}
+	if req.ParentBankID != 0 {
+		if err := helpers.ScopeBank(c, &req.ParentBankID, nil); err != nil {
+			return helpers.ScopeResponse(c, err)
+		}
+		query = query.Where("parent_bank_id = ?", req.ParentBankID)
+	}
+	if req.ChildBankID == 0 && req.ParentBankID == 0 && !helpers.HasRole(c, models.RoleAdmin) {
+		user := helpers.AuthUser(c)
+		switch {
+		case helpers.HasRole(c, models.RoleChildBank) && user.ChildBankID != nil:
+			query = query.Where("child_bank_id = ?", *user.ChildBankID)
+		case helpers.HasRole(c, models.RoleParentBank) && user.ParentBankID != nil:
+			query = query.Where("parent_bank_id = ?", *user.ParentBankID)
+		default:
+			return helpers.ScopeResponse(c, helpers.ErrForbidden)
+		}
+	}
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var transfers []models.WasteTransfer
+	if err := query.
+		Preload("ChildBank").
+		Preload("ParentBank").
+		Preload("Items").
+		Preload("Items.ProductWaste").
+		Order("id DESC").Offset(offset).Limit(req.Limit).Find(&transfers).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to fetch waste transfers", nil, nil)
+	}
+
+	data := map[string]any{
+		"transfers": transfers,
+		"meta": map[string]any{
+			"page":  req.Page,
+			"limit": req.Limit,
+			"total": total,
+			"pages": (int(total) + req.Limit - 1) / req.Limit,
+		},
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", data, nil)
+}
+
+// GetWasteTransferByID - detail transfer
+func GetWasteTransferByID(c *fiber.Ctx) error {
+	var transfer models.WasteTransfer
+	if err := configs.DB.
+		Preload("ChildBank").
+		Preload("ParentBank").
+		Preload("Items").
+		Preload("Items.ProductWaste").
+		First(&transfer, c.Params("id")).Error; err != nil {
+		return helpers.Response(c, 404, "Failed", "Waste transfer not found", nil, nil)
+	}
+
+	if err := helpers.ScopeBank(c, &transfer.ParentBankID, &transfer.ChildBankID); err != nil {
+		return helpers.ScopeResponse(c, err)
+	}
+
+	return helpers.Response(c, 200, "Success", "Data found", transfer, nil)
+}
+
+// ConfirmWasteTransfer - bank induk menerima transfer. items opsional untuk menyesuaikan jumlah diterima
+// dan harga per item; item yang tidak disebut diterima sesuai pengajuan.
+func ConfirmWasteTransfer(c *fiber.Ctx) error {
+	var body struct {
+		Note  string `json:"note"`
+		Items []struct {
+			Id                uint     `json:"id"`
+			AcceptedQuantity  *float64 `json:"accepted_quantity"`
+			AcceptedUnitPrice *int     `json:"accepted_unit_price"`
+		} `json:"items"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+
+	tx := configs.DB.Begin()
+
+	transfer, err := lockPendingTransfer(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return transferErrorResponse(c, err)
+	}
+	if !helpers.HasRole(c, models.RoleAdmin, models.RoleParentBank) {
+		tx.Rollback()
+		return helpers.ScopeResponse(c, helpers.ErrForbidden)
+	}
+
+	// Klaim status lebih dulu, konfirmasi paralel yang kalah berhenti sebelum stok dan saldo berubah
+	now := time.Now()
+	if err := claimPendingTransfer(tx, transfer.Id, map[string]any{
+		"status":        models.TransferStatusConfirmed,
+		"response_note": strings.TrimSpace(body.Note),
+		"processed_by":  helpers.AuthUserID(c),
+		"processed_at":  &now,
+	}); err != nil {
+		tx.Rollback()
+		if errors.Is(err, errTransferNotPending) {
+			return transferErrorResponse(c, err)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to confirm waste transfer", nil, nil)
+	}
+
+	adjustments := map[uint]int{}
+	for i, adjustment := range body.Items {
+		adjustments[adjustment.Id] = i
+	}
+
+	rounding := helpers.WasteRoundingFromEnv()
+	inventory := helpers.NewInventoryService(tx)
+	childBank := helpers.InventoryBank{ChildBankID: &transfer.ChildBankID}
+	parentBank := helpers.InventoryBank{ParentBankID: &transfer.ParentBankID}
+	adjusted := false
+	paidAmount := 0
+
+	for _, item := range transfer.Items {
+		quantity, unitPrice := item.Quantity, item.UnitPrice
+		if i, ok := adjustments[item.Id]; ok {
+			delete(adjustments, item.Id)
+			if q := body.Items[i].AcceptedQuantity; q != nil {
+				if *q < 0 || *q > item.Quantity {
+					tx.Rollback()
+					return helpers.Response(c, 400, "Failed", fmt.Sprintf("Accepted quantity for item %d must be between 0 and %.3f", item.Id, item.Quantity), nil, nil)
+				}
+				quantity = *q
+			}
+			if p := body.Items[i].AcceptedUnitPrice; p != nil {
+				if *p < 0 {
+					tx.Rollback()
+					return helpers.Response(c, 400, "Failed", fmt.Sprintf("Invalid accepted unit price for item %d", item.Id), nil, nil)
+				}
+				unitPrice = *p
+			}
+		}
+		if quantity != item.Quantity || unitPrice != item.UnitPrice {
+			adjusted = true
+		}
+
+		subTotal := rounding.Round(quantity * float64(unitPrice))
+		paidAmount += subTotal
+
+		if quantity > 0 {
+			for _, move := range []helpers.StockMove{
+				{Bank: childBank, Type: models.StockMovementTransferOut, Quantity: -quantity},
+				{Bank: parentBank, Type: models.StockMovementTransferIn, Quantity: quantity},
+			} {
+				move.ProductWasteID = item.ProductWasteID
+				move.Unit = item.Unit
+				move.Reference = transfer.ReferenceID
+				move.CreatedBy = helpers.AuthUserID(c)
+				if _, err := inventory.Move(move); err != nil {
+					tx.Rollback()
+					if errors.Is(err, helpers.ErrInsufficientStock) {
+						return helpers.Response(c, 400, "Failed", fmt.Sprintf("Child bank stock is not sufficient for item %d: %s", item.Id, err.Error()), nil, nil)
+					}
+					return helpers.Response(c, 500, "Failed", "Failed to move waste stock", nil, nil)
+				}
+			}
+		}
+
+		err := tx.Model(&models.WasteTransferItem{}).Where("id = ?", item.Id).Updates(map[string]any{
+			"accepted_quantity":   quantity,
+			"accepted_unit_price": unitPrice,
+			"accepted_sub_total":  subTotal,
+		}).Error
+		if err != nil {
+			tx.Rollback()
+			return helpers.Response(c, 500, "Failed", "Failed to update transfer items", nil, nil)
+		}
+	}
+
+	if len(adjustments) > 0 {
+		tx.Rollback()
+		return helpers.Response(c, 400, "Failed", "Adjustment contains items that are not part of this transfer", nil, nil)
+	}
+
+	// Bank induk membayar bank unit: dicatat sebagai biaya pembelian sampah, saldo bank unit bertambah
+	_, err = helpers.NewLedgerService(tx).Post(
+		transfer.ReferenceID,
+		"Pembayaran transfer sampah ke bank unit",
+		helpers.Debit(models.AccountWastePurchase, 0, paidAmount),
+		helpers.Credit(models.AccountChildBankFloat, transfer.ChildBankID, paidAmount),
+	)
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to credit child bank balance", nil, nil)
+	}
+
+	err = tx.Model(&models.WasteTransfer{}).Where("id = ?", transfer.Id).Updates(map[string]any{
+		"adjusted":    adjusted,
+		"paid_amount": paidAmount,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return helpers.Response(c, 500, "Failed", "Failed to confirm waste transfer", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondTransfer(c, transfer.Id, "Waste transfer confirmed successfully")
+}
+
+// RejectWasteTransfer - bank induk menolak transfer, stok tetap di bank unit
+func RejectWasteTransfer(c *fiber.Ctx) error {
+	var body struct {
+		Note string `json:"note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return helpers.Response(c, 400, "Failed", "Invalid request body", nil, nil)
+	}
+	if strings.TrimSpace(body.Note) == "" {
+		return helpers.Response(c, 400, "Failed", "Rejection note is required", nil, nil)
+	}
+	if !helpers.HasRole(c, models.RoleAdmin, models.RoleParentBank) {
+		return helpers.ScopeResponse(c, helpers.ErrForbidden)
+	}
+
+	return closeTransfer(c, models.TransferStatusRejected, strings.TrimSpace(body.Note), "Waste transfer rejected")
+}
+
+// CancelWasteTransfer - bank unit membatalkan transfer yang belum diproses
+func CancelWasteTransfer(c *fiber.Ctx) error {
+	return closeTransfer(c, models.TransferStatusCancelled, "", "Waste transfer cancelled")
+}
+
+func closeTransfer(c *fiber.Ctx, status, note, message string) error {
+	tx := configs.DB.Begin()
+
+	transfer, err := lockPendingTransfer(c, tx)
+	if err != nil {
+		tx.Rollback()
+		return transferErrorResponse(c, err)
+	}
+
+	now := time.Now()
+	err = claimPendingTransfer(tx, transfer.Id, map[string]any{
+		"status":        status,
+		"response_note": note,
+		"processed_by":  helpers.AuthUserID(c),
+		"processed_at":  &now,
+	})
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, errTransferNotPending) {
+			return transferErrorResponse(c, err)
+		}
+		return helpers.Response(c, 500, "Failed", "Failed to update waste transfer", nil, nil)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Transaction failed", nil, nil)
+	}
+
+	return respondTransfer(c, transfer.Id, message)
+}
+
+var errTransferNotPending = errors.New("waste transfer is no longer pending")
+
+// lockPendingTransfer mengambil transfer dengan FOR UPDATE, cek scope dan status pending
+func lockPendingTransfer(c *fiber.Ctx, tx *gorm.DB) (*models.WasteTransfer, error) {
+	var transfer models.WasteTransfer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&transfer, c.Params("id")).Error; err != nil {
+		return nil, err
+	}
+	if err := helpers.ScopeBank(c, &transfer.ParentBankID, &transfer.ChildBankID); err != nil {
+		return nil, err
+	}
+	if transfer.Status != models.TransferStatusPending {
+		return nil, errTransferNotPending
+	}
+	return &transfer, nil
+}
+
+// claimPendingTransfer mengubah status hanya jika transfer masih pending, errTransferNotPending jika
+// transaksi lain sudah memprosesnya lebih dulu
+func claimPendingTransfer(tx *gorm.DB, id uint, updates map[string]any) error {
+	result := tx.Model(&models.WasteTransfer{}).
+		Where("id = ? AND status = ?", id, models.TransferStatusPending).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errTransferNotPending
+	}
+	return nil
+}
+
+func transferErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return helpers.Response(c, 404, "Failed", "Waste transfer not found", nil, nil)
+	case errors.Is(err, errTransferNotPending):
+		return helpers.Response(c, 409, "Failed", "Waste transfer has already been processed", nil, nil)
+	}
+	return helpers.ScopeResponse(c, err)
+}
+
+func respondTransfer(c *fiber.Ctx, id uint, message string) error {
+	var transfer models.WasteTransfer
+	if err := configs.DB.
+		Preload("ChildBank").
+		Preload("ParentBank").
+		Preload("Items").
+		Preload("Items.ProductWaste").
+		First(&transfer, id).Error; err != nil {
+		return helpers.Response(c, 500, "Failed", "Failed to load waste transfer", nil, nil)
+	}
+	return helpers.Response(c, 200, "Success", message, transfer, nil)
+}
+
+// checkTransferStock - total per produk tidak boleh melebihi stok bank unit saat pengajuan
+func checkTransferStock(db *gorm.DB, childBankID uint, items []models.WasteTransferItem) error {
+	requested := map[uint]float64{}
+	for _, item := range items {
+		requested[item.ProductWasteID] += item.Quantity
+	}
+
+	bankKey := helpers.InventoryBank{ChildBankID: &childBankID}.Key()
+	for productID, quantity := range requested {
+		var stock models.WasteStock
+		err := db.Where("bank_key = ? AND product_waste_id = ?", bankKey, productID).First(&stock).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if stock.Quantity < quantity {
+			return fmt.Errorf("stock for product waste %d is not sufficient: available %.3f, requested %.3f", productID, stock.Quantity, quantity)
+		}
+	}
+	return nil
+}
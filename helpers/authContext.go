@@ -0,0 +1,44 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Key c.Locals yang diisi middleware.RequireAuth
+const (
+	LocalAuthUser = "auth_user"
+	LocalAuthRole = "auth_role"
+)
+
+// AuthUser - User yang sedang login (nil jika route tidak melewati RequireAuth)
+func AuthUser(c *fiber.Ctx) *models.User {
+	user, _ := c.Locals(LocalAuthUser).(*models.User)
+	return user
+}
+
+// AuthUserID - Id user yang login untuk kolom created_by, nil jika tidak ada
+func AuthUserID(c *fiber.Ctx) *uint {
+	if user := AuthUser(c); user != nil {
+		return &user.Id
+	}
+	return nil
+}
+
+// AuthRole - Nama role user yang sedang login
+func AuthRole(c *fiber.Ctx) string {
+	role, _ := c.Locals(LocalAuthRole).(string)
+	return role
+}
+
+// HasRole - Cek apakah user yang login punya salah satu role
+func HasRole(c *fiber.Ctx, roles ...string) bool {
+	current := AuthRole(c)
+	for _, role := range roles {
+		if role == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrSessionRevoked      = errors.New("session revoked")
+)
+
+// Alasan pencabutan sesi
+const (
+	RevokeLogout       = "logout"
+	RevokeTokenReuse   = "refresh_token_reuse"
+	RevokeByAdmin      = "revoked_by_admin"
+	RevokeUserInactive = "user_inactive"
+	RevokeUserDeleted  = "user_deleted"
+)
+
+// TokenPair - hasil login/refresh yang dikirim ke client
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // detik sampai access token kedaluwarsa
+	SessionID    uint
+}
+
+// AccessTokenTTL - umur access token, diatur lewat ACCESS_TOKEN_TTL (format time.ParseDuration)
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL - umur refresh token, diatur lewat REFRESH_TOKEN_TTL
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// IssueSession membuat sesi baru beserta access dan refresh token untuk user yang berhasil login
+func IssueSession(db *gorm.DB, userID uint, userAgent, ipAddress string) (*TokenPair, error) {
+	var pair *TokenPair
+	err := db.Transaction(func(tx *gorm.DB) error {
+		session := models.AuthSession{
+			UserID:     userID,
+			UserAgent:  truncate(userAgent, 255),
+			IPAddress:  truncate(ipAddress, 64),
+			LastUsedAt: time.Now(),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issueTokenPair(tx, userID, session.Id)
+		return err
+	})
+	return pair, err
+}
+
+// RotateRefreshToken menukar refresh token dengan pasangan token baru. Refresh token yang sudah
+// pernah dipakai dianggap dicuri: seluruh sesi dicabut dan ErrRefreshTokenReused dikembalikan.
+func RotateRefreshToken(db *gorm.DB, rawToken string) (*TokenPair, error) {
+	if rawToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var pair *TokenPair
+	var reusedSessionID, inactiveUserID uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(rawToken)).
+			First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		var session models.AuthSession
+		if err := tx.First(&session, token.SessionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if session.RevokedAt != nil {
+			return ErrSessionRevoked
+		}
+
+		// User yang sudah dinonaktifkan/dihapus tidak boleh memperpanjang sesi
+		active, err := userActive(tx, session.UserID)
+		if err != nil {
+			return err
+		}
+		if !active {
+			inactiveUserID = session.UserID
+			return nil
+		}
+
+		now := time.Now()
+		if token.UsedAt != nil {
+			reusedSessionID = session.Id
+			return nil
+		}
+		if now.After(token.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Tandai terpakai secara kondisional agar dua request paralel tidak sama-sama lolos
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", token.Id).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reusedSessionID = session.Id
+			return nil
+		}
+
+		if err := tx.Model(&session).Update("last_used_at", now).Error; err != nil {
+			return err
+		}
+
+		pair, err = issueTokenPair(tx, session.UserID, session.Id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if inactiveUserID != 0 {
+		if _, err := RevokeUserSessions(db, inactiveUserID, RevokeUserInactive); err != nil {
+			return nil, err
+		}
+		return nil, ErrSessionRevoked
+	}
+
+	if reusedSessionID != 0 {
+		if err := RevokeSession(db, reusedSessionID, RevokeTokenReuse); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	return pair, nil
+}
+
+// RevokeSession mencabut satu sesi, access token dengan sid tersebut langsung ditolak
+func RevokeSession(db *gorm.DB, sessionID uint, reason string) error {
+	return db.Model(&models.AuthSession{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// RevokeUserSessions mencabut semua sesi aktif milik user, mengembalikan jumlah sesi yang dicabut
+func RevokeUserSessions(db *gorm.DB, userID uint, reason string) (int64, error) {
+	result := db.Model(&models.AuthSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoked_reason": reason})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteUserWithSessions menghapus (soft delete) user dan mencabut semua sesinya dalam satu transaksi,
+// sehingga user tidak pernah terhapus dengan refresh token yang masih berlaku
+func DeleteUserWithSessions(db *gorm.DB, user *models.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		_, err := RevokeUserSessions(tx, user.Id, RevokeUserDeleted)
+		return err
+	})
+}
+
+// SessionActive - cek sesi milik user masih berlaku, dipakai middleware.RequireAuth. User yang
+// dinonaktifkan atau dihapus lewat jalur mana pun langsung ditolak walaupun sesinya belum dicabut.
+func SessionActive(db *gorm.DB, sessionID, userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.AuthSession{}).
+		Joins("JOIN users ON users.id = auth_sessions.user_id AND users.deleted_at IS NULL AND users.status = ?", "active").
+		Where("auth_sessions.id = ? AND auth_sessions.user_id = ? AND auth_sessions.revoked_at IS NULL", sessionID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// userActive - user masih ada dan berstatus active
+func userActive(db *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).
+		Where("id = ? AND status = ?", userID, "active").
+		Count(&count).Error
+	return count > 0, err
+}
+
+func issueTokenPair(tx *gorm.DB, userID, sessionID uint) (*TokenPair, error) {
+	accessTTL := AccessTokenTTL()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": userID,
+		"sid": sessionID,
+		"exp": time.Now().Add(accessTTL).Unix(),
+	})
+	accessToken, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	rawRefresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	refresh := models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hashToken(rawRefresh),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+	}
+	if err := tx.Create(&refresh).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+		ExpiresIn:    int64(accessTTL.Seconds()),
+		SessionID:    sessionID,
+	}, nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(value string, limit int) string {
+	if len(value) > limit {
+		return value[:limit]
+	}
+	return value
+}
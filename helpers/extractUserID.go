@@ -10,9 +10,39 @@ import (
 
 // helpers/jwt_helper.go
 func ExtractUserID(c *fiber.Ctx) (uint, error) {
+	claims, err := extractClaims(c)
+	if err != nil {
+		return 0, err
+	}
+
+	sub := claims["sub"]
+	userID, ok := sub.(float64) // JSON numbers are float64
+	if !ok {
+		return 0, fmt.Errorf("invalid user ID in token")
+	}
+
+	return uint(userID), nil
+}
+
+// ExtractSessionID - id sesi ("sid") dari access token, 0 untuk token lama sebelum ada sesi
+func ExtractSessionID(c *fiber.Ctx) (uint, error) {
+	claims, err := extractClaims(c)
+	if err != nil {
+		return 0, err
+	}
+
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return 0, nil
+	}
+
+	return uint(sid), nil
+}
+
+func extractClaims(c *fiber.Ctx) (jwt.MapClaims, error) {
 	tokenString := c.Get("Authorization")
 	if tokenString == "" {
-		return 0, fmt.Errorf("no token provided")
+		return nil, fmt.Errorf("no token provided")
 	}
 
 	// Remove "Bearer " prefix if exists
@@ -28,19 +58,13 @@ func ExtractUserID(c *fiber.Ctx) (uint, error) {
 	})
 
 	if err != nil || !token.Valid {
-		return 0, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, fmt.Errorf("invalid token claims")
+		return nil, fmt.Errorf("invalid token claims")
 	}
 
-	sub := claims["sub"]
-	userID, ok := sub.(float64) // JSON numbers are float64
-	if !ok {
-		return 0, fmt.Errorf("invalid user ID in token")
-	}
-
-	return uint(userID), nil
+	return claims, nil
 }
\ No newline at end of file
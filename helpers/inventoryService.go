@@ -0,0 +1,177 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient waste stock")
+	ErrInventoryBank     = errors.New("inventory bank is required")
+)
+
+// InventoryBank - pemilik stok, bank unit atau bank induk
+type InventoryBank struct {
+	ParentBankID *uint
+	ChildBankID  *uint
+}
+
+// Key - "child:3" untuk bank unit, "parent:1" untuk bank induk
+func (b InventoryBank) Key() string {
+	if b.ChildBankID != nil {
+		return fmt.Sprintf("child:%d", *b.ChildBankID)
+	}
+	if b.ParentBankID != nil {
+		return fmt.Sprintf("parent:%d", *b.ParentBankID)
+	}
+	return ""
+}
+
+// StockMove - satu perubahan stok. Quantity bertanda dalam satuan Unit (kosong = satuan produk).
+type StockMove struct {
+	Bank           InventoryBank
+	ProductWasteID uint
+	Type           string
+	Quantity       float64
+	Unit           string
+	Reference      string
+	Note           string
+	CreatedBy      *uint
+}
+
+// InventoryService - satu-satunya jalur untuk mengubah stok sampah, dipakai di dalam transaksi database
+// yang sama dengan data bisnisnya (setoran, transfer, penjualan, penyesuaian).
+type InventoryService struct {
+	tx *gorm.DB
+}
+
+func NewInventoryService(tx *gorm.DB) *InventoryService {
+	return &InventoryService{tx: tx}
+}
+
+// Move mengunci baris stok, menerapkan perubahan dan mencatat pergerakannya.
+// Stok tidak boleh minus, ErrInsufficientStock jika stok yang tersedia kurang.
+func (s *InventoryService) Move(move StockMove) (*models.WasteStockMovement, error) {
+	if move.Bank.Key() == "" {
+		return nil, ErrInventoryBank
+	}
+	if move.Quantity == 0 || math.IsNaN(move.Quantity) || math.IsInf(move.Quantity, 0) {
+		return nil, fmt.Errorf("invalid stock quantity %v", move.Quantity)
+	}
+
+	stock, err := s.lockStock(move.Bank, move.ProductWasteID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stok disimpan dalam satu satuan, input dalam satuan lain dikonversi dulu
+	quantity := move.Quantity
+	if move.Unit != "" && move.Unit != stock.Unit {
+		quantity, err = ConvertWasteQuantity(move.Quantity, move.Unit, stock.Unit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	quantity = roundStock(quantity)
+	if quantity == 0 {
+		return nil, fmt.Errorf("invalid stock quantity %v %s", move.Quantity, move.Unit)
+	}
+
+	balance := roundStock(stock.Quantity + quantity)
+	if balance < 0 {
+		return nil, fmt.Errorf("%w: available %.3f %s", ErrInsufficientStock, stock.Quantity, stock.Unit)
+	}
+
+	// Update atomik di atas baris yang sudah dikunci, syarat stok cukup tetap dicek di database
+	result := s.tx.Model(&models.WasteStock{}).
+		Where("id = ? AND quantity + ? >= 0", stock.Id, quantity).
+		Update("quantity", gorm.Expr("quantity + ?", quantity))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: available %.3f %s", ErrInsufficientStock, stock.Quantity, stock.Unit)
+	}
+
+	movement := models.WasteStockMovement{
+		StockID:        stock.Id,
+		BankKey:        stock.BankKey,
+		ParentBankID:   stock.ParentBankID,
+		ChildBankID:    stock.ChildBankID,
+		ProductWasteID: move.ProductWasteID,
+		Type:           move.Type,
+		Quantity:       quantity,
+		BalanceAfter:   balance,
+		Unit:           stock.Unit,
+		Reference:      move.Reference,
+		Note:           move.Note,
+		CreatedBy:      move.CreatedBy,
+	}
+	if err := s.tx.Create(&movement).Error; err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+// lockStock mengambil baris stok dengan FOR UPDATE, membuatnya jika belum ada
+func (s *InventoryService) lockStock(bank InventoryBank, productWasteID uint) (*models.WasteStock, error) {
+	var stock models.WasteStock
+	err := s.tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("bank_key = ? AND product_waste_id = ?", bank.Key(), productWasteID).
+		First(&stock).Error
+	if err == nil {
+		return &stock, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var product models.ProductWaste
+	if err := s.tx.Unscoped().First(&product, productWasteID).Error; err != nil {
+		return nil, err
+	}
+	unit, err := NormalizeWasteUnit(product.Unit)
+	if err != nil {
+		unit = product.Unit
+	}
+
+	// Stok bank unit juga menyimpan bank induknya
+	stock = models.WasteStock{
+		BankKey:        bank.Key(),
+		ParentBankID:   bank.ParentBankID,
+		ChildBankID:    bank.ChildBankID,
+		ProductWasteID: productWasteID,
+		Unit:           unit,
+	}
+	if bank.ChildBankID != nil && bank.ParentBankID == nil {
+		var childBank models.ChildBank
+		if err := s.tx.Select("id", "parent_bank_id").First(&childBank, *bank.ChildBankID).Error; err != nil {
+			return nil, err
+		}
+		stock.ParentBankID = &childBank.ParentBankID
+	}
+	if err := s.tx.Create(&stock).Error; err != nil {
+		// Transaksi paralel lebih dulu membuat baris yang sama, pakai baris tersebut
+		if !errors.Is(err, gorm.ErrDuplicatedKey) && !strings.Contains(err.Error(), "Duplicate entry") {
+			return nil, err
+		}
+	}
+
+	// Baris dikunci ulang supaya pemanggil paralel menunggu transaksi ini
+	if err := s.tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("bank_key = ? AND product_waste_id = ?", bank.Key(), productWasteID).
+		First(&stock).Error; err != nil {
+		return nil, err
+	}
+	return &stock, nil
+}
+
+func roundStock(quantity float64) float64 {
+	return math.Round(quantity*1000) / 1000
+}
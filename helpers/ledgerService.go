@@ -0,0 +1,233 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnbalancedJournal   = errors.New("ledger journal is not balanced")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrLedgerAccount       = errors.New("ledger account not found")
+)
+
+// LedgerLeg - satu baris debit atau kredit dalam jurnal
+type LedgerLeg struct {
+	AccountType string
+	AccountID   uint
+	Debit       int
+	Credit      int
+}
+
+func Debit(accountType string, accountID uint, amount int) LedgerLeg {
+	return LedgerLeg{AccountType: accountType, AccountID: accountID, Debit: amount}
+}
+
+func Credit(accountType string, accountID uint, amount int) LedgerLeg {
+	return LedgerLeg{AccountType: accountType, AccountID: accountID, Credit: amount}
+}
+
+// Akun dengan saldo normal di sisi debit (aset dan biaya), sisanya normal di sisi kredit
+var debitNormalAccounts = map[string]bool{
+	models.AccountCash:          true,
+	models.AccountWastePurchase: true,
+}
+
+// Akun yang saldonya disimpan juga di tabel lain: table, kolom saldo, dan boleh minus atau tidak
+var materializedAccounts = map[string]struct {
+	table         string
+	column        string
+	allowNegative bool
+}{
+	models.AccountUserWallet:     {"users", "balance", false},
+	models.AccountChildBankFloat: {"child_banks", "balance", false},
+	models.AccountCompanyRevenue: {"companies", "balance", true},
+	models.AccountDonationEscrow: {"donations", "current_amount", false},
+}
+
+// LedgerService - satu-satunya jalur untuk mengubah saldo. Selalu dipakai di dalam transaksi database
+// yang sama dengan perubahan data bisnisnya.
+type LedgerService struct {
+	tx *gorm.DB
+}
+
+func NewLedgerService(tx *gorm.DB) *LedgerService {
+	return &LedgerService{tx: tx}
+}
+
+// Post mencatat jurnal dan memperbarui saldo akun yang terkait.
+// Jurnal dengan total 0 (misal setoran dengan harga 0) diabaikan dan mengembalikan nil.
+func (s *LedgerService) Post(reference, description string, legs ...LedgerLeg) (*models.LedgerJournal, error) {
+	entries, err := s.prepareEntries(legs)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	// Terapkan perubahan saldo untuk akun yang punya saldo tersimpan
+	for _, entry := range entries {
+		if err := s.applyBalance(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	journal := models.LedgerJournal{
+		Reference:   reference,
+		Description: description,
+		Entries:     entries,
+	}
+	if err := s.tx.Create(&journal).Error; err != nil {
+		return nil, fmt.Errorf("failed to save ledger journal: %w", err)
+	}
+
+	return &journal, nil
+}
+
+// PostOpening mencatat saldo awal tanpa mengubah saldo tersimpan, dipakai untuk saldo yang sudah
+// ada sebelum ledger aktif.
+func (s *LedgerService) PostOpening(accountType string, accountID uint, balance int) error {
+	var leg, opening LedgerLeg
+	if balance >= 0 {
+		leg, opening = Credit(accountType, accountID, balance), Debit(models.AccountOpeningBalance, 0, balance)
+	} else {
+		leg, opening = Debit(accountType, accountID, -balance), Credit(models.AccountOpeningBalance, 0, -balance)
+	}
+
+	entries, err := s.prepareEntries([]LedgerLeg{leg, opening})
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	journal := models.LedgerJournal{
+		Reference:   "OPENING",
+		Description: fmt.Sprintf("Saldo awal %s #%d", accountType, accountID),
+		Entries:     entries,
+	}
+	return s.tx.Create(&journal).Error
+}
+
+// Balance menghitung ulang saldo akun dari jurnal
+func (s *LedgerService) Balance(accountType string, accountID uint) (int, error) {
+	var totals struct {
+		Debit  int
+		Credit int
+	}
+	err := s.tx.Model(&models.LedgerEntry{}).
+		Select("COALESCE(SUM(debit), 0) AS debit, COALESCE(SUM(credit), 0) AS credit").
+		Where("account_type = ? AND account_id = ?", accountType, accountID).
+		Scan(&totals).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if debitNormalAccounts[accountType] {
+		return totals.Debit - totals.Credit, nil
+	}
+	return totals.Credit - totals.Debit, nil
+}
+
+// StoredBalance membaca saldo yang tersimpan di tabel asal akun (users, child_banks, dst)
+func (s *LedgerService) StoredBalance(accountType string, accountID uint) (int, bool, error) {
+	account, ok := materializedAccounts[accountType]
+	if !ok {
+		return 0, false, nil
+	}
+
+	var balances []int
+	err := s.tx.Table(account.table).
+		Where("id = ?", accountID).
+		Pluck(account.column, &balances).Error
+	if err != nil {
+		return 0, true, err
+	}
+	if len(balances) == 0 {
+		return 0, true, ErrLedgerAccount
+	}
+	return balances[0], true, nil
+}
+
+// CompanyAccountID mengambil id company, dibuat jika belum ada (sama seperti sebelumnya di callback PPOB)
+func (s *LedgerService) CompanyAccountID() (uint, error) {
+	var company models.Company
+	if err := s.tx.First(&company).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, err
+		}
+		company = models.Company{Balance: 0}
+		if err := s.tx.Create(&company).Error; err != nil {
+			return 0, err
+		}
+	}
+	return company.Id, nil
+}
+
+func (s *LedgerService) prepareEntries(legs []LedgerLeg) ([]models.LedgerEntry, error) {
+	var entries []models.LedgerEntry
+	var totalDebit, totalCredit int
+
+	for _, leg := range legs {
+		if leg.Debit < 0 || leg.Credit < 0 || (leg.Debit > 0 && leg.Credit > 0) {
+			return nil, fmt.Errorf("%w: invalid leg on %s", ErrUnbalancedJournal, leg.AccountType)
+		}
+		if leg.Debit == 0 && leg.Credit == 0 {
+			continue
+		}
+
+		if leg.AccountType == models.AccountCompanyRevenue && leg.AccountID == 0 {
+			companyID, err := s.CompanyAccountID()
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve company account: %w", err)
+			}
+			leg.AccountID = companyID
+		}
+
+		totalDebit += leg.Debit
+		totalCredit += leg.Credit
+		entries = append(entries, models.LedgerEntry{
+			AccountType: leg.AccountType,
+			AccountID:   leg.AccountID,
+			Debit:       leg.Debit,
+			Credit:      leg.Credit,
+		})
+	}
+
+	if totalDebit != totalCredit {
+		return nil, fmt.Errorf("%w: debit %d, credit %d", ErrUnbalancedJournal, totalDebit, totalCredit)
+	}
+
+	return entries, nil
+}
+
+func (s *LedgerService) applyBalance(entry models.LedgerEntry) error {
+	account, ok := materializedAccounts[entry.AccountType]
+	if !ok {
+		return nil
+	}
+
+	// Semua akun tersimpan bersaldo normal kredit
+	delta := entry.Credit - entry.Debit
+
+	query := s.tx.Table(account.table).Where("id = ?", entry.AccountID)
+	if delta < 0 && !account.allowNegative {
+		query = query.Where(account.column+" >= ?", -delta)
+	}
+
+	result := query.Update(account.column, gorm.Expr(account.column+" + ?", delta))
+	if result.Error != nil {
+		return fmt.Errorf("failed to update %s balance: %w", entry.AccountType, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		// Bedakan akun tidak ada dengan saldo tidak cukup
+		var count int64
+		s.tx.Table(account.table).Where("id = ?", entry.AccountID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("%w: %s #%d", ErrLedgerAccount, entry.AccountType, entry.AccountID)
+		}
+		return fmt.Errorf("%w: %s #%d", ErrInsufficientBalance, entry.AccountType, entry.AccountID)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"backend-mulungs/testdb"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func newLedgerTestDB(t *testing.T, balance int) (*gorm.DB, models.User) {
+	t.Helper()
+
+	db := testdb.Open(t, &models.User{}, &models.Company{}, &models.LedgerJournal{}, &models.LedgerEntry{})
+	user := models.User{Name: "Nasabah Uji", Email: "nasabah@example.com", Balance: balance, Status: "active"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return db, user
+}
+
+func countJournals(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+
+	var journals int64
+	if err := db.Model(&models.LedgerJournal{}).Count(&journals).Error; err != nil {
+		t.Fatalf("count journals: %v", err)
+	}
+	return journals
+}
+
+func TestLedgerPostBalanced(t *testing.T) {
+	db, user := newLedgerTestDB(t, 10000)
+
+	journal, err := NewLedgerService(db).Post("TRX-1", "Pembayaran PPOB",
+		Debit(models.AccountUserWallet, user.Id, 2500),
+		Credit(models.AccountPpobClearing, 0, 2500),
+	)
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if journal == nil || len(journal.Entries) != 2 {
+		t.Fatalf("journal = %+v, want 2 entries", journal)
+	}
+
+	db.First(&user, user.Id)
+	if user.Balance != 7500 {
+		t.Fatalf("balance = %d, want 7500", user.Balance)
+	}
+	if got, _ := NewLedgerService(db).Balance(models.AccountPpobClearing, 0); got != 2500 {
+		t.Fatalf("ppob clearing = %d, want 2500", got)
+	}
+}
+
+func TestLedgerPostUnbalancedLegs(t *testing.T) {
+	cases := []struct {
+		name string
+		legs []LedgerLeg
+	}{
+		{"debit greater than credit", []LedgerLeg{
+			Debit(models.AccountUserWallet, 1, 100),
+			Credit(models.AccountPpobClearing, 0, 90),
+		}},
+		{"negative amount", []LedgerLeg{
+			Debit(models.AccountUserWallet, 1, -100),
+			Credit(models.AccountPpobClearing, 0, -100),
+		}},
+		{"debit and credit on one leg", []LedgerLeg{
+			{AccountType: models.AccountUserWallet, AccountID: 1, Debit: 100, Credit: 100},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, user := newLedgerTestDB(t, 10000)
+
+			journal, err := NewLedgerService(db).Post("TRX-1", "Jurnal tidak seimbang", tc.legs...)
+			if !errors.Is(err, ErrUnbalancedJournal) {
+				t.Fatalf("Post = %v, want ErrUnbalancedJournal", err)
+			}
+			if journal != nil {
+				t.Fatalf("journal = %+v, want nil", journal)
+			}
+			if got := countJournals(t, db); got != 0 {
+				t.Fatalf("ledger journals = %d, want 0", got)
+			}
+			db.First(&user, user.Id)
+			if user.Balance != 10000 {
+				t.Fatalf("balance = %d, want 10000", user.Balance)
+			}
+		})
+	}
+}
+
+func TestLedgerPostInsufficientBalance(t *testing.T) {
+	db, user := newLedgerTestDB(t, 1000)
+
+	journal, err := NewLedgerService(db).Post("TRX-1", "Pembayaran PPOB",
+		Debit(models.AccountUserWallet, user.Id, 2500),
+		Credit(models.AccountPpobClearing, 0, 2500),
+	)
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("Post = %v, want ErrInsufficientBalance", err)
+	}
+	if journal != nil {
+		t.Fatalf("journal = %+v, want nil", journal)
+	}
+
+	db.First(&user, user.Id)
+	if user.Balance != 1000 {
+		t.Fatalf("balance = %d, want 1000", user.Balance)
+	}
+	if got := countJournals(t, db); got != 0 {
+		t.Fatalf("ledger journals = %d, want 0", got)
+	}
+
+	// Akun yang tidak ada dibedakan dari saldo yang tidak cukup
+	_, err = NewLedgerService(db).Post("TRX-2", "Pembayaran PPOB",
+		Debit(models.AccountUserWallet, user.Id+1, 500),
+		Credit(models.AccountPpobClearing, 0, 500),
+	)
+	if !errors.Is(err, ErrLedgerAccount) {
+		t.Fatalf("Post for missing user = %v, want ErrLedgerAccount", err)
+	}
+}
+
+func TestLedgerPostZeroAmount(t *testing.T) {
+	db, user := newLedgerTestDB(t, 1000)
+
+	// Misal setoran sampah dengan harga 0
+	journal, err := NewLedgerService(db).Post("WD-1", "Setoran sampah",
+		Debit(models.AccountWastePurchase, 0, 0),
+		Credit(models.AccountUserWallet, user.Id, 0),
+	)
+	if err != nil || journal != nil {
+		t.Fatalf("Post = %+v, %v, want nil journal and nil error", journal, err)
+	}
+	if got := countJournals(t, db); got != 0 {
+		t.Fatalf("ledger journals = %d, want 0", got)
+	}
+	db.First(&user, user.Id)
+	if user.Balance != 1000 {
+		t.Fatalf("balance = %d, want 1000", user.Balance)
+	}
+}
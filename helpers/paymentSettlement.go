@@ -0,0 +1,108 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPaymentAlreadySettled = errors.New("payment already settled")
+	ErrPaymentAmountMismatch = errors.New("paid amount does not match payment")
+)
+
+// PaymentOutcome - status akhir pembayaran dari webhook gateway atau worker kedaluwarsa
+type PaymentOutcome struct {
+	Status string // models.PaymentStatusPaid, PaymentStatusExpired atau PaymentStatusFailed
+	Amount int    // nominal yang dibayar, wajib sama dengan Payment.Amount untuk status paid
+	PaidAt *time.Time
+	Reason string
+}
+
+// SettlePayment menyelesaikan pembayaran top up tepat satu kali. Lunas mengonfirmasi Transaction dan
+// menambah saldo user lewat ledger; kedaluwarsa/gagal menutup Transaction tanpa mengubah saldo.
+// Pembayaran yang sudah kedaluwarsa tetap diterima jika gateway kemudian menyatakan lunas, karena
+// uangnya sudah masuk. Mengembalikan ErrPaymentAlreadySettled jika tidak ada yang berubah.
+func SettlePayment(tx *gorm.DB, orderID string, outcome PaymentOutcome) (*models.Payment, error) {
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", orderID).First(&payment).Error; err != nil {
+		return nil, err
+	}
+
+	var fromStatuses []string
+	transactionStatus := ""
+	switch outcome.Status {
+	case models.PaymentStatusPaid:
+		if outcome.Amount != payment.Amount {
+			return &payment, fmt.Errorf("%w: paid %d, expected %d", ErrPaymentAmountMismatch, outcome.Amount, payment.Amount)
+		}
+		fromStatuses = []string{models.PaymentStatusPending, models.PaymentStatusExpired}
+		transactionStatus = "confirm"
+	case models.PaymentStatusExpired:
+		fromStatuses = []string{models.PaymentStatusPending}
+		transactionStatus = "expired"
+	case models.PaymentStatusFailed:
+		fromStatuses = []string{models.PaymentStatusPending}
+		transactionStatus = "reject"
+	default:
+		return nil, fmt.Errorf("unknown payment status %q", outcome.Status)
+	}
+
+	updates := map[string]any{"status": outcome.Status}
+	if outcome.Status == models.PaymentStatusPaid {
+		paidAt := time.Now()
+		if outcome.PaidAt != nil {
+			paidAt = *outcome.PaidAt
+		}
+		updates["paid_at"] = paidAt
+		payment.PaidAt = &paidAt
+	} else if outcome.Reason != "" {
+		updates["failure_reason"] = outcome.Reason
+		payment.FailureReason = outcome.Reason
+	}
+
+	// Update kondisional: webhook ulang dan worker paralel hanya satu yang lolos
+	result := tx.Model(&models.Payment{}).
+		Where("id = ? AND status IN ?", payment.Id, fromStatuses).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &payment, ErrPaymentAlreadySettled
+	}
+
+	// Transaction kedaluwarsa dibuka lagi hanya jika pembayarannya ternyata lunas
+	transactionFrom := []string{"pending"}
+	if outcome.Status == models.PaymentStatusPaid {
+		transactionFrom = append(transactionFrom, "expired")
+	}
+	result = tx.Model(&models.Transaction{}).
+		Where("id = ? AND status IN ?", payment.TransactionID, transactionFrom).
+		Update("status", transactionStatus)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &payment, ErrPaymentAlreadySettled
+	}
+
+	if outcome.Status == models.PaymentStatusPaid {
+		_, err := NewLedgerService(tx).Post(
+			fmt.Sprintf("TRX-%d", payment.TransactionID),
+			fmt.Sprintf("Topup saldo via %s %s", payment.Gateway, payment.Method),
+			Debit(models.AccountCash, 0, payment.Amount),
+			Credit(models.AccountUserWallet, payment.UserID, payment.Amount),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payment.Status = outcome.Status
+	return &payment, nil
+}
@@ -0,0 +1,104 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PpobCatalogSynced - katalog lokal sudah pernah berhasil disinkronkan dan bisa dipakai
+func PpobCatalogSynced(db *gorm.DB, kind string) bool {
+	var count int64
+	db.Model(&models.PpobCatalogSync{}).
+		Where("kind = ? AND status = ?", kind, models.CatalogSyncSuccess).
+		Count(&count)
+	return count > 0
+}
+
+// PrepaidCatalog - produk prabayar aktif dari katalog lokal, filter sama dengan pricelist provider
+func PrepaidCatalog(db *gorm.DB, productType, operator string) ([]models.ProductPrepaid, error) {
+	query := db.Model(&models.PpobProduct{}).
+		Where("kind = ? AND status = ?", models.PpobKindPrepaid, models.PpobProductActive)
+	if productType != "" {
+		query = query.Where("product_type = ?", strings.ToLower(productType))
+	}
+	if operator != "" {
+		operator = strings.ToLower(operator)
+		query = query.Where("(operator = ? OR product_category = ?)", PpobOperatorKey(operator), operator)
+	}
+
+	var products []models.PpobProduct
+	if err := query.Order("product_description, price").Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	pricelist := make([]models.ProductPrepaid, 0, len(products))
+	for _, product := range products {
+		pricelist = append(pricelist, PrepaidFromCatalog(product))
+	}
+	return pricelist, nil
+}
+
+// PostpaidCatalog - produk pascabayar aktif dalam format pricelist-pasca provider
+func PostpaidCatalog(db *gorm.DB, productType, province string) ([]map[string]any, error) {
+	query := db.Model(&models.PpobProduct{}).
+		Where("kind = ? AND status = ?", models.PpobKindPostpaid, models.PpobProductActive)
+	if productType != "" {
+		query = query.Where("product_type = ?", strings.ToLower(productType))
+	}
+	if province != "" {
+		query = query.Where("(province = '' OR province = ?)", province)
+	}
+
+	var products []models.PpobProduct
+	if err := query.Order("product_type, product_description").Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	pasca := make([]map[string]any, 0, len(products))
+	for _, product := range products {
+		item := map[string]any{
+			"code":   product.ProductCode,
+			"name":   product.ProductDescription,
+			"type":   product.ProductType,
+			"status": 1,
+			"fee":    product.Price,
+			"komisi": product.Commission,
+		}
+		if product.Province != "" {
+			item["province"] = product.Province
+		}
+		pasca = append(pasca, item)
+	}
+	return pasca, nil
+}
+
+// FindPpobProduct mencari produk di katalog, nil jika tidak ada
+func FindPpobProduct(db *gorm.DB, kind, productCode string) (*models.PpobProduct, error) {
+	var product models.PpobProduct
+	err := db.Where("kind = ? AND product_code = ?", kind, productCode).First(&product).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// PrepaidFromCatalog mengubah produk katalog ke format pricelist provider
+func PrepaidFromCatalog(product models.PpobProduct) models.ProductPrepaid {
+	return models.ProductPrepaid{
+		ProductCode:        product.ProductCode,
+		ProductDescription: product.ProductDescription,
+		ProductNominal:     product.ProductNominal,
+		ProductDetails:     product.ProductDetails,
+		ProductPrice:       product.Price,
+		ProductType:        product.ProductType,
+		ActivePeriod:       product.ActivePeriod,
+		Status:             product.Status,
+		IconURL:            product.IconURL,
+		ProductCategory:    product.ProductCategory,
+	}
+}
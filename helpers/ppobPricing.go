@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PpobProductRef - identitas produk PPOB untuk mencari aturan margin
+type PpobProductRef struct {
+	Category    string // jenis produk: pulsa, data, pln, etoll, bpjs, pdam, ...
+	Operator    string // operator/brand, dinormalisasi dengan PpobOperatorKey
+	ProductCode string
+}
+
+// PpobMarginRules - aturan margin aktif yang sudah dimuat, dipakai berulang untuk satu pricelist
+type PpobMarginRules struct {
+	rules         []models.PpobMarginRule
+	legacyPercent float64 // fallback models.Ppob.Margin jika tidak ada aturan yang cocok
+}
+
+var operatorKeyPattern = regexp.MustCompile(`[()\s]+`)
+
+// PpobOperatorKey - "Mobile Legend (Diamond)" → "mobile_legend_diamond"
+func PpobOperatorKey(description string) string {
+	operator := operatorKeyPattern.ReplaceAllString(description, "_")
+	operator = strings.Trim(operator, "_")
+	operator = strings.ReplaceAll(operator, "__", "_")
+	return strings.ToLower(operator)
+}
+
+// LoadPpobMarginRules memuat aturan margin yang berlaku pada waktu at
+func LoadPpobMarginRules(db *gorm.DB, at time.Time) (*PpobMarginRules, error) {
+	var rules []models.PpobMarginRule
+	err := db.
+		Where("is_active = ?", true).
+		Where("effective_from IS NULL OR effective_from <= ?", at).
+		Where("effective_until IS NULL OR effective_until > ?", at).
+		Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PpobMarginRules{rules: rules}
+
+	var legacy models.Ppob
+	if err := db.First(&legacy).Error; err == nil {
+		result.legacyPercent = float64(legacy.Margin)
+	}
+
+	return result, nil
+}
+
+// Resolve mencari aturan paling spesifik untuk produk, nil jika tidak ada
+func (r *PpobMarginRules) Resolve(ref PpobProductRef) *models.PpobMarginRule {
+	var best *models.PpobMarginRule
+	bestScore := -1
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+		score, ok := marginRuleScore(rule, ref)
+		if !ok {
+			continue
+		}
+		// Skor sama: aturan dengan tanggal berlaku terbaru, lalu id terbaru
+		if score > bestScore || (score == bestScore && newerRule(rule, best)) {
+			best = rule
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+// Margin menghitung margin rupiah untuk harga provider basePrice
+func (r *PpobMarginRules) Margin(ref PpobProductRef, basePrice float64) float64 {
+	rule := r.Resolve(ref)
+	if rule == nil {
+		return basePrice * r.legacyPercent / 100
+	}
+	return MarginFromRule(rule, basePrice)
+}
+
+// SellingPrice - harga jual ke user (harga provider + margin), dibulatkan ke rupiah
+func (r *PpobMarginRules) SellingPrice(ref PpobProductRef, basePrice float64) float64 {
+	return RoundToNearest(basePrice + r.Margin(ref, basePrice))
+}
+
+// MarginFromRule menghitung margin dari satu aturan, termasuk batas min/max
+func MarginFromRule(rule *models.PpobMarginRule, basePrice float64) float64 {
+	margin := rule.Value
+	if rule.Type != models.MarginTypeFlat {
+		margin = basePrice * rule.Value / 100
+	}
+
+	if rule.MinMargin != nil {
+		margin = math.Max(margin, float64(*rule.MinMargin))
+	}
+	if rule.MaxMargin != nil {
+		margin = math.Min(margin, float64(*rule.MaxMargin))
+	}
+	return margin
+}
+
+func marginRuleScore(rule *models.PpobMarginRule, ref PpobProductRef) (int, bool) {
+	score := 0
+
+	if rule.ProductCode != "" {
+		if !strings.EqualFold(rule.ProductCode, ref.ProductCode) {
+			return 0, false
+		}
+		score += 4
+	}
+	if rule.Operator != "" {
+		if PpobOperatorKey(rule.Operator) != PpobOperatorKey(ref.Operator) {
+			return 0, false
+		}
+		score += 2
+	}
+	if rule.Category != "" {
+		// "bpjs" juga berlaku untuk jenis turunannya seperti "bpjs_health"
+		category := strings.ToLower(ref.Category)
+		ruleCategory := strings.ToLower(rule.Category)
+		if category != ruleCategory && !strings.HasPrefix(category, ruleCategory+"_") {
+			return 0, false
+		}
+		score += 1
+	}
+
+	return score, true
+}
+
+func newerRule(rule, current *models.PpobMarginRule) bool {
+	if current == nil {
+		return true
+	}
+	ruleFrom, currentFrom := time.Time{}, time.Time{}
+	if rule.EffectiveFrom != nil {
+		ruleFrom = *rule.EffectiveFrom
+	}
+	if current.EffectiveFrom != nil {
+		currentFrom = *current.EffectiveFrom
+	}
+	if !ruleFrom.Equal(currentFrom) {
+		return ruleFrom.After(currentFrom)
+	}
+	return rule.Id > current.Id
+}
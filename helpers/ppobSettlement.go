@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrPpobAlreadySettled = errors.New("ppob transaction already settled")
+
+// PrepaidOutcome - hasil akhir transaksi PPOB dari provider (callback, cek status, atau pembayaran
+// tagihan pascabayar)
+type PrepaidOutcome struct {
+	Success     bool
+	Price       int // harga dari provider, dipakai untuk hitung margin jika sukses
+	SN          string
+	ProductCode string
+	Message     string
+}
+
+// SettlePrepaid menyelesaikan transaksi PPOB (prabayar maupun pascabayar) yang masih PROSES tepat satu
+// kali: sukses melepas dana clearing ke provider dan margin ke company, gagal mengembalikan saldo user.
+// Mengembalikan ErrPpobAlreadySettled jika status sudah bukan PROSES.
+func SettlePrepaid(tx *gorm.DB, refID string, outcome PrepaidOutcome) (*models.HistoryModel, error) {
+	var history models.HistoryModel
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ref_id = ?", refID).First(&history).Error; err != nil {
+		return nil, err
+	}
+	if history.Status != models.HistoryStatusPending {
+		return &history, ErrPpobAlreadySettled
+	}
+
+	userPaidPrice, err := strconv.Atoi(history.TotalPrice)
+	if err != nil {
+		return nil, fmt.Errorf("invalid total price format in history: %s", history.TotalPrice)
+	}
+
+	status := models.HistoryStatusFailed
+	if outcome.Success {
+		status = models.HistoryStatusSuccess
+	}
+
+	updateData := map[string]any{
+		"status":  status,
+		"message": outcome.Message,
+	}
+
+	// PLN memiliki stroom_token, non-PLN kosong
+	if strings.Contains(strings.ToLower(outcome.ProductCode), "pln") {
+		parts := strings.Split(outcome.SN, "/")
+		if len(parts) > 0 {
+			updateData["stroom_token"] = strings.TrimSpace(parts[0])
+		}
+	} else {
+		updateData["stroom_token"] = ""
+	}
+
+	// Update kondisional: callback/reconciler paralel hanya satu yang lolos
+	result := tx.Model(&models.HistoryModel{}).
+		Where("id = ? AND status = ?", history.Id, models.HistoryStatusPending).
+		Updates(updateData)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &history, ErrPpobAlreadySettled
+	}
+
+	kind := "prabayar"
+	if history.Kind == models.PpobKindPostpaid {
+		kind = "pascabayar"
+	}
+
+	ledger := NewLedgerService(tx)
+	if outcome.Success {
+		// Lepas dana clearing: harga provider dibayar ke IAK, selisihnya jadi pendapatan company
+		marginAmount := userPaidPrice - outcome.Price
+		legs := []LedgerLeg{
+			Debit(models.AccountPpobClearing, 0, userPaidPrice),
+			Credit(models.AccountCash, 0, outcome.Price),
+		}
+		if marginAmount >= 0 {
+			legs = append(legs, Credit(models.AccountCompanyRevenue, 0, marginAmount))
+		} else {
+			// Margin negatif ditanggung company
+			legs = append(legs, Debit(models.AccountCompanyRevenue, 0, -marginAmount))
+		}
+		if _, err := ledger.Post(history.RefID, "Transaksi PPOB "+kind+" sukses", legs...); err != nil {
+			return nil, err
+		}
+	} else {
+		_, err := ledger.Post(
+			history.RefID,
+			"Transaksi PPOB "+kind+" gagal, saldo dikembalikan",
+			Debit(models.AccountPpobClearing, 0, userPaidPrice),
+			Credit(models.AccountUserWallet, history.UserID, userPaidPrice),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	history.Status = status
+	history.Message = outcome.Message
+	return &history, nil
+}
@@ -0,0 +1,17 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UniqueReference - kode referensi prefix + waktu (sampai detik) + id bank/dokumen, ditambah 6 karakter
+// acak supaya dua request di detik yang sama untuk id yang sama tidak bertabrakan. Contoh WT2025010208300512A9F03C.
+func UniqueReference(prefix string, at time.Time, id uint) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s%s%d%s", prefix, at.Format("20060102150405"), id, strings.ToUpper(hex.EncodeToString(suffix)))
+}
@@ -0,0 +1,115 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRegionNotFound = errors.New("region not found")
+	ErrRegionMismatch = errors.New("region codes do not belong to the same hierarchy")
+)
+
+// RegionNames - nama wilayah sesuai dataset, dipakai untuk mengisi kolom teks lama
+type RegionNames struct {
+	Province    string `json:"province"`
+	District    string `json:"district"`
+	Subdistrict string `json:"subdistrict"`
+	Village     string `json:"village"`
+}
+
+// NormalizeRegionCode - kode wilayah tanpa titik dan spasi, "32.04.12" menjadi "320412"
+func NormalizeRegionCode(code string) string {
+	return strings.NewReplacer(".", "", " ", "").Replace(strings.TrimSpace(code))
+}
+
+// RegionPath - wilayah beserta induknya, urut dari provinsi sampai wilayah itu sendiri
+func RegionPath(db *gorm.DB, code string) ([]models.Region, error) {
+	var path []models.Region
+	next := NormalizeRegionCode(code)
+	// Maksimal empat tingkat, batas ini juga mencegah loop jika parent_code rusak
+	for i := 0; i < 4 && next != ""; i++ {
+		var region models.Region
+		if err := db.Where("code = ?", next).First(&region).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrRegionNotFound, next)
+			}
+			return nil, err
+		}
+		path = append([]models.Region{region}, path...)
+		next = ""
+		if region.ParentCode != nil {
+			next = *region.ParentCode
+		}
+	}
+	return path, nil
+}
+
+// ResolveRegionCodes melengkapi kode wilayah dari kode paling dalam yang dikirim. Kode tingkat di atasnya
+// boleh dikosongkan; jika dikirim harus sesuai induknya. Hasil kosong jika tidak ada kode sama sekali.
+func ResolveRegionCodes(db *gorm.DB, input models.RegionCodes) (models.RegionCodes, RegionNames, error) {
+	given := map[string]string{}
+	deepest := ""
+	for _, field := range []struct {
+		level string
+		code  *string
+	}{
+		{models.RegionLevelProvince, input.ProvinceCode},
+		{models.RegionLevelDistrict, input.DistrictCode},
+		{models.RegionLevelSubdistrict, input.SubdistrictCode},
+		{models.RegionLevelVillage, input.VillageCode},
+	} {
+		if field.code == nil || NormalizeRegionCode(*field.code) == "" {
+			continue
+		}
+		given[field.level] = NormalizeRegionCode(*field.code)
+		deepest = given[field.level]
+	}
+
+	var codes models.RegionCodes
+	var names RegionNames
+	if deepest == "" {
+		return codes, names, nil
+	}
+
+	path, err := RegionPath(db, deepest)
+	if err != nil {
+		return codes, names, err
+	}
+	for _, region := range path {
+		if code, ok := given[region.Level]; ok && code != region.Code {
+			return codes, names, fmt.Errorf("%w: %s is not within %s", ErrRegionMismatch, deepest, code)
+		}
+		delete(given, region.Level)
+
+		code := region.Code
+		switch region.Level {
+		case models.RegionLevelProvince:
+			codes.ProvinceCode, names.Province = &code, region.Name
+		case models.RegionLevelDistrict:
+			codes.DistrictCode, names.District = &code, region.Name
+		case models.RegionLevelSubdistrict:
+			codes.SubdistrictCode, names.Subdistrict = &code, region.Name
+		case models.RegionLevelVillage:
+			codes.VillageCode, names.Village = &code, region.Name
+		}
+	}
+	// Kode yang dikirim untuk tingkat lebih dalam dari wilayah yang ditemukan, misal district_code berisi kode provinsi
+	for level, code := range given {
+		return codes, names, fmt.Errorf("%w: %s is not a %s code", ErrRegionMismatch, code, level)
+	}
+	return codes, names, nil
+}
+
+// RegionFullName - "Cibinong, Kabupaten Bogor, Jawa Barat" dari wilayah terdalam ke provinsi
+func RegionFullName(path []models.Region) string {
+	names := make([]string, 0, len(path))
+	for i := len(path) - 1; i >= 0; i-- {
+		names = append(names, path[i].Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,345 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidRegionDataset = errors.New("invalid region dataset")
+
+// RegionImportOptions - pengaturan import dataset wilayah
+type RegionImportOptions struct {
+	// Nonaktifkan wilayah yang tidak ada di file (pemekaran/penggabungan). Hanya untuk file lengkap,
+	// file satu provinsi akan menonaktifkan provinsi lain.
+	DeactivateMissing bool
+	BatchSize         int
+}
+
+// RegionImportResult - ringkasan import
+type RegionImportResult struct {
+	Rows        int            `json:"rows"`
+	Levels      map[string]int `json:"levels"`
+	Deactivated int64          `json:"deactivated"`
+	ImportedAt  time.Time      `json:"imported_at"`
+}
+
+var regionCodePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// ImportRegions membaca CSV "code,name[,latitude,longitude]" dari dataset BPS/Kemendagri dan menyimpannya
+// ke tabel regions. Header boleh ada. Kode bertitik (32.04.12.2001) memakai jumlah bagian untuk tingkat
+// wilayah, kode tanpa titik memakai panjangnya: 2 provinsi, 4 kabupaten/kota, 6-7 kecamatan,
+// 10 kelurahan/desa. Import bisa diulang untuk memperbarui nama dan koordinat; semua baris disimpan
+// dalam satu transaksi.
+func ImportRegions(db *gorm.DB, r io.Reader, opts RegionImportOptions) (RegionImportResult, error) {
+	result := RegionImportResult{Levels: map[string]int{}}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	// Kode desa 10 digit tanpa titik bisa berinduk kecamatan BPS (7 digit) atau Kemendagri (6 digit),
+	// induknya baru bisa ditentukan setelah semua kecamatan terbaca
+	type pendingRegion struct {
+		line   int
+		region models.Region
+	}
+	var rows []pendingRegion
+	known := map[string]string{} // kode -> tingkat
+
+	importedAt := time.Now().Truncate(time.Second)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("%w: line %d: %s", ErrInvalidRegionDataset, line, err.Error())
+		}
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+
+		rawCode := strings.TrimSpace(strings.TrimPrefix(record[0], "\ufeff"))
+		if !regionCodePattern.MatchString(rawCode) {
+			if line == 1 {
+				continue // header
+			}
+			return result, fmt.Errorf("%w: line %d: invalid code %q", ErrInvalidRegionDataset, line, rawCode)
+		}
+		if len(record) < 2 || strings.TrimSpace(record[1]) == "" {
+			return result, fmt.Errorf("%w: line %d: name is required", ErrInvalidRegionDataset, line)
+		}
+
+		region := models.Region{
+			Code:      NormalizeRegionCode(rawCode),
+			Name:      strings.Join(strings.Fields(record[1]), " "),
+			IsActive:  true,
+			UpdatedAt: importedAt,
+		}
+		if region.Level, region.ParentCode, err = regionLevel(rawCode); err != nil {
+			return result, fmt.Errorf("%w: line %d: %s", ErrInvalidRegionDataset, line, err.Error())
+		}
+		if len(record) >= 4 && strings.TrimSpace(record[2]) != "" && strings.TrimSpace(record[3]) != "" {
+			latitude, latErr := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+			longitude, lngErr := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+			if latErr != nil || lngErr != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+				return result, fmt.Errorf("%w: line %d: invalid latitude/longitude", ErrInvalidRegionDataset, line)
+			}
+			region.Latitude, region.Longitude = &latitude, &longitude
+		}
+		if _, exists := known[region.Code]; exists {
+			return result, fmt.Errorf("%w: line %d: duplicate code %s", ErrInvalidRegionDataset, line, region.Code)
+		}
+		known[region.Code] = region.Level
+		rows = append(rows, pendingRegion{line: line, region: region})
+	}
+	if len(rows) == 0 {
+		return result, fmt.Errorf("%w: file has no regions", ErrInvalidRegionDataset)
+	}
+
+	// Induk boleh berasal dari import sebelumnya, misal file kelurahan satu provinsi
+	var existing []models.Region
+	if err := db.Select("code", "level").Where("level <> ?", models.RegionLevelVillage).Find(&existing).Error; err != nil {
+		return result, err
+	}
+	for _, region := range existing {
+		if _, ok := known[region.Code]; !ok {
+			known[region.Code] = region.Level
+		}
+	}
+
+	regions := make([]models.Region, 0, len(rows))
+	for _, row := range rows {
+		region := row.region
+		if region.Level == models.RegionLevelVillage && region.ParentCode == nil {
+			for _, size := range []int{7, 6} {
+				if known[region.Code[:size]] == models.RegionLevelSubdistrict {
+					parent := region.Code[:size]
+					region.ParentCode = &parent
+					break
+				}
+			}
+		}
+		if region.Level != models.RegionLevelProvince {
+			if region.ParentCode == nil || known[*region.ParentCode] == "" {
+				return result, fmt.Errorf("%w: line %d: parent region of %s not found", ErrInvalidRegionDataset, row.line, region.Code)
+			}
+		}
+		regions = append(regions, region)
+		result.Levels[region.Level]++
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "code"}},
+			DoUpdates: clause.AssignmentColumns([]string{"parent_code", "level", "name", "latitude", "longitude", "is_active", "updated_at"}),
+		}).CreateInBatches(&regions, opts.BatchSize).Error
+		if err != nil {
+			return err
+		}
+
+		if opts.DeactivateMissing {
+			deactivate := tx.Model(&models.Region{}).
+				Where("updated_at < ? AND is_active = ?", importedAt, true).
+				Update("is_active", false)
+			if deactivate.Error != nil {
+				return deactivate.Error
+			}
+			result.Deactivated = deactivate.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Rows = len(regions)
+	result.ImportedAt = importedAt
+	return result, nil
+}
+
+// regionLevel - tingkat dan induk dari kode. Induk desa dengan kode tanpa titik dikosongkan untuk
+// ditentukan setelah semua kecamatan terbaca.
+func regionLevel(rawCode string) (string, *string, error) {
+	levels := []string{models.RegionLevelProvince, models.RegionLevelDistrict, models.RegionLevelSubdistrict, models.RegionLevelVillage}
+
+	if strings.Contains(rawCode, ".") {
+		parts := strings.Split(rawCode, ".")
+		if len(parts) > len(levels) {
+			return "", nil, fmt.Errorf("invalid code %s", rawCode)
+		}
+		if len(parts) == 1 {
+			return levels[0], nil, nil
+		}
+		parent := strings.Join(parts[:len(parts)-1], "")
+		return levels[len(parts)-1], &parent, nil
+	}
+
+	code := rawCode
+	parentOf := func(size int) *string {
+		parent := code[:size]
+		return &parent
+	}
+	switch len(code) {
+	case 2:
+		return models.RegionLevelProvince, nil, nil
+	case 4:
+		return models.RegionLevelDistrict, parentOf(2), nil
+	case 6, 7:
+		return models.RegionLevelSubdistrict, parentOf(4), nil
+	case 10:
+		return models.RegionLevelVillage, nil, nil
+	}
+	return "", nil, fmt.Errorf("invalid code length %s", rawCode)
+}
+
+// RegionLinkResult - jumlah data lama yang berhasil ditautkan ke kode wilayah
+type RegionLinkResult struct {
+	ParentBanks int `json:"parent_banks"`
+	ChildBanks  int `json:"child_banks"`
+	Users       int `json:"users"`
+}
+
+// LinkRegionNames mengisi kode wilayah bank dan user lama dari kolom teks province/district/subdistrict.
+// Nama dicocokkan tanpa membedakan huruf besar; jika tidak ada yang persis sama, awalan "Kabupaten"/
+// "Kota" diabaikan asalkan hasilnya hanya satu wilayah. Data yang tidak cocok dibiarkan untuk diisi manual.
+func LinkRegionNames(db *gorm.DB) (RegionLinkResult, error) {
+	var result RegionLinkResult
+
+	var regions []models.Region
+	if err := db.Where("level <> ? AND is_active = ?", models.RegionLevelVillage, true).Find(&regions).Error; err != nil {
+		return result, err
+	}
+	index := newRegionNameIndex(regions)
+
+	var parentBanks []models.ParentBank
+	if err := db.Where("province_code IS NULL").Find(&parentBanks).Error; err != nil {
+		return result, err
+	}
+	for _, bank := range parentBanks {
+		codes := index.match(bank.Province, bank.District, "")
+		if codes.ProvinceCode == nil {
+			continue
+		}
+		if err := db.Model(&bank).Select("province_code", "district_code").Updates(&models.ParentBank{RegionCodes: codes}).Error; err != nil {
+			return result, err
+		}
+		result.ParentBanks++
+	}
+
+	// Bank unit hanya menyimpan kecamatan, kabupaten/kota diambil dari bank induknya
+	var childBanks []models.ChildBank
+	if err := db.Preload("ParentBank").Where("subdistrict_code IS NULL").Find(&childBanks).Error; err != nil {
+		return result, err
+	}
+	for _, bank := range childBanks {
+		codes := index.match(bank.ParentBank.Province, bank.ParentBank.District, bank.Subdistrict)
+		if codes.SubdistrictCode == nil {
+			continue
+		}
+		if err := db.Model(&bank).Select("province_code", "district_code", "subdistrict_code").Updates(&models.ChildBank{RegionCodes: codes}).Error; err != nil {
+			return result, err
+		}
+		result.ChildBanks++
+	}
+
+	var users []models.User
+	if err := db.Where("province_code IS NULL AND province <> ''").Find(&users).Error; err != nil {
+		return result, err
+	}
+	for _, user := range users {
+		codes := index.match(user.Province, user.District, "")
+		if codes.ProvinceCode == nil {
+			continue
+		}
+		if err := db.Model(&user).Select("province_code", "district_code").Updates(&models.User{RegionCodes: codes}).Error; err != nil {
+			return result, err
+		}
+		result.Users++
+	}
+	return result, nil
+}
+
+// regionNameIndex - wilayah per induk dan nama ternormalisasi
+type regionNameIndex struct {
+	exact    map[string][]string // induk|NAMA -> kode
+	stripped map[string][]string // induk|NAMA tanpa awalan -> kode
+}
+
+var regionNamePrefixes = []string{"PROVINSI ", "PROV. ", "KABUPATEN ", "KAB. ", "KAB ", "KOTA ADMINISTRASI ", "KOTA ADM. ", "KOTA ", "KECAMATAN ", "KEC. "}
+
+func normalizeRegionName(name string) string {
+	name = strings.ToUpper(strings.Join(strings.Fields(name), " "))
+	name = strings.Replace(name, "KAB. ", "KABUPATEN ", 1)
+	return strings.Replace(name, "KEC. ", "KECAMATAN ", 1)
+}
+
+func stripRegionName(name string) string {
+	name = normalizeRegionName(name)
+	for _, prefix := range regionNamePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
+
+func newRegionNameIndex(regions []models.Region) regionNameIndex {
+	index := regionNameIndex{exact: map[string][]string{}, stripped: map[string][]string{}}
+	for _, region := range regions {
+		parent := ""
+		if region.ParentCode != nil {
+			parent = *region.ParentCode
+		}
+		exact := parent + "|" + normalizeRegionName(region.Name)
+		stripped := parent + "|" + stripRegionName(region.Name)
+		index.exact[exact] = append(index.exact[exact], region.Code)
+		index.stripped[stripped] = append(index.stripped[stripped], region.Code)
+	}
+	return index
+}
+
+func (index regionNameIndex) find(parent, name string) *string {
+	if strings.TrimSpace(name) == "" {
+		return nil
+	}
+	for _, candidates := range [][]string{
+		index.exact[parent+"|"+normalizeRegionName(name)],
+		index.stripped[parent+"|"+stripRegionName(name)],
+	} {
+		if len(candidates) == 1 {
+			code := candidates[0]
+			return &code
+		}
+		if len(candidates) > 1 {
+			return nil // ambigu, misal "Bogor" untuk Kabupaten dan Kota Bogor
+		}
+	}
+	return nil
+}
+
+// match - kode sampai tingkat terdalam yang cocok, berhenti saat satu tingkat tidak ditemukan
+func (index regionNameIndex) match(province, district, subdistrict string) models.RegionCodes {
+	var codes models.RegionCodes
+	if codes.ProvinceCode = index.find("", province); codes.ProvinceCode == nil {
+		return codes
+	}
+	if codes.DistrictCode = index.find(*codes.ProvinceCode, district); codes.DistrictCode == nil {
+		return codes
+	}
+	codes.SubdistrictCode = index.find(*codes.DistrictCode, subdistrict)
+	return codes
+}
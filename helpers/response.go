@@ -11,6 +11,16 @@ type ResponseWithData struct {
 	Data    any     `json:"data"`
 }
 
+// ResponseWithSession - response login/refresh, field token tetap dipakai untuk access token
+type ResponseWithSession struct {
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Data         any    `json:"data"`
+}
+
 type ResponseWithoutData struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
@@ -31,3 +41,14 @@ func Response(c *fiber.Ctx, statusCode int, status string, message string, data
 		})
 	}
 }
+
+func SessionResponse(c *fiber.Ctx, statusCode int, message string, data any, pair *TokenPair) error {
+	return c.Status(statusCode).JSON(ResponseWithSession{
+		Status:       "Success",
+		Message:      message,
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+		Data:         data,
+	})
+}
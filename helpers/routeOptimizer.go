@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// RoutePoint - titik pada rute penjemputan
+type RoutePoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// RouteSettings - asumsi kecepatan dan lama berhenti untuk estimasi waktu rute
+type RouteSettings struct {
+	SpeedKmh    float64       // kecepatan rata-rata kendaraan petugas
+	StopMinutes float64       // waktu menimbang dan memuat sampah per titik
+	RoadFactor  float64       // pengali jarak garis lurus ke jarak jalan
+	MaxStops    int           // batas titik per rute
+	StartAt     time.Duration // jam berangkat default dari bank, dihitung dari tengah malam
+}
+
+// RouteSettingsFromEnv membaca PICKUP_ROUTE_SPEED_KMH (default 25), PICKUP_ROUTE_STOP_MINUTES (10),
+// PICKUP_ROUTE_ROAD_FACTOR (1.3), PICKUP_ROUTE_MAX_STOPS (100) dan PICKUP_ROUTE_START (08:00)
+func RouteSettingsFromEnv() RouteSettings {
+	settings := RouteSettings{
+		SpeedKmh:    25,
+		StopMinutes: 10,
+		RoadFactor:  1.3,
+		MaxStops:    100,
+		StartAt:     8 * time.Hour,
+	}
+	if value, err := strconv.ParseFloat(os.Getenv("PICKUP_ROUTE_SPEED_KMH"), 64); err == nil && value > 0 {
+		settings.SpeedKmh = value
+	}
+	if value, err := strconv.ParseFloat(os.Getenv("PICKUP_ROUTE_STOP_MINUTES"), 64); err == nil && value >= 0 {
+		settings.StopMinutes = value
+	}
+	if value, err := strconv.ParseFloat(os.Getenv("PICKUP_ROUTE_ROAD_FACTOR"), 64); err == nil && value >= 1 {
+		settings.RoadFactor = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("PICKUP_ROUTE_MAX_STOPS")); err == nil && value > 0 {
+		settings.MaxStops = value
+	}
+	if value, err := time.Parse("15:04", os.Getenv("PICKUP_ROUTE_START")); err == nil {
+		settings.StartAt = time.Duration(value.Hour())*time.Hour + time.Duration(value.Minute())*time.Minute
+	}
+	return settings
+}
+
+// DistanceKm - jarak jalan perkiraan antara dua titik
+func (s RouteSettings) DistanceKm(from, to RoutePoint) float64 {
+	return CalculateDistance(from.Latitude, from.Longitude, to.Latitude, to.Longitude) * s.RoadFactor
+}
+
+// TravelTime - waktu tempuh untuk jarak tertentu
+func (s RouteSettings) TravelTime(distanceKm float64) time.Duration {
+	return time.Duration(distanceKm / s.SpeedKmh * float64(time.Hour))
+}
+
+// StopTime - lama berhenti di setiap titik
+func (s RouteSettings) StopTime() time.Duration {
+	return time.Duration(s.StopMinutes * float64(time.Minute))
+}
+
+// OptimizeRoute mengurutkan titik kunjungan untuk rute yang berangkat dan kembali ke depot.
+// Urutan awal dari nearest neighbour, lalu diperbaiki dengan 2-opt sampai tidak ada perbaikan.
+// Hasilnya berisi index dari stops.
+func OptimizeRoute(depot RoutePoint, stops []RoutePoint) []int {
+	n := len(stops)
+	if n == 0 {
+		return []int{}
+	}
+
+	// Matriks jarak, index 0 adalah depot dan index i+1 adalah stops[i]
+	points := append([]RoutePoint{depot}, stops...)
+	dist := make([][]float64, n+1)
+	for i := range points {
+		dist[i] = make([]float64, n+1)
+		for j := range points {
+			if i != j {
+				dist[i][j] = CalculateDistance(points[i].Latitude, points[i].Longitude, points[j].Latitude, points[j].Longitude)
+			}
+		}
+	}
+
+	// Nearest neighbour dari depot
+	tour := make([]int, 0, n+2)
+	tour = append(tour, 0)
+	visited := make([]bool, n+1)
+	current := 0
+	for len(tour) <= n {
+		next := -1
+		for candidate := 1; candidate <= n; candidate++ {
+			if visited[candidate] {
+				continue
+			}
+			if next == -1 || dist[current][candidate] < dist[current][next] {
+				next = candidate
+			}
+		}
+		visited[next] = true
+		tour = append(tour, next)
+		current = next
+	}
+	tour = append(tour, 0)
+
+	// 2-opt: balik segmen tour[i..k] jika memperpendek rute, depot di kedua ujung tidak ikut dipindah
+	const epsilon = 1e-9
+	for improved := true; improved; {
+		improved = false
+		for i := 1; i < len(tour)-2; i++ {
+			for k := i + 1; k < len(tour)-1; k++ {
+				a, b := tour[i-1], tour[i]
+				c, d := tour[k], tour[k+1]
+				if dist[a][c]+dist[b][d] < dist[a][b]+dist[c][d]-epsilon {
+					for left, right := i, k; left < right; left, right = left+1, right-1 {
+						tour[left], tour[right] = tour[right], tour[left]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+
+	order := make([]int, 0, n)
+	for _, index := range tour[1 : len(tour)-1] {
+		order = append(order, index-1)
+	}
+	return order
+}
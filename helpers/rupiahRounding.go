@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mode pembulatan rupiah
+const (
+	RoundingNearest = "nearest"
+	RoundingDown    = "down"
+	RoundingUp      = "up"
+)
+
+// RupiahRounding - aturan pembulatan nominal rupiah ke kelipatan Step
+type RupiahRounding struct {
+	Mode string
+	Step int
+}
+
+// WasteRoundingFromEnv membaca WASTE_PRICE_ROUNDING (nearest, down, up; default nearest)
+// dan WASTE_PRICE_ROUNDING_STEP (default 1 rupiah)
+func WasteRoundingFromEnv() RupiahRounding {
+	rounding := RupiahRounding{
+		Mode: strings.ToLower(os.Getenv("WASTE_PRICE_ROUNDING")),
+		Step: 1,
+	}
+	if step, err := strconv.Atoi(os.Getenv("WASTE_PRICE_ROUNDING_STEP")); err == nil && step > 0 {
+		rounding.Step = step
+	}
+	return rounding
+}
+
+// Round membulatkan amount ke kelipatan Step, misal nearest/100: 12.345,6 → 12.300
+func (r RupiahRounding) Round(amount float64) int {
+	step := float64(r.Step)
+	if step <= 0 {
+		step = 1
+	}
+
+	// Hilangkan noise floating point (2.7 * 3000 = 8100.000000000001) sebelum floor/ceil
+	units := math.Round(amount/step*1e6) / 1e6
+
+	switch r.Mode {
+	case RoundingDown:
+		units = math.Floor(units)
+	case RoundingUp:
+		units = math.Ceil(units)
+	default:
+		units = math.Round(units)
+	}
+	return int(units * step)
+}
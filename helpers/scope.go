@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/models"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// ScopeSelf - hanya user itu sendiri (atau admin) yang boleh, misal ganti password
+func ScopeSelf(c *fiber.Ctx, targetUserID uint) error {
+	authUser := AuthUser(c)
+	if authUser == nil {
+		return ErrForbidden
+	}
+	if HasRole(c, models.RoleAdmin) || authUser.Id == targetUserID {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// ScopeUser - cek apakah user yang login boleh mengakses data milik targetUserID.
+// Admin bebas, end user hanya dirinya sendiri, operator bank hanya user di bawah bank induk/unitnya.
+func ScopeUser(c *fiber.Ctx, targetUserID uint) error {
+	if err := ScopeSelf(c, targetUserID); err == nil {
+		return nil
+	}
+
+	if !HasRole(c, models.RoleParentBank, models.RoleChildBank) {
+		return ErrForbidden
+	}
+
+	var target models.User
+	if err := configs.DB.Preload("ChildBank").First(&target, targetUserID).Error; err != nil {
+		return err
+	}
+
+	var targetParentBankID *uint
+	if target.ParentBankID != nil {
+		targetParentBankID = target.ParentBankID
+	} else if target.ChildBank != nil {
+		targetParentBankID = &target.ChildBank.ParentBankID
+	}
+
+	return ScopeBank(c, targetParentBankID, target.ChildBankID)
+}
+
+// ResolveUserID - user id efektif dari body/path. Kosong berarti user yang login,
+// selain itu harus lolos ScopeUser.
+func ResolveUserID(c *fiber.Ctx, requestedUserID uint) (uint, error) {
+	return resolveUserID(c, requestedUserID, ScopeUser)
+}
+
+// ResolveSelfUserID - seperti ResolveUserID tapi hanya untuk diri sendiri atau admin (ScopeSelf).
+// Dipakai endpoint yang memotong saldo, operator bank tidak boleh membelanjakan saldo nasabahnya.
+func ResolveSelfUserID(c *fiber.Ctx, requestedUserID uint) (uint, error) {
+	return resolveUserID(c, requestedUserID, ScopeSelf)
+}
+
+func resolveUserID(c *fiber.Ctx, requestedUserID uint, scope func(*fiber.Ctx, uint) error) (uint, error) {
+	authUser := AuthUser(c)
+	if authUser == nil {
+		return 0, ErrForbidden
+	}
+	if requestedUserID == 0 {
+		return authUser.Id, nil
+	}
+	if err := scope(c, requestedUserID); err != nil {
+		return 0, err
+	}
+	return requestedUserID, nil
+}
+
+// ScopeBank - cek apakah user yang login boleh mengakses data milik bank induk/unit tertentu
+func ScopeBank(c *fiber.Ctx, parentBankID, childBankID *uint) error {
+	if HasRole(c, models.RoleAdmin) {
+		return nil
+	}
+
+	authUser := AuthUser(c)
+	if authUser == nil {
+		return ErrForbidden
+	}
+
+	switch AuthRole(c) {
+	case models.RoleChildBank:
+		if authUser.ChildBankID != nil && childBankID != nil && *authUser.ChildBankID == *childBankID {
+			return nil
+		}
+	case models.RoleParentBank:
+		if authUser.ParentBankID == nil {
+			return ErrForbidden
+		}
+		if parentBankID != nil && *parentBankID == *authUser.ParentBankID {
+			return nil
+		}
+		if childBankID != nil {
+			var childBank models.ChildBank
+			if err := configs.DB.Select("id", "parent_bank_id").First(&childBank, *childBankID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrForbidden
+				}
+				return err
+			}
+			if childBank.ParentBankID == *authUser.ParentBankID {
+				return nil
+			}
+		}
+	}
+
+	return ErrForbidden
+}
+
+// ScopeWasteDeposit - pemilik setoran atau operator bank tempat setoran dibuat
+func ScopeWasteDeposit(c *fiber.Ctx, deposit *models.WasteDeposit) error {
+	if authUser := AuthUser(c); authUser != nil && authUser.Id == deposit.UserID {
+		return nil
+	}
+	return ScopeBank(c, deposit.ParentBankID, deposit.ChildBankID)
+}
+
+// ScopeResponse - response standar untuk error dari fungsi Scope*
+func ScopeResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrForbidden) {
+		return Response(c, fiber.StatusForbidden, "Failed", "You do not have access to this resource", nil, nil)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Response(c, fiber.StatusNotFound, "Failed", "User not found", nil, nil)
+	}
+	return Response(c, fiber.StatusInternalServerError, "Failed", "Failed to check access", nil, nil)
+}
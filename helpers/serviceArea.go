@@ -0,0 +1,312 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidServiceArea = errors.New("invalid service area")
+
+// Batas ukuran wilayah yang digambar admin supaya cek overlap tetap ringan
+const maxServiceAreaVertices = 5000
+
+// Toleransi koordinat (derajat, kira-kira 1 cm) untuk titik yang tepat di garis batas
+const geoEpsilon = 1e-9
+
+// GeoPoint - satu titik GeoJSON
+type GeoPoint struct {
+	Lng float64
+	Lat float64
+}
+
+// geoPolygon - ring pertama batas luar, sisanya lubang (enclave)
+type geoPolygon [][]GeoPoint
+
+// ServiceArea - wilayah layanan hasil parse GeoJSON Polygon/MultiPolygon
+type ServiceArea struct {
+	polygons []geoPolygon
+	MinLat   float64
+	MaxLat   float64
+	MinLng   float64
+	MaxLng   float64
+}
+
+// ParseServiceArea membaca geometry GeoJSON Polygon atau MultiPolygon, boleh dibungkus Feature.
+// Ring yang belum tertutup ditutup otomatis.
+func ParseServiceArea(raw []byte) (*ServiceArea, error) {
+	var geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+		Geometry    json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(raw, &geometry); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidServiceArea, err.Error())
+	}
+	if geometry.Type == "Feature" {
+		if len(geometry.Geometry) == 0 || string(geometry.Geometry) == "null" {
+			return nil, fmt.Errorf("%w: feature has no geometry", ErrInvalidServiceArea)
+		}
+		return ParseServiceArea(geometry.Geometry)
+	}
+
+	var rawPolygons [][][][]float64
+	switch geometry.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidServiceArea, err.Error())
+		}
+		rawPolygons = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(geometry.Coordinates, &rawPolygons); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidServiceArea, err.Error())
+		}
+	default:
+		return nil, fmt.Errorf("%w: geometry type must be Polygon or MultiPolygon", ErrInvalidServiceArea)
+	}
+	if len(rawPolygons) == 0 {
+		return nil, fmt.Errorf("%w: coordinates cannot be empty", ErrInvalidServiceArea)
+	}
+
+	area := &ServiceArea{MinLat: math.Inf(1), MaxLat: math.Inf(-1), MinLng: math.Inf(1), MaxLng: math.Inf(-1)}
+	vertices := 0
+	for i, rawPolygon := range rawPolygons {
+		if len(rawPolygon) == 0 {
+			return nil, fmt.Errorf("%w: polygon %d has no rings", ErrInvalidServiceArea, i)
+		}
+		var polygon geoPolygon
+		for j, rawRing := range rawPolygon {
+			ring := make([]GeoPoint, 0, len(rawRing)+1)
+			for _, position := range rawRing {
+				if len(position) < 2 {
+					return nil, fmt.Errorf("%w: position must be [longitude, latitude]", ErrInvalidServiceArea)
+				}
+				point := GeoPoint{Lng: position[0], Lat: position[1]}
+				if point.Lng < -180 || point.Lng > 180 || point.Lat < -90 || point.Lat > 90 {
+					return nil, fmt.Errorf("%w: position [%v, %v] is out of range", ErrInvalidServiceArea, point.Lng, point.Lat)
+				}
+				ring = append(ring, point)
+			}
+			if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+				ring = append(ring, ring[0])
+			}
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("%w: ring %d of polygon %d needs at least 3 distinct positions", ErrInvalidServiceArea, j, i)
+			}
+			if j == 0 && math.Abs(ringArea(ring)) < geoEpsilon {
+				return nil, fmt.Errorf("%w: polygon %d has no area", ErrInvalidServiceArea, i)
+			}
+			vertices += len(ring)
+			polygon = append(polygon, ring)
+		}
+		for _, point := range polygon[0] {
+			area.MinLat = math.Min(area.MinLat, point.Lat)
+			area.MaxLat = math.Max(area.MaxLat, point.Lat)
+			area.MinLng = math.Min(area.MinLng, point.Lng)
+			area.MaxLng = math.Max(area.MaxLng, point.Lng)
+		}
+		area.polygons = append(area.polygons, polygon)
+	}
+	if vertices > maxServiceAreaVertices {
+		return nil, fmt.Errorf("%w: too many positions (max %d)", ErrInvalidServiceArea, maxServiceAreaVertices)
+	}
+	return area, nil
+}
+
+// GeoJSON - geometry yang disimpan: Polygon jika satu bagian, selain itu MultiPolygon
+func (a *ServiceArea) GeoJSON() json.RawMessage {
+	coordinates := make([][][][2]float64, 0, len(a.polygons))
+	for _, polygon := range a.polygons {
+		rings := make([][][2]float64, 0, len(polygon))
+		for _, ring := range polygon {
+			positions := make([][2]float64, 0, len(ring))
+			for _, point := range ring {
+				positions = append(positions, [2]float64{point.Lng, point.Lat})
+			}
+			rings = append(rings, positions)
+		}
+		coordinates = append(coordinates, rings)
+	}
+
+	var geometry any = map[string]any{"type": "MultiPolygon", "coordinates": coordinates}
+	if len(coordinates) == 1 {
+		geometry = map[string]any{"type": "Polygon", "coordinates": coordinates[0]}
+	}
+	data, _ := json.Marshal(geometry)
+	return data
+}
+
+// Contains - titik di dalam wilayah, titik tepat di garis batas dianggap masuk
+func (a *ServiceArea) Contains(lat, lng float64) bool {
+	point := GeoPoint{Lng: lng, Lat: lat}
+	if !a.boxContains(point) {
+		return false
+	}
+	for _, polygon := range a.polygons {
+		if polygon.onBoundary(point) || polygon.contains(point) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps - dua wilayah berbagi bagian dalam. Wilayah yang hanya bersinggungan di garis batas
+// (misal RW yang bertetangga) tidak dianggap overlap.
+func (a *ServiceArea) Overlaps(b *ServiceArea) bool {
+	if a.MaxLat < b.MinLat || b.MaxLat < a.MinLat || a.MaxLng < b.MinLng || b.MaxLng < a.MinLng {
+		return false
+	}
+	for _, pa := range a.polygons {
+		for _, pb := range b.polygons {
+			if polygonsOverlap(pa, pb) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *ServiceArea) boxContains(point GeoPoint) bool {
+	return point.Lat >= a.MinLat-geoEpsilon && point.Lat <= a.MaxLat+geoEpsilon &&
+		point.Lng >= a.MinLng-geoEpsilon && point.Lng <= a.MaxLng+geoEpsilon
+}
+
+// contains - ray casting pada batas luar, titik di dalam lubang tidak termasuk
+func (p geoPolygon) contains(point GeoPoint) bool {
+	if !ringContains(p[0], point) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if ringContains(hole, point) && !onRing(hole, point) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p geoPolygon) onBoundary(point GeoPoint) bool {
+	for _, ring := range p {
+		if onRing(ring, point) {
+			return true
+		}
+	}
+	return false
+}
+
+// strictlyContains - di dalam dan tidak di garis batas mana pun
+func (p geoPolygon) strictlyContains(point GeoPoint) bool {
+	return !p.onBoundary(point) && p.contains(point)
+}
+
+func polygonsOverlap(a, b geoPolygon) bool {
+	// Garis batas saling memotong
+	for _, ringA := range a {
+		for _, ringB := range b {
+			for i := 0; i+1 < len(ringA); i++ {
+				for j := 0; j+1 < len(ringB); j++ {
+					if segmentsCross(ringA[i], ringA[i+1], ringB[j], ringB[j+1]) {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	// Salah satu berada di dalam yang lain, atau batasnya berimpit: uji titik sudut dan titik
+	// yang sedikit masuk ke dalam dari tengah setiap sisi
+	for _, pair := range [][2]geoPolygon{{a, b}, {b, a}} {
+		inner, outer := pair[0], pair[1]
+		for _, point := range inner[0] {
+			if outer.strictlyContains(point) {
+				return true
+			}
+		}
+		for _, point := range interiorSamples(inner) {
+			if outer.strictlyContains(point) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// interiorSamples - titik di dalam polygon yang dekat dengan tengah setiap sisi batas luar
+func interiorSamples(p geoPolygon) []GeoPoint {
+	const offset = 1e-7
+	ring := p[0]
+	var samples []GeoPoint
+	for i := 0; i+1 < len(ring); i++ {
+		from, to := ring[i], ring[i+1]
+		length := math.Hypot(to.Lng-from.Lng, to.Lat-from.Lat)
+		if length == 0 {
+			continue
+		}
+		mid := GeoPoint{Lng: (from.Lng + to.Lng) / 2, Lat: (from.Lat + to.Lat) / 2}
+		normalLng, normalLat := -(to.Lat-from.Lat)/length*offset, (to.Lng-from.Lng)/length*offset
+		for _, candidate := range []GeoPoint{
+			{Lng: mid.Lng + normalLng, Lat: mid.Lat + normalLat},
+			{Lng: mid.Lng - normalLng, Lat: mid.Lat - normalLat},
+		} {
+			if p.strictlyContains(candidate) {
+				samples = append(samples, candidate)
+				break
+			}
+		}
+	}
+	return samples
+}
+
+func ringContains(ring []GeoPoint, point GeoPoint) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat > point.Lat) != (b.Lat > point.Lat) {
+			crossLng := (b.Lng-a.Lng)*(point.Lat-a.Lat)/(b.Lat-a.Lat) + a.Lng
+			if point.Lng < crossLng {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+func onRing(ring []GeoPoint, point GeoPoint) bool {
+	for i := 0; i+1 < len(ring); i++ {
+		if onSegment(ring[i], ring[i+1], point) {
+			return true
+		}
+	}
+	return false
+}
+
+func onSegment(a, b, point GeoPoint) bool {
+	if math.Abs(orientation(a, b, point)) > geoEpsilon*math.Max(1, math.Hypot(b.Lng-a.Lng, b.Lat-a.Lat)) {
+		return false
+	}
+	return point.Lng >= math.Min(a.Lng, b.Lng)-geoEpsilon && point.Lng <= math.Max(a.Lng, b.Lng)+geoEpsilon &&
+		point.Lat >= math.Min(a.Lat, b.Lat)-geoEpsilon && point.Lat <= math.Max(a.Lat, b.Lat)+geoEpsilon
+}
+
+// segmentsCross - dua sisi saling memotong di tengah, bukan hanya bersentuhan di ujung atau berimpit
+func segmentsCross(a, b, c, d GeoPoint) bool {
+	d1 := orientation(c, d, a)
+	d2 := orientation(c, d, b)
+	d3 := orientation(a, b, c)
+	d4 := orientation(a, b, d)
+	return ((d1 > geoEpsilon && d2 < -geoEpsilon) || (d1 < -geoEpsilon && d2 > geoEpsilon)) &&
+		((d3 > geoEpsilon && d4 < -geoEpsilon) || (d3 < -geoEpsilon && d4 > geoEpsilon))
+}
+
+func orientation(a, b, c GeoPoint) float64 {
+	return (b.Lng-a.Lng)*(c.Lat-a.Lat) - (b.Lat-a.Lat)*(c.Lng-a.Lng)
+}
+
+func ringArea(ring []GeoPoint) float64 {
+	var area float64
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i].Lng*ring[i+1].Lat - ring[i+1].Lng*ring[i].Lat
+	}
+	return area / 2
+}
@@ -0,0 +1,184 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Jenis bank pada wilayah layanan
+const (
+	ServiceAreaChildBank  = "child_bank"
+	ServiceAreaParentBank = "parent_bank"
+)
+
+var ErrNoServiceArea = errors.New("no bank service area covers this location")
+
+// ServiceAreaMatch - bank yang wilayahnya mencakup sebuah titik
+type ServiceAreaMatch struct {
+	ChildBanks []models.ChildBank // bank unit yang mencakup titik, terdekat lebih dulu
+	ParentBank *models.ParentBank // bank induk yang mencakup titik, atau induk dari bank unit pertama
+}
+
+// ServiceAreaOverlap - bank lain yang wilayahnya beririsan
+type ServiceAreaOverlap struct {
+	BankType string `json:"bank_type"`
+	BankID   uint   `json:"bank_id"`
+	Name     string `json:"name"`
+}
+
+// SetServiceArea mengisi kolom wilayah layanan dan bounding box. nil menghapus wilayah.
+func SetServiceArea(target *models.BankServiceArea, area *ServiceArea) {
+	if area == nil {
+		*target = models.BankServiceArea{}
+		return
+	}
+	minLat, maxLat, minLng, maxLng := area.MinLat, area.MaxLat, area.MinLng, area.MaxLng
+	*target = models.BankServiceArea{
+		ServiceArea: area.GeoJSON(),
+		AreaMinLat:  &minLat,
+		AreaMaxLat:  &maxLat,
+		AreaMinLng:  &minLng,
+		AreaMaxLng:  &maxLng,
+	}
+}
+
+// boxQuery - kandidat yang bounding box-nya mencakup titik
+func boxQuery(db *gorm.DB, lat, lng float64) *gorm.DB {
+	return db.Where("service_area IS NOT NULL AND area_min_lat <= ? AND area_max_lat >= ? AND area_min_lng <= ? AND area_max_lng >= ?", lat, lat, lng, lng)
+}
+
+// FindServiceAreaBanks mencari bank unit dan bank induk yang wilayahnya mencakup titik
+func FindServiceAreaBanks(db *gorm.DB, lat, lng float64) (ServiceAreaMatch, error) {
+	var match ServiceAreaMatch
+
+	var childBanks []models.ChildBank
+	if err := boxQuery(db.Preload("ParentBank"), lat, lng).Find(&childBanks).Error; err != nil {
+		return match, err
+	}
+	for _, bank := range childBanks {
+		area, err := ParseServiceArea(bank.ServiceArea)
+		if err != nil || !area.Contains(lat, lng) {
+			continue
+		}
+		match.ChildBanks = append(match.ChildBanks, bank)
+	}
+	sort.SliceStable(match.ChildBanks, func(i, j int) bool {
+		return CalculateDistance(lat, lng, match.ChildBanks[i].Latitude, match.ChildBanks[i].Longitude) <
+			CalculateDistance(lat, lng, match.ChildBanks[j].Latitude, match.ChildBanks[j].Longitude)
+	})
+
+	var parentBanks []models.ParentBank
+	if err := boxQuery(db, lat, lng).Order("id ASC").Find(&parentBanks).Error; err != nil {
+		return match, err
+	}
+	for i := range parentBanks {
+		area, err := ParseServiceArea(parentBanks[i].ServiceArea)
+		if err == nil && area.Contains(lat, lng) {
+			match.ParentBank = &parentBanks[i]
+			break
+		}
+	}
+
+	// Bank induk tidak menggambar wilayah sendiri: pakai induk dari bank unit yang mencakup titik
+	if match.ParentBank == nil && len(match.ChildBanks) > 0 {
+		parentBank := match.ChildBanks[0].ParentBank
+		match.ParentBank = &parentBank
+	}
+	return match, nil
+}
+
+// ResolveServiceBank - bank untuk titik: bank unit terdekat yang mencakup titik, lalu bank induk.
+// ErrNoServiceArea jika tidak ada wilayah yang cocok.
+func ResolveServiceBank(db *gorm.DB, lat, lng float64) (InventoryBank, error) {
+	match, err := FindServiceAreaBanks(db, lat, lng)
+	if err != nil {
+		return InventoryBank{}, err
+	}
+	if len(match.ChildBanks) > 0 {
+		id := match.ChildBanks[0].Id
+		return InventoryBank{ChildBankID: &id}, nil
+	}
+	if match.ParentBank != nil {
+		id := match.ParentBank.Id
+		return InventoryBank{ParentBankID: &id}, nil
+	}
+	return InventoryBank{}, ErrNoServiceArea
+}
+
+// BankCoversPoint - bank tanpa wilayah layanan dianggap mencakup semua titik supaya bank lama tetap
+// bisa dipilih sampai wilayahnya digambar
+func BankCoversPoint(db *gorm.DB, bank InventoryBank, lat, lng float64) (bool, error) {
+	var serviceArea models.BankServiceArea
+	var err error
+	if bank.ChildBankID != nil {
+		var childBank models.ChildBank
+		err = db.Select("id", "service_area").First(&childBank, *bank.ChildBankID).Error
+		serviceArea = childBank.BankServiceArea
+	} else if bank.ParentBankID != nil {
+		var parentBank models.ParentBank
+		err = db.Select("id", "service_area").First(&parentBank, *bank.ParentBankID).Error
+		serviceArea = parentBank.BankServiceArea
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(serviceArea.ServiceArea) == 0 || string(serviceArea.ServiceArea) == "null" {
+		return true, nil
+	}
+
+	area, err := ParseServiceArea(serviceArea.ServiceArea)
+	if err != nil {
+		return false, err
+	}
+	return area.Contains(lat, lng), nil
+}
+
+// FindServiceAreaOverlaps - bank sejenis yang wilayahnya beririsan dengan area, excludeID untuk bank
+// yang sedang diubah
+func FindServiceAreaOverlaps(db *gorm.DB, bankType string, excludeID uint, area *ServiceArea) ([]ServiceAreaOverlap, error) {
+	overlaps := []ServiceAreaOverlap{}
+
+	// Kandidat: bounding box beririsan
+	boxOverlap := func(query *gorm.DB) *gorm.DB {
+		return query.Where("service_area IS NOT NULL AND id <> ? AND area_min_lat <= ? AND area_max_lat >= ? AND area_min_lng <= ? AND area_max_lng >= ?",
+			excludeID, area.MaxLat, area.MinLat, area.MaxLng, area.MinLng)
+	}
+
+	switch bankType {
+	case ServiceAreaChildBank:
+		var banks []models.ChildBank
+		if err := boxOverlap(db).Order("id ASC").Find(&banks).Error; err != nil {
+			return nil, err
+		}
+		for _, bank := range banks {
+			if other, err := ParseServiceArea(bank.ServiceArea); err == nil && area.Overlaps(other) {
+				overlaps = append(overlaps, ServiceAreaOverlap{
+					BankType: ServiceAreaChildBank,
+					BankID:   bank.Id,
+					Name:     fmt.Sprintf("%s RT %s/RW %s", bank.Subdistrict, bank.RT, bank.RW),
+				})
+			}
+		}
+	case ServiceAreaParentBank:
+		var banks []models.ParentBank
+		if err := boxOverlap(db).Order("id ASC").Find(&banks).Error; err != nil {
+			return nil, err
+		}
+		for _, bank := range banks {
+			if other, err := ParseServiceArea(bank.ServiceArea); err == nil && area.Overlaps(other) {
+				overlaps = append(overlaps, ServiceAreaOverlap{
+					BankType: ServiceAreaParentBank,
+					BankID:   bank.Id,
+					Name:     fmt.Sprintf("%s, %s", bank.District, bank.Province),
+				})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: bank_type must be child_bank or parent_bank", ErrInvalidServiceArea)
+	}
+	return overlaps, nil
+}
@@ -0,0 +1,229 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDepositInvalid         = errors.New("invalid waste deposit")
+	ErrDepositProductNotFound = errors.New("product waste not found")
+	ErrDepositUserNotFound    = errors.New("user not found")
+	ErrDepositBankNotFound    = errors.New("child bank not found")
+	ErrDepositDuplicateRef    = errors.New("reference ID already exists")
+)
+
+// DepositItemInput - satu item hasil timbang. Photo berisi URL yang sudah diupload.
+type DepositItemInput struct {
+	ProductWasteID uint
+	Weight         float64
+	Unit           string
+	Photo          string
+}
+
+// DepositInput - data setoran baru, dari form setoran di bank atau dari penjemputan yang selesai
+type DepositInput struct {
+	UserID          uint
+	ParentBankID    *uint
+	ChildBankID     *uint
+	PickupRequestID *uint
+	Items           []DepositItemInput
+	CreatedBy       *uint
+}
+
+// WasteDepositService - satu jalur pembuatan setoran: harga per bank, stok, saldo user lewat ledger,
+// riwayat transaksi dan revisi pertama dalam satu transaksi database.
+type WasteDepositService struct {
+	tx *gorm.DB
+}
+
+func NewWasteDepositService(tx *gorm.DB) *WasteDepositService {
+	return &WasteDepositService{tx: tx}
+}
+
+// Create membuat setoran. Error validasi dibungkus ErrDepositInvalid, error lain dari sentinel di atas
+// atau error database.
+func (s *WasteDepositService) Create(input DepositInput) (*models.WasteDeposit, error) {
+	if (input.ParentBankID == nil) == (input.ChildBankID == nil) {
+		return nil, fmt.Errorf("%w: exactly one of child_bank_id or parent_bank_id is required", ErrDepositInvalid)
+	}
+	if len(input.Items) == 0 {
+		return nil, fmt.Errorf("%w: items cannot be empty", ErrDepositInvalid)
+	}
+
+	var user models.User
+	if err := s.tx.Select("id").First(&user, input.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDepositUserNotFound
+		}
+		return nil, err
+	}
+
+	// Harga mengikuti bank yang menangani setoran: bank unit → bank induk → default company
+	priceScope, err := NewWastePriceScope(s.tx, input.ParentBankID, input.ChildBankID)
+	if err != nil {
+		return nil, ErrDepositBankNotFound
+	}
+
+	// Generate reference ID, harga produk diambil yang berlaku pada waktu setoran
+	depositedAt := time.Now()
+	referenceID := UniqueReference("WD", depositedAt, input.UserID)
+	rounding := WasteRoundingFromEnv()
+
+	var totalWeight float64
+	var totalPrice int
+	var items []models.WasteDepositItem
+
+	for _, itemReq := range input.Items {
+		var productWaste models.ProductWaste
+		if err := s.tx.First(&productWaste, itemReq.ProductWasteID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %d", ErrDepositProductNotFound, itemReq.ProductWasteID)
+			}
+			return nil, err
+		}
+
+		unitPrice, err := ResolveWastePrice(s.tx, productWaste, priceScope, depositedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Hitung subtotal dari harga produk dengan konversi satuan, harga disimpan sebagai snapshot
+		itemPrice, err := PriceWasteItem(productWaste, unitPrice.Price, itemReq.Weight, itemReq.Unit, rounding)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrDepositInvalid, err.Error())
+		}
+
+		items = append(items, models.WasteDepositItem{
+			ProductWasteID:   itemReq.ProductWasteID,
+			Category:         productWaste.Category,
+			Weight:           itemReq.Weight,
+			Unit:             itemPrice.Unit,
+			UnitPrice:        itemPrice.UnitPrice,
+			PriceUnit:        itemPrice.PriceUnit,
+			NormalizedWeight: itemPrice.NormalizedWeight,
+			SubTotal:         itemPrice.SubTotal,
+			Photo:            itemReq.Photo,
+		})
+		// Total berat dalam kg, item liter/pcs tidak dihitung
+		totalWeight += WasteWeightKg(itemReq.Weight, itemPrice.Unit)
+		totalPrice += itemPrice.SubTotal
+	}
+
+	deposit := models.WasteDeposit{
+		UserID:          input.UserID,
+		ChildBankID:     input.ChildBankID,
+		ParentBankID:    input.ParentBankID,
+		PickupRequestID: input.PickupRequestID,
+		TotalWeight:     totalWeight,
+		TotalPrice:      totalPrice,
+		ReferenceID:     referenceID,
+		Status:          models.DepositStatusActive,
+		Revision:        1,
+		Items:           items,
+	}
+	if err := s.tx.Create(&deposit).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "Duplicate entry") {
+			return nil, ErrDepositDuplicateRef
+		}
+		return nil, err
+	}
+
+	// Revisi pertama menyimpan isi setoran asli untuk riwayat koreksi
+	err = s.tx.Create(&models.WasteDepositRevision{
+		WasteDepositID:   deposit.Id,
+		Revision:         1,
+		Action:           models.DepositRevisionCreate,
+		TotalWeightAfter: totalWeight,
+		TotalPriceAfter:  totalPrice,
+		BalanceDelta:     totalPrice,
+		ItemsAfter:       SnapshotDepositItems(deposit.Items),
+		CreatedBy:        input.CreatedBy,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Sampah yang disetor masuk ke stok bank yang menerima
+	inventory := NewInventoryService(s.tx)
+	for _, item := range deposit.Items {
+		_, err := inventory.Move(StockMove{
+			Bank:           InventoryBank{ParentBankID: input.ParentBankID, ChildBankID: input.ChildBankID},
+			ProductWasteID: item.ProductWasteID,
+			Type:           models.StockMovementDeposit,
+			Quantity:       item.NormalizedWeight,
+			Unit:           item.PriceUnit,
+			Reference:      referenceID,
+			CreatedBy:      input.CreatedBy,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Saldo user bertambah lewat ledger
+	_, err = NewLedgerService(s.tx).Post(
+		referenceID,
+		"Pembelian sampah dari setoran nasabah",
+		Debit(models.AccountWastePurchase, 0, totalPrice),
+		Credit(models.AccountUserWallet, input.UserID, totalPrice),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := models.Transaction{
+		UserID:  input.UserID,
+		Balance: totalPrice,
+		Type:    "topup",
+		Status:  "confirm", // Otomatis confirmed karena dari waste deposit
+		Desc:    "Topup dari setoran sampah - Ref: " + referenceID,
+	}
+	if err := s.tx.Create(&transaction).Error; err != nil {
+		// Log error tapi jangan gagalkan setoran, saldo sudah tercatat di ledger
+		fmt.Printf("Warning: Failed to create transaction record: %v\n", err)
+	}
+
+	return &deposit, nil
+}
+
+// depositItemSnapshot - isi item yang disimpan di riwayat revisi setoran
+type depositItemSnapshot struct {
+	Id               uint    `json:"id"`
+	ProductWasteID   uint    `json:"product_waste_id"`
+	Category         string  `json:"category"`
+	Weight           float64 `json:"weight"`
+	Unit             string  `json:"unit"`
+	UnitPrice        int     `json:"unit_price"`
+	PriceUnit        string  `json:"price_unit"`
+	NormalizedWeight float64 `json:"normalized_weight"`
+	SubTotal         int     `json:"sub_total"`
+	Photo            string  `json:"photo"`
+}
+
+// SnapshotDepositItems - JSON item setoran untuk WasteDepositRevision
+func SnapshotDepositItems(items []models.WasteDepositItem) json.RawMessage {
+	snapshots := make([]depositItemSnapshot, 0, len(items))
+	for _, item := range items {
+		snapshots = append(snapshots, depositItemSnapshot{
+			Id:               item.Id,
+			ProductWasteID:   item.ProductWasteID,
+			Category:         item.Category,
+			Weight:           item.Weight,
+			Unit:             item.Unit,
+			UnitPrice:        item.UnitPrice,
+			PriceUnit:        item.PriceUnit,
+			NormalizedWeight: item.NormalizedWeight,
+			SubTotal:         item.SubTotal,
+			Photo:            item.Photo,
+		})
+	}
+	data, _ := json.Marshal(snapshots)
+	return data
+}
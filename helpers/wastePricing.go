@@ -0,0 +1,202 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WastePriceScope - bank yang menangani setoran. Kosong berarti harga default company.
+type WastePriceScope struct {
+	ParentBankID *uint
+	ChildBankID  *uint
+}
+
+// ResolvedWastePrice - harga efektif beserta level asal harganya (models.WastePriceLevel*)
+type ResolvedWastePrice struct {
+	Price int    `json:"price"`
+	Level string `json:"level"`
+}
+
+// NewWastePriceScope melengkapi bank induk dari bank unit, supaya override bank induk ikut berlaku
+func NewWastePriceScope(db *gorm.DB, parentBankID, childBankID *uint) (WastePriceScope, error) {
+	scope := WastePriceScope{ParentBankID: parentBankID, ChildBankID: childBankID}
+	if childBankID != nil && parentBankID == nil {
+		var childBank models.ChildBank
+		if err := db.Select("id", "parent_bank_id").First(&childBank, *childBankID).Error; err != nil {
+			return scope, err
+		}
+		scope.ParentBankID = &childBank.ParentBankID
+	}
+	return scope, nil
+}
+
+// Level - level harga yang ditulis untuk scope ini (bank unit lebih spesifik dari bank induk)
+func (s WastePriceScope) Level() string {
+	switch {
+	case s.ChildBankID != nil:
+		return models.WastePriceLevelChildBank
+	case s.ParentBankID != nil:
+		return models.WastePriceLevelParentBank
+	}
+	return models.WastePriceLevelDefault
+}
+
+// whereLevel - filter baris harga untuk satu level saja
+func whereLevel(db *gorm.DB, level string, scope WastePriceScope) *gorm.DB {
+	switch level {
+	case models.WastePriceLevelChildBank:
+		return db.Where("child_bank_id = ?", *scope.ChildBankID)
+	case models.WastePriceLevelParentBank:
+		return db.Where("parent_bank_id = ? AND child_bank_id IS NULL", *scope.ParentBankID)
+	}
+	return db.Where("parent_bank_id IS NULL AND child_bank_id IS NULL")
+}
+
+// levels - urutan pencarian harga: bank unit → bank induk → default company
+func (s WastePriceScope) levels() []string {
+	var levels []string
+	if s.ChildBankID != nil {
+		levels = append(levels, models.WastePriceLevelChildBank)
+	}
+	if s.ParentBankID != nil {
+		levels = append(levels, models.WastePriceLevelParentBank)
+	}
+	return append(levels, models.WastePriceLevelDefault)
+}
+
+// ResolveWastePrice - harga produk yang berlaku pada waktu at untuk bank pada scope.
+// Produk tanpa riwayat harga default (data lama) memakai ProductWaste.Price.
+func ResolveWastePrice(db *gorm.DB, product models.ProductWaste, scope WastePriceScope, at time.Time) (ResolvedWastePrice, error) {
+	for _, level := range scope.levels() {
+		var price models.ProductWastePrice
+		err := whereLevel(db, level, scope).
+			Where("product_waste_id = ? AND effective_from <= ?", product.Id, at).
+			Order("effective_from DESC, id DESC").
+			First(&price).Error
+		if err == nil {
+			return ResolvedWastePrice{Price: price.Price, Level: level}, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return ResolvedWastePrice{}, err
+		}
+	}
+	return ResolvedWastePrice{Price: product.Price, Level: models.WastePriceLevelDefault}, nil
+}
+
+// CurrentWastePrices - ResolveWastePrice untuk banyak produk sekaligus
+func CurrentWastePrices(db *gorm.DB, products []models.ProductWaste, scope WastePriceScope, at time.Time) (map[uint]ResolvedWastePrice, error) {
+	prices := make(map[uint]ResolvedWastePrice, len(products))
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		prices[product.Id] = ResolvedWastePrice{Price: product.Price, Level: models.WastePriceLevelDefault}
+		ids = append(ids, product.Id)
+	}
+	if len(ids) == 0 {
+		return prices, nil
+	}
+
+	// Level umum lebih dulu agar ditimpa level yang lebih spesifik
+	levels := scope.levels()
+	for i := len(levels) - 1; i >= 0; i-- {
+		// Diurutkan naik sehingga baris terakhir per produk adalah harga yang berlaku
+		var history []models.ProductWastePrice
+		err := whereLevel(db, levels[i], scope).
+			Where("product_waste_id IN ? AND effective_from <= ?", ids, at).
+			Order("effective_from ASC, id ASC").
+			Find(&history).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, price := range history {
+			prices[price.ProductWasteID] = ResolvedWastePrice{Price: price.Price, Level: levels[i]}
+		}
+	}
+	return prices, nil
+}
+
+// WastePriceHistory - semua baris harga (termasuk jadwal) untuk satu level, urut dari yang paling lama
+func WastePriceHistory(db *gorm.DB, productID uint, scope WastePriceScope) ([]models.ProductWastePrice, error) {
+	var prices []models.ProductWastePrice
+	err := whereLevel(db, scope.Level(), scope).
+		Where("product_waste_id = ?", productID).
+		Order("effective_from ASC, id ASC").
+		Find(&prices).Error
+	return prices, err
+}
+
+// RecordWastePrice mencatat harga baru pada level scope. Harga default yang langsung berlaku juga
+// disalin ke ProductWaste.Price supaya kolom tersebut tetap menunjukkan harga terakhir.
+func RecordWastePrice(db *gorm.DB, productID uint, scope WastePriceScope, price int, effectiveFrom time.Time, note string, createdBy *uint) (*models.ProductWastePrice, error) {
+	record := models.ProductWastePrice{
+		ProductWasteID: productID,
+		Price:          price,
+		EffectiveFrom:  effectiveFrom,
+		Note:           note,
+		CreatedBy:      createdBy,
+	}
+	// Override bank unit hanya menyimpan ChildBankID agar tidak ikut terbaca sebagai override bank induk
+	switch scope.Level() {
+	case models.WastePriceLevelChildBank:
+		record.ChildBankID = scope.ChildBankID
+	case models.WastePriceLevelParentBank:
+		record.ParentBankID = scope.ParentBankID
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	if scope.Level() == models.WastePriceLevelDefault && !effectiveFrom.After(time.Now()) {
+		if err := db.Model(&models.ProductWaste{}).Where("id = ?", productID).Update("price", price).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+// WasteItemPrice - hasil perhitungan harga satu item setoran, disimpan sebagai snapshot di WasteDepositItem
+type WasteItemPrice struct {
+	Unit             string  // satuan input petugas
+	PriceUnit        string  // satuan harga produk saat setoran
+	NormalizedWeight float64 // jumlah dalam PriceUnit
+	UnitPrice        int     // harga per PriceUnit saat setoran
+	SubTotal         int
+}
+
+// PriceWasteItem menghitung subtotal item dengan konversi satuan, misal 5 ons produk Rp3.000/kg → Rp1.500.
+// Unit kosong berarti satuan produk.
+func PriceWasteItem(product models.ProductWaste, unitPrice int, quantity float64, unit string, rounding RupiahRounding) (WasteItemPrice, error) {
+	if quantity <= 0 || math.IsNaN(quantity) || math.IsInf(quantity, 0) {
+		return WasteItemPrice{}, fmt.Errorf("weight must be greater than 0")
+	}
+	if strings.TrimSpace(unit) == "" {
+		unit = product.Unit
+	}
+
+	result := WasteItemPrice{UnitPrice: unitPrice}
+
+	priceUnit, priceErr := NormalizeWasteUnit(product.Unit)
+	inputUnit, inputErr := NormalizeWasteUnit(unit)
+	switch {
+	case priceErr == nil && inputErr == nil:
+		normalized, err := ConvertWasteQuantity(quantity, inputUnit, priceUnit)
+		if err != nil {
+			return WasteItemPrice{}, fmt.Errorf("cannot weigh %s in %s: %w", product.WasteType, inputUnit, err)
+		}
+		result.Unit, result.PriceUnit, result.NormalizedWeight = inputUnit, priceUnit, normalized
+	case strings.EqualFold(strings.TrimSpace(unit), strings.TrimSpace(product.Unit)):
+		// Satuan produk lama yang tidak dikenali tetap bisa dipakai selama sama persis
+		result.Unit, result.PriceUnit, result.NormalizedWeight = product.Unit, product.Unit, quantity
+	case inputErr != nil:
+		return WasteItemPrice{}, inputErr
+	default:
+		return WasteItemPrice{}, fmt.Errorf("%s has unsupported unit %q", product.WasteType, product.Unit)
+	}
+
+	result.SubTotal = rounding.Round(result.NormalizedWeight * float64(unitPrice))
+	return result, nil
+}
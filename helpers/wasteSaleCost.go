@@ -0,0 +1,30 @@
+package helpers
+
+import (
+	"backend-mulungs/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AverageBuybackPrice - rata-rata tertimbang harga beli sampah dari nasabah (WasteDepositItem) per satuan
+// unit, untuk setoran di bank induk dan bank unit di bawahnya sampai waktu tertentu.
+// Mengembalikan 0 jika belum ada setoran produk tersebut.
+func AverageBuybackPrice(db *gorm.DB, parentBankID, productWasteID uint, unit string, until time.Time) (float64, error) {
+	var totals struct {
+		Weight float64
+		Amount float64
+	}
+	err := db.Model(&models.WasteDepositItem{}).
+		Select("COALESCE(SUM(waste_deposit_items.normalized_weight), 0) AS weight, COALESCE(SUM(waste_deposit_items.sub_total), 0) AS amount").
+		Joins("JOIN waste_deposits ON waste_deposits.id = waste_deposit_items.waste_deposit_id AND waste_deposits.deleted_at IS NULL AND waste_deposits.status <> ?", models.DepositStatusVoided).
+		Where("waste_deposit_items.product_waste_id = ? AND waste_deposit_items.price_unit = ? AND waste_deposit_items.normalized_weight > 0", productWasteID, unit).
+		Where("(waste_deposits.parent_bank_id = ? OR waste_deposits.child_bank_id IN (?))",
+			parentBankID, db.Model(&models.ChildBank{}).Select("id").Where("parent_bank_id = ?", parentBankID)).
+		Where("waste_deposits.created_at <= ?", until).
+		Scan(&totals).Error
+	if err != nil || totals.Weight == 0 {
+		return 0, err
+	}
+	return totals.Amount / totals.Weight, nil
+}
@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Satuan sampah yang dikenali
+const (
+	UnitKg    = "kg"
+	UnitOns   = "ons"
+	UnitGram  = "gram"
+	UnitLiter = "liter"
+	UnitPcs   = "pcs"
+)
+
+var ErrIncompatibleUnit = errors.New("incompatible waste unit")
+
+type wasteUnit struct {
+	dimension string  // mass, volume, count
+	factor    float64 // kelipatan satuan dasar dimensi (kg, liter, pcs)
+}
+
+var wasteUnits = map[string]wasteUnit{
+	UnitKg:    {"mass", 1},
+	UnitOns:   {"mass", 0.1},
+	UnitGram:  {"mass", 0.001},
+	UnitLiter: {"volume", 1},
+	UnitPcs:   {"count", 1},
+}
+
+var wasteUnitAliases = map[string]string{
+	"kilogram": UnitKg,
+	"kilo":     UnitKg,
+	"g":        UnitGram,
+	"gr":       UnitGram,
+	"l":        UnitLiter,
+	"lt":       UnitLiter,
+	"ltr":      UnitLiter,
+	"litre":    UnitLiter,
+	"pc":       UnitPcs,
+	"buah":     UnitPcs,
+	"biji":     UnitPcs,
+}
+
+// NormalizeWasteUnit - "Kilogram" → "kg", error jika satuan tidak dikenali
+func NormalizeWasteUnit(unit string) (string, error) {
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if alias, ok := wasteUnitAliases[unit]; ok {
+		unit = alias
+	}
+	if _, ok := wasteUnits[unit]; !ok {
+		return "", fmt.Errorf("unknown waste unit %q (allowed: kg, ons, gram, liter, pcs)", unit)
+	}
+	return unit, nil
+}
+
+// ConvertWasteQuantity mengubah jumlah dari satuan from ke satuan to, misal 5 ons → 0.5 kg.
+// Satuan beda dimensi (kg ↔ liter ↔ pcs) mengembalikan ErrIncompatibleUnit.
+func ConvertWasteQuantity(quantity float64, from, to string) (float64, error) {
+	fromUnit, err := NormalizeWasteUnit(from)
+	if err != nil {
+		return 0, err
+	}
+	toUnit, err := NormalizeWasteUnit(to)
+	if err != nil {
+		return 0, err
+	}
+
+	source, target := wasteUnits[fromUnit], wasteUnits[toUnit]
+	if source.dimension != target.dimension {
+		return 0, fmt.Errorf("%w: %s to %s", ErrIncompatibleUnit, fromUnit, toUnit)
+	}
+	return quantity * source.factor / target.factor, nil
+}
+
+// WasteWeightKg - berat dalam kg untuk satuan massa, 0 untuk liter/pcs yang tidak punya berat
+func WasteWeightKg(quantity float64, unit string) float64 {
+	kg, err := ConvertWasteQuantity(quantity, unit, UnitKg)
+	if err != nil {
+		return 0
+	}
+	return kg
+}
@@ -5,6 +5,8 @@ import (
 	"backend-mulungs/initializers"
 	"backend-mulungs/routes"
 	"backend-mulungs/seeders"
+	"backend-mulungs/workers"
+	"context"
 	"log"
 	"os"
 
@@ -34,6 +36,15 @@ func main() {
 		log.Fatal("Failed to initialize S3:", err)
 	}
 
+	// Background worker untuk transaksi PPOB yang tidak mendapat callback
+	workers.NewPpobReconcilerFromEnv().Start(context.Background())
+
+	// Sinkronisasi katalog harga PPOB dari provider
+	workers.NewPpobCatalogSyncerFromEnv().Start(context.Background())
+
+	// Tutup pembayaran top up yang kedaluwarsa tanpa webhook lunas
+	workers.NewPaymentExpirerFromEnv().Start(context.Background())
+
 	app := fiber.New()
 
 	app.Use(cors.New(cors.Config{
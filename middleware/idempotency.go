@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	// Request yang tidak selesai dalam waktu ini (misal server mati) boleh diulang dengan key yang sama
+	idempotencyLockTimeout = 5 * time.Minute
+)
+
+// Idempotency - dipasang setelah RequireAuth di endpoint yang memindahkan uang.
+// Request dengan key yang sama dari user yang sama mendapat response asli, key yang dipakai ulang
+// dengan body berbeda ditolak 422, dan request yang masih diproses ditolak 409.
+// Tanpa header Idempotency-Key request diproses seperti biasa.
+func Idempotency(c *fiber.Ctx) error {
+	key := strings.TrimSpace(c.Get(idempotencyHeader))
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > 100 {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Idempotency-Key is too long (max 100 characters)", nil, nil)
+	}
+
+	authUser := helpers.AuthUser(c)
+	if authUser == nil {
+		return helpers.Response(c, fiber.StatusUnauthorized, "Failed", "Unauthorized", nil, nil)
+	}
+
+	requestHash, err := idempotencyRequestHash(c)
+	if err != nil {
+		return helpers.Response(c, fiber.StatusBadRequest, "Failed", "Invalid request body", nil, nil)
+	}
+
+	record := models.IdempotencyKey{
+		UserID:      authUser.Id,
+		Key:         key,
+		Method:      c.Method(),
+		Path:        c.Path(),
+		RequestHash: requestHash,
+	}
+
+	if err := configs.DB.Create(&record).Error; err != nil {
+		if !strings.Contains(err.Error(), "Duplicate entry") && !strings.Contains(err.Error(), "duplicate") {
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to store idempotency key", nil, nil)
+		}
+
+		var existing models.IdempotencyKey
+		if err := configs.DB.Where("user_id = ? AND `key` = ?", authUser.Id, key).First(&existing).Error; err != nil {
+			return helpers.Response(c, fiber.StatusInternalServerError, "Failed", "Failed to load idempotency key", nil, nil)
+		}
+
+		if existing.RequestHash != requestHash || existing.Method != record.Method || existing.Path != record.Path {
+			return helpers.Response(c, fiber.StatusUnprocessableEntity, "Failed", "Idempotency-Key already used for a different request", nil, nil)
+		}
+
+		if existing.CompletedAt != nil {
+			c.Set("Idempotent-Replayed", "true")
+			if existing.ContentType != "" {
+				c.Set(fiber.HeaderContentType, existing.ContentType)
+			}
+			return c.Status(existing.StatusCode).Send(existing.ResponseBody)
+		}
+
+		if time.Since(existing.UpdatedAt) < idempotencyLockTimeout {
+			return helpers.Response(c, fiber.StatusConflict, "Failed", "A request with this Idempotency-Key is still being processed", nil, nil)
+		}
+
+		// Request sebelumnya tidak pernah selesai, ambil alih key tersebut
+		result := configs.DB.Model(&models.IdempotencyKey{}).
+			Where("id = ? AND completed_at IS NULL AND updated_at = ?", existing.Id, existing.UpdatedAt).
+			Update("updated_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return helpers.Response(c, fiber.StatusConflict, "Failed", "A request with this Idempotency-Key is still being processed", nil, nil)
+		}
+		record = existing
+	}
+
+	if err := c.Next(); err != nil {
+		configs.DB.Delete(&models.IdempotencyKey{}, record.Id)
+		return err
+	}
+
+	// Error server tidak disimpan supaya client bisa mencoba lagi dengan key yang sama
+	status := c.Response().StatusCode()
+	if status >= fiber.StatusInternalServerError {
+		configs.DB.Delete(&models.IdempotencyKey{}, record.Id)
+		return nil
+	}
+
+	now := time.Now()
+	configs.DB.Model(&models.IdempotencyKey{}).Where("id = ?", record.Id).Updates(map[string]any{
+		"status_code":   status,
+		"content_type":  string(c.Response().Header.ContentType()),
+		"response_body": append([]byte(nil), c.Response().Body()...),
+		"completed_at":  &now,
+	})
+
+	return nil
+}
+
+// idempotencyRequestHash - hash isi request. Untuk multipart, field form diurutkan dan file
+// di-hash berdasarkan nama, ukuran dan isinya.
+func idempotencyRequestHash(c *fiber.Ctx) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", c.Method(), c.Path())
+
+	if !strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		hash.Write(c.Body())
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return "", err
+	}
+
+	fields := make([]string, 0, len(form.Value))
+	for name := range form.Value {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	for _, name := range fields {
+		for _, value := range form.Value[name] {
+			fmt.Fprintf(hash, "v:%s=%s\n", name, value)
+		}
+	}
+
+	fileFields := make([]string, 0, len(form.File))
+	for name := range form.File {
+		fileFields = append(fileFields, name)
+	}
+	sort.Strings(fileFields)
+	for _, name := range fileFields {
+		for _, fileHeader := range form.File[name] {
+			fmt.Fprintf(hash, "f:%s=%s:%d:", name, fileHeader.Filename, fileHeader.Size)
+			file, err := fileHeader.Open()
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(hash, file)
+			file.Close()
+			if err != nil {
+				return "", err
+			}
+			hash.Write([]byte("\n"))
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -1,12 +1,13 @@
 package middleware
 
 import (
-	"os"
-	"strings"
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
+
 func RequireAuth(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
@@ -17,10 +18,7 @@ func RequireAuth(c *fiber.Ctx) error {
 	}
 
 	// cek token valid
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	_, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
-		return []byte(os.Getenv("SECRET")), nil
-	})
+	userID, err := helpers.ExtractUserID(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "Failed",
@@ -28,7 +26,54 @@ func RequireAuth(c *fiber.Ctx) error {
 		})
 	}
 
-	// tanpa c.Locals
+	// token wajib terikat ke sesi yang belum dicabut (logout, revoke admin, refresh token bocor)
+	sessionID, err := helpers.ExtractSessionID(c)
+	if err != nil || sessionID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "Failed",
+			"message": "Session expired, please login again",
+		})
+	}
+
+	active, err := helpers.SessionActive(configs.DB, sessionID, userID)
+	if err != nil || !active {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "Failed",
+			"message": "Session has been revoked",
+		})
+	}
+
+	// ambil user beserta role untuk dipakai policy per route
+	var user models.User
+	if err := configs.DB.Preload("Role").First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "Failed",
+			"message": "User not found",
+		})
+	}
+
+	if user.Status == "inactive" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "Failed",
+			"message": "Account is inactive",
+		})
+	}
+
+	c.Locals(helpers.LocalAuthUser, &user)
+	c.Locals(helpers.LocalAuthRole, user.Role.Name)
+
 	return c.Next()
 }
 
+// RequireRole - hanya role yang disebutkan boleh mengakses route, dipasang setelah RequireAuth
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !helpers.HasRole(c, roles...) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "Failed",
+				"message": "You do not have permission to access this resource",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -13,7 +13,8 @@ type HistoryModel struct {
 	DeletedAt     gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 	UserID        uint           `json:"-"`
 	User          User           `json:"user" gorm:"foreignKey:UserID"`
-	RefID         string         `json:"ref_id" gorm:"index"`
+	Kind          string         `json:"kind" gorm:"type:varchar(20);index;not null;default:'prepaid'"` // PpobKindPrepaid atau PpobKindPostpaid
+	RefID         string         `json:"ref_id" gorm:"type:varchar(100);uniqueIndex"`                   // satu riwayat per ref_id/tr_id, dipakai untuk settle
 	ProductName   string         `json:"product_name" gorm:"type:varchar(255)"`
 	ProductPrice  string         `json:"product_price"`
 	ProductType   string         `json:"product_type"`
@@ -25,4 +26,12 @@ type HistoryModel struct {
 	Province      string         `json:"province"`
 	Region        string         `json:"region"`
 	Status        string         `json:"status"`
+	Message       string         `json:"message" gorm:"type:varchar(255)"`
 }
+
+// Status transaksi PPOB: PROSES hanya boleh berubah sekali menjadi SUCCESS atau FAILED
+const (
+	HistoryStatusPending = "PROSES"
+	HistoryStatusSuccess = "SUCCESS"
+	HistoryStatusFailed  = "FAILED"
+)
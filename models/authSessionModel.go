@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// AuthSession - satu sesi login (per device). Access token membawa id sesi ("sid")
+// sehingga sesi yang dicabut langsung ditolak oleh middleware.RequireAuth.
+type AuthSession struct {
+	Id            uint       `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	UserID        uint       `json:"user_id" gorm:"index;not null"`
+	User          User       `json:"-" gorm:"foreignKey:UserID"`
+	UserAgent     string     `json:"user_agent" gorm:"type:varchar(255)"`
+	IPAddress     string     `json:"ip_address" gorm:"type:varchar(64)"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	RevokedAt     *time.Time `json:"revoked_at" gorm:"index"`
+	RevokedReason string     `json:"revoked_reason" gorm:"type:varchar(100)"`
+}
+
+// RefreshToken - refresh token yang dirotasi setiap dipakai. Hanya hash SHA-256 yang disimpan.
+type RefreshToken struct {
+	Id        uint       `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	SessionID uint       `json:"session_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
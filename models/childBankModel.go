@@ -21,6 +21,8 @@ type ChildBank struct {
 	ParentBank   ParentBank     `json:"parent_bank" gorm:"foreignKey:ParentBankID"`
 	Norek        uint           `json:"norek" gorm:"type:char(50);not null"`
 	Balance      int            `json:"balance" gorm:"default:0"`
+	BankServiceArea
+	RegionCodes
 }
 
 // type ChildBankResponse struct {
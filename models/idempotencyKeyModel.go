@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IdempotencyKey - menyimpan hasil request dengan header Idempotency-Key supaya retry dari
+// client mendapat response yang sama tanpa memproses ulang uangnya.
+type IdempotencyKey struct {
+	Id           uint       `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UserID       uint       `json:"user_id" gorm:"uniqueIndex:idx_idempotency_user_key;not null"`
+	Key          string     `json:"key" gorm:"type:varchar(100);uniqueIndex:idx_idempotency_user_key;not null"`
+	Method       string     `json:"method" gorm:"type:varchar(10)"`
+	Path         string     `json:"path" gorm:"type:varchar(255)"`
+	RequestHash  string     `json:"request_hash" gorm:"type:char(64)"`
+	StatusCode   int        `json:"status_code"`
+	ContentType  string     `json:"content_type" gorm:"type:varchar(100)"`
+	ResponseBody []byte     `json:"-" gorm:"type:mediumblob"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
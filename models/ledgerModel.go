@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Jenis akun ledger. Akun yang punya saldo di tabel lain (users, child_banks,
+// companies, donations) ikut diperbarui saat posting, sisanya hanya tercatat di jurnal.
+const (
+	AccountUserWallet       = "user_wallet"       // saldo user (users.balance)
+	AccountChildBankFloat   = "child_bank_float"  // saldo bank pembantu (child_banks.balance)
+	AccountCompanyRevenue   = "company_revenue"   // pendapatan perusahaan (companies.balance)
+	AccountPpobClearing     = "ppob_clearing"     // dana PPOB yang menunggu callback provider
+	AccountDonationEscrow   = "donation_escrow"   // dana donasi terkumpul (donations.current_amount)
+	AccountWithdrawClearing = "withdraw_clearing" // penarikan saldo yang menunggu konfirmasi admin
+	AccountWastePurchase    = "waste_purchase"    // biaya pembelian sampah dari nasabah
+	AccountCash             = "cash"              // uang keluar/masuk rekening bank perusahaan
+	AccountOpeningBalance   = "opening_balance"   // saldo awal sebelum ledger diaktifkan
+)
+
+type LedgerJournal struct {
+	Id          uint          `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	Reference   string        `json:"reference" gorm:"type:varchar(100);index"`
+	Description string        `json:"description" gorm:"type:text"`
+	Entries     []LedgerEntry `json:"entries" gorm:"foreignKey:JournalID"`
+}
+
+// LedgerEntry tidak punya soft delete: jurnal hanya boleh ditambah, koreksi dilakukan dengan jurnal balik.
+type LedgerEntry struct {
+	Id          uint      `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	JournalID   uint      `json:"journal_id" gorm:"index;not null"`
+	AccountType string    `json:"account_type" gorm:"type:varchar(50);index:idx_ledger_account;not null"`
+	AccountID   uint      `json:"account_id" gorm:"index:idx_ledger_account;not null;default:0"`
+	Debit       int       `json:"debit" gorm:"type:bigint;not null;default:0"`
+	Credit      int       `json:"credit" gorm:"type:bigint;not null;default:0"`
+}
@@ -14,4 +14,9 @@ type ParentBank struct {
 	District  string         `json:"district" gorm:"type:varchar(100);not null"`
 	Province  string         `json:"province" gorm:"type:varchar(100);not null"`
 	Address   string         `json:"address" gorm:"type:text;not null"`
+	// Titik awal rute penjemputan, kosong untuk bank induk lama yang belum diisi
+	Latitude  *float64 `json:"latitude" gorm:"type:decimal(10,8)"`
+	Longitude *float64 `json:"longitude" gorm:"type:decimal(11,8)"`
+	BankServiceArea
+	RegionCodes
 }
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Status pembayaran top up lewat payment gateway
+const (
+	PaymentStatusPending = "pending"
+	PaymentStatusPaid    = "paid"
+	PaymentStatusExpired = "expired"
+	PaymentStatusFailed  = "failed"
+)
+
+// Payment - instruksi pembayaran top up (VA/QRIS) untuk satu Transaction. Transaction dikonfirmasi
+// otomatis saat webhook gateway menyatakan lunas.
+type Payment struct {
+	Id            uint         `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	TransactionID uint         `json:"transaction_id" gorm:"uniqueIndex;not null"`
+	Transaction   *Transaction `json:"transaction,omitempty" gorm:"foreignKey:TransactionID"`
+	UserID        uint         `json:"user_id" gorm:"index;not null"`
+	Gateway       string       `json:"gateway" gorm:"type:varchar(30);not null"`
+	Method        string       `json:"method" gorm:"type:varchar(30);not null"`
+	OrderID       string       `json:"order_id" gorm:"type:varchar(100);uniqueIndex;not null"` // dikirim ke gateway
+	ExternalID    *string      `json:"external_id" gorm:"type:varchar(100);uniqueIndex"`       // id dari gateway
+	Amount        int          `json:"amount" gorm:"not null"`
+	Status        string       `json:"status" gorm:"type:varchar(20);index;not null;default:'pending'"`
+	VANumber      string       `json:"va_number,omitempty" gorm:"type:varchar(50)"`
+	QRString      string       `json:"qr_string,omitempty" gorm:"type:text"`
+	ExpiresAt     time.Time    `json:"expires_at" gorm:"index"`
+	PaidAt        *time.Time   `json:"paid_at"`
+	FailureReason string       `json:"failure_reason,omitempty" gorm:"type:varchar(255)"`
+}
+
+// PaymentWebhookLog - semua webhook payment gateway disimpan apa adanya untuk audit, Result memakai
+// konstanta CallbackResult*
+type PaymentWebhookLog struct {
+	Id        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Gateway   string    `json:"gateway" gorm:"type:varchar(30)"`
+	OrderID   string    `json:"order_id" gorm:"type:varchar(100);index"`
+	Status    string    `json:"status" gorm:"type:varchar(20)"`
+	SignValid bool      `json:"sign_valid"`
+	Result    string    `json:"result" gorm:"type:varchar(30);index"`
+	Error     string    `json:"error" gorm:"type:text"`
+	RemoteIP  string    `json:"remote_ip" gorm:"type:varchar(64)"`
+	RawBody   string    `json:"raw_body" gorm:"type:text"`
+}
@@ -6,6 +6,28 @@ import (
 	"gorm.io/gorm"
 )
 
+// Status penjemputan
+const (
+	PickupStatusPending   = "pending"    // menunggu konfirmasi bank
+	PickupStatusConfirmed = "confirm"    // dikonfirmasi bank, belum ada petugas
+	PickupStatusAssigned  = "assigned"   // petugas penjemput sudah ditunjuk
+	PickupStatusOnTheWay  = "on_the_way" // petugas berangkat menjemput
+	PickupStatusCompleted = "complete"
+	PickupStatusRejected  = "reject"
+	PickupStatusCancelled = "cancelled" // dibatalkan user atau bank
+)
+
+// pickupTransitions - perpindahan status yang diizinkan
+var pickupTransitions = map[string][]string{
+	PickupStatusPending:   {PickupStatusConfirmed, PickupStatusRejected, PickupStatusCancelled},
+	PickupStatusConfirmed: {PickupStatusAssigned, PickupStatusRejected, PickupStatusCancelled},
+	PickupStatusAssigned:  {PickupStatusAssigned, PickupStatusOnTheWay, PickupStatusConfirmed, PickupStatusCancelled},
+	PickupStatusOnTheWay:  {PickupStatusCompleted, PickupStatusAssigned},
+}
+
+// PickupActiveStatuses - status yang masih memakai kapasitas slot
+var PickupActiveStatuses = []string{PickupStatusPending, PickupStatusConfirmed, PickupStatusAssigned, PickupStatusOnTheWay}
+
 type PickupRequest struct {
 	Id        uint           `json:"id" gorm:"primarykey"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -22,8 +44,80 @@ type PickupRequest struct {
 	ParentBankID *uint       `json:"-"`
 	ParentBank   *ParentBank `json:"parent_bank" gorm:"foreignKey:ParentBankID"`
 
-	// Data sederhana - hanya koordinat dan status
 	Latitude  float64 `json:"latitude" gorm:"type:decimal(10,8);not null"`
 	Longitude float64 `json:"longitude" gorm:"type:decimal(11,8);not null"`
-	Status    string  `json:"status" gorm:"type:enum('pending','confirm','complete','reject');default:'pending'"`
+	Status    string  `json:"status" gorm:"type:varchar(20);index;default:'pending'"`
+
+	// Jadwal: slot bank atau tanggal/jam yang diminta user jika bank belum membuat slot
+	SlotID          *uint       `json:"slot_id" gorm:"index"`
+	Slot            *PickupSlot `json:"slot,omitempty" gorm:"foreignKey:SlotID"`
+	PickupDate      *time.Time  `json:"pickup_date" gorm:"type:date;index"`
+	WindowStart     string      `json:"window_start" gorm:"type:varchar(5)"` // HH:MM
+	WindowEnd       string      `json:"window_end" gorm:"type:varchar(5)"`
+	RescheduleCount int         `json:"reschedule_count" gorm:"default:0"`
+
+	// Petugas penjemput, user di bawah bank tujuan
+	CollectorID *uint      `json:"collector_id" gorm:"index"`
+	Collector   *User      `json:"collector,omitempty" gorm:"foreignKey:CollectorID"`
+	AssignedAt  *time.Time `json:"assigned_at"`
+
+	// Posisi terakhir petugas selama penjemputan, dikirim dari aplikasi petugas
+	CollectorLatitude   *float64   `json:"collector_latitude" gorm:"type:decimal(10,8)"`
+	CollectorLongitude  *float64   `json:"collector_longitude" gorm:"type:decimal(11,8)"`
+	CollectorLocationAt *time.Time `json:"collector_location_at"`
+
+	Notes          string              `json:"notes" gorm:"type:text"`     // catatan dari user, misal patokan rumah
+	BankNote       string              `json:"bank_note" gorm:"type:text"` // catatan operator bank
+	CancelReason   string              `json:"cancel_reason" gorm:"type:text"`
+	CancelledAt    *time.Time          `json:"cancelled_at"`
+	EstimatedItems []PickupRequestItem `json:"estimated_items" gorm:"foreignKey:PickupRequestID"`
+
+	// Setoran hasil timbang saat penjemputan selesai, saldo user bertambah dari setoran ini
+	CompletedAt  *time.Time    `json:"completed_at"`
+	WasteDeposit *WasteDeposit `json:"waste_deposit,omitempty" gorm:"foreignKey:PickupRequestID"`
+}
+
+// CanTransitionTo - cek perpindahan status sesuai alur penjemputan
+func (p PickupRequest) CanTransitionTo(status string) bool {
+	for _, next := range pickupTransitions[p.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// PickupStatusFinal - status akhir yang tidak bisa berubah lagi (complete, reject, cancelled)
+func PickupStatusFinal(status string) bool {
+	return len(pickupTransitions[status]) == 0
+}
+
+// PickupRequestItem - perkiraan sampah yang akan dijemput, diisi user saat request
+type PickupRequestItem struct {
+	Id              uint          `json:"id" gorm:"primarykey"`
+	CreatedAt       time.Time     `json:"created_at"`
+	PickupRequestID uint          `json:"pickup_request_id" gorm:"index;not null"`
+	ProductWasteID  uint          `json:"product_waste_id" gorm:"not null"`
+	ProductWaste    *ProductWaste `json:"product_waste,omitempty" gorm:"foreignKey:ProductWasteID"`
+	EstimatedWeight float64       `json:"estimated_weight" gorm:"type:decimal(10,2);not null"`
+	Unit            string        `json:"unit" gorm:"type:varchar(20);not null"`
+}
+
+// PickupSlot - jadwal penjemputan yang dibuka bank pada tanggal dan jam tertentu dengan kapasitas
+// jumlah request. BankKey ("parent:1"/"child:3") membedakan bank pemilik slot.
+type PickupSlot struct {
+	Id           uint      `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	BankKey      string    `json:"bank_key" gorm:"type:varchar(30);not null;uniqueIndex:idx_pickup_slot"`
+	ParentBankID *uint     `json:"parent_bank_id" gorm:"index"`
+	ChildBankID  *uint     `json:"child_bank_id" gorm:"index"`
+	Date         time.Time `json:"date" gorm:"type:date;not null;uniqueIndex:idx_pickup_slot"`
+	StartTime    string    `json:"start_time" gorm:"type:varchar(5);not null;uniqueIndex:idx_pickup_slot"` // HH:MM
+	EndTime      string    `json:"end_time" gorm:"type:varchar(5);not null"`
+	Capacity     int       `json:"capacity" gorm:"not null"`
+	IsActive     bool      `json:"is_active" gorm:"default:true"`
+	Note         string    `json:"note" gorm:"type:varchar(255)"`
+	CreatedBy    *uint     `json:"created_by"`
+	Booked       int       `json:"booked" gorm:"-"` // jumlah request aktif, diisi saat listing
 }
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Hasil pemrosesan callback PPOB
+const (
+	CallbackResultProcessed        = "processed"
+	CallbackResultDuplicate        = "duplicate"
+	CallbackResultInvalidSignature = "invalid_signature"
+	CallbackResultNotFound         = "not_found"
+	CallbackResultIgnored          = "ignored"
+	CallbackResultError            = "error"
+)
+
+// Asal pemrosesan: callback dari provider atau reconciler yang cek status sendiri
+const (
+	CallbackSourceCallback   = "callback"
+	CallbackSourceReconciler = "reconciler"
+)
+
+// PpobCallbackLog - semua callback yang masuk dari provider PPOB disimpan apa adanya untuk audit
+type PpobCallbackLog struct {
+	Id        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Source    string    `json:"source" gorm:"type:varchar(20);default:'callback'"`
+	RefID     string    `json:"ref_id" gorm:"type:varchar(100);index"`
+	Status    string    `json:"status" gorm:"type:varchar(10)"`
+	RC        string    `json:"rc" gorm:"type:varchar(10)"`
+	Message   string    `json:"message" gorm:"type:varchar(255)"`
+	SignValid bool      `json:"sign_valid"`
+	Result    string    `json:"result" gorm:"type:varchar(30);index"`
+	Error     string    `json:"error" gorm:"type:text"`
+	RemoteIP  string    `json:"remote_ip" gorm:"type:varchar(64)"`
+	RawBody   string    `json:"raw_body" gorm:"type:text"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PpobInquiry - hasil inquiry tagihan pascabayar. Harga yang ditampilkan ke user disimpan di sini
+// supaya pembayaran dengan tr_id yang sama memotong nominal yang persis sama, dan saldo bisa
+// ditahan sebelum tagihan dibayar ke provider.
+type PpobInquiry struct {
+	Id           uint      `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	TrID         string    `json:"tr_id" gorm:"type:varchar(100);uniqueIndex;not null"` // dari provider
+	UserID       uint      `json:"user_id" gorm:"index"`                                // user yang melakukan inquiry
+	Code         string    `json:"code" gorm:"type:varchar(50)"`
+	Hp           string    `json:"hp" gorm:"type:varchar(50)"`
+	BasePrice    int       `json:"base_price" gorm:"not null"`    // price provider, sudah termasuk admin
+	SellingPrice int       `json:"selling_price" gorm:"not null"` // BasePrice + margin, yang dibayar user
+	Data         string    `json:"-" gorm:"type:text"`            // response inquiry apa adanya (JSON)
+}
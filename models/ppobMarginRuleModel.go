@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Mode margin PPOB
+const (
+	MarginTypePercent = "percent" // Value dalam persen dari harga provider
+	MarginTypeFlat    = "flat"    // Value dalam rupiah per transaksi
+)
+
+// PpobMarginRule - aturan margin PPOB. Kolom filter yang kosong berarti berlaku untuk semua,
+// aturan yang paling spesifik (product_code > operator > category) yang dipakai.
+type PpobMarginRule struct {
+	Id             uint           `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	Name           string         `json:"name" gorm:"type:varchar(100)"`
+	Category       string         `json:"category" gorm:"type:varchar(50);index"` // pulsa, data, pln, etoll, game, voucher, bpjs, pdam, ...
+	Operator       string         `json:"operator" gorm:"type:varchar(100)"`      // telkomsel, ovo, mobile_legend, ...
+	ProductCode    string         `json:"product_code" gorm:"type:varchar(100);index"`
+	Type           string         `json:"type" gorm:"type:enum('percent','flat');default:'percent';not null"`
+	Value          float64        `json:"value" gorm:"not null;default:0"`
+	MinMargin      *int           `json:"min_margin"`
+	MaxMargin      *int           `json:"max_margin"`
+	EffectiveFrom  *time.Time     `json:"effective_from"`
+	EffectiveUntil *time.Time     `json:"effective_until"`
+	IsActive       bool           `json:"is_active" gorm:"default:true"`
+}
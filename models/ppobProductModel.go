@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// Jenis katalog PPOB
+const (
+	PpobKindPrepaid  = "prepaid"
+	PpobKindPostpaid = "postpaid"
+)
+
+// Status produk di katalog
+const (
+	PpobProductActive   = "active"
+	PpobProductInactive = "inactive"
+)
+
+// Pemicu sinkronisasi katalog
+const (
+	CatalogSyncTriggerSchedule = "schedule"
+	CatalogSyncTriggerManual   = "manual"
+)
+
+// Status sinkronisasi katalog
+const (
+	CatalogSyncRunning = "running"
+	CatalogSyncSuccess = "success"
+	CatalogSyncFailed  = "failed"
+)
+
+// Jenis perubahan produk antar sinkronisasi
+const (
+	CatalogChangeAdded         = "added"
+	CatalogChangeRemoved       = "removed"
+	CatalogChangePriceChanged  = "price_changed"
+	CatalogChangeStatusChanged = "status_changed"
+)
+
+// PpobProduct - cache pricelist provider. Price adalah harga provider sebelum margin,
+// untuk pascabayar berisi biaya admin (fee) karena tagihan baru diketahui saat inquiry.
+type PpobProduct struct {
+	Id                 uint       `json:"id" gorm:"primarykey"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	Kind               string     `json:"kind" gorm:"type:varchar(20);not null;uniqueIndex:idx_ppob_product_kind_code"`
+	ProductCode        string     `json:"product_code" gorm:"type:varchar(100);not null;uniqueIndex:idx_ppob_product_kind_code"`
+	ProductDescription string     `json:"product_description" gorm:"type:varchar(255)"`
+	ProductNominal     string     `json:"product_nominal" gorm:"type:varchar(100)"`
+	ProductDetails     string     `json:"product_details" gorm:"type:text"`
+	ProductType        string     `json:"product_type" gorm:"type:varchar(50);index"`
+	ProductCategory    string     `json:"product_category" gorm:"type:varchar(100);index"`
+	Operator           string     `json:"operator" gorm:"type:varchar(100);index"` // helpers.PpobOperatorKey(ProductDescription)
+	ActivePeriod       string     `json:"active_period" gorm:"type:varchar(50)"`
+	IconURL            string     `json:"icon_url" gorm:"type:varchar(255)"`
+	Province           string     `json:"province" gorm:"type:varchar(100)"`
+	Price              float64    `json:"price"`
+	Commission         float64    `json:"commission"`
+	Status             string     `json:"status" gorm:"type:varchar(20);index"`
+	LastSyncID         uint       `json:"last_sync_id"`
+	LastSyncedAt       time.Time  `json:"last_synced_at"`
+	RemovedAt          *time.Time `json:"removed_at"` // tidak ada lagi di pricelist provider
+}
+
+// PpobCatalogSync - satu kali sinkronisasi katalog beserta ringkasan perubahannya
+type PpobCatalogSync struct {
+	Id            uint                `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	Kind          string              `json:"kind" gorm:"type:varchar(20);index"`
+	Trigger       string              `json:"trigger" gorm:"type:varchar(20)"`
+	TriggeredBy   *uint               `json:"triggered_by"`
+	Status        string              `json:"status" gorm:"type:varchar(20)"`
+	Error         string              `json:"error" gorm:"type:text"`
+	Total         int                 `json:"total"`
+	Added         int                 `json:"added"`
+	Removed       int                 `json:"removed"`
+	PriceChanged  int                 `json:"price_changed"`
+	StatusChanged int                 `json:"status_changed"`
+	FinishedAt    *time.Time          `json:"finished_at"`
+	Changes       []PpobCatalogChange `json:"changes,omitempty" gorm:"foreignKey:SyncID"`
+}
+
+// PpobCatalogChange - perubahan satu produk dibanding sinkronisasi sebelumnya
+type PpobCatalogChange struct {
+	Id                 uint      `json:"id" gorm:"primarykey"`
+	CreatedAt          time.Time `json:"created_at"`
+	SyncID             uint      `json:"sync_id" gorm:"index"`
+	ProductCode        string    `json:"product_code" gorm:"type:varchar(100);index"`
+	ProductDescription string    `json:"product_description" gorm:"type:varchar(255)"`
+	Change             string    `json:"change" gorm:"type:varchar(20)"`
+	OldPrice           float64   `json:"old_price"`
+	NewPrice           float64   `json:"new_price"`
+	OldStatus          string    `json:"old_status" gorm:"type:varchar(20)"`
+	NewStatus          string    `json:"new_status" gorm:"type:varchar(20)"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Level harga sampah, dari yang paling umum
+const (
+	WastePriceLevelDefault    = "default"
+	WastePriceLevelParentBank = "parent_bank"
+	WastePriceLevelChildBank  = "child_bank"
+)
+
+// ProductWastePrice - riwayat harga beli sampah. Harga yang berlaku adalah baris dengan
+// effective_from terbaru yang sudah lewat; baris dengan effective_from di masa depan adalah jadwal.
+// Tanpa bank berarti harga default company, ParentBankID/ChildBankID berarti override bank tersebut.
+type ProductWastePrice struct {
+	Id             uint           `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+	ProductWasteID uint           `json:"product_waste_id" gorm:"index:idx_product_waste_price_effective;not null"`
+	ParentBankID   *uint          `json:"parent_bank_id" gorm:"index"`
+	ChildBankID    *uint          `json:"child_bank_id" gorm:"index"`
+	Price          int            `json:"price" gorm:"type:int;not null"`
+	EffectiveFrom  time.Time      `json:"effective_from" gorm:"index:idx_product_waste_price_effective;not null"`
+	Note           string         `json:"note" gorm:"type:varchar(255)"`
+	CreatedBy      *uint          `json:"created_by"`
+}
@@ -1,8 +1,39 @@
 package models
 
+import "time"
+
 type RegionResponse struct {
 	Id        string  `json:"id"`
 	Name      string  `json:"nama"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 }
+
+// Tingkat wilayah administrasi BPS
+const (
+	RegionLevelProvince    = "province"    // provinsi, 2 digit
+	RegionLevelDistrict    = "district"    // kabupaten/kota, 4 digit
+	RegionLevelSubdistrict = "subdistrict" // kecamatan, 6-7 digit
+	RegionLevelVillage     = "village"     // kelurahan/desa, 10 digit
+)
+
+// Region - wilayah administrasi dari dataset BPS, kode disimpan tanpa titik
+type Region struct {
+	Code       string    `json:"code" gorm:"primaryKey;type:varchar(13)"`
+	ParentCode *string   `json:"parent_code" gorm:"type:varchar(13);index"`
+	Level      string    `json:"level" gorm:"type:varchar(12);index"`
+	Name       string    `json:"name" gorm:"type:varchar(150);index"`
+	Latitude   *float64  `json:"latitude" gorm:"type:decimal(10,8)"`
+	Longitude  *float64  `json:"longitude" gorm:"type:decimal(11,8)"`
+	IsActive   bool      `json:"is_active" gorm:"default:true;index"` // false jika hilang dari dataset terbaru
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// RegionCodes - kode wilayah yang ditautkan ke bank dan user, kolom teks lama tetap diisi nama wilayah
+type RegionCodes struct {
+	ProvinceCode    *string `json:"province_code" gorm:"type:varchar(13);index"`
+	DistrictCode    *string `json:"district_code" gorm:"type:varchar(13);index"`
+	SubdistrictCode *string `json:"subdistrict_code" gorm:"type:varchar(13);index"`
+	VillageCode     *string `json:"village_code" gorm:"type:varchar(13);index"`
+}
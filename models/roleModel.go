@@ -14,3 +14,12 @@ type Role struct {
 	Name      string         `json:"name" gorm:"type:varchar(50);unique;not null"`
 }
 
+
+// Nama role sesuai seeders.SeedRole
+const (
+	RoleAdmin      = "admin"
+	RoleUser       = "user"
+	RoleParentBank = "parent bank"
+	RoleChildBank  = "child bank"
+	RolePartner    = "partner"
+)
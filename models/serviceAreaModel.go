@@ -0,0 +1,14 @@
+package models
+
+import "encoding/json"
+
+// BankServiceArea - wilayah layanan bank dalam GeoJSON (Polygon/MultiPolygon, urutan [lng, lat]).
+// Bounding box disimpan terpisah untuk menyaring kandidat di database sebelum cek point-in-polygon.
+// Kosong berarti bank belum menggambar wilayah dan masih memakai pencarian radius.
+type BankServiceArea struct {
+	ServiceArea json.RawMessage `json:"service_area" gorm:"type:json"`
+	AreaMinLat  *float64        `json:"-" gorm:"type:decimal(10,8)"`
+	AreaMaxLat  *float64        `json:"-" gorm:"type:decimal(10,8)"`
+	AreaMinLng  *float64        `json:"-" gorm:"type:decimal(11,8)"`
+	AreaMaxLng  *float64        `json:"-" gorm:"type:decimal(11,8)"`
+}
@@ -15,7 +15,7 @@ type Transaction struct {
 	User      User           `json:"data_user" gorm:"foreignkey:UserID"`
 	Balance   int            `json:"balance" gorm:"not null"`
 	Type      string         `json:"type" gorm:"type:enum('topup', 'withdraw')"`
-	Status    string         `json:"status" gorm:"type:enum('pending', 'confirm', 'reject')"`
+	Status    string         `json:"status" gorm:"type:enum('pending', 'confirm', 'reject', 'expired')"`
 	Desc      string         `json:"desc" grom:"text"`
 	AdminID   *uint          `json:"-"`
 	Admin     *User          `json:"data_admin" gorm:"foreignkey:AdminID"`
@@ -32,4 +32,5 @@ type User struct {
 	Balance      int            `json:"balance" gorm:"default:0"`
 	ChildBankID  *uint          `json:"-"`
 	ChildBank    *ChildBank     `json:"child_bank" gorm:"foreignKey:ChildBankID"`
+	RegionCodes
 }
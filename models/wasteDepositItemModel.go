@@ -18,6 +18,10 @@ type WasteDepositItem struct {
 	Category       string         `json:"category" gorm:"type:enum('organik','anorganik');not null"`
 	Weight         float64        `json:"weight" gorm:"type:decimal(10,2);not null"`
 	Unit           string         `json:"unit" gorm:"type:varchar(20);not null"` // kg, ons, etc
-	SubTotal       int            `json:"sub_total" gorm:"type:int;not null"`
-	Photo          string         `json:"photo" gorm:"type:varchar(255)"`
+	// Snapshot harga saat setoran, tidak berubah walaupun harga produk diubah
+	UnitPrice        int     `json:"unit_price" gorm:"type:int;not null;default:0"`                  // harga per PriceUnit
+	PriceUnit        string  `json:"price_unit" gorm:"type:varchar(20)"`                             // satuan harga produk
+	NormalizedWeight float64 `json:"normalized_weight" gorm:"type:decimal(12,3);not null;default:0"` // Weight dalam PriceUnit
+	SubTotal         int     `json:"sub_total" gorm:"type:int;not null"`
+	Photo            string  `json:"photo" gorm:"type:varchar(255)"`
 }
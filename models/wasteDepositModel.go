@@ -6,19 +6,32 @@ import (
 	"gorm.io/gorm"
 )
 
+// Status setoran. Setoran yang dibatalkan tetap disimpan untuk audit, saldo dan stoknya sudah dibalik.
+const (
+	DepositStatusActive = "active"
+	DepositStatusVoided = "voided"
+)
+
 type WasteDeposit struct {
-	Id           uint               `json:"id" gorm:"primarykey"`
-	CreatedAt    time.Time          `json:"created_at"`
-	UpdatedAt    time.Time          `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt     `json:"deleted_at" gorm:"index"`
-	UserID       uint               `json:"-"`
-	User         User               `json:"user" gorm:"foreignKey:UserID"`
-	ChildBankID  *uint              `json:"-"`
-	ChildBank    *ChildBank         `json:"child_bank" gorm:"foreignKey:ChildBankID"`
-	ParentBankID *uint              `json:"-"`
-	ParentBank   *ParentBank        `json:"parent_bank" gorm:"foreignKey:ParentBankID"`
-	TotalWeight  float64            `json:"total_weight" gorm:"type:decimal(10,2);not null"`
-	TotalPrice   int                `json:"total_price" gorm:"type:int;not null"`
-	ReferenceID  string             `json:"reference_id" gorm:"type:varchar(100);uniqueIndex"`
-	Items        []WasteDepositItem `json:"items" gorm:"foreignKey:WasteDepositID"`
+	Id           uint           `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	UserID       uint           `json:"-"`
+	User         User           `json:"user" gorm:"foreignKey:UserID"`
+	ChildBankID  *uint          `json:"-"`
+	ChildBank    *ChildBank     `json:"child_bank" gorm:"foreignKey:ChildBankID"`
+	ParentBankID *uint          `json:"-"`
+	ParentBank   *ParentBank    `json:"parent_bank" gorm:"foreignKey:ParentBankID"`
+	TotalWeight  float64        `json:"total_weight" gorm:"type:decimal(10,2);not null"`
+	TotalPrice   int            `json:"total_price" gorm:"type:int;not null"`
+	ReferenceID  string         `json:"reference_id" gorm:"type:varchar(100);uniqueIndex"`
+	// Penjemputan yang menghasilkan setoran ini, kosong untuk setoran langsung di bank
+	PickupRequestID *uint              `json:"pickup_request_id" gorm:"uniqueIndex"`
+	Status          string             `json:"status" gorm:"type:varchar(20);index;not null;default:'active'"`
+	Revision        int                `json:"revision" gorm:"not null;default:1"` // nomor revisi terakhir
+	VoidReason      string             `json:"void_reason,omitempty" gorm:"type:text"`
+	VoidedAt        *time.Time         `json:"voided_at,omitempty"`
+	VoidedBy        *uint              `json:"voided_by,omitempty"`
+	Items           []WasteDepositItem `json:"items" gorm:"foreignKey:WasteDepositID"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Jenis perubahan setoran
+const (
+	DepositRevisionCreate = "create"
+	DepositRevisionAmend  = "amend"
+	DepositRevisionVoid   = "void"
+)
+
+// WasteDepositRevision - riwayat perubahan setoran, hanya ditambah. Items menyimpan snapshot item
+// (termasuk URL foto asli) sebelum dan sesudah perubahan.
+type WasteDepositRevision struct {
+	Id                uint            `json:"id" gorm:"primarykey"`
+	CreatedAt         time.Time       `json:"created_at"`
+	WasteDepositID    uint            `json:"waste_deposit_id" gorm:"uniqueIndex:idx_deposit_revision;not null"`
+	Revision          int             `json:"revision" gorm:"uniqueIndex:idx_deposit_revision;not null"`
+	Action            string          `json:"action" gorm:"type:varchar(20);not null"`
+	Reason            string          `json:"reason" gorm:"type:text"`
+	TotalWeightBefore float64         `json:"total_weight_before" gorm:"type:decimal(10,2);not null;default:0"`
+	TotalWeightAfter  float64         `json:"total_weight_after" gorm:"type:decimal(10,2);not null;default:0"`
+	TotalPriceBefore  int             `json:"total_price_before" gorm:"type:int;not null;default:0"`
+	TotalPriceAfter   int             `json:"total_price_after" gorm:"type:int;not null;default:0"`
+	BalanceDelta      int             `json:"balance_delta" gorm:"type:int;not null;default:0"` // perubahan saldo user
+	ItemsBefore       json.RawMessage `json:"items_before" gorm:"type:json"`
+	ItemsAfter        json.RawMessage `json:"items_after" gorm:"type:json"`
+	CreatedBy         *uint           `json:"created_by"`
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Status order penjualan sampah ke offtaker
+const (
+	SaleStatusOrdered   = "ordered"   // order dibuat, barang belum dikirim
+	SaleStatusDelivered = "delivered" // barang diterima offtaker, stok keluar dan tagihan terbit
+	SaleStatusCancelled = "cancelled"
+)
+
+// Status pembayaran tagihan penjualan
+const (
+	SalePaymentUnpaid  = "unpaid"
+	SalePaymentPartial = "partial"
+	SalePaymentPaid    = "paid"
+)
+
+// Offtaker - pembeli sampah terpilah (pengepul plastik, kertas, logam). ParentBankID kosong berarti
+// offtaker umum yang bisa dipakai semua bank induk.
+type Offtaker struct {
+	Id           uint           `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	ParentBankID *uint          `json:"parent_bank_id" gorm:"index"`
+	Name         string         `json:"name" gorm:"type:varchar(150);not null"`
+	ContactName  string         `json:"contact_name" gorm:"type:varchar(100)"`
+	Phone        string         `json:"phone" gorm:"type:varchar(30)"`
+	Email        string         `json:"email" gorm:"type:varchar(100)"`
+	Address      string         `json:"address" gorm:"type:text"`
+	Materials    string         `json:"materials" gorm:"type:varchar(255)"` // jenis sampah yang dibeli, misal "plastik, kertas"
+	IsActive     bool           `json:"is_active" gorm:"default:true"`
+}
+
+// WasteSale - order penjualan sampah dari bank induk ke offtaker. Saat pengiriman dikonfirmasi,
+// stok bank induk berkurang, tagihan (InvoiceAmount) terbit dan harga beli dari nasabah dicatat
+// sebagai CostAmount untuk laporan laba.
+type WasteSale struct {
+	Id            uint               `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+	ReferenceID   string             `json:"reference_id" gorm:"type:varchar(100);uniqueIndex"`
+	InvoiceNumber string             `json:"invoice_number" gorm:"type:varchar(100);index"`
+	ParentBankID  uint               `json:"parent_bank_id" gorm:"index;not null"`
+	ParentBank    *ParentBank        `json:"parent_bank,omitempty" gorm:"foreignKey:ParentBankID"`
+	OfftakerID    uint               `json:"offtaker_id" gorm:"index;not null"`
+	Offtaker      *Offtaker          `json:"offtaker,omitempty" gorm:"foreignKey:OfftakerID"`
+	Status        string             `json:"status" gorm:"type:varchar(20);index;not null"`
+	PaymentStatus string             `json:"payment_status" gorm:"type:varchar(20);index;not null"`
+	OrderTotal    int                `json:"order_total" gorm:"type:int;not null;default:0"`    // nilai order sesuai jumlah pesanan
+	InvoiceAmount int                `json:"invoice_amount" gorm:"type:int;not null;default:0"` // nilai tagihan sesuai berat terkirim
+	PaidAmount    int                `json:"paid_amount" gorm:"type:int;not null;default:0"`
+	CostAmount    int                `json:"cost_amount" gorm:"type:int;not null;default:0"` // harga beli dari nasabah untuk berat terkirim
+	Note          string             `json:"note" gorm:"type:text"`
+	CreatedBy     *uint              `json:"created_by"`
+	DeliveredAt   *time.Time         `json:"delivered_at" gorm:"index"`
+	CancelledAt   *time.Time         `json:"cancelled_at"`
+	Items         []WasteSaleItem    `json:"items" gorm:"foreignKey:SaleID"`
+	Payments      []WasteSalePayment `json:"payments,omitempty" gorm:"foreignKey:SaleID"`
+}
+
+// WasteSaleItem - jumlah dipesan dan terkirim dalam satuan harga produk
+type WasteSaleItem struct {
+	Id                uint          `json:"id" gorm:"primarykey"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
+	SaleID            uint          `json:"sale_id" gorm:"index;not null"`
+	ProductWasteID    uint          `json:"product_waste_id" gorm:"index;not null"`
+	ProductWaste      *ProductWaste `json:"product_waste,omitempty" gorm:"foreignKey:ProductWasteID"`
+	Quantity          float64       `json:"quantity" gorm:"type:decimal(14,3);not null"`
+	DeliveredQuantity *float64      `json:"delivered_quantity" gorm:"type:decimal(14,3)"`
+	Unit              string        `json:"unit" gorm:"type:varchar(20);not null"`
+	UnitPrice         int           `json:"unit_price" gorm:"type:int;not null"` // harga jual per Unit
+	SubTotal          int           `json:"sub_total" gorm:"type:int;not null;default:0"`
+	CostUnitPrice     float64       `json:"cost_unit_price" gorm:"type:decimal(14,2);not null;default:0"` // rata-rata harga beli per Unit
+	CostAmount        int           `json:"cost_amount" gorm:"type:int;not null;default:0"`
+}
+
+// WasteSalePayment - pembayaran dari offtaker, masuk ke pendapatan perusahaan lewat ledger
+type WasteSalePayment struct {
+	Id        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	SaleID    uint      `json:"sale_id" gorm:"index;not null"`
+	Reference string    `json:"reference" gorm:"type:varchar(100);uniqueIndex"`
+	Amount    int       `json:"amount" gorm:"type:int;not null"`
+	Method    string    `json:"method" gorm:"type:varchar(50)"` // transfer, tunai, dll
+	PaidAt    time.Time `json:"paid_at"`
+	Note      string    `json:"note" gorm:"type:text"`
+	CreatedBy *uint     `json:"created_by"`
+}
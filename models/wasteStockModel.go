@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Jenis pergerakan stok sampah
+const (
+	StockMovementDeposit     = "deposit"      // setoran nasabah masuk ke bank
+	StockMovementDepositVoid = "deposit_void" // setoran dibatalkan/dikoreksi
+	StockMovementTransferOut = "transfer_out" // dikirim dari bank unit ke bank induk
+	StockMovementTransferIn  = "transfer_in"  // diterima bank induk dari bank unit
+	StockMovementSale        = "sale"         // dijual ke pengepul/offtaker
+	StockMovementAdjustment  = "adjustment"   // koreksi stok opname, susut, hilang
+)
+
+// WasteStock - stok satu jenis sampah di satu bank. Stok bank unit menyimpan ParentBankID bank induknya
+// supaya filter per bank induk ikut mencakup unit di bawahnya; BankKey membedakan pemilik stok.
+type WasteStock struct {
+	Id             uint          `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	BankKey        string        `json:"bank_key" gorm:"type:varchar(30);not null;uniqueIndex:idx_waste_stock_bank_product"` // "parent:1" atau "child:3"
+	ParentBankID   *uint         `json:"parent_bank_id" gorm:"index"`
+	ChildBankID    *uint         `json:"child_bank_id" gorm:"index"`
+	ProductWasteID uint          `json:"product_waste_id" gorm:"not null;uniqueIndex:idx_waste_stock_bank_product"`
+	ProductWaste   *ProductWaste `json:"product_waste,omitempty" gorm:"foreignKey:ProductWasteID"`
+	Quantity       float64       `json:"quantity" gorm:"type:decimal(14,3);not null;default:0"`
+	Unit           string        `json:"unit" gorm:"type:varchar(20);not null"`
+}
+
+// WasteStockMovement - jurnal stok, hanya ditambah. Quantity bertanda: positif masuk, negatif keluar.
+type WasteStockMovement struct {
+	Id             uint          `json:"id" gorm:"primarykey"`
+	CreatedAt      time.Time     `json:"created_at"`
+	StockID        uint          `json:"stock_id" gorm:"index;not null"`
+	BankKey        string        `json:"bank_key" gorm:"type:varchar(30);index;not null"`
+	ParentBankID   *uint         `json:"parent_bank_id" gorm:"index"`
+	ChildBankID    *uint         `json:"child_bank_id" gorm:"index"`
+	ProductWasteID uint          `json:"product_waste_id" gorm:"index;not null"`
+	ProductWaste   *ProductWaste `json:"product_waste,omitempty" gorm:"foreignKey:ProductWasteID"`
+	Type           string        `json:"type" gorm:"type:varchar(20);index;not null"`
+	Quantity       float64       `json:"quantity" gorm:"type:decimal(14,3);not null"`
+	BalanceAfter   float64       `json:"balance_after" gorm:"type:decimal(14,3);not null"`
+	Unit           string        `json:"unit" gorm:"type:varchar(20);not null"`
+	Reference      string        `json:"reference" gorm:"type:varchar(100);index"`
+	Note           string        `json:"note" gorm:"type:varchar(255)"`
+	CreatedBy      *uint         `json:"created_by"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Status dokumen transfer sampah bank unit → bank induk
+const (
+	TransferStatusPending   = "pending"
+	TransferStatusConfirmed = "confirmed"
+	TransferStatusRejected  = "rejected"
+	TransferStatusCancelled = "cancelled"
+)
+
+// WasteTransfer - penyerahan sampah dari bank unit ke bank induknya. Dibuat bank unit, lalu
+// dikonfirmasi (boleh dengan penyesuaian jumlah/harga) atau ditolak bank induk.
+// Konfirmasi memindahkan stok dan mengkredit saldo bank unit (child_banks.balance) lewat ledger.
+type WasteTransfer struct {
+	Id           uint                `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	ReferenceID  string              `json:"reference_id" gorm:"type:varchar(100);uniqueIndex"`
+	ChildBankID  uint                `json:"child_bank_id" gorm:"index;not null"`
+	ChildBank    *ChildBank          `json:"child_bank,omitempty" gorm:"foreignKey:ChildBankID"`
+	ParentBankID uint                `json:"parent_bank_id" gorm:"index;not null"`
+	ParentBank   *ParentBank         `json:"parent_bank,omitempty" gorm:"foreignKey:ParentBankID"`
+	Status       string              `json:"status" gorm:"type:varchar(20);index;not null"`
+	Note         string              `json:"note" gorm:"type:text"`
+	ResponseNote string              `json:"response_note" gorm:"type:text"` // alasan penyesuaian/penolakan dari bank induk
+	Adjusted     bool                `json:"adjusted"`                       // bank induk mengubah jumlah atau harga
+	TotalPrice   int                 `json:"total_price" gorm:"type:int;not null;default:0"`
+	PaidAmount   int                 `json:"paid_amount" gorm:"type:int;not null;default:0"` // total yang dikredit ke bank unit
+	CreatedBy    *uint               `json:"created_by"`
+	ProcessedBy  *uint               `json:"processed_by"`
+	ProcessedAt  *time.Time          `json:"processed_at"`
+	Items        []WasteTransferItem `json:"items" gorm:"foreignKey:TransferID"`
+}
+
+// WasteTransferItem - jumlah dan harga yang diajukan bank unit, serta yang diterima bank induk
+type WasteTransferItem struct {
+	Id                uint          `json:"id" gorm:"primarykey"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
+	TransferID        uint          `json:"transfer_id" gorm:"index;not null"`
+	ProductWasteID    uint          `json:"product_waste_id" gorm:"not null"`
+	ProductWaste      *ProductWaste `json:"product_waste,omitempty" gorm:"foreignKey:ProductWasteID"`
+	Quantity          float64       `json:"quantity" gorm:"type:decimal(14,3);not null"` // dalam Unit
+	Unit              string        `json:"unit" gorm:"type:varchar(20);not null"`
+	UnitPrice         int           `json:"unit_price" gorm:"type:int;not null"`
+	SubTotal          int           `json:"sub_total" gorm:"type:int;not null"`
+	AcceptedQuantity  *float64      `json:"accepted_quantity" gorm:"type:decimal(14,3)"`
+	AcceptedUnitPrice *int          `json:"accepted_unit_price"`
+	AcceptedSubTotal  *int          `json:"accepted_sub_total"`
+}
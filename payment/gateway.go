@@ -0,0 +1,201 @@
+// Package payment berisi client payment gateway untuk top up saldo lewat virtual account dan QRIS.
+// Controller hanya bicara ke interface Gateway; implementasi dipilih lewat env PAYMENT_GATEWAY.
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotConfigured - gateway atau secret webhook belum diisi
+	ErrNotConfigured = errors.New("payment gateway is not configured")
+	// ErrUnavailable - gateway tidak bisa dihubungi
+	ErrUnavailable = errors.New("payment gateway unavailable")
+	// ErrUnsupportedMethod - metode pembayaran tidak tersedia di gateway
+	ErrUnsupportedMethod = errors.New("unsupported payment method")
+	// ErrInvalidAmount - nominal di luar batas metode pembayaran
+	ErrInvalidAmount = errors.New("invalid payment amount")
+	// ErrInvalidSignature - signature webhook tidak cocok
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrInvalidPayload - body webhook tidak bisa dibaca
+	ErrInvalidPayload = errors.New("invalid webhook payload")
+)
+
+// SignatureHeader - header berisi HMAC-SHA256 (hex) dari body webhook
+const SignatureHeader = "X-Callback-Signature"
+
+// Jenis channel pembayaran
+const (
+	ChannelVirtualAccount = "virtual_account"
+	ChannelQRIS           = "qris"
+)
+
+// Kode metode pembayaran
+const (
+	MethodVABCA     = "va_bca"
+	MethodVABNI     = "va_bni"
+	MethodVABRI     = "va_bri"
+	MethodVAMandiri = "va_mandiri"
+	MethodQRIS      = "qris"
+)
+
+// Status pembayaran dari gateway
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusExpired = "expired"
+	StatusFailed  = "failed"
+)
+
+// Method - metode pembayaran yang bisa dipilih user
+type Method struct {
+	Code      string        `json:"code"`
+	Name      string        `json:"name"`
+	Channel   string        `json:"channel"`
+	MinAmount int           `json:"min_amount"`
+	MaxAmount int           `json:"max_amount"`
+	Expiry    time.Duration `json:"-"`
+	ExpiryMin int           `json:"expiry_minutes"`
+}
+
+// ChargeRequest - permintaan pembayaran ke gateway
+type ChargeRequest struct {
+	OrderID       string
+	Amount        int
+	Method        string
+	CustomerName  string
+	CustomerEmail string
+	ExpiresAt     time.Time
+}
+
+// Charge - instruksi pembayaran dari gateway: nomor VA atau string QRIS
+type Charge struct {
+	ExternalID string
+	Method     string
+	Amount     int
+	VANumber   string
+	QRString   string
+	ExpiresAt  time.Time
+}
+
+// WebhookEvent - notifikasi status pembayaran dari gateway
+type WebhookEvent struct {
+	ExternalID string     `json:"external_id"`
+	OrderID    string     `json:"order_id"`
+	Status     string     `json:"status"` // StatusPaid, StatusExpired, StatusFailed atau StatusPending
+	Amount     int        `json:"amount"`
+	PaidAt     *time.Time `json:"paid_at,omitempty"`
+}
+
+// Gateway - operasi payment gateway yang dipakai aplikasi
+type Gateway interface {
+	Name() string
+	Methods() []Method
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	// ParseWebhook memverifikasi signature lalu membaca body webhook
+	ParseWebhook(body []byte, signature string) (*WebhookEvent, error)
+}
+
+// FindMethod - metode dengan kode tersebut, ErrUnsupportedMethod jika tidak ada
+func FindMethod(g Gateway, code string) (Method, error) {
+	for _, method := range g.Methods() {
+		if method.Code == code {
+			return method, nil
+		}
+	}
+	return Method{}, ErrUnsupportedMethod
+}
+
+// Sign - HMAC-SHA256 hex dari body dengan secret webhook
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature membandingkan signature dalam waktu konstan
+func VerifySignature(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(Sign(secret, body))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
+
+var (
+	defaultMu      sync.Mutex
+	defaultGateway Gateway
+)
+
+// Default - gateway yang dipakai aplikasi, dibuat sekali dari env
+func Default() Gateway {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultGateway == nil {
+		defaultGateway = NewFromEnv()
+	}
+	return defaultGateway
+}
+
+// SetDefault mengganti gateway aplikasi, misalnya dengan NewSimulator saat pengujian
+func SetDefault(g Gateway) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultGateway = g
+}
+
+// NewFromEnv membaca PAYMENT_GATEWAY. Saat ini hanya simulator yang tersedia dan harus dipilih
+// eksplisit; PAYMENT_GATEWAY kosong berarti top up lewat gateway dimatikan. Gateway sungguhan cukup
+// mengimplementasikan Gateway dan didaftarkan di sini.
+func NewFromEnv() Gateway {
+	name := strings.ToLower(os.Getenv("PAYMENT_GATEWAY"))
+	switch name {
+	case "simulator":
+		return NewSimulatorFromEnv()
+	case "":
+		return unconfigured{name: "none"}
+	}
+	return unconfigured{name: name}
+}
+
+// SimulatorEnabled - PAYMENT_SIMULATOR_ENABLED=true membuka endpoint simulasi pembayaran untuk admin.
+// Hanya untuk development/staging, jangan diaktifkan di production.
+func SimulatorEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("PAYMENT_SIMULATOR_ENABLED"))
+	return enabled
+}
+
+// unconfigured - PAYMENT_GATEWAY kosong atau berisi gateway yang belum diimplementasikan
+type unconfigured struct {
+	name string
+}
+
+func (g unconfigured) Name() string {
+	return g.name
+}
+
+func (g unconfigured) Methods() []Method {
+	return nil
+}
+
+func (g unconfigured) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	return nil, ErrNotConfigured
+}
+
+func (g unconfigured) ParseWebhook(body []byte, signature string) (*WebhookEvent, error) {
+	return nil, ErrNotConfigured
+}
@@ -0,0 +1,77 @@
+package payment
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignAndVerifySignature(t *testing.T) {
+	body := []byte(`{"order_id":"TOPUP-1","status":"paid","amount":50000}`)
+	signature := Sign("rahasia", body)
+
+	if len(signature) != 64 {
+		t.Fatalf("signature length = %d, want 64 hex chars", len(signature))
+	}
+	if signature != Sign("rahasia", body) {
+		t.Fatal("Sign is not deterministic")
+	}
+
+	cases := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", "rahasia", body, signature, true},
+		{"uppercase hex and whitespace", "rahasia", body, " " + strings.ToUpper(signature) + "\n", true},
+		{"wrong secret", "lain", body, signature, false},
+		{"tampered body", "rahasia", []byte(`{"order_id":"TOPUP-1","status":"paid","amount":500000}`), signature, false},
+		{"truncated", "rahasia", body, signature[:62], false},
+		{"not hex", "rahasia", body, "zz" + signature[2:], false},
+		{"empty", "rahasia", body, "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := VerifySignature(tc.secret, tc.body, tc.signature); got != tc.want {
+				t.Fatalf("VerifySignature = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSimulatorWebhookRoundTrip(t *testing.T) {
+	simulator := NewSimulator("rahasia")
+
+	body, signature, err := simulator.Webhook(WebhookEvent{OrderID: "TOPUP-7", Status: StatusPaid, Amount: 25000})
+	if err != nil {
+		t.Fatalf("Webhook: %v", err)
+	}
+	event, err := simulator.ParseWebhook(body, signature)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if event.OrderID != "TOPUP-7" || event.Status != StatusPaid || event.Amount != 25000 || event.PaidAt == nil {
+		t.Fatalf("event = %+v, want paid TOPUP-7 for 25000 with paid_at", event)
+	}
+
+	if _, err := simulator.ParseWebhook(body, Sign("lain", body)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("ParseWebhook with foreign signature = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := NewSimulator("").ParseWebhook(body, signature); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("ParseWebhook without secret = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestNewFromEnvRequiresExplicitGateway(t *testing.T) {
+	t.Setenv("PAYMENT_GATEWAY", "")
+	if _, ok := NewFromEnv().(*Simulator); ok {
+		t.Fatal("empty PAYMENT_GATEWAY must not fall back to the simulator")
+	}
+
+	t.Setenv("PAYMENT_GATEWAY", "simulator")
+	if _, ok := NewFromEnv().(*Simulator); !ok {
+		t.Fatal("PAYMENT_GATEWAY=simulator must return the simulator")
+	}
+}
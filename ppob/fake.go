@@ -0,0 +1,258 @@
+package ppob
+
+import (
+	"backend-mulungs/models"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Fake - provider in-memory untuk menjalankan alur PPOB tanpa koneksi ke IAK (PPOB_PROVIDER=fake).
+// Nomor pelanggan yang berakhiran "0" selalu gagal, selainnya sukses saat CheckStatus.
+type Fake struct {
+	mu       sync.Mutex
+	products []models.ProductPrepaid
+	topups   map[string]fakeTopup
+	bills    map[string]map[string]any
+	nextTrID int
+}
+
+type fakeTopup struct {
+	request TopupRequest
+	price   int
+	status  string
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		products: []models.ProductPrepaid{
+			{ProductCode: "htelkomsel10000", ProductDescription: "Telkomsel", ProductNominal: "10000", ProductPrice: 10500, ProductType: "pulsa", ProductCategory: "telkomsel", Status: "active"},
+			{ProductCode: "htelkomsel25000", ProductDescription: "Telkomsel", ProductNominal: "25000", ProductPrice: 25200, ProductType: "pulsa", ProductCategory: "telkomsel", Status: "active"},
+			{ProductCode: "xld10000", ProductDescription: "XL", ProductNominal: "10000", ProductPrice: 10600, ProductType: "pulsa", ProductCategory: "xl", Status: "active"},
+			{ProductCode: "telkomsel_data_1gb", ProductDescription: "Telkomsel", ProductNominal: "1GB", ProductPrice: 15000, ProductType: "data", ProductCategory: "telkomsel_paket_internet", Status: "active"},
+			{ProductCode: "hpln20000", ProductDescription: "PLN", ProductNominal: "20000", ProductPrice: 20500, ProductType: "pln", ProductCategory: "pln", Status: "active"},
+			{ProductCode: "hpln50000", ProductDescription: "PLN", ProductNominal: "50000", ProductPrice: 50500, ProductType: "pln", ProductCategory: "pln", Status: "active"},
+			{ProductCode: "ovo20000", ProductDescription: "OVO", ProductNominal: "20000", ProductPrice: 21000, ProductType: "etoll", ProductCategory: "ovo", Status: "active"},
+			{ProductCode: "dana20000", ProductDescription: "DANA", ProductNominal: "20000", ProductPrice: 21000, ProductType: "etoll", ProductCategory: "dana", Status: "active"},
+		},
+		topups:   map[string]fakeTopup{},
+		bills:    map[string]map[string]any{},
+		nextTrID: 1000,
+	}
+}
+
+func (p *Fake) Name() string {
+	return "fake"
+}
+
+func (p *Fake) Pricelist(ctx context.Context, productType, operator string) ([]models.ProductPrepaid, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var products []models.ProductPrepaid
+	for _, product := range p.products {
+		if productType != "" && product.ProductType != productType {
+			continue
+		}
+		if operator != "" && !strings.EqualFold(product.ProductCategory, operator) {
+			continue
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+func (p *Fake) InquiryPLN(ctx context.Context, customerID string) (*models.PLNCustomerData, error) {
+	if failingNumber(customerID) {
+		return nil, &ProviderError{Op: "inquiry-pln", RC: "14", Message: "INCORRECT DESTINATION NUMBER"}
+	}
+	return &models.PLNCustomerData{
+		Status:       "1",
+		CustomerID:   customerID,
+		MeterNo:      customerID,
+		SubscriberID: customerID,
+		Name:         "PELANGGAN UJI",
+		SegmentPower: "R1 /000000900",
+		Message:      "SUCCESS",
+		RC:           "00",
+	}, nil
+}
+
+func (p *Fake) InquiryOVO(ctx context.Context, customerID string) (*models.OVOCustomerData, error) {
+	if failingNumber(customerID) {
+		return nil, &ProviderError{Op: "inquiry-ovo", RC: "14", Message: "INCORRECT DESTINATION NUMBER"}
+	}
+	return &models.OVOCustomerData{
+		Status:     "1",
+		CustomerID: customerID,
+		Name:       "PELANGGAN UJI",
+		Message:    "SUCCESS",
+		RC:         "00",
+	}, nil
+}
+
+func (p *Fake) CheckOperator(ctx context.Context, number string) (*models.PulsaInquiryData, error) {
+	operator := "telkomsel"
+	if strings.HasPrefix(number, "0817") || strings.HasPrefix(number, "0818") || strings.HasPrefix(number, "0819") {
+		operator = "xl"
+	}
+	return &models.PulsaInquiryData{Operator: operator, Message: "SUCCESS", RC: "00"}, nil
+}
+
+func (p *Fake) Topup(ctx context.Context, req TopupRequest) (*models.DataTopup, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	product, ok := p.findProduct(req.ProductCode)
+	if !ok {
+		data := &models.DataTopup{RefId: req.RefID, Status: 2, ProductCode: req.ProductCode, Message: "PRODUCT NOT FOUND", Rc: "20"}
+		return data, &ProviderError{Op: "top-up", RC: data.Rc, Message: data.Message, Raw: data}
+	}
+	if _, exists := p.topups[req.RefID]; exists {
+		data := &models.DataTopup{RefId: req.RefID, Status: 2, ProductCode: req.ProductCode, Message: "REF ID ALREADY USED", Rc: "17"}
+		return data, &ProviderError{Op: "top-up", RC: data.Rc, Message: data.Message, Raw: data}
+	}
+
+	p.nextTrID++
+	p.topups[req.RefID] = fakeTopup{request: req, price: int(product.ProductPrice), status: StatusPending}
+
+	return &models.DataTopup{
+		RefId:       req.RefID,
+		Status:      0,
+		ProductCode: req.ProductCode,
+		CustomerId:  req.CustomerID,
+		Price:       product.ProductPrice,
+		Message:     "PROCESS",
+		TrId:        float64(p.nextTrID),
+		Rc:          "39",
+	}, nil
+}
+
+// CheckStatus menyelesaikan topup yang masih pending sesuai aturan nomor pelanggan
+func (p *Fake) CheckStatus(ctx context.Context, refID string) (*StatusResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	topup, ok := p.topups[refID]
+	if !ok {
+		return nil, &ProviderError{Op: "check-status", RC: RCTransactionNotFound, Message: "TRANSACTION NOT FOUND"}
+	}
+
+	if topup.status == StatusPending {
+		topup.status = StatusSuccess
+		if failingNumber(topup.request.CustomerID) {
+			topup.status = StatusFailed
+		}
+		p.topups[refID] = topup
+	}
+
+	result := &StatusResult{
+		RefID:       refID,
+		Status:      topup.status,
+		ProductCode: topup.request.ProductCode,
+		Price:       topup.price,
+		RC:          "00",
+		Message:     "SUCCESS",
+	}
+	if topup.status == StatusSuccess {
+		result.SN = "1234-5678-9012-3456-7890/PELANGGAN UJI"
+	} else {
+		result.RC = "07"
+		result.Message = "FAILED"
+	}
+	return result, nil
+}
+
+func (p *Fake) PostpaidPricelist(ctx context.Context, productType, province string) ([]map[string]any, error) {
+	products := []map[string]any{
+		{"code": "PLNPOSTPAID", "name": "PLN Pascabayar", "type": "pln", "status": 1, "fee": 2500, "komisi": 1000},
+		{"code": "BPJS", "name": "BPJS Kesehatan", "type": "bpjs", "status": 1, "fee": 2500, "komisi": 1000},
+		{"code": "BPJSTK", "name": "BPJS Ketenagakerjaan", "type": "bpjs", "status": 1, "fee": 2500, "komisi": 1000},
+		{"code": "PDAMKOTA.SURABAYA", "name": "PDAM Kota Surabaya", "type": "pdam", "status": 1, "fee": 2500, "komisi": 800, "province": "Jawa Timur"},
+		{"code": "SPEEDY", "name": "Indihome", "type": "internet", "status": 1, "fee": 2500, "komisi": 1000},
+	}
+
+	var filtered []map[string]any
+	for _, product := range products {
+		if productType != "" && product["type"] != productType {
+			continue
+		}
+		if province != "" && product["province"] != nil && !strings.EqualFold(product["province"].(string), province) {
+			continue
+		}
+		filtered = append(filtered, product)
+	}
+	return filtered, nil
+}
+
+func (p *Fake) PostpaidInquiry(ctx context.Context, req PostpaidInquiryRequest) (map[string]any, error) {
+	if failingNumber(req.Hp) {
+		return nil, &ProviderError{Op: "inq-pasca", RC: "14", Message: "INCORRECT DESTINATION NUMBER"}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextTrID++
+	trID := p.nextTrID
+	bill := map[string]any{
+		"tr_id":         float64(trID),
+		"code":          req.Code,
+		"hp":            req.Hp,
+		"tr_name":       "PELANGGAN UJI",
+		"period":        req.Month,
+		"nominal":       float64(100000),
+		"admin":         float64(2500),
+		"ref_id":        req.RefID,
+		"response_code": "00",
+		"message":       "INQUIRY SUCCESS",
+		"price":         float64(102500),
+		"selling_price": float64(102500),
+		"desc":          map[string]any{"nama": "PELANGGAN UJI"},
+	}
+	p.bills[fmt.Sprintf("%d", trID)] = bill
+
+	return cloneMap(bill), nil
+}
+
+func (p *Fake) PostpaidPayment(ctx context.Context, trID string) (map[string]any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bill, ok := p.bills[trID]
+	if !ok {
+		return nil, &ProviderError{Op: "pay-pasca", RC: "16", Message: "INQUIRY NOT FOUND"}
+	}
+	if bill["paid"] == true {
+		return nil, &ProviderError{Op: "pay-pasca", RC: RCBillAlreadyPaid, Message: "BILL ALREADY PAID"}
+	}
+	bill["paid"] = true
+
+	data := cloneMap(bill)
+	delete(data, "paid")
+	data["message"] = "PAYMENT SUCCESS"
+	data["noref"] = fmt.Sprintf("FAKE%s", trID)
+	return data, nil
+}
+
+func (p *Fake) findProduct(code string) (models.ProductPrepaid, bool) {
+	for _, product := range p.products {
+		if product.ProductCode == code {
+			return product, true
+		}
+	}
+	return models.ProductPrepaid{}, false
+}
+
+func failingNumber(number string) bool {
+	return strings.HasSuffix(number, "0")
+}
+
+func cloneMap(source map[string]any) map[string]any {
+	cloned := make(map[string]any, len(source))
+	for key, value := range source {
+		cloned[key] = value
+	}
+	return cloned
+}
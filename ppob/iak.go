@@ -0,0 +1,330 @@
+package ppob
+
+import (
+	"backend-mulungs/models"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Base URL IAK per environment (IAK_ENV=production untuk live)
+const (
+	iakPrepaidDevURL   = "https://prepaid.iak.dev"
+	iakPrepaidProdURL  = "https://prepaid.iak.id"
+	iakPostpaidDevURL  = "https://testpostpaid.mobilepulsa.net"
+	iakPostpaidProdURL = "https://mobilepulsa.net"
+)
+
+// IAKConfig - konfigurasi client IAK
+type IAKConfig struct {
+	Username    string
+	APIKey      string
+	PrepaidURL  string
+	PostpaidURL string
+	Timeout     time.Duration
+}
+
+// IAK - implementasi Provider untuk IAK (mobilepulsa)
+type IAK struct {
+	cfg    IAKConfig
+	client *http.Client
+}
+
+func NewIAK(cfg IAKConfig) *IAK {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &IAK{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// NewIAKFromEnv membaca IDENTITY, APIKEY, IAK_ENV, IAK_PREPAID_URL, IAK_POSTPAID_URL dan IAK_TIMEOUT
+func NewIAKFromEnv() *IAK {
+	cfg := IAKConfig{
+		Username:    os.Getenv("IDENTITY"),
+		APIKey:      os.Getenv("APIKEY"),
+		PrepaidURL:  iakPrepaidDevURL,
+		PostpaidURL: iakPostpaidDevURL,
+	}
+
+	if strings.EqualFold(os.Getenv("IAK_ENV"), "production") {
+		cfg.PrepaidURL = iakPrepaidProdURL
+		cfg.PostpaidURL = iakPostpaidProdURL
+	}
+	if url := os.Getenv("IAK_PREPAID_URL"); url != "" {
+		cfg.PrepaidURL = url
+	}
+	if url := os.Getenv("IAK_POSTPAID_URL"); url != "" {
+		cfg.PostpaidURL = url
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("IAK_TIMEOUT")); err == nil {
+		cfg.Timeout = timeout
+	}
+
+	return NewIAK(cfg)
+}
+
+func (p *IAK) Name() string {
+	return "iak"
+}
+
+// sign = md5(username + api key + kode unik), sama dengan helpers.MakeSignPricelist
+func (p *IAK) sign(code string) string {
+	sum := md5.Sum([]byte(p.cfg.Username + p.cfg.APIKey + code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *IAK) Pricelist(ctx context.Context, productType, operator string) ([]models.ProductPrepaid, error) {
+	path := "/api/pricelist"
+	for _, part := range []string{productType, operator} {
+		if part != "" {
+			path += "/" + part
+		}
+	}
+
+	var result models.PrepaidResponse
+	err := p.post(ctx, "pricelist", p.cfg.PrepaidURL+path, map[string]any{
+		"status":   "all",
+		"username": p.cfg.Username,
+		"sign":     p.sign("pl"),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Data.RC != "00" {
+		return nil, &ProviderError{Op: "pricelist", RC: result.Data.RC, Message: result.Data.Message, Raw: result.Data}
+	}
+	return result.Data.Pricelist, nil
+}
+
+func (p *IAK) InquiryPLN(ctx context.Context, customerID string) (*models.PLNCustomerData, error) {
+	var result models.InquiryPLNResponse
+	err := p.post(ctx, "inquiry-pln", p.cfg.PrepaidURL+"/api/inquiry-pln", map[string]any{
+		"username":    p.cfg.Username,
+		"customer_id": customerID,
+		"sign":        p.sign(customerID),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Data.RC != "" && result.Data.RC != "00" {
+		return nil, &ProviderError{Op: "inquiry-pln", RC: result.Data.RC, Message: result.Data.Message, Raw: result.Data}
+	}
+	return &result.Data, nil
+}
+
+func (p *IAK) InquiryOVO(ctx context.Context, customerID string) (*models.OVOCustomerData, error) {
+	var result models.InquiryOVOResponse
+	err := p.post(ctx, "inquiry-ovo", p.cfg.PrepaidURL+"/api/inquiry-ovo", map[string]any{
+		"username":    p.cfg.Username,
+		"customer_id": customerID,
+		"sign":        p.sign(customerID),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Data.RC != "" && result.Data.RC != "00" {
+		return nil, &ProviderError{Op: "inquiry-ovo", RC: result.Data.RC, Message: result.Data.Message, Raw: result.Data}
+	}
+	return &result.Data, nil
+}
+
+func (p *IAK) CheckOperator(ctx context.Context, number string) (*models.PulsaInquiryData, error) {
+	var result models.InquiryPulsaResponse
+	err := p.post(ctx, "check-operator", p.cfg.PrepaidURL+"/api/check-operator", map[string]any{
+		"username":    p.cfg.Username,
+		"customer_id": number,
+		"sign":        p.sign("op"),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Data.RC != "00" || result.Data.Operator == "" {
+		return nil, &ProviderError{Op: "check-operator", RC: result.Data.RC, Message: result.Data.Message, Raw: result.Data}
+	}
+	return &result.Data, nil
+}
+
+// Topup mengirim pembelian prabayar. Status 2 atau limit harian dikembalikan sebagai ProviderError
+// bersama datanya; status 0/1 berarti diterima dan hasil akhirnya datang lewat callback.
+func (p *IAK) Topup(ctx context.Context, req TopupRequest) (*models.DataTopup, error) {
+	var result models.PrepaidResponseTopup
+	err := p.post(ctx, "top-up", p.cfg.PrepaidURL+"/api/top-up", models.ExternalRequestTopup{
+		Username:    p.cfg.Username,
+		RefId:       req.RefID,
+		CustomerId:  req.CustomerID,
+		ProductCode: req.ProductCode,
+		Sign:        p.sign(req.RefID),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Data.Status == 2 || strings.Contains(strings.ToUpper(result.Data.Message), "MAXIMUM 1 NUMBER 1 TIME IN 1 DAY") {
+		return &result.Data, &ProviderError{Op: "top-up", RC: result.Data.Rc, Message: result.Data.Message, Raw: result.Data}
+	}
+	return &result.Data, nil
+}
+
+func (p *IAK) CheckStatus(ctx context.Context, refID string) (*StatusResult, error) {
+	var result struct {
+		Data struct {
+			RefID       string  `json:"ref_id"`
+			Status      int     `json:"status"`
+			ProductCode string  `json:"product_code"`
+			Price       float64 `json:"price"`
+			Message     string  `json:"message"`
+			SN          string  `json:"sn"`
+			RC          string  `json:"rc"`
+		} `json:"data"`
+	}
+	err := p.post(ctx, "check-status", p.cfg.PrepaidURL+"/api/check-status", map[string]any{
+		"username": p.cfg.Username,
+		"ref_id":   refID,
+		"sign":     p.sign(refID),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	data := result.Data
+	status := StatusPending
+	switch {
+	case data.Status == 1 && data.RC == "00":
+		status = StatusSuccess
+	case data.Status == 2:
+		status = StatusFailed
+	case data.Status == 0 && data.RC != "" && data.RC != "00" && data.RC != "39":
+		// rc selain sukses/proses tanpa status transaksi, misal ref_id tidak dikenal
+		return nil, &ProviderError{Op: "check-status", RC: data.RC, Message: data.Message, Raw: data}
+	}
+
+	return &StatusResult{
+		RefID:       refID,
+		Status:      status,
+		ProductCode: data.ProductCode,
+		Price:       int(data.Price),
+		SN:          data.SN,
+		RC:          data.RC,
+		Message:     data.Message,
+	}, nil
+}
+
+func (p *IAK) PostpaidPricelist(ctx context.Context, productType, province string) ([]map[string]any, error) {
+	payload := models.ExternalRequestPostpaid{
+		Commands: "pricelist-pasca",
+		Status:   "all",
+		Username: p.cfg.Username,
+		Sign:     p.sign("pl"),
+	}
+	if productType == "pdam" && province != "" {
+		payload.Province = &province
+	}
+
+	url := p.cfg.PostpaidURL + "/api/v1/bill/check"
+	if productType != "" {
+		url += "/" + productType
+	}
+
+	var result struct {
+		Data struct {
+			Pasca []map[string]any `json:"pasca"`
+		} `json:"data"`
+	}
+	if err := p.post(ctx, "pricelist-pasca", url, payload, &result); err != nil {
+		return nil, err
+	}
+	return result.Data.Pasca, nil
+}
+
+func (p *IAK) PostpaidInquiry(ctx context.Context, req PostpaidInquiryRequest) (map[string]any, error) {
+	return p.postpaidCommand(ctx, "inq-pasca", map[string]any{
+		"commands": "inq-pasca",
+		"username": p.cfg.Username,
+		"code":     req.Code,
+		"hp":       req.Hp,
+		"ref_id":   req.RefID,
+		"month":    req.Month,
+		"sign":     p.sign(req.RefID),
+	})
+}
+
+func (p *IAK) PostpaidPayment(ctx context.Context, trID string) (map[string]any, error) {
+	return p.postpaidCommand(ctx, "pay-pasca", map[string]any{
+		"commands": "pay-pasca",
+		"username": p.cfg.Username,
+		"tr_id":    trID,
+		"sign":     p.sign(trID),
+	})
+}
+
+// postpaidCommand - response pascabayar bisa membawa response_code di root atau di dalam data
+func (p *IAK) postpaidCommand(ctx context.Context, op string, payload map[string]any) (map[string]any, error) {
+	var result map[string]any
+	if err := p.post(ctx, op, p.cfg.PostpaidURL+"/api/v1/bill/check", payload, &result); err != nil {
+		return nil, err
+	}
+
+	data, _ := result["data"].(map[string]any)
+	for _, source := range []map[string]any{result, data} {
+		if code, ok := source["response_code"].(string); ok && code != "00" {
+			message, _ := source["message"].(string)
+			return nil, &ProviderError{Op: op, RC: code, Message: message, Raw: result}
+		}
+	}
+
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s: missing data", ErrInvalidResponse, op)
+	}
+	return data, nil
+}
+
+func (p *IAK) post(ctx context.Context, op, url string, payload any, out any) error {
+	if p.cfg.Username == "" || p.cfg.APIKey == "" {
+		return ErrNotConfigured
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("ppob %s: encode request: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ppob %s: build request: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrUnavailable, op, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %s: read body: %v", ErrUnavailable, op, err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %s: http %d", ErrUnavailable, op, resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidResponse, op, err)
+	}
+	return nil
+}
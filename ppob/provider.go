@@ -0,0 +1,166 @@
+// Package ppob berisi client provider PPOB (pulsa, token PLN, tagihan pascabayar).
+// Controller hanya bicara ke interface Provider; implementasi dipilih lewat env PPOB_PROVIDER.
+package ppob
+
+import (
+	"backend-mulungs/models"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotConfigured - kredensial provider (IDENTITY/APIKEY) belum diisi
+	ErrNotConfigured = errors.New("ppob provider is not configured")
+	// ErrUnavailable - provider tidak bisa dihubungi (timeout, network, HTTP 5xx)
+	ErrUnavailable = errors.New("ppob provider unavailable")
+	// ErrInvalidResponse - response provider tidak bisa dibaca
+	ErrInvalidResponse = errors.New("invalid ppob provider response")
+)
+
+// ProviderError - provider menjawab tapi menolak request (rc bukan sukses)
+type ProviderError struct {
+	Op      string
+	RC      string
+	Message string
+	Raw     any // response asli dari provider, diteruskan ke client bila perlu
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("ppob %s: rc %s: %s", e.Op, e.RC, e.Message)
+}
+
+// RCTransactionNotFound - rc IAK saat ref_id tidak pernah diterima provider
+const RCTransactionNotFound = "06"
+
+// IsTransactionNotFound - provider menjawab pasti bahwa transaksi dengan ref_id tersebut tidak ada
+func IsTransactionNotFound(err error) bool {
+	var providerErr *ProviderError
+	return errors.As(err, &providerErr) && providerErr.RC == RCTransactionNotFound
+}
+
+// RCBillAlreadyPaid - rc IAK saat tagihan pascabayar dengan tr_id tersebut sudah lunas
+const RCBillAlreadyPaid = "34"
+
+// IsBillAlreadyPaid - provider menolak pembayaran karena tagihan sudah dibayar sebelumnya
+func IsBillAlreadyPaid(err error) bool {
+	var providerErr *ProviderError
+	return errors.As(err, &providerErr) && providerErr.RC == RCBillAlreadyPaid
+}
+
+// PostpaidPaymentStatus menerjemahkan hasil PostpaidPayment menjadi status akhir. Tagihan yang sudah
+// lunas dianggap sukses, karena provider hanya menolak dengan RCBillAlreadyPaid jika pembayaran
+// sebelumnya untuk tr_id yang sama sudah sampai. Error dikembalikan apa adanya jika hasilnya belum
+// pasti (timeout, network, response tidak terbaca).
+func PostpaidPaymentStatus(trID string, data map[string]any, err error) (*StatusResult, error) {
+	status := &StatusResult{RefID: trID, Status: StatusSuccess, RC: "00"}
+
+	var providerErr *ProviderError
+	switch {
+	case err == nil:
+		status.ProductCode, _ = data["code"].(string)
+		status.Message, _ = data["message"].(string)
+	case IsBillAlreadyPaid(err):
+		status.RC = RCBillAlreadyPaid
+		status.Message = "BILL ALREADY PAID"
+	case errors.As(err, &providerErr):
+		status.Status = StatusFailed
+		status.RC = providerErr.RC
+		status.Message = providerErr.Message
+		if status.Message == "" {
+			status.Message = "Payment failed"
+		}
+	case errors.Is(err, ErrNotConfigured):
+		// Tidak pernah terkirim ke provider
+		status.Status = StatusFailed
+		status.Message = err.Error()
+	default:
+		return nil, err
+	}
+	return status, nil
+}
+
+// Status akhir transaksi prabayar
+const (
+	StatusPending = "pending"
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// TopupRequest - pembelian produk prabayar
+type TopupRequest struct {
+	RefID       string
+	CustomerID  string
+	ProductCode string
+}
+
+// StatusResult - hasil cek status transaksi prabayar
+type StatusResult struct {
+	RefID       string
+	Status      string // StatusPending, StatusSuccess, StatusFailed
+	ProductCode string
+	Price       int
+	SN          string
+	RC          string
+	Message     string
+}
+
+// PostpaidInquiryRequest - cek tagihan pascabayar
+type PostpaidInquiryRequest struct {
+	Code  string
+	Hp    string
+	RefID string
+	Month string
+}
+
+// Provider - operasi PPOB yang dipakai aplikasi
+type Provider interface {
+	Name() string
+
+	// Prabayar
+	Pricelist(ctx context.Context, productType, operator string) ([]models.ProductPrepaid, error)
+	InquiryPLN(ctx context.Context, customerID string) (*models.PLNCustomerData, error)
+	InquiryOVO(ctx context.Context, customerID string) (*models.OVOCustomerData, error)
+	CheckOperator(ctx context.Context, number string) (*models.PulsaInquiryData, error)
+	Topup(ctx context.Context, req TopupRequest) (*models.DataTopup, error)
+	CheckStatus(ctx context.Context, refID string) (*StatusResult, error)
+
+	// Pascabayar, data dibiarkan dinamis karena isi "desc" berbeda per produk
+	PostpaidPricelist(ctx context.Context, productType, province string) ([]map[string]any, error)
+	PostpaidInquiry(ctx context.Context, req PostpaidInquiryRequest) (map[string]any, error)
+	PostpaidPayment(ctx context.Context, trID string) (map[string]any, error)
+}
+
+var (
+	defaultMu       sync.Mutex
+	defaultProvider Provider
+)
+
+// Default - provider yang dipakai aplikasi, dibuat sekali dari env:
+// PPOB_PROVIDER=fake memakai provider in-memory, selain itu IAK.
+func Default() Provider {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultProvider == nil {
+		defaultProvider = NewFromEnv()
+	}
+	return defaultProvider
+}
+
+// SetDefault mengganti provider aplikasi, misalnya dengan NewFake() saat pengujian
+func SetDefault(p Provider) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultProvider = p
+}
+
+func NewFromEnv() Provider {
+	if strings.EqualFold(os.Getenv("PPOB_PROVIDER"), "fake") {
+		return NewFake()
+	}
+	return NewIAKFromEnv()
+}
@@ -0,0 +1,141 @@
+// Package realtime berisi pub/sub in-memory untuk event live (posisi petugas, status penjemputan)
+// yang diteruskan ke client lewat Server-Sent Events. Hub hanya hidup di satu proses; jika aplikasi
+// dijalankan lebih dari satu instance, client tetap mendapat snapshot dari database saat connect.
+package realtime
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Jenis event penjemputan
+const (
+	EventSnapshot = "snapshot"
+	EventLocation = "location"
+	EventStatus   = "status"
+)
+
+// Event - satu pesan untuk subscriber sebuah topic
+type Event struct {
+	Type  string    `json:"type"`
+	Topic string    `json:"topic"`
+	Data  any       `json:"data"`
+	At    time.Time `json:"at"`
+}
+
+// Subscription - channel event untuk satu client. Channel ditutup saat Close dipanggil atau saat
+// client terlalu lambat membaca; client cukup connect ulang untuk mendapat snapshot baru.
+type Subscription struct {
+	Events <-chan Event
+
+	hub    *Hub
+	topic  string
+	events chan Event
+	once   sync.Once
+}
+
+// Close melepas subscription dari hub
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub - daftar subscriber per topic
+type Hub struct {
+	mu          sync.Mutex
+	buffer      int
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+func NewHub(buffer int) *Hub {
+	if buffer <= 0 {
+		buffer = 16
+	}
+	return &Hub{
+		buffer:      buffer,
+		subscribers: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe mendaftarkan client ke topic
+func (h *Hub) Subscribe(topic string) *Subscription {
+	events := make(chan Event, h.buffer)
+	sub := &Subscription{Events: events, hub: h, topic: topic, events: events}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = map[*Subscription]struct{}{}
+	}
+	h.subscribers[topic][sub] = struct{}{}
+	return sub
+}
+
+// Publish mengirim event ke semua subscriber topic tanpa menunggu. Subscriber yang buffer-nya penuh
+// diputus supaya publisher (request HTTP petugas) tidak ikut tertahan.
+func (h *Hub) Publish(topic, eventType string, data any) {
+	event := Event{Type: eventType, Topic: topic, Data: data, At: time.Now()}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers[topic] {
+		select {
+		case sub.events <- event:
+		default:
+			h.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribers - jumlah client yang sedang mendengarkan topic
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[topic])
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+func (h *Hub) removeLocked(sub *Subscription) {
+	sub.once.Do(func() {
+		if subs := h.subscribers[sub.topic]; subs != nil {
+			delete(subs, sub)
+			if len(subs) == 0 {
+				delete(h.subscribers, sub.topic)
+			}
+		}
+		close(sub.events)
+	})
+}
+
+// PickupTopic - topic untuk satu PickupRequest
+func PickupTopic(pickupRequestID uint) string {
+	return fmt.Sprintf("pickup:%d", pickupRequestID)
+}
+
+var (
+	defaultMu  sync.Mutex
+	defaultHub *Hub
+)
+
+// Default - hub yang dipakai aplikasi
+func Default() *Hub {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultHub == nil {
+		defaultHub = NewHub(16)
+	}
+	return defaultHub
+}
+
+// SetDefault mengganti hub aplikasi, misalnya saat pengujian
+func SetDefault(h *Hub) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultHub = h
+}
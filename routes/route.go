@@ -5,7 +5,11 @@ import (
 	"backend-mulungs/controllers/donation"
 	pickuprequest "backend-mulungs/controllers/pickupRequest"
 	"backend-mulungs/controllers/wastedeposit"
+	"backend-mulungs/controllers/wastesale"
+	"backend-mulungs/controllers/wastetransfer"
 	"backend-mulungs/middleware"
+	"backend-mulungs/models"
+	"backend-mulungs/payment"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -22,13 +26,22 @@ func SetupRoute(app *fiber.App) {
 	api := app.Group("/api")
 	{
 		api.Post("/login", controllers.LoginC)
+		api.Post("/token/refresh", controllers.RefreshTokenC)
 		api.Post("/register-user", controllers.RegisterUser)
 		api.Post("/register-user-child-bank", controllers.RegisterUserChildBank)
 		api.Post("/callback", controllers.CallbackPrepaid)
+		api.Post("/payments/webhook", controllers.PaymentWebhook) // Webhook payment gateway, diverifikasi dengan HMAC
 		api.Get("/testBucket", controllers.TestNEOConnection)
 
 		app.Use(middleware.RequireAuth)
 
+		// Policy per route berdasarkan role dari seeders.SeedRole
+		admin := middleware.RequireRole(models.RoleAdmin)
+		parentOperator := middleware.RequireRole(models.RoleAdmin, models.RoleParentBank)
+		bankOperator := middleware.RequireRole(models.RoleAdmin, models.RoleParentBank, models.RoleChildBank)
+
+		api.Post("/logout", controllers.LogoutC)
+
 		// api.Get("/profile", func(c *fiber.Ctx) error {
 		// 	return c.JSON(fiber.Map{
 		// 		"message": "Success",
@@ -36,24 +49,24 @@ func SetupRoute(app *fiber.App) {
 		// })
 
 		// Scan Barcode User
-		api.Post("/scan-user", controllers.ScanBarcodeUser)
+		api.Post("/scan-user", bankOperator, controllers.ScanBarcodeUser)
 
 		// for website
-		api.Get("/list-topup", controllers.TransactionAllTopUp)
-		api.Get("/list-withdraw", controllers.TransactionAllWithdraw)
-		api.Get("/roles", controllers.ListRoleC)
-		api.Get("/division", controllers.DivisiUserController)
+		api.Get("/list-topup", admin, controllers.TransactionAllTopUp)
+		api.Get("/list-withdraw", admin, controllers.TransactionAllWithdraw)
+		api.Get("/roles", admin, controllers.ListRoleC)
+		api.Get("/division", admin, controllers.DivisiUserController)
 		api.Put("/:id/change-password", controllers.ChangePassword)
 
 		// for role parent bank, child bank, mitra, end user
-		api.Post("/create-topup", controllers.TransactionCreateTopUp)
-		api.Post("/create-withdraw", controllers.TransactionCreateWithdraw)
+		api.Post("/create-topup", middleware.Idempotency, controllers.TransactionCreateTopUp)
+		api.Post("/create-withdraw", middleware.Idempotency, controllers.TransactionCreateWithdraw)
 
 		transaction := api.Group("/transactions")
 		{
 			transaction.Get("/:id", controllers.GetTransactionDetailHandler)
-			transaction.Put("/:id/confirm", controllers.ConfirmTransactionHandler)
-			transaction.Put("/:id/reject", controllers.RejectTransactionHandler)
+			transaction.Put("/:id/confirm", admin, controllers.ConfirmTransactionHandler)
+			transaction.Put("/:id/reject", admin, controllers.RejectTransactionHandler)
 		}
 
 		profileGroup := api.Group("/profile")
@@ -67,95 +80,169 @@ func SetupRoute(app *fiber.App) {
 		parentBank := api.Group("/parent-bank")
 		{
 			// Website Admin
-			parentBank.Get("/", controllers.GetPrentBank)
-			parentBank.Post("/", controllers.CreateParentBank)
-			parentBank.Put("/:id", controllers.UpdateParentBank)
-			parentBank.Delete("/:id", controllers.DeleteParentBank)
+			parentBank.Get("/", admin, controllers.GetPrentBank)
+			parentBank.Post("/", admin, controllers.CreateParentBank)
+			parentBank.Put("/:id", admin, controllers.UpdateParentBank)
+			parentBank.Delete("/:id", admin, controllers.DeleteParentBank)
+			parentBank.Put("/:id/service-area", admin, controllers.UpdateParentBankServiceArea)
 
 			// Mobile Parent Bank
-			parentBank.Get("/:id", controllers.GetParentBankID)
+			parentBank.Get("/:id", parentOperator, controllers.GetParentBankID)
 		}
 
 		childBank := api.Group("/child-bank")
 		{
-			childBank.Post("/", controllers.CreateChildBank)
+			childBank.Post("/", parentOperator, controllers.CreateChildBank)
 			childBank.Get("/", controllers.GetAllChildBanks)
 			childBank.Get("/:id", controllers.GetChildBankById)
-			childBank.Get("/by-id/:id", controllers.GetUserChildBankByIDC)
-			childBank.Put("/:id", controllers.UpdateChildBank)
-			childBank.Delete("/:id", controllers.DeleteChildBank)
+			childBank.Get("/by-id/:id", bankOperator, controllers.GetUserChildBankByIDC)
+			childBank.Put("/:id", parentOperator, controllers.UpdateChildBank)
+			childBank.Delete("/:id", parentOperator, controllers.DeleteChildBank)
+			childBank.Put("/:id/service-area", parentOperator, controllers.UpdateChildBankServiceArea)
+		}
 
+		// Wilayah layanan bank (GeoJSON)
+		serviceArea := api.Group("/service-areas")
+		{
+			serviceArea.Get("/lookup", controllers.LookupServiceArea)
+			serviceArea.Post("/check", parentOperator, controllers.CheckServiceArea)
 		}
 
 		userChildBank := api.Group("/user-childbank")
 		{
-			userChildBank.Get("/", controllers.GetAllUsersChildBank)
-			userChildBank.Post("/", controllers.CreateUserChildBank)
-			userChildBank.Put("/:id", controllers.UpdateUserChildBank)
-			userChildBank.Delete("/:id", controllers.DeleteUserChildBank)
+			userChildBank.Get("/", parentOperator, controllers.GetAllUsersChildBank)
+			userChildBank.Post("/", parentOperator, controllers.CreateUserChildBank)
+			userChildBank.Put("/:id", parentOperator, controllers.UpdateUserChildBank)
+			userChildBank.Delete("/:id", parentOperator, controllers.DeleteUserChildBank)
 		}
 
 		userAdmin := api.Group("/admins")
 		{
-			userAdmin.Post("/", controllers.CreateAdmin)
-			userAdmin.Get("/", controllers.GetAllAdmin)
-			userAdmin.Get("/:id", controllers.GetAdminByID)
-			userAdmin.Put("/:id", controllers.UpdateUserAdmin)
-			userAdmin.Delete("/:id", controllers.DeleteUserAdmin)
+			userAdmin.Post("/", admin, controllers.CreateAdmin)
+			userAdmin.Get("/", admin, controllers.GetAllAdmin)
+			userAdmin.Get("/:id", admin, controllers.GetAdminByID)
+			userAdmin.Put("/:id", admin, controllers.UpdateUserAdmin)
+			userAdmin.Delete("/:id", admin, controllers.DeleteUserAdmin)
+			userAdmin.Post("/:id/revoke-sessions", admin, controllers.RevokeUserSessionsC)
 		}
 
 		ppob := api.Group("/ppob")
 		{
 			ppob.Get("/prepaid/:type?", controllers.GetListPrepaid)
-			ppob.Post("/prepaid/topup", controllers.TopupPrepaid)
+			ppob.Post("/prepaid/topup", middleware.Idempotency, controllers.TopupPrepaid)
 			ppob.Post("/postpaid/inquiry", controllers.PostpaidInquiry)
-			ppob.Post("/postpaid/payment", controllers.PaymentPostpaid)
+			ppob.Post("/postpaid/payment", middleware.Idempotency, controllers.PaymentPostpaid)
 			ppob.Get("/postpaid/:type?", controllers.GetListPostpaid)
 			ppob.Get("/postpaid/:type/:province", controllers.GetListPostpaid)
-			ppob.Post("/margin", controllers.CreateMargin)
+			ppob.Get("/margin", admin, controllers.GetMarginRules)
+			ppob.Post("/margin", admin, controllers.CreateMargin)
+			ppob.Get("/margin/resolve", admin, controllers.ResolveMargin)
+			ppob.Get("/margin/:id", admin, controllers.GetMarginRule)
+			ppob.Put("/margin/:id", admin, controllers.UpdateMarginRule)
+			ppob.Delete("/margin/:id", admin, controllers.DeleteMarginRule)
+			ppob.Get("/callback-logs", admin, controllers.GetCallbackLogs)
+			ppob.Post("/reconcile", admin, controllers.ReconcilePpob)
+			ppob.Post("/catalog/sync", admin, controllers.SyncPpobCatalog)
+			ppob.Get("/catalog/syncs", admin, controllers.GetPpobCatalogSyncs)
+			ppob.Get("/catalog/syncs/:id", admin, controllers.GetPpobCatalogSync)
 
 			ppob.Get("/history", controllers.GetHistoryByRefID)
 		}
 
+		payments := api.Group("/payments")
+		{
+			payments.Get("/methods", controllers.GetPaymentMethods)
+			payments.Post("/topup", middleware.Idempotency, controllers.CreateTopUpPayment) // Top up via VA/QRIS
+			payments.Get("/:id", controllers.GetTopUpPayment)
+			if payment.SimulatorEnabled() {
+				payments.Post("/:id/simulate", admin, controllers.SimulatePayment) // Hanya PAYMENT_GATEWAY=simulator
+			}
+		}
+
 		region := api.Group("/region")
 		{
 			region.Get("/province", controllers.RegionProvince)
 			region.Get("/district", controllers.RegionDistrict)
 			region.Get("/subdistrict", controllers.RegionSubDistrict)
 			region.Get("/village", controllers.RegionVillage)
+			region.Get("/search", controllers.SearchRegions)               // Cari nama wilayah di semua tingkat
+			region.Post("/import", admin, controllers.ImportRegionDataset) // Upload CSV dataset BPS
+			region.Get("/:code", controllers.GetRegion)                    // Detail + induk sampai provinsi
 		}
 
 		dash := api.Group("/dashboard")
 		{
-			dash.Get("/admin", controllers.DashboardController)
+			dash.Get("/admin", admin, controllers.DashboardController)
 		}
 
 		userGroup := api.Group("/parent-bank-users")
 		{
-			userGroup.Get("/", controllers.GetUsersParentBank)      // Get all users with filters
-			userGroup.Get("/reset-filter", controllers.ResetFilter) // Reset filter
-			userGroup.Get("/list-parent", controllers.GetParentBanksDropdown)
-			userGroup.Post("/", controllers.CreateUserBankInduk) // Create user bank induk
-			userGroup.Get("/:id", controllers.GetUserByID)       // Get user by ID
-			userGroup.Put("/:id", controllers.UpdateUser)        // Update user
-			userGroup.Delete("/:id", controllers.DeleteUser)     // Delete user
+			userGroup.Get("/", admin, controllers.GetUsersParentBank)      // Get all users with filters
+			userGroup.Get("/reset-filter", admin, controllers.ResetFilter) // Reset filter
+			userGroup.Get("/list-parent", admin, controllers.GetParentBanksDropdown)
+			userGroup.Post("/", admin, controllers.CreateUserBankInduk) // Create user bank induk
+			userGroup.Get("/:id", admin, controllers.GetUserByID)       // Get user by ID
+			userGroup.Put("/:id", admin, controllers.UpdateUser)        // Update user
+			userGroup.Delete("/:id", admin, controllers.DeleteUser)     // Delete user
 		}
 
 		marketings := api.Group("/marketing")
 		{
-			marketings.Get("/", controllers.GetMarketingList)      // Get dengan filter
-			marketings.Post("/", controllers.CreateMarketing)      // Create new
-			marketings.Put("/:id", controllers.UpdateMarketing)    // Update
-			marketings.Delete("/:id", controllers.DeleteMarketing) // Delete
+			marketings.Get("/", controllers.GetMarketingList)             // Get dengan filter
+			marketings.Post("/", admin, controllers.CreateMarketing)      // Create new
+			marketings.Put("/:id", admin, controllers.UpdateMarketing)    // Update
+			marketings.Delete("/:id", admin, controllers.DeleteMarketing) // Delete
 		}
 
 		wasteGroup := api.Group("/waste")
 		{
-			wasteGroup.Get("/total", controllers.GetTotalWaste)                // Get total weight
-			wasteGroup.Get("/products", controllers.GetProductWasteList)       // Get list dengan filter
-			wasteGroup.Post("/products", controllers.CreateProductWaste)       // Create new
-			wasteGroup.Put("/products/:id", controllers.UpdateProductWaste)    // Update
-			wasteGroup.Delete("/products/:id", controllers.DeleteProductWaste) // Delete
+			wasteGroup.Get("/total", controllers.GetTotalWaste)                       // Get total weight
+			wasteGroup.Get("/products", controllers.GetProductWasteList)              // Get list dengan filter
+			wasteGroup.Post("/products", admin, controllers.CreateProductWaste)       // Create new
+			wasteGroup.Put("/products/:id", admin, controllers.UpdateProductWaste)    // Update
+			wasteGroup.Delete("/products/:id", admin, controllers.DeleteProductWaste) // Delete
+			wasteGroup.Get("/products/:id/prices", controllers.GetProductWastePrices)
+			wasteGroup.Post("/products/:id/prices", bankOperator, controllers.ScheduleProductWastePrice)
+			wasteGroup.Delete("/products/:id/prices/:price_id", bankOperator, controllers.CancelProductWastePrice)
+			wasteGroup.Delete("/products/:id/overrides", bankOperator, controllers.RemoveProductWastePriceOverride)
+			wasteGroup.Get("/price-history", controllers.GetWastePriceHistory)
+		}
+
+		inventoryGroup := api.Group("/inventory")
+		{
+			inventoryGroup.Get("/stock", bankOperator, controllers.GetWasteStock)
+			inventoryGroup.Get("/movements", bankOperator, controllers.GetWasteStockMovements)
+			inventoryGroup.Post("/adjustments", bankOperator, controllers.CreateStockAdjustment)
+		}
+
+		transferGroup := api.Group("/transfers")
+		{
+			transferGroup.Get("/", bankOperator, wastetransfer.GetWasteTransfers)
+			transferGroup.Get("/:id", bankOperator, wastetransfer.GetWasteTransferByID)
+			transferGroup.Post("/", bankOperator, middleware.Idempotency, wastetransfer.CreateWasteTransfer)
+			transferGroup.Post("/:id/confirm", parentOperator, wastetransfer.ConfirmWasteTransfer)
+			transferGroup.Post("/:id/reject", parentOperator, wastetransfer.RejectWasteTransfer)
+			transferGroup.Post("/:id/cancel", bankOperator, wastetransfer.CancelWasteTransfer)
+		}
+
+		offtakerGroup := api.Group("/offtakers")
+		{
+			offtakerGroup.Get("/", parentOperator, wastesale.GetOfftakers)
+			offtakerGroup.Get("/:id", parentOperator, wastesale.GetOfftakerByID)
+			offtakerGroup.Post("/", parentOperator, wastesale.CreateOfftaker)
+			offtakerGroup.Put("/:id", parentOperator, wastesale.UpdateOfftaker)
+			offtakerGroup.Delete("/:id", parentOperator, wastesale.DeleteOfftaker)
+		}
+
+		saleGroup := api.Group("/sales")
+		{
+			saleGroup.Get("/", parentOperator, wastesale.GetWasteSales)
+			saleGroup.Get("/report", parentOperator, wastesale.GetWasteSaleReport)
+			saleGroup.Get("/:id", parentOperator, wastesale.GetWasteSaleByID)
+			saleGroup.Post("/", parentOperator, middleware.Idempotency, wastesale.CreateWasteSale)
+			saleGroup.Post("/:id/deliver", parentOperator, wastesale.DeliverWasteSale)
+			saleGroup.Post("/:id/cancel", parentOperator, wastesale.CancelWasteSale)
+			saleGroup.Post("/:id/payments", parentOperator, middleware.Idempotency, wastesale.CreateWasteSalePayment)
 		}
 
 		donationGroup := api.Group("/donations")
@@ -163,23 +250,33 @@ func SetupRoute(app *fiber.App) {
 			donationGroup.Get("/", controllers.GetDonationList)
 			donationGroup.Get("/all", controllers.GetDonationListAll)
 			donationGroup.Get("/:id", controllers.GetDonationByID)
-			donationGroup.Post("/", controllers.CreateDonation)
-			donationGroup.Put("/:id", controllers.UpdateDonation)
-			donationGroup.Delete("/:id", controllers.DeleteDonation)
-			donationGroup.Post("/:user_id/donate", donation.CreateDonation)                  // POST /donations/:user_id/donate
-			donationGroup.Get("/:user_id/history", donation.GetUserDonations)                // GET /donations/:user_id/history
-			donationGroup.Post("/:donation_id/complete/:user_id", donation.CompleteDonation) // POST /donations/:donation_id/complete/:user_id   // POST /donations/:id/complete
+			donationGroup.Post("/", admin, controllers.CreateDonation)
+			donationGroup.Put("/:id", admin, controllers.UpdateDonation)
+			donationGroup.Delete("/:id", admin, controllers.DeleteDonation)
+			donationGroup.Post("/:user_id/donate", middleware.Idempotency, donation.CreateDonation) // POST /donations/:user_id/donate
+			donationGroup.Get("/:user_id/history", donation.GetUserDonations)                       // GET /donations/:user_id/history
+			donationGroup.Post("/:donation_id/complete/:user_id", admin, donation.CompleteDonation) // POST /donations/:donation_id/complete/:user_id   // POST /donations/:id/complete
 		}
 
 		wasteDepositGroup := api.Group("/waste-deposits")
 		{
-			wasteDepositGroup.Get("/", wastedeposit.GetAllWasteDeposits)                                    // Get all waste deposits
-			wasteDepositGroup.Get("/:id", wastedeposit.GetWasteDepositByID)                                 // Get by ID
-			wasteDepositGroup.Get("/user/:user_id", wastedeposit.GetWasteDepositsByUser)                    // Get by user ID
-			wasteDepositGroup.Get("/childbank/:child_bank_id", wastedeposit.GetWasteDepositsByChildBank)    // Get by user ID
-			wasteDepositGroup.Get("/parentbank/:parent_bank_id", wastedeposit.GetWasteDepositsByParentBank) // Get by user ID
-			wasteDepositGroup.Post("/", wastedeposit.CreateWasteDeposit)                                    // Create new waste deposit
-			wasteDepositGroup.Delete("/:id", wastedeposit.DeleteWasteDeposit)                               // Delete waste deposit
+			wasteDepositGroup.Get("/", wastedeposit.ListWasteDeposits)                                                      // List + filter + totals, sesuai scope
+			wasteDepositGroup.Get("/report/region", bankOperator, wastedeposit.GetWasteDepositRegionReport)                 // Rekap per wilayah administrasi
+			wasteDepositGroup.Get("/:id", wastedeposit.GetWasteDepositByID)                                                 // Get by ID
+			wasteDepositGroup.Get("/user/:user_id", wastedeposit.GetWasteDepositsByUser)                                    // Get by user ID
+			wasteDepositGroup.Get("/childbank/:child_bank_id", bankOperator, wastedeposit.GetWasteDepositsByChildBank)      // Get by user ID
+			wasteDepositGroup.Get("/parentbank/:parent_bank_id", parentOperator, wastedeposit.GetWasteDepositsByParentBank) // Get by user ID
+			wasteDepositGroup.Post("/", bankOperator, middleware.Idempotency, wastedeposit.CreateWasteDeposit)              // Create new waste deposit
+			wasteDepositGroup.Put("/:id", bankOperator, wastedeposit.AmendWasteDeposit)                                     // Amend items, balance delta otomatis
+			wasteDepositGroup.Post("/:id/void", bankOperator, wastedeposit.VoidWasteDeposit)                                // Void dengan alasan
+			wasteDepositGroup.Delete("/:id", bankOperator, wastedeposit.VoidWasteDeposit)                                   // Alias void untuk client lama
+			wasteDepositGroup.Get("/:id/revisions", admin, wastedeposit.GetWasteDepositRevisions)                           // Riwayat revisi
+		}
+
+		ledger := api.Group("/ledger")
+		{
+			ledger.Get("/journals", admin, controllers.GetLedgerJournals)
+			ledger.Get("/accounts/:type/:id", admin, controllers.GetLedgerAccount)
 		}
 
 		requestPickup := api.Group("/pickup")
@@ -187,7 +284,18 @@ func SetupRoute(app *fiber.App) {
 			requestPickup.Post("/check-distance", pickuprequest.CheckNearbyBanks)
 			requestPickup.Post("/requests", pickuprequest.CreatePickupRequest)
 			requestPickup.Get("/list-requests", pickuprequest.GetPickupRequests)
-			requestPickup.Put("/requests/:id_request/:status", pickuprequest.UpdatePickupRequestStatus)
+			requestPickup.Put("/requests/:id/reschedule", pickuprequest.ReschedulePickupRequest)
+			requestPickup.Post("/requests/:id/cancel", pickuprequest.CancelPickupRequest)
+			requestPickup.Post("/requests/:id/assign", bankOperator, pickuprequest.AssignPickupCollector)
+			requestPickup.Post("/requests/:id/complete", middleware.Idempotency, pickuprequest.CompletePickupRequest)
+			requestPickup.Put("/requests/:id_request/:status", pickuprequest.UpdatePickupRequestStatus) // operator bank atau petugas yang ditunjuk
+			requestPickup.Post("/requests/:id/location", pickuprequest.UpdateCollectorLocation)         // petugas yang ditunjuk
+			requestPickup.Get("/requests/:id/stream", pickuprequest.StreamPickupRequest)                // SSE untuk user, petugas dan operator bank
+			requestPickup.Get("/route", pickuprequest.GetPickupRoute)                                   // operator bank atau petugas untuk rutenya sendiri
+			requestPickup.Get("/slots", pickuprequest.GetPickupSlots)
+			requestPickup.Post("/slots", bankOperator, pickuprequest.CreatePickupSlots)
+			requestPickup.Put("/slots/:id", bankOperator, pickuprequest.UpdatePickupSlot)
+			requestPickup.Delete("/slots/:id", bankOperator, pickuprequest.DeletePickupSlot)
 		}
 	}
 }
@@ -0,0 +1,66 @@
+package seeders
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// SeedLedgerOpening mencatat saldo yang sudah ada sebelum ledger aktif sebagai jurnal saldo awal,
+// supaya saldo bisa dihitung ulang dari jurnal. Akun yang sudah punya jurnal dilewati.
+func SeedLedgerOpening() error {
+	type account struct {
+		Id      uint
+		Balance int
+	}
+
+	sources := []struct {
+		accountType string
+		table       string
+		column      string
+	}{
+		{models.AccountUserWallet, "users", "balance"},
+		{models.AccountChildBankFloat, "child_banks", "balance"},
+		{models.AccountCompanyRevenue, "companies", "balance"},
+		{models.AccountDonationEscrow, "donations", "current_amount"},
+	}
+
+	return configs.DB.Transaction(func(tx *gorm.DB) error {
+		ledger := helpers.NewLedgerService(tx)
+		opened := 0
+
+		for _, source := range sources {
+			var accounts []account
+			if err := tx.Table(source.table).
+				Select("id, " + source.column + " AS balance").
+				Where(source.column + " <> 0 AND deleted_at IS NULL").
+				Scan(&accounts).Error; err != nil {
+				return err
+			}
+
+			for _, acc := range accounts {
+				var count int64
+				tx.Model(&models.LedgerEntry{}).
+					Where("account_type = ? AND account_id = ?", source.accountType, acc.Id).
+					Count(&count)
+				if count > 0 {
+					continue
+				}
+
+				if err := ledger.PostOpening(source.accountType, acc.Id, acc.Balance); err != nil {
+					log.Printf("❌ Error opening ledger for %s #%d: %v", source.accountType, acc.Id, err)
+					return err
+				}
+				opened++
+			}
+		}
+
+		if opened > 0 {
+			log.Printf("✅ Ledger opening balances recorded for %d accounts", opened)
+		}
+		return nil
+	})
+}
@@ -24,5 +24,8 @@ func SeedAll() error {
 	if err := SeedCompany(); err != nil {
 		return err
 	}
+	if err := SeedLedgerOpening(); err != nil {
+		return err
+	}
 	return nil
 }
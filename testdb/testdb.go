@@ -0,0 +1,61 @@
+// Package testdb menyiapkan database SQLite in-memory untuk unit test, supaya model asli (yang
+// ditulis untuk MySQL) bisa dimigrasikan tanpa server database.
+package testdb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open membuat database in-memory khusus test ini dan memigrasikan tables. Koneksi ditutup otomatis
+// saat test selesai.
+func Open(t testing.TB, tables ...any) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sqlite handle: %v", err)
+	}
+	// Satu koneksi supaya transaksi tidak saling mengunci di SQLite
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		sqlDB.Close()
+	})
+
+	if err := compatibleSchema(db, tables...); err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// compatibleSchema mengganti kolom enum MySQL menjadi text di schema yang di-cache GORM,
+// sehingga AutoMigrate model asli bisa jalan di SQLite
+func compatibleSchema(db *gorm.DB, tables ...any) error {
+	for _, table := range tables {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(table); err != nil {
+			return err
+		}
+		for _, field := range stmt.Schema.Fields {
+			if strings.HasPrefix(strings.ToLower(string(field.DataType)), "enum") {
+				field.DataType = "text"
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package workers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentExpirer - menutup pembayaran top up yang melewati expires_at tanpa webhook lunas. Grace
+// memberi waktu webhook yang terlambat; pembayaran yang lunas setelah ditutup tetap dikreditkan.
+type PaymentExpirer struct {
+	Interval  time.Duration
+	Grace     time.Duration
+	BatchSize int
+}
+
+// NewPaymentExpirerFromEnv membaca PAYMENT_EXPIRY_INTERVAL (default 1m, 0 untuk mematikan)
+// dan PAYMENT_EXPIRY_GRACE (default 5m)
+func NewPaymentExpirerFromEnv() *PaymentExpirer {
+	return &PaymentExpirer{
+		Interval:  durationEnv("PAYMENT_EXPIRY_INTERVAL", time.Minute),
+		Grace:     durationEnv("PAYMENT_EXPIRY_GRACE", 5*time.Minute),
+		BatchSize: 100,
+	}
+}
+
+// Start menjalankan expirer di goroutine sampai ctx selesai
+func (e *PaymentExpirer) Start(ctx context.Context) {
+	if e.Interval <= 0 {
+		log.Println("Payment expirer disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(e.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				expired, err := e.RunOnce(ctx)
+				if err != nil {
+					log.Println("Payment expirer error:", err)
+					continue
+				}
+				if expired > 0 {
+					log.Printf("Payment expirer: expired %d payments\n", expired)
+				}
+			}
+		}
+	}()
+}
+
+// RunOnce menutup pembayaran pending yang kedaluwarsa, mengembalikan jumlah yang ditutup
+func (e *PaymentExpirer) RunOnce(ctx context.Context) (int, error) {
+	var payments []models.Payment
+	err := configs.DB.
+		Where("status = ? AND expires_at < ?", models.PaymentStatusPending, time.Now().Add(-e.Grace)).
+		Order("expires_at ASC").
+		Limit(e.BatchSize).
+		Find(&payments).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, payment := range payments {
+		if ctx.Err() != nil {
+			break
+		}
+		err := configs.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := helpers.SettlePayment(tx, payment.OrderID, helpers.PaymentOutcome{
+				Status: models.PaymentStatusExpired,
+				Reason: "payment window expired",
+			})
+			return err
+		})
+		if err != nil {
+			// Webhook lunas bisa masuk bersamaan, tidak perlu dicatat sebagai error
+			if !errors.Is(err, helpers.ErrPaymentAlreadySettled) {
+				log.Printf("Payment expirer: expire %s: %v\n", payment.OrderID, err)
+			}
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
@@ -0,0 +1,309 @@
+package workers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"backend-mulungs/ppob"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var errEmptyPricelist = errors.New("provider returned an empty pricelist")
+
+// Sinkronisasi terjadwal dan manual tidak boleh berjalan bersamaan
+var catalogSyncMu sync.Mutex
+
+// PpobCatalogSyncer - menyalin pricelist prabayar dan pascabayar provider ke tabel ppob_products
+// dan mencatat perubahan harga/status dibanding sinkronisasi sebelumnya.
+type PpobCatalogSyncer struct {
+	Provider ppob.Provider
+	Interval time.Duration
+}
+
+// NewPpobCatalogSyncerFromEnv membaca PPOB_CATALOG_SYNC_INTERVAL (default 1h, 0 untuk mematikan)
+func NewPpobCatalogSyncerFromEnv() *PpobCatalogSyncer {
+	return &PpobCatalogSyncer{
+		Provider: ppob.Default(),
+		Interval: durationEnv("PPOB_CATALOG_SYNC_INTERVAL", time.Hour),
+	}
+}
+
+// Start sinkronisasi sekali saat start lalu setiap Interval sampai ctx selesai
+func (s *PpobCatalogSyncer) Start(ctx context.Context) {
+	if s.Interval <= 0 {
+		log.Println("PPOB catalog sync disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			s.logRun(s.SyncAll(ctx, models.CatalogSyncTriggerSchedule, nil))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *PpobCatalogSyncer) logRun(syncs []models.PpobCatalogSync, err error) {
+	if err != nil {
+		log.Println("PPOB catalog sync error:", err)
+	}
+	for _, run := range syncs {
+		if run.Status != models.CatalogSyncSuccess {
+			continue
+		}
+		log.Printf("PPOB catalog sync %s: %d products, added %d, removed %d, price changed %d, status changed %d\n",
+			run.Kind, run.Total, run.Added, run.Removed, run.PriceChanged, run.StatusChanged)
+	}
+}
+
+// SyncAll menyinkronkan katalog prabayar lalu pascabayar. Error pertama dikembalikan,
+// tapi kedua katalog tetap dicoba.
+func (s *PpobCatalogSyncer) SyncAll(ctx context.Context, trigger string, triggeredBy *uint) ([]models.PpobCatalogSync, error) {
+	var syncs []models.PpobCatalogSync
+	var firstErr error
+
+	for _, kind := range []string{models.PpobKindPrepaid, models.PpobKindPostpaid} {
+		run, err := s.Sync(ctx, kind, trigger, triggeredBy)
+		if run != nil {
+			syncs = append(syncs, *run)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return syncs, firstErr
+}
+
+// Sync menyinkronkan satu jenis katalog. Hasil (termasuk yang gagal) selalu dicatat di ppob_catalog_syncs.
+func (s *PpobCatalogSyncer) Sync(ctx context.Context, kind, trigger string, triggeredBy *uint) (*models.PpobCatalogSync, error) {
+	catalogSyncMu.Lock()
+	defer catalogSyncMu.Unlock()
+
+	run := models.PpobCatalogSync{
+		Kind:        kind,
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		Status:      models.CatalogSyncRunning,
+	}
+	if err := configs.DB.Create(&run).Error; err != nil {
+		return nil, err
+	}
+
+	products, err := s.fetch(ctx, kind)
+	if err == nil {
+		err = configs.DB.Transaction(func(tx *gorm.DB) error {
+			return applyCatalog(tx, &run, kind, products)
+		})
+	}
+
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = models.CatalogSyncSuccess
+	if err != nil {
+		run.Status = models.CatalogSyncFailed
+		run.Error = err.Error()
+		run.Changes = nil
+	}
+	configs.DB.Omit("Changes").Save(&run)
+
+	return &run, err
+}
+
+// fetch mengambil pricelist provider dalam bentuk PpobProduct
+func (s *PpobCatalogSyncer) fetch(ctx context.Context, kind string) ([]models.PpobProduct, error) {
+	var products []models.PpobProduct
+
+	switch kind {
+	case models.PpobKindPrepaid:
+		pricelist, err := s.Provider.Pricelist(ctx, "", "")
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range pricelist {
+			status := models.PpobProductActive
+			if !strings.EqualFold(item.Status, models.PpobProductActive) {
+				status = models.PpobProductInactive
+			}
+			products = append(products, models.PpobProduct{
+				Kind:               kind,
+				ProductCode:        item.ProductCode,
+				ProductDescription: item.ProductDescription,
+				ProductNominal:     item.ProductNominal,
+				ProductDetails:     item.ProductDetails,
+				ProductType:        strings.ToLower(item.ProductType),
+				ProductCategory:    strings.ToLower(item.ProductCategory),
+				Operator:           helpers.PpobOperatorKey(item.ProductDescription),
+				ActivePeriod:       item.ActivePeriod,
+				IconURL:            item.IconURL,
+				Price:              item.ProductPrice,
+				Status:             status,
+			})
+		}
+	case models.PpobKindPostpaid:
+		pasca, err := s.Provider.PostpaidPricelist(ctx, "", "")
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range pasca {
+			code := mapString(item, "code")
+			if code == "" {
+				continue
+			}
+			status := models.PpobProductActive
+			if mapFloat(item, "status") != 1 {
+				status = models.PpobProductInactive
+			}
+			products = append(products, models.PpobProduct{
+				Kind:               kind,
+				ProductCode:        code,
+				ProductDescription: mapString(item, "name"),
+				ProductType:        strings.ToLower(mapString(item, "type")),
+				Province:           mapString(item, "province"),
+				Price:              mapFloat(item, "fee"),
+				Commission:         mapFloat(item, "komisi"),
+				Status:             status,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown catalog kind %q", kind)
+	}
+
+	// Pricelist kosong hampir pasti gangguan provider, jangan nonaktifkan seluruh katalog
+	if len(products) == 0 {
+		return nil, errEmptyPricelist
+	}
+	return products, nil
+}
+
+// applyCatalog menyimpan hasil fetch dan mencatat diff terhadap isi katalog sebelumnya
+func applyCatalog(tx *gorm.DB, run *models.PpobCatalogSync, kind string, fetched []models.PpobProduct) error {
+	var existing []models.PpobProduct
+	if err := tx.Where("kind = ?", kind).Find(&existing).Error; err != nil {
+		return err
+	}
+	byCode := make(map[string]models.PpobProduct, len(existing))
+	for _, product := range existing {
+		byCode[product.ProductCode] = product
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(fetched))
+	var changes []models.PpobCatalogChange
+
+	for _, product := range fetched {
+		if seen[product.ProductCode] {
+			continue
+		}
+		seen[product.ProductCode] = true
+		run.Total++
+
+		product.LastSyncID = run.Id
+		product.LastSyncedAt = now
+
+		old, ok := byCode[product.ProductCode]
+		if !ok || old.RemovedAt != nil {
+			run.Added++
+			changes = append(changes, catalogChange(run.Id, product, models.CatalogChangeAdded, old))
+		} else {
+			if old.Price != product.Price {
+				run.PriceChanged++
+				changes = append(changes, catalogChange(run.Id, product, models.CatalogChangePriceChanged, old))
+			}
+			if old.Status != product.Status {
+				run.StatusChanged++
+				changes = append(changes, catalogChange(run.Id, product, models.CatalogChangeStatusChanged, old))
+			}
+		}
+
+		if ok {
+			product.Id = old.Id
+			product.CreatedAt = old.CreatedAt
+		}
+		product.RemovedAt = nil
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+	}
+
+	// Produk yang hilang dari pricelist dinonaktifkan, bukan dihapus, supaya riwayat tetap terbaca
+	for _, old := range existing {
+		if seen[old.ProductCode] || old.RemovedAt != nil {
+			continue
+		}
+		run.Removed++
+		removed := old
+		removed.Status = models.PpobProductInactive
+		changes = append(changes, catalogChange(run.Id, removed, models.CatalogChangeRemoved, old))
+
+		err := tx.Model(&models.PpobProduct{}).Where("id = ?", old.Id).Updates(map[string]any{
+			"status":       models.PpobProductInactive,
+			"removed_at":   now,
+			"last_sync_id": run.Id,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(changes) > 0 {
+		if err := tx.CreateInBatches(&changes, 200).Error; err != nil {
+			return err
+		}
+	}
+	run.Changes = changes
+	return nil
+}
+
+func catalogChange(syncID uint, product models.PpobProduct, change string, old models.PpobProduct) models.PpobCatalogChange {
+	return models.PpobCatalogChange{
+		SyncID:             syncID,
+		ProductCode:        product.ProductCode,
+		ProductDescription: product.ProductDescription,
+		Change:             change,
+		OldPrice:           old.Price,
+		NewPrice:           product.Price,
+		OldStatus:          old.Status,
+		NewStatus:          product.Status,
+	}
+}
+
+func mapString(item map[string]any, key string) string {
+	switch value := item[key].(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func mapFloat(item map[string]any, key string) float64 {
+	switch value := item[key].(type) {
+	case float64:
+		return value
+	case int:
+		return float64(value)
+	case string:
+		var parsed float64
+		fmt.Sscan(value, &parsed)
+		return parsed
+	}
+	return 0
+}
@@ -0,0 +1,223 @@
+// Package workers berisi proses background yang dijalankan dari main.go
+package workers
+
+import (
+	"backend-mulungs/configs"
+	"backend-mulungs/helpers"
+	"backend-mulungs/models"
+	"backend-mulungs/ppob"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// PpobReconciler - menyelesaikan transaksi prabayar yang tidak pernah mendapat callback
+// dengan menanyakan status ke provider, lalu settle lewat helpers.SettlePrepaid seperti callback.
+// Pembayaran tagihan pascabayar yang hasilnya tidak diketahui dikirim ulang dengan tr_id yang sama.
+type PpobReconciler struct {
+	Provider   ppob.Provider
+	Interval   time.Duration
+	StaleAfter time.Duration
+	// NotFoundAfter - transaksi yang masih "tidak ditemukan" di provider setelah umur ini dianggap
+	// tidak pernah terkirim, lalu digagalkan dan saldo dikembalikan
+	NotFoundAfter time.Duration
+	BatchSize     int
+}
+
+// ReconcileResult - ringkasan satu kali jalan
+type ReconcileResult struct {
+	Checked int `json:"checked"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Pending int `json:"pending"`
+	Errors  int `json:"errors"`
+}
+
+// NewPpobReconcilerFromEnv membaca PPOB_RECONCILE_INTERVAL (default 5m, 0 untuk mematikan),
+// PPOB_RECONCILE_STALE_AFTER (default 10m) dan PPOB_RECONCILE_NOT_FOUND_AFTER (default 1h)
+func NewPpobReconcilerFromEnv() *PpobReconciler {
+	return &PpobReconciler{
+		Provider:      ppob.Default(),
+		Interval:      durationEnv("PPOB_RECONCILE_INTERVAL", 5*time.Minute),
+		StaleAfter:    durationEnv("PPOB_RECONCILE_STALE_AFTER", 10*time.Minute),
+		NotFoundAfter: durationEnv("PPOB_RECONCILE_NOT_FOUND_AFTER", time.Hour),
+		BatchSize:     50,
+	}
+}
+
+// Start menjalankan reconciler di goroutine sampai ctx selesai
+func (r *PpobReconciler) Start(ctx context.Context) {
+	if r.Interval <= 0 {
+		log.Println("PPOB reconciler disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := r.RunOnce(ctx)
+				if err != nil {
+					log.Println("PPOB reconciler error:", err)
+					continue
+				}
+				if result.Checked > 0 {
+					log.Printf("PPOB reconciler: checked %d, success %d, failed %d, pending %d, errors %d\n",
+						result.Checked, result.Success, result.Failed, result.Pending, result.Errors)
+				}
+			}
+		}
+	}()
+}
+
+// RunOnce mengecek transaksi PROSES yang lebih lama dari StaleAfter
+func (r *PpobReconciler) RunOnce(ctx context.Context) (ReconcileResult, error) {
+	var result ReconcileResult
+
+	var histories []models.HistoryModel
+	err := configs.DB.
+		Where("status = ? AND created_at < ?", models.HistoryStatusPending, time.Now().Add(-r.StaleAfter)).
+		Order("created_at ASC").
+		Limit(r.BatchSize).
+		Find(&histories).Error
+	if err != nil {
+		return result, err
+	}
+
+	for _, history := range histories {
+		if ctx.Err() != nil {
+			break
+		}
+		result.Checked++
+
+		status, err := r.status(ctx, history)
+		if err != nil {
+			result.Errors++
+			log.Printf("PPOB reconciler: check status %s: %v\n", history.RefID, err)
+			continue
+		}
+
+		if status.Status == ppob.StatusPending {
+			result.Pending++
+			continue
+		}
+
+		if err := r.settle(history, status); err != nil {
+			result.Errors++
+			log.Printf("PPOB reconciler: settle %s: %v\n", history.RefID, err)
+			continue
+		}
+
+		if status.Status == ppob.StatusSuccess {
+			result.Success++
+		} else {
+			result.Failed++
+		}
+	}
+
+	return result, nil
+}
+
+func (r *PpobReconciler) settle(history models.HistoryModel, status *ppob.StatusResult) error {
+	auditLog := models.PpobCallbackLog{
+		Source:    models.CallbackSourceReconciler,
+		RefID:     history.RefID,
+		Status:    status.Status,
+		RC:        status.RC,
+		Message:   status.Message,
+		SignValid: true,
+		Result:    models.CallbackResultProcessed,
+	}
+	defer func() {
+		configs.DB.Create(&auditLog)
+	}()
+
+	tx := configs.DB.Begin()
+	_, err := helpers.SettlePrepaid(tx, history.RefID, helpers.PrepaidOutcome{
+		Success:     status.Status == ppob.StatusSuccess,
+		Price:       status.Price,
+		SN:          status.SN,
+		ProductCode: status.ProductCode,
+		Message:     status.Message,
+	})
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, helpers.ErrPpobAlreadySettled) {
+			// Callback datang lebih dulu
+			auditLog.Result = models.CallbackResultDuplicate
+			return nil
+		}
+		auditLog.Result = models.CallbackResultError
+		auditLog.Error = err.Error()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		auditLog.Result = models.CallbackResultError
+		auditLog.Error = err.Error()
+		return err
+	}
+	return nil
+}
+
+// status - status transaksi di provider: cek status untuk prabayar, kirim ulang pembayaran untuk pascabayar
+func (r *PpobReconciler) status(ctx context.Context, history models.HistoryModel) (*ppob.StatusResult, error) {
+	if history.Kind == models.PpobKindPostpaid {
+		return r.postpaidStatus(ctx, history)
+	}
+
+	status, err := r.Provider.CheckStatus(ctx, history.RefID)
+	if err != nil && ppob.IsTransactionNotFound(err) && r.NotFoundAfter > 0 && time.Since(history.CreatedAt) > r.NotFoundAfter {
+		// Provider tidak pernah menerima transaksi ini (misal request hilang sebelum sampai),
+		// tanpa ini transaksi PROSES dicek ulang selamanya dan saldo user tertahan
+		return notFoundStatus(history.RefID, err), nil
+	}
+	return status, err
+}
+
+// postpaidStatus mengirim ulang pembayaran tagihan. Provider menolak pembayaran ganda untuk tr_id yang
+// sama, sehingga tagihan yang sudah lunas tidak terbayar dua kali. Harga provider diambil dari inquiry.
+func (r *PpobReconciler) postpaidStatus(ctx context.Context, history models.HistoryModel) (*ppob.StatusResult, error) {
+	var inquiry models.PpobInquiry
+	if err := configs.DB.Where("tr_id = ?", history.RefID).First(&inquiry).Error; err != nil {
+		return nil, err
+	}
+
+	paid, err := r.Provider.PostpaidPayment(ctx, history.RefID)
+	status, err := ppob.PostpaidPaymentStatus(history.RefID, paid, err)
+	if err != nil {
+		return nil, err
+	}
+	status.ProductCode = inquiry.Code
+	status.Price = inquiry.BasePrice
+	return status, nil
+}
+
+// notFoundStatus - hasil gagal untuk transaksi yang tidak dikenal provider
+func notFoundStatus(refID string, err error) *ppob.StatusResult {
+	status := &ppob.StatusResult{RefID: refID, Status: ppob.StatusFailed, RC: ppob.RCTransactionNotFound, Message: "TRANSACTION NOT FOUND"}
+	var providerErr *ppob.ProviderError
+	if errors.As(err, &providerErr) && providerErr.Message != "" {
+		status.Message = providerErr.Message
+	}
+	return status
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return d
+}